@@ -0,0 +1,672 @@
+// Package admin provides an optional web UI for inspecting and editing a
+// Datastore. It lists Collections, pages through their Documents, filters them
+// by field, and edits or deletes individual Documents.
+//
+// The UI is a single http.Handler with its templates embedded, so it can be
+// mounted on any mux:
+//
+//	http.Handle("/admin/", http.StripPrefix("/admin", admin.Handler(ds)))
+//
+// GET /healthz reports Datastore.Health as JSON, and responds with 503 if the
+// Datastore is closed or its last Flush failed.
+//
+// For backups, GET /export downloads the whole Datastore in the format Flush
+// writes (see Datastore.WriteTo), and GET /c/{collection}/export downloads one
+// Collection (see Collection.WriteTo). POST /c/{collection}/import restores a
+// Collection from such a download, sent as the request body or as the file
+// field of a form; it is rejected unless it was written by a Datastore with
+// the same signature (see Collection.ReadFrom).
+//
+// Documents are shown the way Collection.ExportJSON writes them, so fields that
+// are marked as sensitive (see datastore.Redacted) are never displayed. Saving
+// a Document leaves those fields unchanged.
+//
+// Forms that change the Datastore are rejected if a browser reports that they
+// were submitted from another origin, by its Sec-Fetch-Site or Origin header.
+// Their
+// size, and how often they are accepted, can be limited with Options. Unless
+// Options.Authorizer is set the handler does no authentication, so do not
+// expose it to untrusted networks without one.
+package admin
+
+import (
+	"context"
+	"embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"git.stormbase.io/cbednarski/datastore"
+)
+
+// PageSize is the number of Documents shown on each page of a Collection.
+const PageSize = 50
+
+//go:embed templates/*.html templates/*.css
+var assets embed.FS
+
+var templates = template.Must(template.New("").Funcs(template.FuncMap{
+	"add": func(a, b int) int { return a + b },
+}).ParseFS(assets, "templates/*.html"))
+
+// DefaultMaxBodySize is the largest form accepted when Options.MaxBodySize is
+// zero, and DefaultMaxUploadSize is the largest import accepted when
+// Options.MaxUploadSize is zero.
+const (
+	DefaultMaxBodySize   = 1 << 20
+	DefaultMaxUploadSize = 64 << 20
+)
+
+// Options configures the handler returned by NewHandler. The zero value gives
+// the same handler as Handler.
+type Options struct {
+	// MaxBodySize is the largest request body, in bytes, accepted by a form
+	// that changes the Datastore. Larger forms are rejected with 413 Request
+	// Entity Too Large. Zero means DefaultMaxBodySize. MaxUploadSize is the
+	// same for imports, and zero means DefaultMaxUploadSize.
+	MaxBodySize   int64
+	MaxUploadSize int64
+
+	// RateLimit is the most forms per second that may change the Datastore,
+	// and Burst is how many may be accepted at once after a quiet period.
+	// Other forms are rejected with 429 Too Many Requests. The limit is shared
+	// by every client. Zero means no limit; Burst defaults to one.
+	RateLimit float64
+	Burst     int
+
+	// Authorizer, if set, decides who may use the handler and which
+	// Collections they may read and change. /healthz and /style.css are
+	// served to everyone.
+	Authorizer Authorizer
+}
+
+// Access is the kind of access a request needs to a Collection.
+type Access int
+
+const (
+	// Read is needed to list a Collection and view its Documents.
+	Read Access = iota
+
+	// Write is needed to edit or delete a Document.
+	Write
+)
+
+// An Authorizer checks the credentials of each request, and what the caller
+// may do. See Options.
+type Authorizer interface {
+	// Authenticate checks the bearer token from the request's Authorization
+	// header, which is empty if there is none, and returns the identity it
+	// belongs to. Requests it returns an error for are rejected with 401
+	// Unauthorized.
+	Authenticate(token string) (identity string, err error)
+
+	// Allow reports whether identity has access to the named Collection.
+	// Requests it refuses are rejected with 403 Forbidden, and Collections
+	// that identity can not Read are left out of the list of Collections.
+	Allow(identity, collection string, access Access) bool
+}
+
+// identityKey is the context key for the identity returned by Authenticate.
+type identityKey struct{}
+
+type handler struct {
+	ds      *datastore.Datastore
+	options Options
+	limiter *limiter
+}
+
+// Handler returns an http.Handler that serves the admin UI for ds. Changes made
+// through the UI mark the Datastore dirty in the usual way; they are not
+// written to disk until Flush is called.
+func Handler(ds *datastore.Datastore) http.Handler {
+	return NewHandler(ds, Options{})
+}
+
+// NewHandler is like Handler, but configured by options.
+func NewHandler(ds *datastore.Datastore, options Options) http.Handler {
+	if options.MaxBodySize <= 0 {
+		options.MaxBodySize = DefaultMaxBodySize
+	}
+	if options.MaxUploadSize <= 0 {
+		options.MaxUploadSize = DefaultMaxUploadSize
+	}
+	h := &handler{ds: ds, options: options}
+	if options.RateLimit > 0 {
+		h.limiter = newLimiter(options.RateLimit, options.Burst)
+	}
+	return h
+}
+
+func (h *handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	type route struct {
+		get, post http.HandlerFunc
+		public    bool
+		upload    bool
+	}
+
+	var found route
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/"), "/")
+	switch {
+	case r.URL.Path == "/":
+		found = route{get: h.collections}
+	case r.URL.Path == "/style.css":
+		found = route{get: h.style, public: true}
+	case r.URL.Path == "/healthz":
+		found = route{get: h.healthz, public: true}
+	case r.URL.Path == "/export":
+		found = route{get: h.exportDatastore}
+	case parts[0] == "c" && len(parts) == 3 && parts[2] == "export":
+		found = route{get: h.exportCollection}
+	case parts[0] == "c" && len(parts) == 3 && parts[2] == "import":
+		found = route{post: h.importCollection, upload: true}
+	case parts[0] == "c" && len(parts) == 2:
+		found = route{get: h.documents}
+	case parts[0] == "c" && len(parts) == 3:
+		found = route{get: h.document, post: h.edit}
+	case parts[0] == "c" && len(parts) == 4 && parts[3] == "delete":
+		found = route{get: h.confirmDelete, post: h.delete}
+	default:
+		http.NotFound(w, r)
+		return
+	}
+	if len(parts) > 1 {
+		r.SetPathValue("collection", parts[1])
+	}
+	if len(parts) > 2 {
+		r.SetPathValue("key", parts[2])
+	}
+
+	if authorizer := h.options.Authorizer; authorizer != nil && !found.public {
+		token, _ := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		identity, err := authorizer.Authenticate(token)
+		if err != nil {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+			return
+		}
+		access := Read
+		if r.Method == http.MethodPost {
+			access = Write
+		}
+		if len(parts) > 1 && !authorizer.Allow(identity, parts[1], access) {
+			http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+			return
+		}
+		r = r.WithContext(context.WithValue(r.Context(), identityKey{}, identity))
+	}
+
+	switch {
+	case r.Method == http.MethodGet && found.get != nil:
+		found.get(w, r)
+	case r.Method == http.MethodPost && found.post != nil:
+		if !sameOrigin(r) {
+			http.Error(w, "cross-origin request rejected", http.StatusForbidden)
+			return
+		}
+		if h.limiter != nil && !h.limiter.allow(time.Now()) {
+			http.Error(w, http.StatusText(http.StatusTooManyRequests), http.StatusTooManyRequests)
+			return
+		}
+		limit := h.options.MaxBodySize
+		if found.upload {
+			limit = h.options.MaxUploadSize
+		}
+		r.Body = http.MaxBytesReader(w, r.Body, limit)
+		if err := r.ParseForm(); err != nil {
+			http.Error(w, err.Error(), uploadStatus(err))
+			return
+		}
+		found.post(w, r)
+	default:
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+	}
+}
+
+type collectionSummary struct {
+	Name  string
+	Type  string
+	Count int
+}
+
+func (h *handler) collections(w http.ResponseWriter, r *http.Request) {
+	summaries := []collectionSummary{}
+	for _, name := range h.ds.CollectionNames() {
+		if !h.allowed(r, name, Read) {
+			continue
+		}
+		c := h.ds.In(name)
+		summary := collectionSummary{Name: name, Count: len(c.List())}
+		if first := c.FindOne(func(datastore.Document) bool { return true }); first != nil {
+			summary.Type = fmt.Sprintf("%T", first)
+		}
+		summaries = append(summaries, summary)
+	}
+
+	h.render(w, r, "collections.html", map[string]interface{}{
+		"Title":       "Collections",
+		"Path":        h.ds.Path(),
+		"Collections": summaries,
+	})
+}
+
+func (h *handler) documents(w http.ResponseWriter, r *http.Request) {
+	c, ok := h.collection(w, r)
+	if !ok {
+		return
+	}
+
+	field, value := r.URL.Query().Get("field"), r.URL.Query().Get("value")
+	matched := c.FindAll(func(document datastore.Document) bool {
+		if field == "" {
+			return true
+		}
+		v, ok := fieldValues(c, document)[field]
+		return ok && v == value
+	})
+
+	page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+	pages := (len(matched) + PageSize - 1) / PageSize
+	if page < 1 {
+		page = 1
+	}
+	if page > pages && pages > 0 {
+		page = pages
+	}
+	start := (page - 1) * PageSize
+	end := start + PageSize
+	if end > len(matched) {
+		end = len(matched)
+	}
+
+	var columns []string
+	rows := [][]string{}
+	keys := []uint64{}
+	for _, document := range matched[start:end] {
+		if columns == nil {
+			columns = fieldNames(document)
+		}
+		values := fieldValues(c, document)
+		row := make([]string, len(columns))
+		for i, name := range columns {
+			row[i] = values[name]
+		}
+		rows = append(rows, row)
+		keys = append(keys, document.ID())
+	}
+
+	h.render(w, r, "documents.html", map[string]interface{}{
+		"Title":      r.PathValue("collection"),
+		"Collection": r.PathValue("collection"),
+		"Columns":    columns,
+		"Rows":       rows,
+		"Keys":       keys,
+		"Field":      field,
+		"Value":      value,
+		"Matched":    len(matched),
+		"Page":       page,
+		"Pages":      pages,
+	})
+}
+
+func (h *handler) document(w http.ResponseWriter, r *http.Request) {
+	c, document, ok := h.find(w, r)
+	if !ok {
+		return
+	}
+	h.renderDocument(w, r, c, document, "", http.StatusOK)
+}
+
+func (h *handler) renderDocument(w http.ResponseWriter, r *http.Request, c *datastore.Collection, document datastore.Document, problem string, status int) {
+	encoded, err := json.MarshalIndent(c.Redact(document), "", "  ")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(status)
+	h.render(w, r, "document.html", map[string]interface{}{
+		"Title":      r.PathValue("collection") + " " + r.PathValue("key"),
+		"Collection": r.PathValue("collection"),
+		"Key":        document.ID(),
+		"Type":       fmt.Sprintf("%T", document),
+		"JSON":       string(encoded),
+		"Error":      problem,
+	})
+}
+
+// edit applies the submitted JSON to the Document as a merge patch, so fields
+// left out of the form keep their current values. So do fields that are still
+// Redacted, as they were when the form was shown.
+func (h *handler) edit(w http.ResponseWriter, r *http.Request) {
+	c, document, ok := h.find(w, r)
+	if !ok {
+		return
+	}
+
+	if err := c.PatchJSON(document.ID(), unredact([]byte(r.FormValue("document")))); err != nil {
+		h.renderDocument(w, r, c, document, err.Error(), http.StatusBadRequest)
+		return
+	}
+	redirect(w, r.PathValue("key"))
+}
+
+func (h *handler) confirmDelete(w http.ResponseWriter, r *http.Request) {
+	_, document, ok := h.find(w, r)
+	if !ok {
+		return
+	}
+
+	h.render(w, r, "delete.html", map[string]interface{}{
+		"Title":      "Delete " + r.PathValue("collection") + " " + r.PathValue("key"),
+		"Collection": r.PathValue("collection"),
+		"Key":        document.ID(),
+		"Type":       fmt.Sprintf("%T", document),
+	})
+}
+
+func (h *handler) delete(w http.ResponseWriter, r *http.Request) {
+	c, document, ok := h.find(w, r)
+	if !ok {
+		return
+	}
+
+	if err := c.DeleteKey(document.ID()); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	redirect(w, "../../"+url.PathEscape(r.PathValue("collection")))
+}
+
+// exportDatastore downloads the whole Datastore. With an Authorizer, the caller
+// must be able to Read every Collection.
+func (h *handler) exportDatastore(w http.ResponseWriter, r *http.Request) {
+	for _, name := range h.ds.CollectionNames() {
+		if !h.allowed(r, name, Read) {
+			http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+			return
+		}
+	}
+
+	filename := "datastore" + datastore.Extension
+	if path := h.ds.Path(); path != "" {
+		filename = filepath.Base(path)
+	}
+	download(w, filename)
+	if _, err := h.ds.WriteTo(w); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+func (h *handler) exportCollection(w http.ResponseWriter, r *http.Request) {
+	c, ok := h.collection(w, r)
+	if !ok {
+		return
+	}
+
+	download(w, r.PathValue("collection")+".collection")
+	if _, err := c.WriteTo(w); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// importCollection replaces the contents of a Collection, which is created if
+// it does not exist, with an upload written by Collection.WriteTo.
+func (h *handler) importCollection(w http.ResponseWriter, r *http.Request) {
+	body := io.Reader(r.Body)
+	if mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mediaType == "multipart/form-data" {
+		file, _, err := r.FormFile("file")
+		if err != nil {
+			http.Error(w, err.Error(), uploadStatus(err))
+			return
+		}
+		defer file.Close()
+		body = file
+	}
+
+	if _, err := h.ds.In(r.PathValue("collection")).ReadFrom(body); err != nil {
+		http.Error(w, err.Error(), uploadStatus(err))
+		return
+	}
+	redirect(w, "../"+url.PathEscape(r.PathValue("collection")))
+}
+
+// sameOrigin reports whether a browser submitted r from a page served by the
+// same host. Modern browsers send Sec-Fetch-Site; older ones only send Origin.
+// Requests with neither header did not come from a browser, so they are
+// allowed.
+func sameOrigin(r *http.Request) bool {
+	switch r.Header.Get("Sec-Fetch-Site") {
+	case "same-origin", "none":
+		return true
+	case "":
+	default:
+		return false
+	}
+
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	parsed, err := url.Parse(origin)
+	return err == nil && parsed.Host == r.Host
+}
+
+// uploadStatus is the response status for an upload that failed with err.
+func uploadStatus(err error) int {
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		return http.StatusRequestEntityTooLarge
+	}
+	return http.StatusBadRequest
+}
+
+// download sets the headers for a response saved as filename.
+func download(w http.ResponseWriter, filename string) {
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": filename}))
+	w.Header().Set("Cache-Control", "no-store")
+}
+
+// allowed reports whether the caller has access to the named Collection. It is
+// always true if there is no Authorizer.
+func (h *handler) allowed(r *http.Request, collection string, access Access) bool {
+	if h.options.Authorizer == nil {
+		return true
+	}
+	identity, _ := r.Context().Value(identityKey{}).(string)
+	return h.options.Authorizer.Allow(identity, collection, access)
+}
+
+// collection looks up the Collection named in the request. It does not use
+// In, so browsing to a misspelled name does not create an empty Collection.
+func (h *handler) collection(w http.ResponseWriter, r *http.Request) (*datastore.Collection, bool) {
+	name := r.PathValue("collection")
+	for _, existing := range h.ds.CollectionNames() {
+		if existing == name {
+			return h.ds.In(name), true
+		}
+	}
+	http.NotFound(w, r)
+	return nil, false
+}
+
+func (h *handler) find(w http.ResponseWriter, r *http.Request) (*datastore.Collection, datastore.Document, bool) {
+	c, ok := h.collection(w, r)
+	if !ok {
+		return nil, nil, false
+	}
+
+	key, err := strconv.ParseUint(r.PathValue("key"), 10, 64)
+	if err != nil {
+		http.NotFound(w, r)
+		return nil, nil, false
+	}
+	document := c.FindKey(key)
+	if document == nil {
+		http.NotFound(w, r)
+		return nil, nil, false
+	}
+	return c, document, true
+}
+
+func (h *handler) style(w http.ResponseWriter, r *http.Request) {
+	css, _ := assets.ReadFile("templates/style.css")
+	w.Header().Set("Content-Type", "text/css; charset=utf-8")
+	w.Write(css)
+}
+
+// healthStatus is the JSON body served at /healthz.
+type healthStatus struct {
+	Healthy        bool    `json:"healthy"`
+	Open           bool    `json:"open"`
+	LastFlush      string  `json:"last_flush,omitempty"`
+	LastFlushAge   float64 `json:"last_flush_age_seconds"`
+	PendingChanges int     `json:"pending_changes"`
+	UnflushedAge   float64 `json:"unflushed_age_seconds"`
+	LastError      string  `json:"last_error,omitempty"`
+}
+
+// healthz reports Datastore.Health as JSON for liveness and readiness probes.
+// It responds with 503 Service Unavailable if the Datastore is closed or its
+// last Flush failed.
+func (h *handler) healthz(w http.ResponseWriter, r *http.Request) {
+	health := h.ds.Health()
+	status := healthStatus{
+		Healthy:        health.Healthy(),
+		Open:           health.Open,
+		LastFlushAge:   health.LastFlushAge.Seconds(),
+		PendingChanges: health.PendingChanges,
+		UnflushedAge:   health.UnflushedAge.Seconds(),
+	}
+	if !health.LastFlush.IsZero() {
+		status.LastFlush = health.LastFlush.UTC().Format(time.RFC3339Nano)
+	}
+	if health.LastError != nil {
+		status.LastError = health.LastError.Error()
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	if !status.Healthy {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	json.NewEncoder(w).Encode(status)
+}
+
+// render executes the named template. Links in the templates are relative to
+// Root, so the handler works wherever it is mounted.
+func (h *handler) render(w http.ResponseWriter, r *http.Request, name string, data map[string]interface{}) {
+	data["Root"] = "./"
+	if depth := strings.Count(r.URL.Path, "/") - 1; depth > 0 {
+		data["Root"] = strings.Repeat("../", depth)
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := templates.ExecuteTemplate(w, name, data); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// redirect sends the browser to a location relative to the request. Unlike
+// http.Redirect it does not make the location absolute, because the request
+// path does not include any prefix stripped by the mux the handler is mounted
+// on.
+func redirect(w http.ResponseWriter, location string) {
+	w.Header().Set("Location", location)
+	w.WriteHeader(http.StatusSeeOther)
+}
+
+// fieldNames returns the names of the exported fields of a Document, which is
+// usually a pointer to a struct.
+func fieldNames(document datastore.Document) []string {
+	v := reflect.Indirect(reflect.ValueOf(document))
+	if v.Kind() != reflect.Struct {
+		return []string{"Value"}
+	}
+
+	names := []string{}
+	for i := 0; i < v.NumField(); i++ {
+		if v.Type().Field(i).IsExported() {
+			names = append(names, v.Type().Field(i).Name)
+		}
+	}
+	return names
+}
+
+// fieldValues formats the exported fields of a Document for display, by name.
+// Values are taken from Collection.Redact, so sensitive fields are Redacted.
+// Documents that are not structs have a single field called Value.
+func fieldValues(c *datastore.Collection, document datastore.Document) map[string]string {
+	v := reflect.Indirect(reflect.ValueOf(document))
+	if v.Kind() != reflect.Struct {
+		return map[string]string{"Value": fmt.Sprint(v.Interface())}
+	}
+
+	exported, _ := c.Redact(document).(map[string]interface{})
+	values := map[string]string{}
+	for i := 0; i < v.NumField(); i++ {
+		field := v.Type().Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		switch value := exported[jsonName(field)].(type) {
+		case nil:
+			values[field.Name] = ""
+		case string:
+			values[field.Name] = value
+		case map[string]interface{}, []interface{}:
+			encoded, _ := json.Marshal(value)
+			values[field.Name] = string(encoded)
+		default:
+			values[field.Name] = strings.TrimSpace(fmt.Sprint(value))
+		}
+	}
+	return values
+}
+
+// jsonName returns the name encoding/json uses for a struct field.
+func jsonName(field reflect.StructField) string {
+	if name, _, _ := strings.Cut(field.Tag.Get("json"), ","); name != "" {
+		return name
+	}
+	return field.Name
+}
+
+// unredact removes values that are still Redacted from a JSON merge patch, so
+// the fields they replaced are not changed. A patch that is not a JSON object
+// is returned as it is.
+func unredact(patch []byte) []byte {
+	var object map[string]interface{}
+	if err := json.Unmarshal(patch, &object); err != nil {
+		return patch
+	}
+	stripRedacted(object)
+	stripped, err := json.Marshal(object)
+	if err != nil {
+		return patch
+	}
+	return stripped
+}
+
+func stripRedacted(object map[string]interface{}) {
+	for name, value := range object {
+		switch value := value.(type) {
+		case string:
+			if value == datastore.Redacted {
+				delete(object, name)
+			}
+		case map[string]interface{}:
+			stripRedacted(value)
+		}
+	}
+}
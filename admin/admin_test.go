@@ -0,0 +1,500 @@
+package admin_test
+
+import (
+	"bytes"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"git.stormbase.io/cbednarski/datastore"
+	"git.stormbase.io/cbednarski/datastore/admin"
+)
+
+type Pet struct {
+	Identifier uint64
+	Name       string
+	Species    string
+}
+
+func (p *Pet) ID() uint64 {
+	return p.Identifier
+}
+
+func (p *Pet) SetID(id uint64) {
+	p.Identifier = id
+}
+
+func newServer(t *testing.T) (*datastore.Datastore, *httptest.Server) {
+	return newServerWith(t, admin.Options{})
+}
+
+func newServerWith(t *testing.T, options admin.Options) (*datastore.Datastore, *httptest.Server) {
+	ds, err := datastore.Create(filepath.Join(t.TempDir(), "admin"+datastore.Extension), "admintest.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 1; i <= admin.PageSize+10; i++ {
+		species := "cat"
+		if i%2 == 0 {
+			species = "dog"
+		}
+		if err := ds.In("pets").Upsert(&Pet{Name: fmt.Sprintf("pet-%d", i), Species: species}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/admin/", http.StripPrefix("/admin", admin.NewHandler(ds, options)))
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	return ds, server
+}
+
+func get(t *testing.T, url string) (int, string) {
+	t.Helper()
+	resp, err := http.Get(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp.StatusCode, string(body)
+}
+
+func TestHandler_Browse(t *testing.T) {
+	_, server := newServer(t)
+
+	status, body := get(t, server.URL+"/admin/")
+	if status != http.StatusOK {
+		t.Fatalf("Expected %d, found %d", http.StatusOK, status)
+	}
+	if !strings.Contains(body, `href="./c/pets"`) || !strings.Contains(body, "*admin_test.Pet") {
+		t.Errorf("Expected pets collection to be listed, found %s", body)
+	}
+
+	_, body = get(t, server.URL+"/admin/c/pets")
+	if strings.Count(body, "<tr><td>") != admin.PageSize {
+		t.Errorf("Expected %d rows on the first page, found %d", admin.PageSize, strings.Count(body, "<tr><td>"))
+	}
+	if !strings.Contains(body, "Page 1 of 2") {
+		t.Errorf("Expected pagination, found %s", body)
+	}
+
+	_, body = get(t, server.URL+"/admin/c/pets?page=2")
+	if strings.Count(body, "<tr><td>") != 10 {
+		t.Errorf("Expected 10 rows on the second page, found %d", strings.Count(body, "<tr><td>"))
+	}
+
+	_, body = get(t, server.URL+"/admin/c/pets?field=Species&value=dog")
+	if !strings.Contains(body, "30 documents") {
+		t.Errorf("Expected 30 matching documents, found %s", body)
+	}
+
+	if status, _ := get(t, server.URL+"/admin/c/missing"); status != http.StatusNotFound {
+		t.Errorf("Expected %d, found %d", http.StatusNotFound, status)
+	}
+	if status, _ := get(t, server.URL+"/admin/c/pets/1000"); status != http.StatusNotFound {
+		t.Errorf("Expected %d, found %d", http.StatusNotFound, status)
+	}
+}
+
+func TestHandler_EditDelete(t *testing.T) {
+	ds, server := newServer(t)
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}}
+
+	status, body := get(t, server.URL+"/admin/c/pets/3")
+	if status != http.StatusOK || !strings.Contains(body, "pet-3") {
+		t.Fatalf("Expected document page, found %d %s", status, body)
+	}
+
+	resp, err := client.PostForm(server.URL+"/admin/c/pets/3", url.Values{"document": {`{"Name": "renamed"}`}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusSeeOther || resp.Header.Get("Location") != "3" {
+		t.Errorf("Expected redirect to the document, found %d %q", resp.StatusCode, resp.Header.Get("Location"))
+	}
+	pet := ds.In("pets").FindKey(3).(*Pet)
+	if pet.Name != "renamed" || pet.Species != "cat" {
+		t.Errorf("Expected only Name to change, found %#v", pet)
+	}
+	if !ds.Dirty() {
+		t.Error("Expected datastore to be dirty after edit")
+	}
+
+	resp, err = client.PostForm(server.URL+"/admin/c/pets/3", url.Values{"document": {`not json`}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("Expected %d, found %d", http.StatusBadRequest, resp.StatusCode)
+	}
+
+	// Nothing is deleted until the confirmation form is submitted
+	if status, _ := get(t, server.URL+"/admin/c/pets/3/delete"); status != http.StatusOK {
+		t.Errorf("Expected %d, found %d", http.StatusOK, status)
+	}
+	if ds.In("pets").FindKey(3) == nil {
+		t.Fatal("Expected document to exist before confirmation")
+	}
+
+	resp, err = client.PostForm(server.URL+"/admin/c/pets/3/delete", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusSeeOther || resp.Header.Get("Location") != "../../pets" {
+		t.Errorf("Expected redirect to the collection, found %d %q", resp.StatusCode, resp.Header.Get("Location"))
+	}
+	if ds.In("pets").FindKey(3) != nil {
+		t.Error("Expected document to be deleted")
+	}
+}
+
+func TestHandler_Healthz(t *testing.T) {
+	ds, server := newServer(t)
+
+	status, body := get(t, server.URL+"/admin/healthz")
+	if status != http.StatusOK {
+		t.Errorf("Expected %d, found %d", http.StatusOK, status)
+	}
+	if !strings.Contains(body, `"healthy":true`) || !strings.Contains(body, fmt.Sprintf(`"pending_changes":%d`, admin.PageSize+10)) {
+		t.Errorf("Expected healthy status with pending changes, found %s", body)
+	}
+
+	// Pet is not registered with gob, so the flush fails
+	if err := ds.Flush(); err == nil {
+		t.Fatal("Expected flush to fail")
+	}
+	status, body = get(t, server.URL+"/admin/healthz")
+	if status != http.StatusServiceUnavailable {
+		t.Errorf("Expected %d, found %d", http.StatusServiceUnavailable, status)
+	}
+	if !strings.Contains(body, `"healthy":false`) || !strings.Contains(body, "not registered") {
+		t.Errorf("Expected the flush error, found %s", body)
+	}
+}
+
+type Account struct {
+	Identifier uint64
+	Name       string
+	Password   string `datastore:"redact"`
+}
+
+func (a *Account) ID() uint64 {
+	return a.Identifier
+}
+
+func (a *Account) SetID(id uint64) {
+	a.Identifier = id
+}
+
+func TestHandler_Redact(t *testing.T) {
+	ds, server := newServer(t)
+	accounts := ds.In("accounts")
+	account := &Account{Name: "alice", Password: "hunter2"}
+	if err := accounts.Upsert(account); err != nil {
+		t.Fatal(err)
+	}
+	page := fmt.Sprintf("%s/admin/c/accounts/%d", server.URL, account.ID())
+
+	for _, url := range []string{server.URL + "/admin/c/accounts", page} {
+		_, body := get(t, url)
+		if strings.Contains(body, "hunter2") || !strings.Contains(body, datastore.Redacted) {
+			t.Errorf("Expected password to be redacted, found %s", body)
+		}
+	}
+	if _, body := get(t, server.URL+"/admin/c/accounts?field=Password&value=hunter2"); !strings.Contains(body, "0 documents") {
+		t.Errorf("Expected no documents to match a redacted field, found %s", body)
+	}
+
+	// Submitting the form as it was shown does not change the password
+	resp, err := http.PostForm(page, url.Values{"document": {`{"Name": "bob", "Password": "[REDACTED]"}`}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	saved := accounts.FindKey(account.ID()).(*Account)
+	if saved.Name != "bob" || saved.Password != "hunter2" {
+		t.Errorf("Expected only Name to change, found %#v", saved)
+	}
+}
+
+func TestHandler_CrossOrigin(t *testing.T) {
+	ds, server := newServer(t)
+
+	for _, header := range []http.Header{
+		{"Sec-Fetch-Site": {"cross-site"}},
+		{"Origin": {"https://attacker.example"}},
+	} {
+		for _, path := range []string{"/admin/c/pets/3", "/admin/c/pets/3/delete"} {
+			req, err := http.NewRequest(http.MethodPost, server.URL+path, strings.NewReader(`document={"Name":"stolen"}`))
+			if err != nil {
+				t.Fatal(err)
+			}
+			req.Header = header.Clone()
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp.Body.Close()
+			if resp.StatusCode != http.StatusForbidden {
+				t.Errorf("Expected %d for %s with %v, found %d", http.StatusForbidden, path, header, resp.StatusCode)
+			}
+		}
+	}
+
+	pet, ok := ds.In("pets").FindKey(3).(*Pet)
+	if !ok || pet.Name != "pet-3" {
+		t.Errorf("Expected pet to be unchanged, found %#v", pet)
+	}
+
+	// Forms from the admin UI itself are accepted
+	for _, header := range []http.Header{
+		{"Sec-Fetch-Site": {"same-origin"}},
+		{"Origin": {server.URL}},
+	} {
+		req := mustRequest(t, http.MethodPost, server.URL+"/admin/c/pets/3", "application/x-www-form-urlencoded", strings.NewReader(`document={"Name":"renamed"}`))
+		for name, values := range header {
+			req.Header[name] = values
+		}
+		resp, err := http.DefaultTransport.RoundTrip(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusSeeOther {
+			t.Errorf("Expected %d with %v, found %d", http.StatusSeeOther, header, resp.StatusCode)
+		}
+	}
+}
+
+func TestHandler_Limits(t *testing.T) {
+	ds, server := newServerWith(t, admin.Options{MaxBodySize: 64, RateLimit: 0.001, Burst: 1})
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}}
+
+	large := `{"Name": "` + strings.Repeat("x", 100) + `"}`
+	resp, err := client.PostForm(server.URL+"/admin/c/pets/3", url.Values{"document": {large}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusRequestEntityTooLarge {
+		t.Errorf("Expected %d, found %d", http.StatusRequestEntityTooLarge, resp.StatusCode)
+	}
+	if pet := ds.In("pets").FindKey(3).(*Pet); pet.Name != "pet-3" {
+		t.Errorf("Expected pet to be unchanged, found %#v", pet)
+	}
+
+	// The rejected form spent the only token, so the next one is limited
+	resp, err = client.PostForm(server.URL+"/admin/c/pets/3", url.Values{"document": {`{"Name": "renamed"}`}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusTooManyRequests {
+		t.Errorf("Expected %d, found %d", http.StatusTooManyRequests, resp.StatusCode)
+	}
+
+	// Pages that only read are not limited
+	if status, _ := get(t, server.URL+"/admin/c/pets/3"); status != http.StatusOK {
+		t.Errorf("Expected %d, found %d", http.StatusOK, status)
+	}
+}
+
+// tokenAuthorizer lets readers view pets, and writers change them too.
+type tokenAuthorizer map[string]string
+
+func (a tokenAuthorizer) Authenticate(token string) (string, error) {
+	identity, ok := a[token]
+	if !ok {
+		return "", errors.New("unknown token")
+	}
+	return identity, nil
+}
+
+func (a tokenAuthorizer) Allow(identity, collection string, access admin.Access) bool {
+	return collection == "pets" && (access == admin.Read || identity == "writer")
+}
+
+func TestHandler_Authorizer(t *testing.T) {
+	authorizer := tokenAuthorizer{"read-token": "reader", "write-token": "writer"}
+	ds, server := newServerWith(t, admin.Options{Authorizer: authorizer})
+	if err := ds.In("accounts").Upsert(&Account{Name: "alice"}); err != nil {
+		t.Fatal(err)
+	}
+
+	request := func(method, path, token string) (int, string) {
+		t.Helper()
+		var body io.Reader
+		if method == http.MethodPost {
+			body = strings.NewReader(`document={"Name":"renamed"}`)
+		}
+		req, err := http.NewRequest(method, server.URL+path, body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		resp, err := http.DefaultTransport.RoundTrip(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		data, err := io.ReadAll(resp.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp.StatusCode, string(data)
+	}
+
+	for _, test := range []struct {
+		method, path, token string
+		status              int
+	}{
+		{http.MethodGet, "/admin/", "", http.StatusUnauthorized},
+		{http.MethodGet, "/admin/c/pets", "wrong", http.StatusUnauthorized},
+		{http.MethodGet, "/admin/healthz", "", http.StatusOK},
+		{http.MethodGet, "/admin/c/pets/3", "read-token", http.StatusOK},
+		{http.MethodGet, "/admin/c/accounts", "read-token", http.StatusForbidden},
+		{http.MethodPost, "/admin/c/pets/3", "read-token", http.StatusForbidden},
+		{http.MethodPost, "/admin/c/pets/3", "write-token", http.StatusSeeOther},
+	} {
+		if status, body := request(test.method, test.path, test.token); status != test.status {
+			t.Errorf("Expected %d for %s %s with %q, found %d %s", test.status, test.method, test.path, test.token, status, body)
+		}
+	}
+
+	_, body := request(http.MethodGet, "/admin/", "read-token")
+	if !strings.Contains(body, `href="./c/pets"`) || strings.Contains(body, "accounts") {
+		t.Errorf("Expected only pets to be listed, found %s", body)
+	}
+	if pet := ds.In("pets").FindKey(3).(*Pet); pet.Name != "renamed" {
+		t.Errorf("Expected the writer to rename the pet, found %#v", pet)
+	}
+}
+
+type Note struct {
+	Identifier uint64
+	Text       string
+}
+
+func (n *Note) ID() uint64 {
+	return n.Identifier
+}
+
+func (n *Note) SetID(id uint64) {
+	n.Identifier = id
+}
+
+func TestHandler_ExportImport(t *testing.T) {
+	gob.Register(&Note{})
+	serve := func(signature string, options admin.Options) (*datastore.Datastore, *httptest.Server) {
+		ds, err := datastore.Create(filepath.Join(t.TempDir(), "notes"+datastore.Extension), signature)
+		if err != nil {
+			t.Fatal(err)
+		}
+		server := httptest.NewServer(http.StripPrefix("/admin", admin.NewHandler(ds, options)))
+		t.Cleanup(server.Close)
+		return ds, server
+	}
+	post := func(url, contentType string, body io.Reader) int {
+		t.Helper()
+		resp, err := http.DefaultTransport.RoundTrip(mustRequest(t, http.MethodPost, url, contentType, body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	source, server := serve("admintest.1", admin.Options{})
+	for _, text := range []string{"one", "two"} {
+		if err := source.In("notes").Upsert(&Note{Text: text}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	status, body := get(t, server.URL+"/admin/export")
+	if status != http.StatusOK {
+		t.Fatalf("Expected %d, found %d %s", http.StatusOK, status, body)
+	}
+	decoded, err := datastore.Decode(strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if found := len(decoded.In("notes").List()); found != 2 {
+		t.Errorf("Expected 2 exported notes, found %d", found)
+	}
+
+	status, exported := get(t, server.URL+"/admin/c/notes/export")
+	if status != http.StatusOK {
+		t.Fatalf("Expected %d, found %d %s", http.StatusOK, status, exported)
+	}
+
+	// The body can be the stream itself, or a file in a form
+	target, targetServer := serve("admintest.1", admin.Options{})
+	if status := post(targetServer.URL+"/admin/c/notes/import", "application/octet-stream", strings.NewReader(exported)); status != http.StatusSeeOther {
+		t.Errorf("Expected %d, found %d", http.StatusSeeOther, status)
+	}
+	form := &bytes.Buffer{}
+	writer := multipart.NewWriter(form)
+	part, err := writer.CreateFormFile("file", "notes.collection")
+	if err != nil {
+		t.Fatal(err)
+	}
+	part.Write([]byte(exported))
+	writer.Close()
+	if status := post(targetServer.URL+"/admin/c/copies/import", writer.FormDataContentType(), form); status != http.StatusSeeOther {
+		t.Errorf("Expected %d, found %d", http.StatusSeeOther, status)
+	}
+	for _, name := range []string{"notes", "copies"} {
+		if found := len(target.In(name).List()); found != 2 {
+			t.Errorf("Expected 2 imported %s, found %d", name, found)
+		}
+	}
+
+	// Streams from a Datastore with another signature are rejected
+	other, otherServer := serve("admintest.2", admin.Options{})
+	if status := post(otherServer.URL+"/admin/c/notes/import", "application/octet-stream", strings.NewReader(exported)); status != http.StatusBadRequest {
+		t.Errorf("Expected %d, found %d", http.StatusBadRequest, status)
+	}
+	if len(other.In("notes").List()) != 0 {
+		t.Error("Expected nothing to be imported")
+	}
+
+	_, limitedServer := serve("admintest.1", admin.Options{MaxUploadSize: 16})
+	if status := post(limitedServer.URL+"/admin/c/notes/import", "application/octet-stream", strings.NewReader(exported)); status != http.StatusRequestEntityTooLarge {
+		t.Errorf("Expected %d, found %d", http.StatusRequestEntityTooLarge, status)
+	}
+}
+
+func mustRequest(t *testing.T, method, url, contentType string, body io.Reader) *http.Request {
+	t.Helper()
+	req, err := http.NewRequest(method, url, body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", contentType)
+	return req
+}
@@ -0,0 +1,43 @@
+package admin
+
+import (
+	"sync"
+	"time"
+)
+
+// limiter is a token bucket shared by every request that changes the
+// Datastore. It holds up to burst tokens, refilled at rate per second, and
+// each request spends one.
+type limiter struct {
+	mutex  sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func newLimiter(rate float64, burst int) *limiter {
+	if burst < 1 {
+		burst = 1
+	}
+	return &limiter{rate: rate, burst: float64(burst), tokens: float64(burst)}
+}
+
+// allow spends a token if one is available at now.
+func (l *limiter) allow(now time.Time) bool {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if !l.last.IsZero() && now.After(l.last) {
+		l.tokens += now.Sub(l.last).Seconds() * l.rate
+		if l.tokens > l.burst {
+			l.tokens = l.burst
+		}
+	}
+	l.last = now
+	if l.tokens < 1 {
+		return false
+	}
+	l.tokens--
+	return true
+}
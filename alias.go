@@ -0,0 +1,128 @@
+package datastore
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"sort"
+)
+
+// AliasError lists the keys of the Documents in a Collection that were changed
+// without being upserted. See SetAliasDetection.
+type AliasError struct {
+	Collection string
+	Keys       []uint64
+}
+
+func (e *AliasError) Error() string {
+	return fmt.Sprintf("documents in collection %q were changed without upsert: keys %v", e.Collection, e.Keys)
+}
+
+// SetAliasDetection turns on (or off) a debug mode that finds Documents that
+// were changed through a retained pointer instead of through the Collection.
+// Such changes are written by the next Flush even though Views, history, the
+// audit log, and checksums never saw them, which makes the bugs hard to track
+// down.
+//
+// While alias detection is on, an encoding of each Document is kept in memory
+// each time it is stored, and compared with the Document before each Flush. It
+// covers the same fields that Flush writes, including fields hidden from JSON.
+// Each Collection with changed Documents is reported to subscribers as an
+// EventAliasedMutation with an *AliasError; call CheckAliasing to check on
+// demand. This doubles the memory used by the Datastore, so only use it in
+// development and tests. Compressed Collections hold copies of their
+// Documents and are not checked.
+func (d *Datastore) SetAliasDetection(enabled bool) error {
+	d.aliasDetection.Store(enabled)
+
+	for _, c := range d.collections() {
+		c.mutex.Lock()
+		c.encoded = nil
+		if enabled && !c.Compressed {
+			c.encoded = map[uint64][]byte{}
+			for _, key := range c.index.Keys() {
+				if err := c.recordEncoding(key, c.Items[key]); err != nil {
+					c.mutex.Unlock()
+					return wrapError(err, "set alias detection", c, key)
+				}
+			}
+		}
+		c.mutex.Unlock()
+	}
+	return nil
+}
+
+// CheckAliasing compares each Document with its encoding from when it was last
+// stored, and returns an *AliasError for each Collection with changed
+// Documents, joined with errors.Join. It returns nil if alias detection is off.
+func (d *Datastore) CheckAliasing() error {
+	errs := []error{}
+	for _, c := range d.collections() {
+		if err := c.checkAliasing(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// detectAliasing sends an EventAliasedMutation for each Collection with
+// changed Documents. It is called before each Flush.
+func (d *Datastore) detectAliasing() {
+	if !d.aliasDetection.Load() {
+		return
+	}
+	for _, c := range d.collections() {
+		if err := c.checkAliasing(); err != nil {
+			d.emit(Event{Type: EventAliasedMutation, Collection: c.name, Err: err})
+		}
+	}
+}
+
+// collections returns the Collections in the Datastore, so they can be used
+// without holding the Datastore lock.
+func (d *Datastore) collections() []*Collection {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	collections := make([]*Collection, 0, len(d.Collections))
+	for _, c := range d.Collections {
+		collections = append(collections, c)
+	}
+	return collections
+}
+
+func (c *Collection) checkAliasing() error {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	changed := []uint64{}
+	for key, previous := range c.encoded {
+		current, err := stableEncoding(c.Items[key])
+		if err != nil || !bytes.Equal(current, previous) {
+			changed = append(changed, key)
+		}
+	}
+	if len(changed) == 0 {
+		return nil
+	}
+	sort.Sort(UIntSlice(changed))
+	return &AliasError{Collection: c.name, Keys: changed}
+}
+
+// recordEncoding keeps the encoding of a Document that is being stored, while
+// alias detection is on. It must be called while the Collection is locked.
+func (c *Collection) recordEncoding(key uint64, document Document) error {
+	if c.store == nil || !c.store.aliasDetection.Load() || c.Compressed {
+		return nil
+	}
+
+	encoded, err := stableEncoding(document)
+	if err != nil {
+		return err
+	}
+	if c.encoded == nil {
+		c.encoded = map[uint64][]byte{}
+	}
+	c.encoded[key] = encoded
+	return nil
+}
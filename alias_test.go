@@ -0,0 +1,100 @@
+package datastore_test
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"git.stormbase.io/cbednarski/datastore"
+)
+
+func TestDatastore_SetAliasDetection(t *testing.T) {
+	tempdir, err := ioutil.TempDir("", "datastore")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempdir)
+
+	ds, err := datastore.Create(filepath.Join(tempdir, "alias"+datastore.Extension), TestdataSignature)
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := ds.In("names")
+	existing := &NameDocument{Name: "existing"}
+	names.Upsert(existing)
+
+	if err := ds.SetAliasDetection(true); err != nil {
+		t.Fatal(err)
+	}
+	events := []datastore.Event{}
+	ds.Subscribe(func(event datastore.Event) {
+		if event.Type == datastore.EventAliasedMutation {
+			events = append(events, event)
+		}
+	})
+
+	retained := &NameDocument{Name: "retained"}
+	names.Upsert(retained)
+	if err := ds.CheckAliasing(); err != nil {
+		t.Errorf("Expected no aliasing, found %s", err)
+	}
+
+	// Changes made through the Collection are not reported
+	retained.Name = "upserted"
+	names.Upsert(retained)
+
+	// Changes made through a retained pointer are
+	existing.Name = "changed"
+	retained.Name = "changed"
+	err = ds.CheckAliasing()
+	var aliasErr *datastore.AliasError
+	if !errors.As(err, &aliasErr) || len(aliasErr.Keys) != 2 || aliasErr.Collection != "names" {
+		t.Fatalf("Expected keys 1 and 2 to be reported, found %v", err)
+	}
+
+	if err := ds.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 1 || events[0].Collection != "names" {
+		t.Errorf("Expected one aliased mutation event, found %v", events)
+	}
+
+	if err := ds.SetAliasDetection(false); err != nil {
+		t.Fatal(err)
+	}
+	if err := ds.CheckAliasing(); err != nil {
+		t.Errorf("Expected no checks while disabled, found %s", err)
+	}
+}
+
+func TestDatastore_SetAliasDetectionHiddenField(t *testing.T) {
+	ds := datastore.New()
+	if err := ds.SetAliasDetection(true); err != nil {
+		t.Fatal(err)
+	}
+
+	// Maps are encoded in a stable order, so unchanged maps are not reported
+	rich := &RichDocument{Labels: map[string]int{"a": 1, "b": 2, "c": 3, "d": 4, "e": 5}}
+	if err := ds.In("rich").Upsert(rich); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 10; i++ {
+		if err := ds.CheckAliasing(); err != nil {
+			t.Fatalf("Expected no aliasing, found %s", err)
+		}
+	}
+
+	// Fields hidden from JSON are still written by Flush, so changes to them
+	// are reported
+	token := &TokenDocument{Name: "bob", Token: "old"}
+	if err := ds.In("tokens").Upsert(token); err != nil {
+		t.Fatal(err)
+	}
+	token.Token = "new"
+	var aliasErr *datastore.AliasError
+	if err := ds.CheckAliasing(); !errors.As(err, &aliasErr) || aliasErr.Collection != "tokens" {
+		t.Errorf("Expected the hidden field change to be reported, found %v", err)
+	}
+}
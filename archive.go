@@ -0,0 +1,40 @@
+package datastore
+
+import "io"
+
+// Archive writes the Documents that satisfy match to w and removes them from
+// the Collection in a single operation, and returns the number of Documents
+// archived. The archive has the same format as WriteTo, so it can be loaded
+// into an empty Collection with ReadFrom.
+//
+// The Collection is locked while the archive is written, so nothing can change
+// between writing and removing the Documents. If writing fails no Documents
+// are removed.
+func (c *Collection) Archive(match func(Document) bool, w io.Writer) (int, error) {
+	archived := 0
+	err := c.mutate(Operation{Op: OpArchive}, func() error {
+		archive := &Collection{
+			Items:        map[uint64]Document{},
+			Type:         c.Type,
+			CurrentIndex: c.CurrentIndex,
+		}
+		keys := []uint64{}
+		for _, key := range c.index.Keys() {
+			document, _ := c.item(key)
+			if match(document) {
+				archive.Items[key] = document
+				keys = append(keys, key)
+			}
+		}
+
+		if _, err := c.encode(w, archive); err != nil {
+			return err
+		}
+		for _, key := range keys {
+			c.deleteKey(key)
+		}
+		archived = len(keys)
+		return nil
+	})
+	return archived, err
+}
@@ -0,0 +1,64 @@
+package datastore_test
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"git.stormbase.io/cbednarski/datastore"
+	"git.stormbase.io/cbednarski/datastore/datastoretest"
+)
+
+func TestCollection_Archive(t *testing.T) {
+	tempdir, err := ioutil.TempDir("", "datastore")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempdir)
+
+	ds, err := datastore.Create(filepath.Join(tempdir, "archive"+datastore.Extension), TestdataSignature)
+	if err != nil {
+		t.Fatal(err)
+	}
+	numbers := ds.In("numbers")
+	for i := 1; i <= 10; i++ {
+		if err := numbers.Upsert(&NumberDocument{Number: i}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	old := func(d datastore.Document) bool {
+		return d.(*NumberDocument).Number <= 4
+	}
+
+	// Nothing is removed if the archive can not be written
+	if _, err := numbers.Archive(old, &datastoretest.FailingWriter{}); !errors.Is(err, datastoretest.ErrInjected) {
+		t.Errorf("Expected %s, found %v", datastoretest.ErrInjected, err)
+	}
+	if len(numbers.List()) != 10 {
+		t.Errorf("Expected 10 documents, found %d", len(numbers.List()))
+	}
+
+	buf := &bytes.Buffer{}
+	archived, err := numbers.Archive(old, buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if archived != 4 {
+		t.Errorf("Expected 4 documents archived, found %d", archived)
+	}
+	if len(numbers.List()) != 6 || numbers.FindKey(1) != nil {
+		t.Errorf("Expected archived documents to be removed, found %v", numbers.List())
+	}
+
+	cold := ds.In("cold")
+	if _, err := cold.ReadFrom(buf); err != nil {
+		t.Fatal(err)
+	}
+	keys := cold.List()
+	if len(keys) != 4 || keys[0] != 1 || keys[3] != 4 {
+		t.Errorf("Expected keys 1-4 in the archive, found %v", keys)
+	}
+}
@@ -0,0 +1,203 @@
+package datastore
+
+import (
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// AttachmentsSuffix is appended to the Datastore's path to name the directory
+// where attachments are stored.
+const AttachmentsSuffix = ".attachments"
+
+// collectionDir returns the directory holding the attachments for the
+// Collection. PathEscape leaves "." and ".." as they are, so Collections with
+// those names (or no name) can't have attachments.
+func (c *Collection) collectionDir() (string, error) {
+	if err := c.checkOpen(); err != nil {
+		return "", err
+	}
+	if c.store == nil || c.store.path == "" {
+		return "", ErrNotPersistent
+	}
+	if c.name == "" || c.name == "." || c.name == ".." {
+		return "", ErrInvalidAttachment
+	}
+	return filepath.Join(c.store.path+AttachmentsSuffix, url.PathEscape(c.name)), nil
+}
+
+// attachmentDir returns the directory holding the attachments for a key.
+func (c *Collection) attachmentDir(key uint64) (string, error) {
+	dir, err := c.collectionDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, strconv.FormatUint(key, 10)), nil
+}
+
+// attachmentPath returns the path of a named attachment for a key. Names
+// starting with "." are reserved for the temp files PutAttachment writes, and
+// are hidden by Attachments.
+func (c *Collection) attachmentPath(key uint64, name string) (string, error) {
+	if name == "" || strings.HasPrefix(name, ".") || strings.ContainsAny(name, `/\`) {
+		return "", ErrInvalidAttachment
+	}
+	dir, err := c.attachmentDir(key)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, name), nil
+}
+
+// PutAttachment stores the contents of r as a named attachment for the Document
+// with the specified key. Attachments are streamed to disk beside the Datastore
+// file rather than held in memory, which makes them suitable for large binary
+// data like images. If an attachment with the same name exists it is replaced.
+//
+// Unlike Documents, attachments are written immediately and do not wait for
+// Flush. The name may not start with "." or contain path separators.
+// PutAttachment fails with ErrReadOnly if the Collection is read-only.
+func (c *Collection) PutAttachment(key uint64, name string, r io.Reader) error {
+	return wrapError(c.putAttachment(key, name, r), "put attachment", c, key)
+}
+
+func (c *Collection) putAttachment(key uint64, name string, r io.Reader) error {
+	path, err := c.attachmentPath(key, name)
+	if err != nil {
+		return err
+	}
+	if c.ReadOnly() {
+		return ErrReadOnly
+	}
+	if c.FindKey(key) == nil {
+		return ErrKeyNotFound
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+
+	temp, err := os.CreateTemp(filepath.Dir(path), "."+name+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(temp.Name())
+
+	if _, err := io.Copy(temp, r); err != nil {
+		temp.Close()
+		return err
+	}
+	if err := temp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(temp.Name(), path)
+}
+
+// GetAttachment opens the named attachment for the Document with the specified
+// key. You must close it when you are done reading.
+func (c *Collection) GetAttachment(key uint64, name string) (io.ReadCloser, error) {
+	path, err := c.attachmentPath(key, name)
+	if err != nil {
+		return nil, wrapError(err, "get attachment", c, key)
+	}
+
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		err = ErrAttachmentNotFound
+	}
+	if err != nil {
+		return nil, wrapError(err, "get attachment", c, key)
+	}
+	return file, nil
+}
+
+// DeleteAttachment removes the named attachment for the Document with the
+// specified key. DeleteAttachment fails with ErrReadOnly if the Collection is
+// read-only.
+func (c *Collection) DeleteAttachment(key uint64, name string) error {
+	path, err := c.attachmentPath(key, name)
+	if err == nil && c.ReadOnly() {
+		err = ErrReadOnly
+	}
+	if err == nil {
+		err = os.Remove(path)
+	}
+	if os.IsNotExist(err) {
+		err = ErrAttachmentNotFound
+	}
+	return wrapError(err, "delete attachment", c, key)
+}
+
+// Attachments returns the sorted names of the attachments for the Document with
+// the specified key.
+func (c *Collection) Attachments(key uint64) ([]string, error) {
+	dir, err := c.attachmentDir(key)
+	if err != nil {
+		return nil, wrapError(err, "attachments", c, key)
+	}
+
+	entries, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return []string{}, nil
+	}
+	if err != nil {
+		return nil, wrapError(err, "attachments", c, key)
+	}
+
+	names := []string{}
+	for _, entry := range entries {
+		if !entry.IsDir() && !strings.HasPrefix(entry.Name(), ".") {
+			names = append(names, entry.Name())
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// PurgeAttachments removes the attachments for every key that is no longer in
+// the Collection (or its trash), and returns the number of keys purged.
+// Attachments are not removed when a Document is deleted, because the delete
+// is not written to disk until Flush.
+func (c *Collection) PurgeAttachments() (int, error) {
+	dir, err := c.collectionDir()
+	if err == nil && c.ReadOnly() {
+		err = ErrReadOnly
+	}
+	if err != nil {
+		return 0, wrapError(err, "purge attachments", c, 0)
+	}
+
+	entries, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, wrapError(err, "purge attachments", c, 0)
+	}
+
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	purged := 0
+	for _, entry := range entries {
+		key, err := strconv.ParseUint(entry.Name(), 10, 64)
+		if err != nil {
+			continue
+		}
+		if _, ok := c.Items[key]; ok {
+			continue
+		}
+		if _, ok := c.Trash[key]; ok {
+			continue
+		}
+		if err := os.RemoveAll(filepath.Join(dir, entry.Name())); err != nil {
+			return purged, wrapError(err, "purge attachments", c, 0)
+		}
+		purged++
+	}
+	return purged, nil
+}
@@ -0,0 +1,130 @@
+package datastore_test
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"git.stormbase.io/cbednarski/datastore"
+)
+
+func TestCollection_Attachments(t *testing.T) {
+	tempdir, err := ioutil.TempDir("", "datastore")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempdir)
+
+	ds, err := datastore.Create(filepath.Join(tempdir, "attach"+datastore.Extension), TestdataSignature)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pets := ds.In("pets")
+	pet := &NameDocument{Name: "Chomper"}
+	if err := pets.Upsert(pet); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := pets.PutAttachment(pet.ID(), "photo.jpg", strings.NewReader("not really a jpeg")); err != nil {
+		t.Fatal(err)
+	}
+	if err := pets.PutAttachment(pet.ID(), "avatar.png", strings.NewReader("small")); err != nil {
+		t.Fatal(err)
+	}
+	if err := pets.PutAttachment(60, "photo.jpg", strings.NewReader("")); !errors.Is(err, datastore.ErrKeyNotFound) {
+		t.Errorf("Expected %s, found %s", datastore.ErrKeyNotFound, err)
+	}
+	if err := pets.PutAttachment(pet.ID(), "../escape", strings.NewReader("")); !errors.Is(err, datastore.ErrInvalidAttachment) {
+		t.Errorf("Expected %s, found %s", datastore.ErrInvalidAttachment, err)
+	}
+	// Dot names would be hidden by Attachments and could collide with temp files
+	for _, name := range []string{".hidden", ".photo.jpg.tmp"} {
+		if err := pets.PutAttachment(pet.ID(), name, strings.NewReader("")); !errors.Is(err, datastore.ErrInvalidAttachment) {
+			t.Errorf("Expected %s for %q, found %s", datastore.ErrInvalidAttachment, name, err)
+		}
+	}
+
+	names, err := pets.Attachments(pet.ID())
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{"avatar.png", "photo.jpg"}
+	if !reflect.DeepEqual(names, expected) {
+		t.Errorf("Expected %#v, found %#v", expected, names)
+	}
+
+	reader, err := pets.GetAttachment(pet.ID(), "photo.jpg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadAll(reader)
+	reader.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "not really a jpeg" {
+		t.Errorf("Expected attachment contents, found %q", data)
+	}
+
+	if err := pets.DeleteAttachment(pet.ID(), "avatar.png"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := pets.GetAttachment(pet.ID(), "avatar.png"); !errors.Is(err, datastore.ErrAttachmentNotFound) {
+		t.Errorf("Expected %s, found %s", datastore.ErrAttachmentNotFound, err)
+	}
+
+	// Attachments are kept until the document is gone and they are purged
+	if err := pets.Delete(pet); err != nil {
+		t.Fatal(err)
+	}
+	purged, err := pets.PurgeAttachments()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if purged != 1 {
+		t.Errorf("Expected 1 key purged, found %d", purged)
+	}
+	names, err = pets.Attachments(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(names) != 0 {
+		t.Errorf("Expected no attachments, found %#v", names)
+	}
+
+	// Read-only Collections can't change their attachments
+	pets.SetReadOnly(true)
+	if err := pets.PutAttachment(pet.ID(), "photo.jpg", strings.NewReader("")); !errors.Is(err, datastore.ErrReadOnly) {
+		t.Errorf("Expected %s, found %s", datastore.ErrReadOnly, err)
+	}
+	var e *datastore.Error
+	if err := pets.DeleteAttachment(pet.ID(), "photo.jpg"); !errors.As(err, &e) || e.Op != "delete attachment" || !errors.Is(err, datastore.ErrReadOnly) {
+		t.Errorf("Expected delete attachment to fail with %s, found %#v", datastore.ErrReadOnly, err)
+	}
+	pets.SetReadOnly(false)
+
+	// Collection names that PathEscape does not change would escape the
+	// attachments directory
+	for _, name := range []string{".", ".."} {
+		if _, err := ds.In(name).Attachments(1); !errors.Is(err, datastore.ErrInvalidAttachment) {
+			t.Errorf("Expected %s for %q, found %s", datastore.ErrInvalidAttachment, name, err)
+		}
+	}
+
+	memory := datastore.New().In("pets")
+	if err := memory.PutAttachment(1, "photo.jpg", strings.NewReader("")); !errors.Is(err, datastore.ErrNotPersistent) {
+		t.Errorf("Expected %s, found %s", datastore.ErrNotPersistent, err)
+	}
+
+	if err := ds.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := pets.PutAttachment(pet.ID(), "photo.jpg", strings.NewReader("")); !errors.Is(err, datastore.ErrClosed) {
+		t.Errorf("Expected %s, found %s", datastore.ErrClosed, err)
+	}
+}
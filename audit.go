@@ -0,0 +1,160 @@
+package datastore
+
+import (
+	"encoding/gob"
+	"time"
+)
+
+// Op identifies a type of change made to a Collection.
+type Op string
+
+const (
+	OpUpsert     Op = "upsert"
+	OpDelete     Op = "delete"
+	OpIncrement  Op = "increment"
+	OpPatch      Op = "patch"
+	OpSoftDelete Op = "softdelete"
+	OpRestore    Op = "restore"
+	OpAllocate   Op = "allocate"
+	OpImport     Op = "import"
+	OpArchive    Op = "archive"
+	OpMerge      Op = "merge"
+	OpLocked     Op = "locked"
+	OpPurge      Op = "purge"
+	OpHistory    Op = "history"
+)
+
+// AuditEntry is a Document that records a single change to a Collection. See
+// EnableAudit.
+type AuditEntry struct {
+	Identifier uint64
+
+	// Time is when the change was made.
+	Time time.Time
+
+	// Actor is who made the change, as supplied to Collection.As. Actor is empty
+	// if the change was made without calling As.
+	Actor string
+
+	// Collection is the name of the Collection that was changed.
+	Collection string
+
+	// Op is the type of change.
+	Op Op
+
+	// Key is the key of the Document that was changed.
+	Key uint64
+}
+
+func (a *AuditEntry) ID() uint64 {
+	return a.Identifier
+}
+
+func (a *AuditEntry) SetID(id uint64) {
+	a.Identifier = id
+}
+
+func init() {
+	gob.Register(&AuditEntry{})
+}
+
+// EnableAudit records an AuditEntry in the named Collection each time a
+// Document is changed in any other Collection in this Datastore. The audit
+// Collection is a normal Collection of *AuditEntry, so it can be queried with
+// the Find functions and is written to disk by Flush.
+//
+// Auditing is not written to disk, so call EnableAudit again after Open.
+func (d *Datastore) EnableAudit(name string) (*Collection, error) {
+	if err := d.checkOpen(); err != nil {
+		return nil, err
+	}
+	c, err := d.Init(name, &AuditEntry{})
+	if err != nil {
+		return nil, err
+	}
+	d.audit.Store(c)
+	return c, nil
+}
+
+// Actor performs changes on a Collection on behalf of a named actor, who is
+// recorded in the audit log. See Collection.As.
+type Actor struct {
+	name       string
+	collection *Collection
+}
+
+// As returns an Actor that performs changes to this Collection on behalf of
+// actor, so the changes are attributed to them in the audit log.
+//
+//	pets.As("alice").Upsert(pet)
+func (c *Collection) As(actor string) *Actor {
+	return &Actor{
+		name:       actor,
+		collection: c,
+	}
+}
+
+// Upsert behaves like Collection.Upsert and records the change on behalf of
+// the Actor.
+func (a *Actor) Upsert(document Document) error {
+	c := a.collection
+	if err := c.SetType(document); err != nil {
+		return err
+	}
+
+	return c.mutate(Operation{Op: OpUpsert, Key: document.ID(), Document: document, Actor: a.name}, func() error {
+		_, err := c.upsert(OpUpsert, document)
+		return err
+	})
+}
+
+// DeleteKey behaves like Collection.DeleteKey and records the change on behalf
+// of the Actor.
+func (a *Actor) DeleteKey(key uint64) error {
+	c := a.collection
+	return c.mutate(Operation{Op: OpDelete, Key: key, Actor: a.name}, func() error {
+		c.deleteKey(key)
+		return nil
+	})
+}
+
+// Delete behaves like Collection.Delete and records the change on behalf of the
+// Actor.
+func (a *Actor) Delete(document Document) error {
+	if document.ID() == 0 {
+		return nil
+	}
+	if err := a.DeleteKey(document.ID()); err != nil {
+		return err
+	}
+	document.SetID(0)
+	return nil
+}
+
+// audited records a change in the audit Collection, if auditing is enabled. It
+// is called while the Collection is locked. The entry is written directly while
+// the audit Collection is locked, without running middleware or checking
+// whether it is read-only, so recording a change can't fail because of either
+// of them or call back into the Collection being changed. An entry rejected by
+// limits set on the audit Collection (see SetQuota) is not recorded.
+func (c *Collection) audited(op Op, key uint64) {
+	if c.store == nil {
+		return
+	}
+
+	audit := c.store.audit.Load()
+	if audit == nil || audit == c {
+		return
+	}
+
+	audit.mutex.Lock()
+	defer audit.mutex.Unlock()
+	audit.thaw()
+	audit.upsert(OpUpsert, &AuditEntry{
+		Time:       c.now(),
+		Actor:      c.actor,
+		Collection: c.name,
+		Op:         op,
+		Key:        key,
+	})
+}
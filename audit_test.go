@@ -0,0 +1,92 @@
+package datastore_test
+
+import (
+	"errors"
+	"testing"
+
+	"git.stormbase.io/cbednarski/datastore"
+)
+
+func TestEnableAudit(t *testing.T) {
+	ds := datastore.New()
+	audit, err := ds.EnableAudit("audit")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cakes := ds.In("cakes")
+	cake := &NameDocument{Name: "chocolate"}
+
+	if err := cakes.As("alice").Upsert(cake); err != nil {
+		t.Fatal(err)
+	}
+	key := cake.ID()
+	if err := cakes.Patch(key, map[string]interface{}{"Name": "vanilla"}); err != nil {
+		t.Fatal(err)
+	}
+	cakes.As("bob").Delete(cake)
+
+	// Deleting a missing key is not a change
+	cakes.DeleteKey(60)
+
+	expected := []datastore.AuditEntry{
+		{Actor: "alice", Op: datastore.OpUpsert},
+		{Actor: "", Op: datastore.OpPatch},
+		{Actor: "bob", Op: datastore.OpDelete},
+	}
+
+	entries := audit.FindAll(func(d datastore.Document) bool {
+		return true
+	})
+	if len(entries) != len(expected) {
+		t.Fatalf("Expected %d entries, found %d", len(expected), len(entries))
+	}
+
+	for i, document := range entries {
+		entry, ok := document.(*datastore.AuditEntry)
+		if !ok {
+			t.Fatal("Expected *datastore.AuditEntry type")
+		}
+		if entry.Actor != expected[i].Actor || entry.Op != expected[i].Op {
+			t.Errorf("Expected %s by %q, found %s by %q", expected[i].Op, expected[i].Actor, entry.Op, entry.Actor)
+		}
+		if entry.Collection != "cakes" || entry.Key != key {
+			t.Errorf("Expected cakes/%d, found %s/%d", key, entry.Collection, entry.Key)
+		}
+		if entry.Time.IsZero() {
+			t.Error("Expected entry time to be set")
+		}
+	}
+
+	if _, err := ds.EnableAudit("cakes"); !errors.Is(err, datastore.ErrInvalidType) {
+		t.Errorf("Expected %s, found %s", datastore.ErrInvalidType, err)
+	}
+}
+
+func TestEnableAuditDirect(t *testing.T) {
+	ds := datastore.New()
+	audit, err := ds.EnableAudit("audit")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Middleware sees the change but not the audit entry it causes
+	collections := []string{}
+	ds.Use(func(op datastore.Operation, next func() error) error {
+		collections = append(collections, op.Collection)
+		return next()
+	})
+
+	// Entries are recorded even if the audit Collection is read-only
+	audit.SetReadOnly(true)
+
+	if err := ds.In("cakes").Upsert(&NameDocument{Name: "chocolate"}); err != nil {
+		t.Fatal(err)
+	}
+	if len(collections) != 1 || collections[0] != "cakes" {
+		t.Errorf("Expected middleware to see cakes, found %v", collections)
+	}
+	if len(audit.List()) != 1 {
+		t.Errorf("Expected 1 entry, found %d", len(audit.List()))
+	}
+}
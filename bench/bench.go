@@ -0,0 +1,292 @@
+// Package bench populates synthetic Datastores and runs standard workloads
+// against them, so you can measure throughput and flush and open times on
+// your own hardware before choosing how much data to keep in a Datastore.
+//
+//	result, err := bench.Run(bench.Config{Documents: 100000, PayloadSize: 512}, bench.ReadHeavy)
+//	fmt.Println(result)
+package bench
+
+import (
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"git.stormbase.io/cbednarski/datastore"
+)
+
+// Signature is the signature of the Datastores created by Run.
+const Signature = "datastore-bench.1"
+
+// Document is the synthetic Document stored by Populate.
+type Document struct {
+	Identifier uint64
+	Name       string
+	Tags       []string
+	Counter    int
+	Payload    []byte
+}
+
+func (d *Document) ID() uint64 {
+	return d.Identifier
+}
+
+func (d *Document) SetID(id uint64) {
+	d.Identifier = id
+}
+
+func init() {
+	gob.Register(&Document{})
+}
+
+// Config describes the shape of the synthetic data and how hard to drive it.
+type Config struct {
+	// Path is where the Datastore is created. If it is empty a temporary file
+	// is used and removed when Run returns.
+	Path string
+
+	// Collections is the number of Collections, and Documents is the number
+	// of Documents in each. PayloadSize is the number of random bytes in each
+	// Document, and Tags is the number of short strings.
+	Collections int
+	Documents   int
+	PayloadSize int
+	Tags        int
+
+	// Operations is the number of operations the workload performs, split
+	// between Workers goroutines.
+	Operations int
+	Workers    int
+
+	// Seed makes the data and operations repeatable.
+	Seed int64
+}
+
+// withDefaults fills in zero fields with small defaults.
+func (c Config) withDefaults() Config {
+	if c.Collections <= 0 {
+		c.Collections = 1
+	}
+	if c.Documents <= 0 {
+		c.Documents = 1000
+	}
+	if c.Operations <= 0 {
+		c.Operations = c.Documents
+	}
+	if c.Workers <= 0 {
+		c.Workers = 1
+	}
+	return c
+}
+
+// Workload is the mix of operations performed by Run. The fractions are of
+// all operations; the remainder are upserts of existing Documents.
+type Workload struct {
+	Name string
+
+	// Reads is the fraction of operations that find a Document by key.
+	Reads float64
+
+	// Churn is the fraction of operations that insert a new Document and
+	// delete an old one.
+	Churn float64
+}
+
+// Standard workloads.
+var (
+	ReadHeavy  = Workload{Name: "read-heavy", Reads: 0.9}
+	WriteHeavy = Workload{Name: "write-heavy", Reads: 0.1}
+	Churn      = Workload{Name: "churn", Reads: 0.2, Churn: 0.6}
+)
+
+// Result reports the timings of a Run.
+type Result struct {
+	Workload string
+
+	// Operations is the number of operations performed, of each kind.
+	Operations int
+	Reads      int
+	Updates    int
+	Churned    int
+
+	// Duration is how long the operations took, and Throughput is the number
+	// of operations per second.
+	Duration   time.Duration
+	Throughput float64
+
+	// PopulateDuration, FlushDuration, and OpenDuration are how long it took
+	// to insert the initial Documents, to Flush after the workload, and to
+	// Open the flushed file.
+	PopulateDuration time.Duration
+	FlushDuration    time.Duration
+	OpenDuration     time.Duration
+
+	// FileBytes is the size of the flushed file.
+	FileBytes int64
+}
+
+func (r Result) String() string {
+	return fmt.Sprintf("%s: %d ops in %s (%.0f ops/s), populate %s, flush %s, open %s, %d bytes",
+		r.Workload, r.Operations, r.Duration, r.Throughput,
+		r.PopulateDuration, r.FlushDuration, r.OpenDuration, r.FileBytes)
+}
+
+// Populate adds synthetic Documents to ds as described by config. The
+// Collections are named "bench0", "bench1", and so on.
+func Populate(ds *datastore.Datastore, config Config) error {
+	config = config.withDefaults()
+	random := rand.New(rand.NewSource(config.Seed))
+
+	for i := 0; i < config.Collections; i++ {
+		c, err := ds.Init(collectionName(i), &Document{})
+		if err != nil {
+			return err
+		}
+		for n := 0; n < config.Documents; n++ {
+			if err := c.Upsert(newDocument(random, config)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Run creates a Datastore, populates it, runs the workload against it, and
+// then measures Flush and Open.
+func Run(config Config, workload Workload) (Result, error) {
+	config = config.withDefaults()
+	result := Result{Workload: workload.Name}
+
+	path := config.Path
+	if path == "" {
+		dir, err := os.MkdirTemp("", "datastore-bench")
+		if err != nil {
+			return result, err
+		}
+		defer os.RemoveAll(dir)
+		path = filepath.Join(dir, "bench"+datastore.Extension)
+	}
+
+	ds, err := datastore.Create(path, Signature)
+	if err != nil {
+		return result, err
+	}
+
+	start := time.Now()
+	if err := Populate(ds, config); err != nil {
+		return result, err
+	}
+	result.PopulateDuration = time.Since(start)
+
+	start = time.Now()
+	if err := run(ds, config, workload, &result); err != nil {
+		return result, err
+	}
+	result.Duration = time.Since(start)
+	if result.Duration > 0 {
+		result.Throughput = float64(result.Operations) / result.Duration.Seconds()
+	}
+
+	start = time.Now()
+	if err := ds.Flush(); err != nil {
+		return result, err
+	}
+	result.FlushDuration = time.Since(start)
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return result, err
+	}
+	result.FileBytes = info.Size()
+
+	start = time.Now()
+	if _, err := datastore.Open(path, Signature); err != nil {
+		return result, err
+	}
+	result.OpenDuration = time.Since(start)
+	return result, nil
+}
+
+// run performs the workload's operations with config.Workers goroutines.
+func run(ds *datastore.Datastore, config Config, workload Workload, result *Result) error {
+	var mutex sync.Mutex
+	var wg sync.WaitGroup
+	errs := make(chan error, config.Workers)
+
+	for w := 0; w < config.Workers; w++ {
+		operations := config.Operations / config.Workers
+		if w < config.Operations%config.Workers {
+			operations++
+		}
+
+		wg.Add(1)
+		go func(seed int64, operations int) {
+			defer wg.Done()
+			random := rand.New(rand.NewSource(seed))
+			reads, updates, churned := 0, 0, 0
+
+			for i := 0; i < operations; i++ {
+				c := ds.In(collectionName(random.Intn(config.Collections)))
+				keys := c.List()
+				if len(keys) == 0 {
+					continue
+				}
+				key := keys[random.Intn(len(keys))]
+
+				switch roll := random.Float64(); {
+				case roll < workload.Reads:
+					c.FindKey(key)
+					reads++
+				case roll < workload.Reads+workload.Churn:
+					if err := c.Upsert(newDocument(random, config)); err != nil {
+						errs <- err
+						return
+					}
+					if err := c.DeleteKey(key); err != nil {
+						errs <- err
+						return
+					}
+					churned++
+				default:
+					if err := c.Patch(key, map[string]interface{}{"Counter": random.Int()}); err != nil && !errors.Is(err, datastore.ErrKeyNotFound) {
+						errs <- err
+						return
+					}
+					updates++
+				}
+			}
+
+			mutex.Lock()
+			result.Reads += reads
+			result.Updates += updates
+			result.Churned += churned
+			result.Operations += reads + updates + churned
+			mutex.Unlock()
+		}(config.Seed+int64(w)+1, operations)
+	}
+
+	wg.Wait()
+	close(errs)
+	return <-errs
+}
+
+func collectionName(i int) string {
+	return fmt.Sprintf("bench%d", i)
+}
+
+func newDocument(random *rand.Rand, config Config) *Document {
+	document := &Document{
+		Name:    fmt.Sprintf("document-%d", random.Int63()),
+		Counter: random.Int(),
+		Payload: make([]byte, config.PayloadSize),
+	}
+	random.Read(document.Payload)
+	for i := 0; i < config.Tags; i++ {
+		document.Tags = append(document.Tags, fmt.Sprintf("tag%d", random.Intn(100)))
+	}
+	return document
+}
@@ -0,0 +1,47 @@
+package bench_test
+
+import (
+	"testing"
+
+	"git.stormbase.io/cbednarski/datastore"
+	"git.stormbase.io/cbednarski/datastore/bench"
+)
+
+func TestRun(t *testing.T) {
+	config := bench.Config{
+		Collections: 2,
+		Documents:   100,
+		PayloadSize: 64,
+		Tags:        3,
+		Operations:  500,
+		Workers:     4,
+	}
+
+	for _, workload := range []bench.Workload{bench.ReadHeavy, bench.WriteHeavy, bench.Churn} {
+		result, err := bench.Run(config, workload)
+		if err != nil {
+			t.Fatalf("%s: %s", workload.Name, err)
+		}
+		if result.Operations != config.Operations {
+			t.Errorf("%s: Expected %d operations, found %d", workload.Name, config.Operations, result.Operations)
+		}
+		if result.Reads+result.Updates+result.Churned != result.Operations {
+			t.Errorf("%s: Expected operations to add up, found %+v", workload.Name, result)
+		}
+		if result.FileBytes == 0 || result.Throughput == 0 {
+			t.Errorf("%s: Expected file size and throughput, found %s", workload.Name, result)
+		}
+	}
+}
+
+func TestPopulate(t *testing.T) {
+	ds := datastore.New()
+	if err := bench.Populate(ds, bench.Config{Collections: 3, Documents: 10}); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"bench0", "bench1", "bench2"} {
+		if found := len(ds.In(name).List()); found != 10 {
+			t.Errorf("Expected 10 documents in %s, found %d", name, found)
+		}
+	}
+}
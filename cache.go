@@ -0,0 +1,158 @@
+package datastore
+
+import (
+	"container/list"
+	"sync"
+)
+
+// CacheStats describes the cache of decompressed Documents for a compressed
+// Collection. See SetCacheSize.
+type CacheStats struct {
+	// Hits and Misses count the lookups that were and were not found in the
+	// cache since it was enabled.
+	Hits   int64
+	Misses int64
+
+	// Size is the number of Documents in the cache, and Capacity is the most
+	// it will hold.
+	Size     int
+	Capacity int
+}
+
+// SetCacheSize keeps up to size of the most recently used Documents of a
+// compressed Collection in memory, already decompressed, so reading them again
+// is fast. Use zero (the default) to disable the cache. The cache only applies
+// while the Collection is compressed (see SetCompressed) and is not written to
+// disk.
+//
+// Documents returned from the cache are shared between callers, like the
+// Documents in a Collection that is not compressed. Do not modify them without
+// calling Upsert.
+func (c *Collection) SetCacheSize(size int) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if size <= 0 {
+		c.cache = nil
+		return
+	}
+	if c.cache == nil {
+		c.cache = &documentCache{}
+	}
+	c.cache.resize(size)
+}
+
+// CacheStats returns the hit and miss counts and size of the Collection's cache.
+func (c *Collection) CacheStats() CacheStats {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	if c.cache == nil {
+		return CacheStats{}
+	}
+	return c.cache.stats()
+}
+
+// uncache removes a deleted Document from the cache. It must be called while the
+// Collection is locked.
+func (c *Collection) uncache(key uint64) {
+	if c.cache != nil {
+		c.cache.remove(key)
+	}
+}
+
+// documentCache is a least-recently-used cache of decompressed Documents. It
+// has its own mutex because it is updated by readers, which only hold the
+// Collection's read lock.
+type documentCache struct {
+	capacity int
+	entries  map[uint64]*list.Element
+	order    *list.List
+	hits     int64
+	misses   int64
+	mutex    sync.Mutex
+}
+
+type cacheEntry struct {
+	key      uint64
+	document Document
+}
+
+func (dc *documentCache) resize(capacity int) {
+	dc.mutex.Lock()
+	defer dc.mutex.Unlock()
+
+	if dc.entries == nil {
+		dc.entries = map[uint64]*list.Element{}
+		dc.order = list.New()
+	}
+	dc.capacity = capacity
+	dc.evict()
+}
+
+func (dc *documentCache) get(key uint64) (Document, bool) {
+	dc.mutex.Lock()
+	defer dc.mutex.Unlock()
+
+	element, ok := dc.entries[key]
+	if !ok {
+		dc.misses++
+		return nil, false
+	}
+	dc.hits++
+	dc.order.MoveToFront(element)
+	return element.Value.(*cacheEntry).document, true
+}
+
+func (dc *documentCache) put(key uint64, document Document) {
+	dc.mutex.Lock()
+	defer dc.mutex.Unlock()
+
+	if element, ok := dc.entries[key]; ok {
+		element.Value.(*cacheEntry).document = document
+		dc.order.MoveToFront(element)
+		return
+	}
+	dc.entries[key] = dc.order.PushFront(&cacheEntry{key: key, document: document})
+	dc.evict()
+}
+
+func (dc *documentCache) remove(key uint64) {
+	dc.mutex.Lock()
+	defer dc.mutex.Unlock()
+
+	if element, ok := dc.entries[key]; ok {
+		dc.order.Remove(element)
+		delete(dc.entries, key)
+	}
+}
+
+func (dc *documentCache) clear() {
+	dc.mutex.Lock()
+	defer dc.mutex.Unlock()
+
+	dc.entries = map[uint64]*list.Element{}
+	dc.order.Init()
+}
+
+// evict removes the least recently used entries until the cache fits. It must
+// be called while the cache is locked.
+func (dc *documentCache) evict() {
+	for dc.order.Len() > dc.capacity {
+		oldest := dc.order.Back()
+		dc.order.Remove(oldest)
+		delete(dc.entries, oldest.Value.(*cacheEntry).key)
+	}
+}
+
+func (dc *documentCache) stats() CacheStats {
+	dc.mutex.Lock()
+	defer dc.mutex.Unlock()
+
+	return CacheStats{
+		Hits:     dc.hits,
+		Misses:   dc.misses,
+		Size:     dc.order.Len(),
+		Capacity: dc.capacity,
+	}
+}
@@ -0,0 +1,76 @@
+package datastore_test
+
+import (
+	"testing"
+
+	"git.stormbase.io/cbednarski/datastore"
+)
+
+func TestCollection_SetCacheSize(t *testing.T) {
+	logs := datastore.New().In("logs")
+	if err := logs.SetCompressed(true); err != nil {
+		t.Fatal(err)
+	}
+	logs.SetCacheSize(2)
+
+	for _, line := range []string{"one", "two", "three"} {
+		if err := logs.Upsert(&NameDocument{Name: line}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// two and three were cached when they were upserted
+	first := logs.FindKey(3)
+	if logs.FindKey(3) != first {
+		t.Error("Expected the cached document to be returned")
+	}
+	logs.FindKey(1)
+	logs.FindKey(1)
+
+	stats := logs.CacheStats()
+	expected := datastore.CacheStats{Hits: 3, Misses: 1, Size: 2, Capacity: 2}
+	if stats != expected {
+		t.Errorf("Expected %#v, found %#v", expected, stats)
+	}
+
+	// Updates replace the cached document, and deletes remove it
+	if err := logs.Upsert(&NameDocument{Identifier: 1, Name: "uno"}); err != nil {
+		t.Fatal(err)
+	}
+	if name := logs.FindKey(1).(*NameDocument).Name; name != "uno" {
+		t.Errorf("Expected uno, found %s", name)
+	}
+	if err := logs.DeleteKey(1); err != nil {
+		t.Fatal(err)
+	}
+	if logs.FindKey(1) != nil {
+		t.Error("Expected deleted document to be gone")
+	}
+	if size := logs.CacheStats().Size; size != 1 {
+		t.Errorf("Expected 1 cached document, found %d", size)
+	}
+
+	logs.SetCacheSize(0)
+	if stats := logs.CacheStats(); stats != (datastore.CacheStats{}) {
+		t.Errorf("Expected empty stats, found %#v", stats)
+	}
+}
+
+func TestCollection_SetCacheSizeCopies(t *testing.T) {
+	logs := datastore.New().In("logs")
+	if err := logs.SetCompressed(true); err != nil {
+		t.Fatal(err)
+	}
+	logs.SetCacheSize(2)
+
+	retained := &NameDocument{Name: "one"}
+	if err := logs.Upsert(retained); err != nil {
+		t.Fatal(err)
+	}
+
+	// The cache holds a copy, like the compressed Items do
+	retained.Name = "changed"
+	if name := logs.FindKey(retained.ID()).(*NameDocument).Name; name != "one" {
+		t.Errorf("Expected one, found %s", name)
+	}
+}
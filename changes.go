@@ -0,0 +1,178 @@
+package datastore
+
+import (
+	"compress/gzip"
+	"encoding/gob"
+	"io"
+	"sort"
+)
+
+// changesStream is written to the Name field of the gzip header by
+// ChangeSet.WriteTo.
+const changesStream = "datastore:changes"
+
+// Change is a single upsert or delete in a ChangeSet.
+type Change struct {
+	Collection string
+	Key        uint64
+
+	// Document is the Document as of the change, or nil if it was deleted.
+	Document Document
+}
+
+// ChangeSet holds the Documents changed in a Datastore between two
+// generations. See ChangesSince.
+type ChangeSet struct {
+	// Signature is the signature of the Datastore the changes were read from.
+	Signature string
+
+	// Since is the generation the changes were requested from, and Generation
+	// is the generation they are complete up to. Pass Generation to the next
+	// call to ChangesSince.
+	Since      uint64
+	Generation uint64
+
+	// Changes holds the changes, ordered by Collection name and key.
+	Changes []Change
+}
+
+// Generation returns the current generation of the Datastore. The generation
+// increases each time a Document is changed, and is restored by Open.
+func (d *Datastore) Generation() uint64 {
+	return d.generation.Load()
+}
+
+// ChangesSince returns the Documents that were inserted, updated, or deleted
+// after the specified generation, for incremental backups or syncing another
+// Datastore with ApplyChanges. Each Document appears once, as of its latest
+// change. ChangesSince(0) returns every Document.
+//
+// The ChangeSet holds copies of the Documents. Changes made while
+// ChangesSince runs may be included even though they are newer than
+// ChangeSet.Generation; applying them twice is harmless.
+func (d *Datastore) ChangesSince(generation uint64) (*ChangeSet, error) {
+	if err := d.checkOpen(); err != nil {
+		return nil, err
+	}
+
+	changes := &ChangeSet{
+		Signature:  d.signature,
+		Since:      generation,
+		Generation: d.Generation(),
+		Changes:    []Change{},
+	}
+
+	for _, name := range d.CollectionNames() {
+		c := d.In(name)
+		c.mutex.RLock()
+		keys := []uint64{}
+		for key, changed := range c.Generations {
+			if changed > generation {
+				keys = append(keys, key)
+			}
+		}
+		if generation == 0 {
+			// Documents loaded from files written before generations were
+			// recorded have no generation
+			for _, key := range c.index.Keys() {
+				if _, ok := c.Generations[key]; !ok {
+					keys = append(keys, key)
+				}
+			}
+		}
+		sort.Sort(UIntSlice(keys))
+
+		for _, key := range keys {
+			change := Change{Collection: name, Key: key}
+			if document, ok := c.item(key); ok {
+				copied, err := copyDocument(document)
+				if err != nil {
+					c.mutex.RUnlock()
+					return nil, wrapError(err, "changes", c, key)
+				}
+				change.Document = copied
+			}
+			changes.Changes = append(changes.Changes, change)
+		}
+		c.mutex.RUnlock()
+	}
+	return changes, nil
+}
+
+// WriteTo writes the ChangeSet to w as a gzipped Gob stream, and returns the
+// number of bytes written. Read it with Datastore.ApplyChanges.
+func (cs *ChangeSet) WriteTo(w io.Writer) (int64, error) {
+	counter := &countingWriter{writer: w}
+	writer := gzip.NewWriter(counter)
+	writer.Name = changesStream
+	writer.Comment = cs.Signature
+
+	if err := gob.NewEncoder(writer).Encode(cs); err != nil {
+		return counter.count, codecError("write changes", err)
+	}
+	if err := writer.Close(); err != nil {
+		return counter.count, &Error{Op: "write changes", Err: err}
+	}
+	return counter.count, nil
+}
+
+// ApplyChanges reads a ChangeSet written by ChangeSet.WriteTo and applies it
+// to the Datastore: each Document is upserted under its original key, and
+// deleted Documents are removed. The ChangeSet must come from a Datastore with
+// the same signature. Changes are applied in order; if one fails, the changes
+// before it are kept and the error is returned.
+func (d *Datastore) ApplyChanges(r io.Reader) error {
+	if err := d.checkOpen(); err != nil {
+		return err
+	}
+
+	reader, err := gzip.NewReader(r)
+	if err != nil {
+		return &Error{Op: "apply changes", Kind: ErrCorrupt, Err: err}
+	}
+	defer reader.Close()
+	if reader.Name != changesStream {
+		return &Error{Op: "apply changes", Kind: ErrCorrupt, Err: gzip.ErrHeader}
+	}
+	if reader.Comment != d.signature {
+		return &Error{Op: "apply changes", Err: ErrInvalidSignature}
+	}
+
+	changes := &ChangeSet{}
+	if err := gob.NewDecoder(reader).Decode(changes); err != nil {
+		return codecError("apply changes", err)
+	}
+	if _, err := io.Copy(io.Discard, reader); err != nil {
+		return &Error{Op: "apply changes", Kind: ErrCorrupt, Err: err}
+	}
+
+	for _, change := range changes.Changes {
+		c := d.In(change.Collection)
+		if change.Document == nil {
+			if err := c.DeleteKey(change.Key); err != nil {
+				return err
+			}
+			continue
+		}
+		change.Document.SetID(change.Key)
+		if err := c.SetType(change.Document); err != nil {
+			return err
+		}
+		if err := c.Upsert(change.Document); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// changed records that the Document with the specified key was changed in a
+// new generation. It must be called while the Collection is locked.
+func (c *Collection) changed(key uint64) {
+	if c.store == nil {
+		return
+	}
+	if c.Generations == nil {
+		c.Generations = map[uint64]uint64{}
+	}
+	c.Generations[key] = c.store.generation.Add(1)
+}
@@ -0,0 +1,113 @@
+package datastore_test
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"git.stormbase.io/cbednarski/datastore"
+)
+
+func TestDatastore_ChangesSince(t *testing.T) {
+	tempdir, err := ioutil.TempDir("", "datastore")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempdir)
+	primaryPath := filepath.Join(tempdir, "primary"+datastore.Extension)
+
+	primary, err := datastore.Create(primaryPath, TestdataSignature)
+	if err != nil {
+		t.Fatal(err)
+	}
+	backup, err := datastore.Create(filepath.Join(tempdir, "backup"+datastore.Extension), TestdataSignature)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	names := primary.In("names")
+	for _, name := range []string{"alpha", "beta", "gamma"} {
+		if err := names.Upsert(&NameDocument{Name: name}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := primary.In("numbers").Upsert(&NumberDocument{Number: 7}); err != nil {
+		t.Fatal(err)
+	}
+
+	full, err := primary.ChangesSince(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(full.Changes) != 4 || full.Generation != primary.Generation() {
+		t.Errorf("Expected 4 changes up to generation %d, found %d up to %d", primary.Generation(), len(full.Changes), full.Generation)
+	}
+	buf := &bytes.Buffer{}
+	if _, err := full.WriteTo(buf); err != nil {
+		t.Fatal(err)
+	}
+	if err := backup.ApplyChanges(buf); err != nil {
+		t.Fatal(err)
+	}
+	if len(backup.In("names").List()) != 3 || len(backup.In("numbers").List()) != 1 {
+		t.Errorf("Expected the full change set to be applied, found %v", backup.CollectionNames())
+	}
+
+	// Only later changes are included in the next change set
+	if err := names.Patch(2, map[string]interface{}{"Name": "beta2"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := names.DeleteKey(3); err != nil {
+		t.Fatal(err)
+	}
+	delta, err := primary.ChangesSince(full.Generation)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(delta.Changes) != 2 || delta.Changes[0].Key != 2 || delta.Changes[1].Document != nil {
+		t.Fatalf("Expected an update and a delete, found %+v", delta.Changes)
+	}
+	buf.Reset()
+	if _, err := delta.WriteTo(buf); err != nil {
+		t.Fatal(err)
+	}
+	if err := backup.ApplyChanges(buf); err != nil {
+		t.Fatal(err)
+	}
+	if name := backup.In("names").FindKey(2).(*NameDocument).Name; name != "beta2" {
+		t.Errorf("Expected %s, found %s", "beta2", name)
+	}
+	if backup.In("names").FindKey(3) != nil {
+		t.Error("Expected key 3 to be deleted")
+	}
+
+	// The generation is restored by Open
+	if err := primary.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	reopened, err := datastore.Open(primaryPath, TestdataSignature)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reopened.Generation() != primary.Generation() {
+		t.Errorf("Expected generation %d, found %d", primary.Generation(), reopened.Generation())
+	}
+	if empty, err := reopened.ChangesSince(delta.Generation); err != nil || len(empty.Changes) != 0 {
+		t.Errorf("Expected no changes, found %v %v", empty, err)
+	}
+
+	other, err := datastore.Create(filepath.Join(tempdir, "other"+datastore.Extension), "other.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf.Reset()
+	if _, err := delta.WriteTo(buf); err != nil {
+		t.Fatal(err)
+	}
+	if err := other.ApplyChanges(buf); !errors.Is(err, datastore.ErrInvalidSignature) {
+		t.Errorf("Expected %s, found %v", datastore.ErrInvalidSignature, err)
+	}
+}
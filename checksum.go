@@ -0,0 +1,146 @@
+package datastore
+
+import (
+	"encoding/json"
+	"fmt"
+	"hash/crc32"
+	"sort"
+)
+
+// ChecksumError lists the keys of the Documents in a Collection that no longer
+// match the checksum recorded when they were last changed through the
+// Collection. See SetChecksums.
+type ChecksumError struct {
+	Collection string
+	Keys       []uint64
+}
+
+func (e *ChecksumError) Error() string {
+	return fmt.Sprintf("checksum mismatch in collection %q for keys %v", e.Collection, e.Keys)
+}
+
+// SetChecksums enables (or disables) checksums for the Documents in the
+// Collection. A checksum is recorded each time a Document is changed through
+// the Collection, and checked by VerifyChecksums. A Document that was modified
+// without calling Upsert (for example, through a pointer shared with other
+// code) or that has been corrupted will fail verification.
+//
+// Checksums are verified automatically before each Flush and after Open, and
+// failures are reported to subscribers as an EventCorruption with a
+// *ChecksumError. Failures do not prevent the Flush.
+//
+// The checksum is computed from the fields of the Document that Flush writes,
+// including fields hidden from JSON. The setting and the checksums are written
+// to disk. Checksums written by older versions were computed from JSON; they are
+// still verified that way until SetChecksums is called again.
+func (c *Collection) SetChecksums(enabled bool) error {
+	if err := c.checkOpen(); err != nil {
+		return err
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if !enabled {
+		c.Checksummed = false
+		c.Checksums = nil
+		c.ChecksumEncoding = ""
+		c.markDirty(1)
+		return nil
+	}
+
+	checksums := make(map[uint64]uint32, len(c.Items))
+	for _, key := range c.index.Keys() {
+		document, _ := c.item(key)
+		sum, err := documentChecksum(document, checksumGob)
+		if err != nil {
+			return err
+		}
+		checksums[key] = sum
+	}
+
+	c.Checksummed = true
+	c.Checksums = checksums
+	c.ChecksumEncoding = checksumGob
+	c.markDirty(1)
+	return nil
+}
+
+// VerifyChecksums compares each Document in the Collection to its recorded
+// checksum, and returns a *ChecksumError listing the keys that do not match.
+// Returns nil if every Document matches, or if checksums are not enabled.
+func (c *Collection) VerifyChecksums() error {
+	if err := c.checkOpen(); err != nil {
+		return err
+	}
+	return c.verifyChecksums()
+}
+
+func (c *Collection) verifyChecksums() error {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	if !c.Checksummed {
+		return nil
+	}
+
+	mismatched := []uint64{}
+	for _, key := range c.index.Keys() {
+		document, _ := c.item(key)
+		sum, err := documentChecksum(document, c.ChecksumEncoding)
+		if expected, ok := c.Checksums[key]; err != nil || !ok || sum != expected {
+			mismatched = append(mismatched, key)
+		}
+	}
+
+	if len(mismatched) == 0 {
+		return nil
+	}
+	sort.Sort(UIntSlice(mismatched))
+	return &ChecksumError{Collection: c.name, Keys: mismatched}
+}
+
+// verifyChecksums verifies every Collection in the Datastore and sends an
+// EventCorruption for each one that fails.
+func (d *Datastore) verifyChecksums() {
+	for _, c := range d.collections() {
+		if err := c.verifyChecksums(); err != nil {
+			d.emit(Event{Type: EventCorruption, Collection: c.name, Err: err})
+		}
+	}
+}
+
+// recordChecksum records the checksum for a Document, if checksums are enabled.
+// It must be called while the Collection is locked.
+func (c *Collection) recordChecksum(key uint64, document Document) error {
+	if !c.Checksummed {
+		return nil
+	}
+	sum, err := documentChecksum(document, c.ChecksumEncoding)
+	if err != nil {
+		return err
+	}
+	if c.Checksums == nil {
+		c.Checksums = map[uint64]uint32{}
+	}
+	c.Checksums[key] = sum
+	return nil
+}
+
+// checksumGob is the ChecksumEncoding of checksums computed by stableEncoding.
+const checksumGob = "gob"
+
+// documentChecksum returns a CRC-32 of the encoding of a Document named by
+// encoding. An empty encoding means JSON, for checksums from older versions.
+func documentChecksum(document Document, encoding string) (uint32, error) {
+	var data []byte
+	var err error
+	if encoding == "" {
+		data, err = json.Marshal(document)
+	} else {
+		data, err = stableEncoding(document)
+	}
+	if err != nil {
+		return 0, codecError("checksum", err)
+	}
+	return crc32.ChecksumIEEE(data), nil
+}
@@ -0,0 +1,158 @@
+package datastore_test
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"git.stormbase.io/cbednarski/datastore"
+)
+
+func TestCollection_SetChecksums(t *testing.T) {
+	tempdir, err := ioutil.TempDir("", "datastore")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempdir)
+	datapath := filepath.Join(tempdir, "checksums"+datastore.Extension)
+
+	ds, err := datastore.Create(datapath, TestdataSignature)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var corrupted []error
+	ds.Subscribe(func(event datastore.Event) {
+		if event.Type == datastore.EventCorruption {
+			corrupted = append(corrupted, event.Err)
+		}
+	})
+
+	pets := ds.In("pets")
+	chomper := &NameDocument{Name: "Chomper"}
+	mittens := &NameDocument{Name: "Mittens"}
+	for _, pet := range []*NameDocument{chomper, mittens} {
+		if err := pets.Upsert(pet); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := pets.SetChecksums(true); err != nil {
+		t.Fatal(err)
+	}
+	if err := pets.VerifyChecksums(); err != nil {
+		t.Errorf("Expected no error, found %s", err)
+	}
+
+	// Changes through the API update the checksum
+	if err := pets.Patch(chomper.ID(), map[string]interface{}{"Name": "Chomper II"}); err != nil {
+		t.Fatal(err)
+	}
+	// Changes made through an aliased pointer do not
+	mittens.Name = "Whiskers"
+
+	err = pets.VerifyChecksums()
+	checksumErr, ok := err.(*datastore.ChecksumError)
+	if !ok {
+		t.Fatalf("Expected *ChecksumError, found %#v", err)
+	}
+	if !reflect.DeepEqual(checksumErr.Keys, []uint64{mittens.ID()}) {
+		t.Errorf("Expected %v, found %v", []uint64{mittens.ID()}, checksumErr.Keys)
+	}
+
+	if err := ds.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if len(corrupted) != 1 || corrupted[0].Error() != checksumErr.Error() {
+		t.Errorf("Expected corruption event, found %v", corrupted)
+	}
+
+	if err := pets.Upsert(mittens); err != nil {
+		t.Fatal(err)
+	}
+	if err := pets.VerifyChecksums(); err != nil {
+		t.Errorf("Expected no error after Upsert, found %s", err)
+	}
+
+	if err := ds.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	ds2, err := datastore.Open(datapath, TestdataSignature)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ds2.In("pets").VerifyChecksums(); err != nil {
+		t.Errorf("Expected no error after Open, found %s", err)
+	}
+	if !ds2.In("pets").Checksummed {
+		t.Error("Expected checksums to be enabled after Open")
+	}
+}
+
+func TestCollection_SetChecksumsHiddenField(t *testing.T) {
+	ds := datastore.New()
+	tokens := ds.In("tokens")
+	if err := tokens.SetChecksums(true); err != nil {
+		t.Fatal(err)
+	}
+	rich := &RichDocument{Labels: map[string]int{"a": 1, "b": 2, "c": 3, "d": 4, "e": 5}}
+	if err := ds.In("rich").SetChecksums(true); err != nil {
+		t.Fatal(err)
+	}
+	if err := ds.In("rich").Upsert(rich); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 10; i++ {
+		if err := ds.In("rich").VerifyChecksums(); err != nil {
+			t.Fatalf("Expected maps to be checksummed in a stable order, found %s", err)
+		}
+	}
+
+	token := &TokenDocument{Name: "bob", Token: "old"}
+	if err := tokens.Upsert(token); err != nil {
+		t.Fatal(err)
+	}
+	token.Token = "new"
+	var checksumErr *datastore.ChecksumError
+	if err := tokens.VerifyChecksums(); !errors.As(err, &checksumErr) {
+		t.Errorf("Expected the hidden field change to fail verification, found %v", err)
+	}
+}
+
+func TestCollection_SetChecksumsLegacy(t *testing.T) {
+	datapath := filepath.Join(t.TempDir(), "legacy"+datastore.Extension)
+	ds, err := datastore.Create(datapath, TestdataSignature)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Simulate a file written before checksums were computed from Gob
+	pets := ds.In("pets")
+	pets.Checksummed = true
+	if err := pets.Upsert(&NameDocument{Name: "mittens"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := ds.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	ds2, err := datastore.Open(datapath, TestdataSignature)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pets = ds2.In("pets")
+	if err := pets.VerifyChecksums(); err != nil {
+		t.Errorf("Expected JSON checksums to verify after Open, found %s", err)
+	}
+	if err := pets.SetChecksums(true); err != nil {
+		t.Fatal(err)
+	}
+	if pets.ChecksumEncoding == "" {
+		t.Error("Expected SetChecksums to switch to the Gob encoding")
+	}
+	if err := pets.VerifyChecksums(); err != nil {
+		t.Errorf("Expected no error after SetChecksums, found %s", err)
+	}
+}
@@ -0,0 +1,35 @@
+package datastore
+
+import "time"
+
+// SetClock replaces the function the Datastore uses to tell the time, which is
+// time.Now by default. The clock is used for the times recorded by history, the
+// trash, and the audit log, for event times, for the modification time in the
+// gzip header, and for retention in a TimeSeries. This lets you test
+// time-dependent behavior without waiting. Pass nil to go back to time.Now.
+//
+// The delay used by FlushSoon and the Duration in FlushStats are not affected.
+func (d *Datastore) SetClock(now func() time.Time) {
+	if now == nil {
+		d.clock.Store(nil)
+		return
+	}
+	d.clock.Store(&now)
+}
+
+// now returns the current time from the Datastore's clock. It may be called
+// while a Collection is locked.
+func (d *Datastore) now() time.Time {
+	if now := d.clock.Load(); now != nil {
+		return (*now)()
+	}
+	return time.Now()
+}
+
+// now returns the current time from the Collection's Datastore.
+func (c *Collection) now() time.Time {
+	if c.store == nil {
+		return time.Now()
+	}
+	return c.store.now()
+}
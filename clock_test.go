@@ -0,0 +1,59 @@
+package datastore_test
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"git.stormbase.io/cbednarski/datastore"
+)
+
+func TestSetClock(t *testing.T) {
+	ds, err := datastore.Create(filepath.Join(t.TempDir(), "clock"+datastore.Extension), TestdataSignature)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	ds.SetClock(func() time.Time { return now })
+
+	var events []datastore.Event
+	ds.Subscribe(func(event datastore.Event) {
+		events = append(events, event)
+	})
+
+	pets := ds.In("pets")
+	if err := pets.SetHistory(1); err != nil {
+		t.Fatal(err)
+	}
+	pet := &NameDocument{Name: "Chomper"}
+	if err := pets.Upsert(pet); err != nil {
+		t.Fatal(err)
+	}
+
+	history, err := pets.History(pet.ID())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !history[0].Time.Equal(now) {
+		t.Errorf("Expected %s, found %s", now, history[0].Time)
+	}
+
+	if err := pets.SoftDelete(pet); err != nil {
+		t.Fatal(err)
+	}
+	now = now.Add(time.Hour)
+	if purged, err := pets.PurgeTrash(2 * time.Hour); err != nil || purged != 0 {
+		t.Errorf("Expected nothing purged after an hour, found %d (%v)", purged, err)
+	}
+	now = now.Add(time.Hour)
+	if purged, err := pets.PurgeTrash(2 * time.Hour); err != nil || purged != 1 {
+		t.Errorf("Expected 1 purged after two hours, found %d (%v)", purged, err)
+	}
+
+	if err := ds.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if len(events) == 0 || !events[0].Time.Equal(now) {
+		t.Errorf("Expected event at %s, found %#v", now, events)
+	}
+}
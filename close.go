@@ -0,0 +1,68 @@
+package datastore
+
+import "context"
+
+// Close flushes any pending changes to disk and closes the Datastore. After
+// Close, every Datastore and Collection method that returns an error fails with
+// ErrClosed, including Flush. Methods that do not return an error (like FindKey)
+// continue to return the Documents that were in memory when it was closed.
+//
+// If the final Flush fails, the Datastore remains open and Close returns the
+// error so you can try again. Closing a Datastore twice returns ErrClosed.
+func (d *Datastore) Close() error {
+	return d.CloseContext(context.Background())
+}
+
+// CloseContext behaves like Close, but gives up on the final Flush when ctx is
+// done (see FlushContext). The Datastore remains open if it gives up.
+func (d *Datastore) CloseContext(ctx context.Context) error {
+	d.mutex.Lock()
+	if d.closed.Load() {
+		d.mutex.Unlock()
+		return ErrClosed
+	}
+	if d.flushTimer != nil {
+		d.flushTimer.Stop()
+		d.flushTimer = nil
+	}
+	// Set closed before the final Flush so no changes can be made after the
+	// snapshot is taken.
+	d.closed.Store(true)
+	d.mutex.Unlock()
+
+	if d.path != "" && d.Dirty() {
+		if _, err := d.flushStats(ctx); err != nil {
+			d.closed.Store(false)
+			return err
+		}
+	}
+
+	d.mutex.Lock()
+	d.stopWatchdog()
+	d.mutex.Unlock()
+
+	d.emit(Event{Type: EventClose})
+	d.detachPlugins()
+	return nil
+}
+
+// Closed returns true if Close has been called.
+func (d *Datastore) Closed() bool {
+	return d.closed.Load()
+}
+
+// checkOpen returns ErrClosed if the Datastore has been closed.
+func (d *Datastore) checkOpen() error {
+	if d.closed.Load() {
+		return ErrClosed
+	}
+	return nil
+}
+
+// checkOpen returns ErrClosed if the Collection's Datastore has been closed.
+func (c *Collection) checkOpen() error {
+	if c.store == nil {
+		return nil
+	}
+	return c.store.checkOpen()
+}
@@ -0,0 +1,116 @@
+package datastore_test
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"git.stormbase.io/cbednarski/datastore"
+)
+
+func TestClose(t *testing.T) {
+	tempdir, err := ioutil.TempDir("", "datastore")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempdir)
+	datapath := filepath.Join(tempdir, "close"+datastore.Extension)
+
+	ds, err := datastore.Create(datapath, TestdataSignature)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	closed := false
+	ds.Subscribe(func(event datastore.Event) {
+		if event.Type == datastore.EventClose {
+			closed = true
+		}
+	})
+
+	pets := ds.In("pets")
+	pet := &NameDocument{Name: "Chomper"}
+	if err := pets.Upsert(pet); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ds.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if !ds.Closed() || !closed {
+		t.Error("Expected datastore to be closed")
+	}
+
+	if err := pets.Upsert(&NameDocument{Name: "Mittens"}); !errors.Is(err, datastore.ErrClosed) {
+		t.Errorf("Expected %s, found %s", datastore.ErrClosed, err)
+	}
+	if err := pets.Delete(pet); !errors.Is(err, datastore.ErrClosed) {
+		t.Errorf("Expected %s, found %s", datastore.ErrClosed, err)
+	}
+	if err := ds.Flush(); !errors.Is(err, datastore.ErrClosed) {
+		t.Errorf("Expected %s, found %s", datastore.ErrClosed, err)
+	}
+	if _, err := ds.Init("people", &NameDocument{}); !errors.Is(err, datastore.ErrClosed) {
+		t.Errorf("Expected %s, found %s", datastore.ErrClosed, err)
+	}
+	if err := ds.Close(); !errors.Is(err, datastore.ErrClosed) {
+		t.Errorf("Expected %s, found %s", datastore.ErrClosed, err)
+	}
+
+	// Pending changes were flushed by Close
+	ds2, err := datastore.Open(datapath, TestdataSignature)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ds2.In("pets").List()) != 1 {
+		t.Errorf("Expected 1 pet after Close, found %d", len(ds2.In("pets").List()))
+	}
+}
+
+func TestCloseContext(t *testing.T) {
+	tempdir, err := ioutil.TempDir("", "datastore")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempdir)
+	datapath := filepath.Join(tempdir, "close"+datastore.Extension)
+
+	ds, err := datastore.Create(datapath, TestdataSignature)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ds.In("names").Upsert(&NameDocument{Name: "pending"}); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := ds.FlushContext(ctx); !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected %s, found %v", context.Canceled, err)
+	}
+	if err := ds.CloseContext(ctx); !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected %s, found %v", context.Canceled, err)
+	}
+	if ds.Closed() || !ds.Dirty() {
+		t.Error("Expected datastore to stay open with pending changes")
+	}
+
+	// The file on disk is unchanged
+	reopened, err := datastore.Open(datapath, TestdataSignature)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(reopened.In("names").List()) != 0 {
+		t.Errorf("Expected no documents on disk, found %d", len(reopened.In("names").List()))
+	}
+
+	ctx, cancel = context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	if err := ds.CloseContext(ctx); err != nil {
+		t.Fatal(err)
+	}
+}
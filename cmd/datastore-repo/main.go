@@ -0,0 +1,243 @@
+// Command datastore-repo generates a typed repository for a Document type, so
+// you don't have to write type assertions around every Collection call.
+//
+// Add a go:generate comment beside the type and run go generate:
+//
+//	//go:generate datastore-repo -type Pet -collection pets
+//	type Pet struct {
+//		Identifier uint64
+//		Name       string
+//	}
+//
+// This writes pet_repo.go, which registers Pet with gob and declares PetRepo
+// with Get, Upsert, Delete, FindAll, FindOne, and a FindBy method for each
+// exported field with a basic type (for example FindByName). The type must
+// already implement datastore.Document with pointer receivers.
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+	"unicode"
+)
+
+func main() {
+	typeName := flag.String("type", "", "name of the Document type (required)")
+	collection := flag.String("collection", "", "name of the Collection (defaults to the lowercase type name)")
+	output := flag.String("output", "", "file to write (defaults to <type>_repo.go)")
+	dir := flag.String("dir", ".", "directory containing the package")
+	flag.Parse()
+
+	if *typeName == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+	if *collection == "" {
+		*collection = strings.ToLower(*typeName)
+	}
+	if *output == "" {
+		*output = filepath.Join(*dir, strings.ToLower(*typeName)+"_repo.go")
+	}
+
+	source, err := generateDir(*dir, *typeName, *collection)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "datastore-repo:", err)
+		os.Exit(1)
+	}
+	if err := os.WriteFile(*output, source, 0644); err != nil {
+		fmt.Fprintln(os.Stderr, "datastore-repo:", err)
+		os.Exit(1)
+	}
+}
+
+// field is an exported struct field that gets a FindBy method.
+type field struct {
+	Name string
+	Type string
+}
+
+// repo holds the values used by the template.
+type repo struct {
+	Package    string
+	Type       string
+	Collection string
+	Fields     []field
+}
+
+// basicTypes are the field types that get a FindBy method.
+var basicTypes = map[string]bool{
+	"bool": true, "string": true,
+	"int": true, "int8": true, "int16": true, "int32": true, "int64": true,
+	"uint": true, "uint8": true, "uint16": true, "uint32": true, "uint64": true,
+	"float32": true, "float64": true, "byte": true, "rune": true,
+}
+
+// generateDir parses the Go files in dir (excluding tests and generated
+// repositories) and generates a repository for the named type.
+func generateDir(dir, typeName, collection string) ([]byte, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.go"))
+	if err != nil {
+		return nil, err
+	}
+
+	fset := token.NewFileSet()
+	files := []*ast.File{}
+	for _, path := range paths {
+		if strings.HasSuffix(path, "_test.go") || strings.HasSuffix(path, "_repo.go") {
+			continue
+		}
+		file, err := parser.ParseFile(fset, path, nil, 0)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, file)
+	}
+	return generate(files, typeName, collection)
+}
+
+// generate finds the named struct type in the files and renders its repository.
+func generate(files []*ast.File, typeName, collection string) ([]byte, error) {
+	for _, file := range files {
+		for _, decl := range file.Decls {
+			gen, ok := decl.(*ast.GenDecl)
+			if !ok || gen.Tok != token.TYPE {
+				continue
+			}
+			for _, spec := range gen.Specs {
+				typeSpec := spec.(*ast.TypeSpec)
+				if typeSpec.Name.Name != typeName {
+					continue
+				}
+				structType, ok := typeSpec.Type.(*ast.StructType)
+				if !ok {
+					return nil, fmt.Errorf("%s is not a struct", typeName)
+				}
+				return render(repo{
+					Package:    file.Name.Name,
+					Type:       typeName,
+					Collection: collection,
+					Fields:     findableFields(structType),
+				})
+			}
+		}
+	}
+	return nil, fmt.Errorf("type %s not found", typeName)
+}
+
+// findableFields returns the exported fields of the struct with basic types.
+func findableFields(structType *ast.StructType) []field {
+	fields := []field{}
+	for _, f := range structType.Fields.List {
+		ident, ok := f.Type.(*ast.Ident)
+		if !ok || !basicTypes[ident.Name] {
+			continue
+		}
+		for _, name := range f.Names {
+			if unicode.IsUpper([]rune(name.Name)[0]) {
+				fields = append(fields, field{Name: name.Name, Type: ident.Name})
+			}
+		}
+	}
+	return fields
+}
+
+func render(r repo) ([]byte, error) {
+	if r.Package == "" {
+		return nil, errors.New("package name not found")
+	}
+
+	source := &bytes.Buffer{}
+	if err := repoTemplate.Execute(source, r); err != nil {
+		return nil, err
+	}
+	return format.Source(source.Bytes())
+}
+
+var repoTemplate = template.Must(template.New("repo").Parse(`// Code generated by datastore-repo. DO NOT EDIT.
+
+package {{.Package}}
+
+import (
+	"encoding/gob"
+
+	"git.stormbase.io/cbednarski/datastore"
+)
+
+func init() {
+	gob.Register(&{{.Type}}{})
+}
+
+// {{.Type}}Repo stores {{.Type}} Documents in the "{{.Collection}}" Collection.
+type {{.Type}}Repo struct {
+	collection *datastore.Collection
+}
+
+// New{{.Type}}Repo returns a {{.Type}}Repo for the Datastore.
+func New{{.Type}}Repo(ds *datastore.Datastore) (*{{.Type}}Repo, error) {
+	collection, err := ds.Init("{{.Collection}}", &{{.Type}}{})
+	if err != nil {
+		return nil, err
+	}
+	return &{{.Type}}Repo{collection: collection}, nil
+}
+
+// Collection returns the underlying Collection.
+func (r *{{.Type}}Repo) Collection() *datastore.Collection {
+	return r.collection
+}
+
+// Get returns the {{.Type}} with the specified key, or datastore.ErrKeyNotFound.
+func (r *{{.Type}}Repo) Get(id uint64) (*{{.Type}}, error) {
+	document, ok := r.collection.FindKey(id).(*{{.Type}})
+	if !ok {
+		return nil, datastore.ErrKeyNotFound
+	}
+	return document, nil
+}
+
+// Upsert inserts or updates the {{.Type}}.
+func (r *{{.Type}}Repo) Upsert(document *{{.Type}}) error {
+	return r.collection.Upsert(document)
+}
+
+// Delete removes the {{.Type}}.
+func (r *{{.Type}}Repo) Delete(document *{{.Type}}) error {
+	return r.collection.Delete(document)
+}
+
+// FindAll returns every {{.Type}} that satisfies the finder, in ascending order.
+func (r *{{.Type}}Repo) FindAll(finder func(*{{.Type}}) bool) []*{{.Type}} {
+	found := []*{{.Type}}{}
+	for _, document := range r.collection.FindAll(func(document datastore.Document) bool {
+		return finder(document.(*{{.Type}}))
+	}) {
+		found = append(found, document.(*{{.Type}}))
+	}
+	return found
+}
+
+// FindOne returns the first {{.Type}} that satisfies the finder, or nil.
+func (r *{{.Type}}Repo) FindOne(finder func(*{{.Type}}) bool) *{{.Type}} {
+	document, _ := r.collection.FindOne(func(document datastore.Document) bool {
+		return finder(document.(*{{.Type}}))
+	}).(*{{.Type}})
+	return document
+}
+{{range .Fields}}
+// FindBy{{.Name}} returns every {{$.Type}} whose {{.Name}} is equal to value.
+func (r *{{$.Type}}Repo) FindBy{{.Name}}(value {{.Type}}) []*{{$.Type}} {
+	return r.FindAll(func(document *{{$.Type}}) bool {
+		return document.{{.Name}} == value
+	})
+}
+{{end}}`))
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"strings"
+	"testing"
+)
+
+const petSource = `package pets
+
+type Pet struct {
+	Identifier uint64
+	Name       string
+	Age, Legs  int
+	Tags       []string
+	secret     string
+}
+`
+
+func TestGenerate(t *testing.T) {
+	file, err := parser.ParseFile(token.NewFileSet(), "pet.go", petSource, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	source, err := generate([]*ast.File{file}, "Pet", "pets")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The generated code must parse
+	if _, err := parser.ParseFile(token.NewFileSet(), "pet_repo.go", source, 0); err != nil {
+		t.Fatalf("%s\n%s", err, source)
+	}
+
+	for _, expected := range []string{
+		"package pets",
+		"gob.Register(&Pet{})",
+		`ds.Init("pets", &Pet{})`,
+		"func (r *PetRepo) Get(id uint64) (*Pet, error)",
+		"func (r *PetRepo) FindByName(value string) []*Pet",
+		"func (r *PetRepo) FindByLegs(value int) []*Pet",
+	} {
+		if !strings.Contains(string(source), expected) {
+			t.Errorf("Expected generated code to contain %q", expected)
+		}
+	}
+	for _, unexpected := range []string{"FindByTags", "FindBysecret"} {
+		if strings.Contains(string(source), unexpected) {
+			t.Errorf("Expected generated code not to contain %q", unexpected)
+		}
+	}
+
+	if _, err := generate([]*ast.File{file}, "Cat", "cats"); err == nil {
+		t.Error("Expected error for missing type")
+	}
+}
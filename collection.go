@@ -1,9 +1,12 @@
 package datastore
 
 import (
+	"crypto/sha256"
+	"math"
+	"math/rand"
 	"reflect"
-	"sort"
 	"sync"
+	"sync/atomic"
 )
 
 // Collection is a RWMutex-managed map containing a type that embeds Document.
@@ -20,11 +23,129 @@ type Collection struct {
 	// CurrentIndex holds the autoincrement value for this Collection. DO NOT MODIFY.
 	CurrentIndex uint64
 
-	list  []uint64
+	// SchemaVersion is the version of the Documents in this Collection. It is
+	// changed by the upgrades registered with RegisterUpgrade. DO NOT MODIFY.
+	SchemaVersion int
+
+	// HistoryLimit is the number of versions kept for each Document. Zero
+	// disables history. DO NOT MODIFY. Use SetHistory instead.
+	HistoryLimit int
+
+	// Versions holds the version history for each Document. DO NOT MODIFY.
+	Versions map[uint64][]Version
+
+	// Trash holds Documents that have been soft deleted. DO NOT MODIFY.
+	Trash map[uint64]TrashItem
+
+	// Compressed indicates each Document in Items is compressed separately.
+	// DO NOT MODIFY. Use SetCompressed instead.
+	Compressed bool
+
+	// Checksummed indicates a checksum is recorded for each Document in
+	// Checksums, and ChecksumEncoding names the encoding they were computed
+	// from (empty for JSON, used by older versions). DO NOT MODIFY. Use
+	// SetChecksums instead.
+	Checksummed      bool
+	Checksums        map[uint64]uint32
+	ChecksumEncoding string
+
+	// Schema holds the type of each field of the Documents in this
+	// Collection, as of the last Flush. DO NOT MODIFY. See VerifySchema.
+	Schema map[string]string
+
+	// Replica names this copy of the Collection, and Clocks holds the
+	// VersionVector of each Document, including deleted ones. DO NOT MODIFY.
+	// Use SetReplica instead.
+	Replica string
+	Clocks  map[uint64]VersionVector
+
+	// Generations holds the generation each Document was last changed in,
+	// including deleted ones. DO NOT MODIFY. See ChangesSince.
+	Generations map[uint64]uint64
+
+	// Signature identifies the code that owns the Collection. DO NOT MODIFY.
+	// See InitSigned.
+	Signature string
+
+	// name and store are set when the Collection is created or loaded by a
+	// Datastore
+	name  string
+	store *Datastore
+
+	// lockFree makes the read methods use reads, an immutable copy of Items
+	// and index that is dropped on each change. See SetLockFreeReads.
+	lockFree atomic.Bool
+	reads    atomic.Pointer[readSnapshot]
+
+	// frozen is set while a snapshot shares the public maps, so they must be
+	// copied before they are changed. See snapshot and thaw.
+	frozen atomic.Bool
+
+	// index holds the keys of the Documents in ascending order, and
+	// newIndex creates it. See SetKeyIndex.
+	index    KeyIndex
+	newIndex func() KeyIndex
+
 	mutex sync.RWMutex
+
+	// actor is attributed with changes in the audit log. It is set while the
+	// Collection is locked.
+	actor string
+
+	// readOnly causes changes to the Collection to fail with ErrReadOnly
+	readOnly bool
+
+	// redact holds the names of fields that are replaced when exporting
+	redact map[string]bool
+
+	// views are updated whenever a Document is upserted or deleted
+	views []*View
+
+	// queries holds the queries registered with DefineQuery, by name
+	queries map[string]*query
+
+	// maxDocumentSize is the largest encoded Document Upsert accepts. See
+	// SetMaxDocumentSize.
+	maxDocumentSize int
+
+	// quota limits the size of the Collection, and sizes holds the encoded
+	// size of each Document while quota.MaxBytes or sizeTracking is set. See
+	// SetQuota and SetSizeTracking.
+	quota        Quota
+	sizeTracking bool
+	sizes        map[uint64]int
+	totalSize    int64
+
+	// encoded holds the encoding of each Document as of its last change,
+	// while alias detection is enabled. See SetAliasDetection.
+	encoded map[uint64][]byte
+
+	// fingerprints holds a hash of each Document as of its last change, while
+	// SetSkipUnchanged is enabled.
+	fingerprints map[uint64][sha256.Size]byte
+
+	// derivers compute fields of each Document before it is stored. See
+	// Derive.
+	derivers []func(Document)
+
+	// idGenerator chooses keys for new Documents. See SetIDGenerator.
+	idGenerator IDGenerator
+
+	// cache holds recently used Documents from a compressed Collection. See
+	// SetCacheSize.
+	cache *documentCache
 }
 
+// SetType sets the type of Documents stored in the Collection, or returns
+// ErrInvalidType if the Collection already holds a different type.
 func (c *Collection) SetType(document Document) error {
+	if err := c.checkOpen(); err != nil {
+		return wrapError(err, "set type", c, 0)
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
 	kind := reflect.TypeOf(document).String()
 	switch c.Type {
 	case "": // Type isn't set yet, so set it to the current type
@@ -34,45 +155,228 @@ func (c *Collection) SetType(document Document) error {
 		return nil
 	// Type is set to something different, return an error
 	default:
-		return ErrInvalidType
+		return wrapError(ErrInvalidType, "set type", c, document.ID())
 	}
 }
 
-// Upsert inserts or updates a Document in the collection.
+// SetReadOnly prevents (or allows) changes to the Collection. While the
+// Collection is read-only, Upsert, Delete, and every other method that changes
+// the Collection fails with ErrReadOnly. This is useful for reference data that
+// ships with your program. The read-only flag is not written to disk.
+func (c *Collection) SetReadOnly(readOnly bool) {
+	c.mutex.Lock()
+	c.readOnly = readOnly
+	c.mutex.Unlock()
+}
+
+// ReadOnly returns true if the Collection is read-only. See SetReadOnly.
+func (c *Collection) ReadOnly() bool {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	return c.readOnly
+}
+
+// Upsert inserts or updates a Document in the collection. A Document instance
+// may only be stored in one Collection at a time, since each Collection assigns
+// its own ID. Upserting an instance that is stored in another Collection fails
+// with ErrDocumentInOtherCollection.
 func (c *Collection) Upsert(document Document) error {
+	_, err := c.UpsertReturning(document)
+	return err
+}
+
+// UpsertReturning inserts or updates a Document in the collection and returns
+// the Document that was previously stored under the same key, or nil if the
+// Document is new. This is useful for change detection and cache invalidation.
+//
+// Note that if you modify a Document you retrieved from the Collection and
+// upsert it again, previous will be the same pointer as the Document you
+// passed in, since the Collection stores the pointer rather than a copy.
+func (c *Collection) UpsertReturning(document Document) (previous Document, err error) {
+	if err := c.SetType(document); err != nil {
+		return nil, err
+	}
+
+	err = c.mutate(Operation{Op: OpUpsert, Key: document.ID(), Document: document}, func() (err error) {
+		previous, err = c.upsert(OpUpsert, document)
+		return err
+	})
+	return previous, err
+}
+
+// UpsertMerge inserts or updates a Document in the collection. If a Document
+// is already stored under the same key, merge is called with the existing and
+// incoming Documents and the Document it returns is stored instead. This allows
+// you to implement conflict resolution strategies other than last-writer-wins,
+// such as merging individual fields. merge is called while the Collection is
+// locked, so it must not call methods on the Collection.
+func (c *Collection) UpsertMerge(document Document, merge func(existing, incoming Document) Document) error {
 	if err := c.SetType(document); err != nil {
 		return err
 	}
 
-	c.mutex.Lock()
+	return c.mutate(Operation{Op: OpUpsert, Key: document.ID(), Document: document}, func() error {
+		if existing, ok := c.item(document.ID()); ok && document.ID() != 0 {
+			merged := merge(existing, document)
+			if merged == nil || reflect.TypeOf(merged).String() != c.Type {
+				return ErrInvalidType
+			}
+			merged.SetID(document.ID())
+			document = merged
+		}
 
-	if document.ID() == 0 {
-		c.CurrentIndex += 1
-		document.SetID(c.CurrentIndex)
-		c.list = append(c.list, document.ID())
+		_, err := c.upsert(OpUpsert, document)
+		return err
+	})
+}
+
+// upsert stores the Document and returns the previous Document stored under the
+// same key, if any. It must be called while the Collection is locked.
+func (c *Collection) upsert(op Op, document Document) (previous Document, err error) {
+	claimed, err := c.claim(document)
+	if err != nil {
+		return nil, err
 	}
+	defer func() {
+		if err != nil && claimed {
+			c.release(document)
+		}
+	}()
 
-	c.Items[document.ID()] = document
-	c.mutex.Unlock()
-	return nil
+	created := document.ID() == 0
+	if created {
+		document.SetID(c.nextID())
+	}
+	c.derive(document)
+
+	if !created && c.unchanged(document) {
+		previous, _ := c.item(document.ID())
+		if previous != document {
+			if err := c.put(document.ID(), document); err != nil {
+				return nil, err
+			}
+			c.release(previous)
+		}
+		return previous, nil
+	}
+
+	if err := c.checkLimits(document); err != nil {
+		if created {
+			document.SetID(0)
+		}
+		return nil, err
+	}
+	if err := c.recordVersion(document); err != nil {
+		if created {
+			document.SetID(0)
+		}
+		return nil, err
+	}
+
+	previous, exists := c.item(document.ID())
+	if err := c.put(document.ID(), document); err != nil {
+		if created {
+			document.SetID(0)
+		}
+		return nil, err
+	}
+	if !exists {
+		c.index.Insert(document.ID())
+	} else if previous != document {
+		c.release(previous)
+	}
+
+	c.updated(op, document.ID(), document)
+	return previous, nil
+}
+
+// Increment adds delta to the named integer field of the Document with the
+// specified key and returns the new value. The read-modify-write is atomic, so
+// concurrent calls to Increment will not lose updates. The field must be
+// exported and have an integer type. If the new value does not fit in the field
+// (or, for an unsigned field, is negative or larger than an int64 can hold)
+// Increment fails with ErrOverflow and the Document is not changed.
+//
+// The change is made to a copy that replaces the stored Document, so Documents
+// returned earlier (for example by FindKey) are not changed.
+func (c *Collection) Increment(key uint64, field string, delta int64) (result int64, err error) {
+	err = c.edit(Operation{Op: OpIncrement, Key: key}, func(document Document) error {
+		value, err := documentField(document, field)
+		if err != nil {
+			return err
+		}
+
+		switch value.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			sum := value.Int() + delta
+			if (delta > 0 && sum < value.Int()) || (delta < 0 && sum > value.Int()) || value.OverflowInt(sum) {
+				return ErrOverflow
+			}
+			value.SetInt(sum)
+			result = sum
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			current := value.Uint()
+			var sum uint64
+			if delta < 0 {
+				// Negating in uint64 also works for math.MinInt64
+				magnitude := -uint64(delta)
+				if magnitude > current {
+					return ErrOverflow
+				}
+				sum = current - magnitude
+			} else {
+				sum = current + uint64(delta)
+				if sum < current {
+					return ErrOverflow
+				}
+			}
+			if value.OverflowUint(sum) || sum > math.MaxInt64 {
+				return ErrOverflow
+			}
+			value.SetUint(sum)
+			result = int64(sum)
+		default:
+			return ErrInvalidField
+		}
+		return nil
+	})
+	return result, err
 }
 
 // DeleteKey removes the indicated key from the Collection, or no-ops if the key
 // is not present.
-func (c *Collection) DeleteKey(key uint64) {
-	c.mutex.Lock()
+func (c *Collection) DeleteKey(key uint64) error {
+	return c.mutate(Operation{Op: OpDelete, Key: key}, func() error {
+		c.deleteKey(key)
+		return nil
+	})
+}
+
+// deleteKey removes the key from the Collection. It must be called while the
+// Collection is locked.
+func (c *Collection) deleteKey(key uint64) {
+	document, ok := c.Items[key]
+	if !ok {
+		return
+	}
+	c.release(document)
 	delete(c.Items, key)
-	deleteKeyFromList(&c.list, key)
-	c.mutex.Unlock()
+	delete(c.Checksums, key)
+	c.uncache(key)
+	c.index.Delete(key)
+	c.deleted(OpDelete, key)
 }
 
 // Delete removes the Document from the Collection and sets the ID to zero.
-func (c *Collection) Delete(document Document) {
+func (c *Collection) Delete(document Document) error {
 	if document.ID() == 0 {
-		return
+		return nil
+	}
+	if err := c.DeleteKey(document.ID()); err != nil {
+		return err
 	}
-	c.DeleteKey(document.ID())
 	document.SetID(0)
+	return nil
 }
 
 // Find a Document by key. This is useful for "foreign key" type relationships
@@ -80,10 +384,15 @@ func (c *Collection) Delete(document Document) {
 // fast lookup by ID if you already know it. Returns nil if the key is not found
 // in the Collection.
 func (c *Collection) FindKey(key uint64) Document {
+	if snapshot := c.readSnapshot(); snapshot != nil {
+		document, _ := snapshot.item(key)
+		return document
+	}
+
 	c.mutex.RLock()
 	defer c.mutex.RUnlock()
 
-	item, ok := c.Items[key]
+	item, ok := c.item(key)
 	if !ok {
 		return nil
 	}
@@ -96,16 +405,35 @@ func (c *Collection) FindKey(key uint64) Document {
 // list will be empty. This function always enumerates the entire Collection
 // (i.e. table scan).
 func (c *Collection) FindAll(finder func(Document) bool) []Document {
+	defer c.profile("findall")()
 	found := []Document{}
-	c.mutex.RLock()
+	keys, item, done := c.reader()
 
-	for _, key := range c.List() {
-		if finder(c.Items[key]) {
-			found = append(found, c.Items[key])
+	for _, key := range keys {
+		if document, _ := item(key); finder(document) {
+			found = append(found, document)
 		}
 	}
 
-	c.mutex.RUnlock()
+	done()
+	return found
+}
+
+// FindAllKeys behaves like FindAll but returns only the keys of the matching
+// Documents, in ascending order. Use it when you only need identifiers for a
+// later operation, so you don't hold references to large Documents.
+func (c *Collection) FindAllKeys(finder func(Document) bool) []uint64 {
+	defer c.profile("findallkeys")()
+	found := []uint64{}
+	keys, item, done := c.reader()
+
+	for _, key := range keys {
+		if document, _ := item(key); finder(document) {
+			found = append(found, key)
+		}
+	}
+
+	done()
 	return found
 }
 
@@ -114,33 +442,260 @@ func (c *Collection) FindAll(finder func(Document) bool) []Document {
 // enumerates the entire Collection (i.e. table scan) until a match is found, or
 // returns nil if there is no match.
 func (c *Collection) FindOne(finder func(Document) bool) Document {
-	c.mutex.RLock()
-	defer c.mutex.RUnlock()
+	defer c.profile("findone")()
+	keys, item, done := c.reader()
+	defer done()
+
+	for _, key := range keys {
+		if document, _ := item(key); finder(document) {
+			return document
+		}
+	}
+	return nil
+}
+
+// FindAllDescending behaves like FindAll except the Collection is scanned in
+// descending order, so the Documents with the highest keys (usually the most
+// recently inserted) are returned first.
+func (c *Collection) FindAllDescending(finder func(Document) bool) []Document {
+	defer c.profile("findalldescending")()
+	found := []Document{}
+	keys, item, done := c.reader()
 
-	for _, key := range c.List() {
-		if finder(c.Items[key]) {
-			return c.Items[key]
+	for i := len(keys) - 1; i >= 0; i-- {
+		if document, _ := item(keys[i]); finder(document) {
+			found = append(found, document)
+		}
+	}
+
+	done()
+	return found
+}
+
+// FindLast is the counterpart to FindOne. It returns the last Document that
+// satisfies the callback, scanning the Collection in descending order until a
+// match is found, or returns nil if there is no match. This is useful for
+// finding the most recent matching record.
+func (c *Collection) FindLast(finder func(Document) bool) Document {
+	defer c.profile("findlast")()
+	keys, item, done := c.reader()
+	defer done()
+
+	for i := len(keys) - 1; i >= 0; i-- {
+		if document, _ := item(keys[i]); finder(document) {
+			return document
 		}
 	}
 	return nil
 }
 
+// Scan calls fn for each Document in the Collection in ascending order, until fn
+// returns stop or an error. The error is returned from Scan. Like FindAll, fn
+// is called while the Collection is locked, so it must not call methods that
+// change the Collection.
+func (c *Collection) Scan(fn func(Document) (stop bool, err error)) error {
+	defer c.profile("scan")()
+	keys, item, done := c.reader()
+	defer done()
+
+	for _, key := range keys {
+		document, _ := item(key)
+		stop, err := fn(document)
+		if err != nil {
+			return err
+		}
+		if stop {
+			return nil
+		}
+	}
+	return nil
+}
+
+// Sample returns n Documents chosen uniformly at random from the Collection, in
+// random order. If n is larger than the number of Documents in the Collection,
+// all of the Documents are returned (in random order). If n is zero or
+// negative the sample is empty.
+func (c *Collection) Sample(n int) []Document {
+	keys, item, done := c.reader()
+	defer done()
+
+	if n > len(keys) {
+		n = len(keys)
+	}
+	if n < 0 {
+		n = 0
+	}
+
+	// This is a partial Fisher-Yates shuffle. Rather than copying and shuffling
+	// the entire list we track which positions have been swapped, so we only do
+	// work proportional to the size of the sample.
+	swapped := map[int]int{}
+	position := func(i int) int {
+		if p, ok := swapped[i]; ok {
+			return p
+		}
+		return i
+	}
+
+	sample := make([]Document, 0, n)
+	for i := 0; i < n; i++ {
+		j := i + rand.Intn(len(keys)-i)
+		pi, pj := position(i), position(j)
+		swapped[i], swapped[j] = pj, pi
+		document, _ := item(keys[pj])
+		sample = append(sample, document)
+	}
+	return sample
+}
+
 // List returns a sorted list of keys (in ascending order) for all Documents
-// currently held in the Collection.
+// currently held in the Collection. The list is a copy, so it is not affected
+// by later changes to the Collection.
 func (c *Collection) List() []uint64 {
-	c.mutex.RLock()
-	defer c.mutex.RUnlock()
-	return c.list
+	keys, _, done := c.reader()
+	defer done()
+
+	list := make([]uint64, len(keys))
+	copy(list, keys)
+	return list
+}
+
+// Patch atomically updates the named fields of the Document with the specified
+// key. Field names are the Go struct field names, and each
+// value must be assignable to the field (numeric values are converted between
+// numeric types, and nil sets the field to its zero value). If any field is
+// invalid the Document is not modified. Patch cannot change the key of the
+// Document. Like Increment, Patch replaces the stored Document with a changed
+// copy.
+func (c *Collection) Patch(key uint64, fields map[string]interface{}) error {
+	return c.edit(Operation{Op: OpPatch, Key: key}, func(document Document) error {
+		// Validate every field before we modify anything
+		targets := map[string]reflect.Value{}
+		values := map[string]reflect.Value{}
+		for name, value := range fields {
+			target, err := documentField(document, name)
+			if err != nil {
+				return err
+			}
+			v, err := assignableValue(value, target.Type())
+			if err != nil {
+				return err
+			}
+			targets[name], values[name] = target, v
+		}
+
+		for name, target := range targets {
+			target.Set(values[name])
+		}
+		return nil
+	})
+}
+
+// PatchJSON atomically applies an RFC 7396 JSON Merge Patch to the Document
+// with the specified key. The patch uses the JSON field
+// names of the Document (honoring json struct tags). PatchJSON cannot change
+// the key of the Document. Like Increment, PatchJSON replaces the stored
+// Document with a changed copy.
+func (c *Collection) PatchJSON(key uint64, patch []byte) error {
+	return c.edit(Operation{Op: OpPatch, Key: key}, func(document Document) error {
+		return applyMergePatch(document, patch)
+	})
+}
+
+// edit applies change to a copy of the Document with op.Key while the
+// Collection is locked, and stores the copy in its place, for Increment and
+// Patch.
+func (c *Collection) edit(op Operation, change func(Document) error) error {
+	return c.mutate(op, func() error {
+		document, err := c.editable(op.Key)
+		if err != nil {
+			return err
+		}
+		if err := change(document); err != nil {
+			return err
+		}
+		return c.edited(op.Op, op.Key, document)
+	})
+}
+
+// editable returns a copy of the Document stored under key for Increment and
+// Patch to change. The stored Document may be shared with callers and with a
+// snapshot that Flush is encoding without a lock, so it must never be changed
+// in place. It must be called while the Collection is locked.
+func (c *Collection) editable(key uint64) (Document, error) {
+	document, ok := c.item(key)
+	if !ok {
+		return nil, ErrKeyNotFound
+	}
+	return copyDocument(document)
+}
+
+// edited stores a Document returned by editable in place of the original,
+// with the same limits and version history as upsert. It must be called while
+// the Collection is locked.
+func (c *Collection) edited(op Op, key uint64, document Document) error {
+	document.SetID(key)
+	c.derive(document)
+	if err := c.checkLimits(document); err != nil {
+		return err
+	}
+	if err := c.recordVersion(document); err != nil {
+		return err
+	}
+
+	previous := c.Items[key]
+	if err := c.put(key, document); err != nil {
+		return err
+	}
+	c.release(previous)
+	if _, err := c.claim(document); err != nil {
+		return err
+	}
+
+	c.updated(op, key, document)
+	return nil
+}
+
+// updated is called while the Collection is locked, after a Document has been
+// inserted or modified.
+func (c *Collection) updated(op Op, key uint64, document Document) {
+	c.measure(key, document)
+	c.fingerprint(key, document)
+	c.tick(key)
+	c.changed(key)
+	c.invalidateQueries()
+	c.dropSnapshot()
+	for _, v := range c.views {
+		v.update(key, document)
+	}
+	c.audited(op, key)
+	c.markDirty(1)
+}
+
+// deleted is called while the Collection is locked, after a Document has been
+// removed.
+func (c *Collection) deleted(op Op, key uint64) {
+	c.measure(key, nil)
+	delete(c.encoded, key)
+	delete(c.fingerprints, key)
+	c.tick(key)
+	c.changed(key)
+	c.invalidateQueries()
+	c.dropSnapshot()
+	for _, v := range c.views {
+		v.remove(key)
+	}
+	c.audited(op, key)
+	c.markDirty(1)
 }
 
 // generateList is an internal call that rebuilds the list of keys after
 // restoring a Datastore from disk. It should not need to be called otherwise.
 func (c *Collection) generateList() {
 	c.mutex.Lock()
-	c.list = []uint64{}
 	for _, item := range c.Items {
-		c.list = append(c.list, item.ID())
+		c.claim(item)
 	}
-	sort.Sort(UIntSlice(c.list))
+	c.rebuildIndex()
 	c.mutex.Unlock()
 }
@@ -1,7 +1,11 @@
 package datastore_test
 
 import (
+	"errors"
+	"math"
+	"path/filepath"
 	"reflect"
+	"sync"
 	"testing"
 
 	"strings"
@@ -50,6 +54,150 @@ func TestCollection_Upsert(t *testing.T) {
 	}
 }
 
+func TestCollection_UpsertReturning(t *testing.T) {
+	ds := datastore.New()
+	cakes := ds.In("cake")
+
+	chocolate := &NameDocument{
+		Name: "chocolate cake",
+	}
+
+	previous, err := cakes.UpsertReturning(chocolate)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if previous != nil {
+		t.Errorf("Expected nil, found %#v", previous)
+	}
+
+	replacement := &NameDocument{
+		Identifier: chocolate.ID(),
+		Name:       "double chocolate cake",
+	}
+
+	previous, err = cakes.UpsertReturning(replacement)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if previous != chocolate {
+		t.Errorf("Expected %#v, found %#v", chocolate, previous)
+	}
+
+	if _, err := cakes.UpsertReturning(&NumberDocument{}); !errors.Is(err, datastore.ErrInvalidType) {
+		t.Errorf("Expected %s, found %s", datastore.ErrInvalidType, err)
+	}
+
+	// Documents with a preset ID are added to the list in order
+	if err := cakes.Upsert(&NameDocument{Identifier: 5, Name: "carrot cake"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := cakes.Upsert(&NameDocument{Identifier: 3, Name: "banana cake"}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Autoincrement skips over keys that are already in use
+	lemon := &NameDocument{Name: "lemon cake"}
+	if err := cakes.Upsert(lemon); err != nil {
+		t.Fatal(err)
+	}
+	if lemon.ID() != 2 {
+		t.Errorf("Expected ID 2, found %d", lemon.ID())
+	}
+	carrot := &NameDocument{Name: "carrot cake"}
+	if err := cakes.Upsert(carrot); err != nil {
+		t.Fatal(err)
+	}
+	if carrot.ID() != 4 {
+		t.Errorf("Expected ID 4, found %d", carrot.ID())
+	}
+
+	expected := []uint64{1, 2, 3, 4, 5}
+	if !reflect.DeepEqual(cakes.List(), expected) {
+		t.Errorf("Expected %#v, found %#v", expected, cakes.List())
+	}
+}
+
+func TestCollection_UpsertMerge(t *testing.T) {
+	ds := datastore.New()
+	numbers := ds.In("numbers")
+
+	sum := func(existing, incoming datastore.Document) datastore.Document {
+		return &NumberDocument{
+			Number: existing.(*NumberDocument).Number + incoming.(*NumberDocument).Number,
+		}
+	}
+
+	first := &NumberDocument{Number: 3}
+	if err := numbers.UpsertMerge(first, sum); err != nil {
+		t.Fatal(err)
+	}
+	if first.Number != 3 {
+		t.Errorf("Expected merge not to be called for a new document")
+	}
+
+	if err := numbers.UpsertMerge(&NumberDocument{Identifier: first.ID(), Number: 4}, sum); err != nil {
+		t.Fatal(err)
+	}
+
+	merged, ok := numbers.FindKey(first.ID()).(*NumberDocument)
+	if !ok {
+		t.Fatal("Expected *NumberDocument type")
+	}
+	if merged.Number != 7 {
+		t.Errorf("Expected 7, found %d", merged.Number)
+	}
+	if merged.ID() != first.ID() {
+		t.Errorf("Expected ID %d, found %d", first.ID(), merged.ID())
+	}
+
+	wrongType := func(existing, incoming datastore.Document) datastore.Document {
+		return &NameDocument{}
+	}
+	if err := numbers.UpsertMerge(merged, wrongType); !errors.Is(err, datastore.ErrInvalidType) {
+		t.Errorf("Expected %s, found %s", datastore.ErrInvalidType, err)
+	}
+}
+
+func TestCollection_SetReadOnly(t *testing.T) {
+	ds := datastore.New()
+	cakes := ds.In("cake")
+
+	chocolate := &NameDocument{
+		Name: "chocolate cake",
+	}
+	if err := cakes.Upsert(chocolate); err != nil {
+		t.Fatal(err)
+	}
+
+	cakes.SetReadOnly(true)
+	if !cakes.ReadOnly() {
+		t.Error("Expected collection to be read-only")
+	}
+
+	if err := cakes.Upsert(&NameDocument{}); !errors.Is(err, datastore.ErrReadOnly) {
+		t.Errorf("Expected %s, found %s", datastore.ErrReadOnly, err)
+	}
+	if err := cakes.Delete(chocolate); !errors.Is(err, datastore.ErrReadOnly) {
+		t.Errorf("Expected %s, found %s", datastore.ErrReadOnly, err)
+	}
+	if err := cakes.Patch(chocolate.ID(), map[string]interface{}{"Name": "vanilla"}); !errors.Is(err, datastore.ErrReadOnly) {
+		t.Errorf("Expected %s, found %s", datastore.ErrReadOnly, err)
+	}
+	if cakes.FindKey(1) != chocolate {
+		t.Error("Expected reads to work on a read-only collection")
+	}
+
+	// Other collections are still writable
+	if err := ds.In("pie").Upsert(&NameDocument{}); err != nil {
+		t.Error(err)
+	}
+
+	cakes.SetReadOnly(false)
+	if err := cakes.Delete(chocolate); err != nil {
+		t.Error(err)
+	}
+}
+
 func TestCollection_Delete(t *testing.T) {
 	ds := datastore.New()
 	cakes := ds.In("cake")
@@ -237,3 +385,443 @@ func TestCollection_FindOne(t *testing.T) {
 		t.Errorf("Expected %s, found %s", bestCookie, chocoChip2.Name)
 	}
 }
+
+func TestCollection_Sample(t *testing.T) {
+	ds := datastore.New()
+	numbers := ds.In("numbers")
+
+	if sample := numbers.Sample(3); len(sample) != 0 {
+		t.Errorf("Expected empty sample, found %d items", len(sample))
+	}
+
+	for i := 0; i < 10; i++ {
+		if err := numbers.Upsert(&NumberDocument{Number: i}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	sample := numbers.Sample(4)
+	if len(sample) != 4 {
+		t.Fatalf("Expected 4 items, found %d", len(sample))
+	}
+
+	seen := map[uint64]bool{}
+	for _, doc := range sample {
+		if seen[doc.ID()] {
+			t.Errorf("Document %d was sampled twice", doc.ID())
+		}
+		seen[doc.ID()] = true
+	}
+
+	all := numbers.Sample(20)
+	if len(all) != 10 {
+		t.Errorf("Expected 10 items, found %d", len(all))
+	}
+
+	for _, n := range []int{0, -1} {
+		if sample := numbers.Sample(n); len(sample) != 0 {
+			t.Errorf("Expected empty sample for %d, found %d items", n, len(sample))
+		}
+	}
+}
+
+func TestCollection_FindLast(t *testing.T) {
+	ds := datastore.New()
+	cookies := ds.In("items")
+
+	for _, name := range []string{"chocolate chip", "oatmeal", "chocolate chunk"} {
+		if err := cookies.Upsert(&NameDocument{Name: name}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	noCookie := cookies.FindLast(func(d datastore.Document) bool {
+		return false
+	})
+	if noCookie != nil {
+		t.Errorf("Expected nil, found %#v", noCookie)
+	}
+
+	chocolate := func(d datastore.Document) bool {
+		cookie, ok := d.(*NameDocument)
+		return ok && strings.HasPrefix(cookie.Name, "chocolate")
+	}
+
+	last := cookies.FindLast(chocolate)
+	if last == nil {
+		t.Fatal("Expected non-nil value")
+	}
+	if last.ID() != 3 {
+		t.Errorf("Expected 3, found %d", last.ID())
+	}
+
+	all := cookies.FindAllDescending(chocolate)
+	if len(all) != 2 {
+		t.Fatalf("Expected 2 results, found %d", len(all))
+	}
+	if all[0].ID() != 3 || all[1].ID() != 1 {
+		t.Errorf("Expected results in descending order, found %d, %d", all[0].ID(), all[1].ID())
+	}
+}
+
+func TestCollection_Increment(t *testing.T) {
+	ds := datastore.New()
+	counters := ds.In("counters")
+
+	counter := &NumberDocument{}
+	if err := counters.Upsert(counter); err != nil {
+		t.Fatal(err)
+	}
+
+	wg := sync.WaitGroup{}
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := counters.Increment(counter.ID(), "Number", 2); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	value, err := counters.Increment(counter.ID(), "Number", -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if value != 99 {
+		t.Errorf("Expected 99, found %d", value)
+	}
+
+	if _, err := counters.Increment(60, "Number", 1); !errors.Is(err, datastore.ErrKeyNotFound) {
+		t.Errorf("Expected %s, found %s", datastore.ErrKeyNotFound, err)
+	}
+	if _, err := counters.Increment(counter.ID(), "Missing", 1); !errors.Is(err, datastore.ErrInvalidField) {
+		t.Errorf("Expected %s, found %s", datastore.ErrInvalidField, err)
+	}
+
+	names := ds.In("names")
+	name := &NameDocument{Name: "cake"}
+	if err := names.Upsert(name); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := names.Increment(name.ID(), "Name", 1); !errors.Is(err, datastore.ErrInvalidField) {
+		t.Errorf("Expected %s, found %s", datastore.ErrInvalidField, err)
+	}
+}
+
+type WidthDocument struct {
+	Identifier uint64
+	Small      int8
+	Large      int64
+	Byte       uint8
+	Unsigned   uint64
+}
+
+func (w *WidthDocument) ID() uint64 {
+	return w.Identifier
+}
+
+func (w *WidthDocument) SetID(id uint64) {
+	w.Identifier = id
+}
+
+func TestCollection_IncrementOverflow(t *testing.T) {
+	ds := datastore.New()
+	widths := ds.In("widths")
+
+	document := &WidthDocument{Small: 120, Large: math.MaxInt64 - 1, Byte: 2, Unsigned: math.MaxInt64}
+	if err := widths.Upsert(document); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		field string
+		delta int64
+	}{
+		{"Small", 8},
+		{"Small", -249},
+		{"Large", 2},
+		{"Byte", -3},
+		{"Byte", 254},
+		{"Unsigned", 1},
+		{"Unsigned", math.MinInt64},
+	}
+	for _, test := range tests {
+		if _, err := widths.Increment(document.ID(), test.field, test.delta); !errors.Is(err, datastore.ErrOverflow) {
+			t.Errorf("Expected %s adding %d to %s, found %v", datastore.ErrOverflow, test.delta, test.field, err)
+		}
+	}
+	if stored := widths.FindKey(document.ID()).(*WidthDocument); *stored != *document {
+		t.Errorf("Expected %#v, found %#v", document, stored)
+	}
+
+	// Values up to the limits are allowed
+	valid := []struct {
+		field    string
+		delta    int64
+		expected int64
+	}{
+		{"Small", 7, 127},
+		{"Small", -255, -128},
+		{"Large", 1, math.MaxInt64},
+		{"Large", math.MinInt64, -1},
+		{"Byte", -2, 0},
+		{"Byte", 255, 255},
+		{"Unsigned", -math.MaxInt64, 0},
+	}
+	for _, test := range valid {
+		result, err := widths.Increment(document.ID(), test.field, test.delta)
+		if err != nil {
+			t.Errorf("Expected adding %d to %s to succeed, found %v", test.delta, test.field, err)
+		} else if result != test.expected {
+			t.Errorf("Expected %d, found %d", test.expected, result)
+		}
+	}
+	if _, err := widths.Increment(document.ID(), "Large", math.MinInt64); !errors.Is(err, datastore.ErrOverflow) {
+		t.Errorf("Expected %s, found %v", datastore.ErrOverflow, err)
+	}
+}
+
+func TestCollection_IncrementDuringFlush(t *testing.T) {
+	ds, err := datastore.Create(filepath.Join(t.TempDir(), "counters"+datastore.Extension), TestdataSignature)
+	if err != nil {
+		t.Fatal(err)
+	}
+	counters := ds.In("counters")
+	counter := &NumberDocument{}
+	if err := counters.Upsert(counter); err != nil {
+		t.Fatal(err)
+	}
+
+	// Flush encodes Documents without holding the lock, so Increment must not
+	// change the stored Document in place. The race detector catches it if it
+	// does.
+	done := make(chan struct{})
+	increments := make(chan int)
+	go func() {
+		count := 0
+		defer func() { increments <- count }()
+		for {
+			select {
+			case <-done:
+				return
+			default:
+			}
+			if _, err := counters.Increment(counter.ID(), "Number", 1); err != nil {
+				t.Error(err)
+				return
+			}
+			count++
+		}
+	}()
+	for i := 0; i < 10; i++ {
+		if err := ds.Flush(); err != nil {
+			t.Error(err)
+		}
+	}
+	close(done)
+	count := <-increments
+
+	if number := counters.FindKey(counter.ID()).(*NumberDocument).Number; number != count {
+		t.Errorf("Expected %d, found %d", count, number)
+	}
+}
+
+func TestCollection_Patch(t *testing.T) {
+	ds := datastore.New()
+	cakes := ds.In("cakes")
+
+	cake := &NameDocument{Name: "chocolate"}
+	if err := cakes.Upsert(cake); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := cakes.Patch(cake.ID(), map[string]interface{}{"Name": "vanilla"}); err != nil {
+		t.Fatal(err)
+	}
+	// The stored Document is replaced, so the original instance is unchanged
+	if cake.Name != "chocolate" {
+		t.Errorf("Expected chocolate, found %s", cake.Name)
+	}
+	if stored := cakes.FindKey(1).(*NameDocument); stored.Name != "vanilla" {
+		t.Errorf("Expected vanilla, found %s", stored.Name)
+	}
+
+	// Identifier can't be used to move the document to another key
+	if err := cakes.Patch(cake.ID(), map[string]interface{}{"Identifier": 7}); err != nil {
+		t.Fatal(err)
+	}
+	if stored := cakes.FindKey(1); stored == nil || stored.ID() != 1 || cakes.FindKey(7) != nil {
+		t.Errorf("Expected the Document to stay at key 1, found keys %v", cakes.List())
+	}
+
+	err := cakes.Patch(cake.ID(), map[string]interface{}{"Name": "strawberry", "Missing": 1})
+	if !errors.Is(err, datastore.ErrInvalidField) {
+		t.Errorf("Expected %s, found %s", datastore.ErrInvalidField, err)
+	}
+	if err := cakes.Patch(cake.ID(), map[string]interface{}{"Name": 12}); !errors.Is(err, datastore.ErrInvalidField) {
+		t.Errorf("Expected %s, found %s", datastore.ErrInvalidField, err)
+	}
+	if stored := cakes.FindKey(1).(*NameDocument); stored.Name != "vanilla" {
+		t.Errorf("Expected vanilla, found %s", stored.Name)
+	}
+
+	if err := cakes.Patch(60, nil); !errors.Is(err, datastore.ErrKeyNotFound) {
+		t.Errorf("Expected %s, found %s", datastore.ErrKeyNotFound, err)
+	}
+}
+
+func TestCollection_PatchJSON(t *testing.T) {
+	ds := datastore.New()
+	numbers := ds.In("numbers")
+
+	number := &NumberDocument{Number: 4}
+	if err := numbers.Upsert(number); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := numbers.PatchJSON(number.ID(), []byte(`{"Number": 10}`)); err != nil {
+		t.Fatal(err)
+	}
+	if stored := numbers.FindKey(1).(*NumberDocument); stored.Number != 10 {
+		t.Errorf("Expected 10, found %d", stored.Number)
+	}
+
+	if err := numbers.PatchJSON(number.ID(), []byte(`{"Number": null, "Identifier": 5}`)); err != nil {
+		t.Fatal(err)
+	}
+	if stored := numbers.FindKey(1).(*NumberDocument); stored.Number != 0 || stored.ID() != 1 {
+		t.Errorf("Expected 0 at key 1, found %d at key %d", stored.Number, stored.ID())
+	}
+
+	if err := numbers.PatchJSON(number.ID(), []byte(`{"Number": "ten"}`)); err == nil {
+		t.Error("Expected error, wrong type")
+	}
+	if err := numbers.PatchJSON(60, []byte(`{}`)); !errors.Is(err, datastore.ErrKeyNotFound) {
+		t.Errorf("Expected %s, found %s", datastore.ErrKeyNotFound, err)
+	}
+}
+
+func TestCollection_PatchJSONHiddenField(t *testing.T) {
+	ds := datastore.New()
+	tokens := ds.In("tokens")
+
+	token := &TokenDocument{Name: "bob", Token: "secret"}
+	if err := tokens.Upsert(token); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, patch := range []string{`{"Name": "alice"}`, `{"Name": null}`} {
+		if err := tokens.PatchJSON(token.ID(), []byte(patch)); err != nil {
+			t.Fatal(err)
+		}
+		if stored := tokens.FindKey(token.ID()).(*TokenDocument); stored.Token != "secret" {
+			t.Errorf("Expected hidden field to be kept after %s, found %q", patch, stored.Token)
+		}
+	}
+	if stored := tokens.FindKey(token.ID()).(*TokenDocument); stored.Name != "" {
+		t.Errorf("Expected null to reset Name, found %q", stored.Name)
+	}
+}
+
+func TestCollection_UpsertOtherCollection(t *testing.T) {
+	ds := datastore.New()
+	cats := ds.In("cats")
+	dogs := ds.In("dogs")
+
+	if err := dogs.Upsert(&NameDocument{Name: "Rex"}); err != nil {
+		t.Fatal(err)
+	}
+
+	pet := &NameDocument{Name: "Chomper"}
+	if err := cats.Upsert(pet); err != nil {
+		t.Fatal(err)
+	}
+	if err := dogs.Upsert(pet); !errors.Is(err, datastore.ErrDocumentInOtherCollection) {
+		t.Errorf("Expected %s, found %s", datastore.ErrDocumentInOtherCollection, err)
+	}
+	if pet.ID() != 1 {
+		t.Errorf("Expected ID to be unchanged, found %d", pet.ID())
+	}
+
+	// Once the document is deleted it may be stored somewhere else
+	if err := cats.Delete(pet); err != nil {
+		t.Fatal(err)
+	}
+	if err := dogs.Upsert(pet); err != nil {
+		t.Error(err)
+	}
+	if pet.ID() != 2 {
+		t.Errorf("Expected 2, found %d", pet.ID())
+	}
+
+	// Replacing a document with a new instance releases the old one
+	replacement := &NameDocument{Identifier: pet.ID(), Name: "Chomper II"}
+	if err := dogs.Upsert(replacement); err != nil {
+		t.Fatal(err)
+	}
+	pet.SetID(0)
+	if err := cats.Upsert(pet); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestCollection_Scan(t *testing.T) {
+	numbers := datastore.New().In("numbers")
+	for i := 1; i <= 10; i++ {
+		if err := numbers.Upsert(&NumberDocument{Number: i}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	sum := 0
+	err := numbers.Scan(func(document datastore.Document) (bool, error) {
+		sum += document.(*NumberDocument).Number
+		return sum >= 10, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sum != 10 {
+		t.Errorf("Expected scan to stop at 10, found %d", sum)
+	}
+
+	errTooBig := errors.New("too big")
+	seen := 0
+	err = numbers.Scan(func(document datastore.Document) (bool, error) {
+		seen++
+		if document.(*NumberDocument).Number > 5 {
+			return false, errTooBig
+		}
+		return false, nil
+	})
+	if err != errTooBig {
+		t.Errorf("Expected %s, found %v", errTooBig, err)
+	}
+	if seen != 6 {
+		t.Errorf("Expected 6 documents scanned, found %d", seen)
+	}
+}
+
+func TestCollection_FindAllKeys(t *testing.T) {
+	numbers := datastore.New().In("numbers")
+	for i := 1; i <= 10; i++ {
+		if err := numbers.Upsert(&NumberDocument{Number: i}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	keys := numbers.FindAllKeys(func(document datastore.Document) bool {
+		return document.(*NumberDocument).Number%3 == 0
+	})
+	expected := []uint64{3, 6, 9}
+	if !reflect.DeepEqual(keys, expected) {
+		t.Errorf("Expected %v, found %v", expected, keys)
+	}
+
+	none := numbers.FindAllKeys(func(datastore.Document) bool { return false })
+	if none == nil || len(none) != 0 {
+		t.Errorf("Expected empty list, found %#v", none)
+	}
+}
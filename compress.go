@@ -0,0 +1,195 @@
+package datastore
+
+import (
+	"bytes"
+	"compress/flate"
+	"encoding/gob"
+	"io"
+)
+
+func init() {
+	gob.Register(&packedDocument{})
+}
+
+// packedDocument holds a Document that has been gob-encoded and compressed on
+// its own, for Collections that use SetCompressed. It takes the place of the
+// Document in Items, and is unpacked each time the Document is accessed.
+type packedDocument struct {
+	Key  uint64
+	Data []byte
+}
+
+func (p *packedDocument) ID() uint64 {
+	return p.Key
+}
+
+func (p *packedDocument) SetID(id uint64) {
+	p.Key = id
+}
+
+// SetCompressed changes whether each Document in the Collection is compressed
+// separately. This is intended for Collections of large Documents (like logs)
+// that are read infrequently: only the compressed bytes are held in memory, and
+// each Document is decompressed when it is accessed. The setting is written to
+// disk.
+//
+// Documents returned from a compressed Collection are copies. Modifying one does
+// not change the Collection until you Upsert it again. Every Find operation
+// decompresses the Documents it scans, so prefer FindKey where you can. Version
+// history and the trash are not compressed.
+func (c *Collection) SetCompressed(compressed bool) error {
+	if err := c.checkOpen(); err != nil {
+		return err
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.Compressed == compressed {
+		return nil
+	}
+
+	items := make(map[uint64]Document, len(c.Items))
+	for key, document := range c.Items {
+		if compressed {
+			packed, err := packDocument(document)
+			if err != nil {
+				return err
+			}
+			items[key] = packed
+		} else {
+			unpacked, err := unpackDocument(document)
+			if err != nil {
+				return err
+			}
+			items[key] = unpacked
+		}
+	}
+
+	for key, document := range c.Items {
+		if compressed {
+			c.release(document)
+		} else {
+			c.claim(items[key])
+		}
+	}
+
+	c.Items = items
+	c.Compressed = compressed
+	c.dropSnapshot()
+	if c.cache != nil {
+		c.cache.clear()
+	}
+	c.markDirty(1)
+	return nil
+}
+
+// item returns the Document stored under key, unpacking it if the Collection is
+// compressed. It must be called while the Collection is locked.
+func (c *Collection) item(key uint64) (Document, bool) {
+	document, ok := c.Items[key]
+	if !ok {
+		return nil, false
+	}
+	if !c.Compressed {
+		if c.strict() {
+			copied, err := copyDocument(document)
+			if err != nil {
+				return nil, false
+			}
+			return copied, true
+		}
+		return document, true
+	}
+	if c.cache != nil {
+		if cached, ok := c.cache.get(key); ok {
+			return cached, true
+		}
+	}
+
+	// Corrupt Documents are detected when the Datastore is opened, so an error
+	// here could only come from a type that can no longer be decoded.
+	document, err := unpackDocument(document)
+	if err != nil {
+		return nil, false
+	}
+	if c.cache != nil {
+		c.cache.put(key, document)
+	}
+	return document, true
+}
+
+// put stores the Document under key, packing it if the Collection is
+// compressed, and records its checksum. It must be called while the Collection
+// is locked.
+func (c *Collection) put(key uint64, document Document) error {
+	stored := document
+	if c.Compressed {
+		packed, err := packDocument(document)
+		if err != nil {
+			return err
+		}
+		stored = packed
+	} else if c.strict() {
+		copied, err := copyDocument(document)
+		if err != nil {
+			return err
+		}
+		stored = copied
+	}
+	if err := c.recordChecksum(key, document); err != nil {
+		return err
+	}
+	if err := c.recordEncoding(key, document); err != nil {
+		return err
+	}
+	if c.Compressed && c.cache != nil {
+		// Cache a copy, so later changes through the caller's pointer are not
+		// returned by reads
+		copied, err := copyDocument(document)
+		if err != nil {
+			return err
+		}
+		c.cache.put(key, copied)
+	}
+	c.Items[key] = stored
+	return nil
+}
+
+// packDocument encodes and compresses a Document. The Document is encoded as an
+// interface, so its type must be registered with gob.Register, as it must be for
+// any Collection.
+func packDocument(document Document) (Document, error) {
+	buffer := &bytes.Buffer{}
+	writer, err := flate.NewWriter(buffer, flate.DefaultCompression)
+	if err != nil {
+		return nil, err
+	}
+	if err := gob.NewEncoder(writer).Encode(&document); err != nil {
+		return nil, codecError("encode", err)
+	}
+	if err := writer.Close(); err != nil {
+		return nil, err
+	}
+	return &packedDocument{Key: document.ID(), Data: buffer.Bytes()}, nil
+}
+
+// unpackDocument returns the Document held by a packedDocument. Any other
+// Document is returned unchanged.
+func unpackDocument(document Document) (Document, error) {
+	packed, ok := document.(*packedDocument)
+	if !ok {
+		return document, nil
+	}
+
+	reader := flate.NewReader(bytes.NewReader(packed.Data))
+	defer reader.Close()
+
+	var unpacked Document
+	if err := gob.NewDecoder(reader).Decode(&unpacked); err != nil && err != io.EOF {
+		return nil, codecError("decode", err)
+	}
+	if unpacked == nil {
+		return nil, ErrInvalidType
+	}
+	return unpacked, nil
+}
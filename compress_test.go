@@ -0,0 +1,81 @@
+package datastore_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"git.stormbase.io/cbednarski/datastore"
+)
+
+func TestCollection_SetCompressed(t *testing.T) {
+	tempdir, err := ioutil.TempDir("", "datastore")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempdir)
+	datapath := filepath.Join(tempdir, "compressed"+datastore.Extension)
+
+	ds, err := datastore.Create(datapath, TestdataSignature)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	logs := ds.In("logs")
+	if err := logs.Upsert(&NameDocument{Name: "before"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := logs.SetCompressed(true); err != nil {
+		t.Fatal(err)
+	}
+
+	line := &NameDocument{Name: strings.Repeat("GET /index.html 200\n", 100)}
+	if err := logs.Upsert(line); err != nil {
+		t.Fatal(err)
+	}
+
+	// Documents are copies, so changes are not visible until upserted
+	found := logs.FindKey(line.ID()).(*NameDocument)
+	if found == line || found.Name != line.Name {
+		t.Errorf("Expected a copy of the document, found %#v", found)
+	}
+	found.Name = "changed"
+	if logs.FindKey(line.ID()).(*NameDocument).Name != line.Name {
+		t.Error("Expected document to be unchanged until upsert")
+	}
+
+	if err := logs.Patch(1, map[string]interface{}{"Name": "patched"}); err != nil {
+		t.Fatal(err)
+	}
+	matches := logs.FindAll(func(d datastore.Document) bool {
+		return d.(*NameDocument).Name == "patched"
+	})
+	if len(matches) != 1 {
+		t.Errorf("Expected 1 patched document, found %d", len(matches))
+	}
+
+	if err := ds.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	ds2, err := datastore.Open(datapath, TestdataSignature)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	logs2 := ds2.In("logs")
+	if !logs2.Compressed {
+		t.Error("Expected collection to be compressed after Open")
+	}
+	if doc := logs2.FindKey(line.ID()); doc == nil || doc.(*NameDocument).Name != line.Name {
+		t.Errorf("Expected document after Open, found %#v", doc)
+	}
+
+	if err := logs2.SetCompressed(false); err != nil {
+		t.Fatal(err)
+	}
+	if logs2.FindKey(1) != logs2.FindKey(1) {
+		t.Error("Expected uncompressed collection to return the stored document")
+	}
+}
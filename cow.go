@@ -0,0 +1,52 @@
+package datastore
+
+import "reflect"
+
+// snapshot returns a frozen copy of the Collection's public fields, for
+// encoding without holding the lock. The maps are shared with the Collection
+// rather than copied, and the next change to the Collection copies them before
+// it writes (see thaw), so a snapshot costs nothing unless the Collection
+// changes while it is in use. The Documents themselves are not copied.
+func (c *Collection) snapshot() *Collection {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	return c.freeze()
+}
+
+// freeze returns a copy of the Collection's public fields that shares its maps,
+// and marks them shared. It must be called while the Collection is locked.
+func (c *Collection) freeze() *Collection {
+	frozen := &Collection{}
+	source := reflect.ValueOf(c).Elem()
+	target := reflect.ValueOf(frozen).Elem()
+	for i := 0; i < source.NumField(); i++ {
+		if source.Type().Field(i).PkgPath == "" {
+			target.Field(i).Set(source.Field(i))
+		}
+	}
+	c.frozen.Store(true)
+	return frozen
+}
+
+// thaw copies the Collection's public maps if a snapshot shares them, so the
+// snapshot is not changed. It must be called while the Collection is locked
+// for writing, before any of the maps are modified in place.
+func (c *Collection) thaw() {
+	if !c.frozen.Load() {
+		return
+	}
+	value := reflect.ValueOf(c).Elem()
+	for i := 0; i < value.NumField(); i++ {
+		field := value.Field(i)
+		if value.Type().Field(i).PkgPath != "" || field.Kind() != reflect.Map || field.IsNil() {
+			continue
+		}
+		copied := reflect.MakeMapWithSize(field.Type(), field.Len())
+		iter := field.MapRange()
+		for iter.Next() {
+			copied.SetMapIndex(iter.Key(), iter.Value())
+		}
+		field.Set(copied)
+	}
+	c.frozen.Store(false)
+}
@@ -0,0 +1,72 @@
+package datastore_test
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"testing"
+
+	"git.stormbase.io/cbednarski/datastore"
+)
+
+func TestSnapshotIsolation(t *testing.T) {
+	ds := datastore.New()
+	names := ds.In(Names)
+	if err := names.SetHistory(2); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 100; i++ {
+		if err := names.Upsert(&NameDocument{Name: fmt.Sprintf("name-%d", i)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Start both exports, and change the Collection while they are blocked
+	// writing to the pipes
+	streamReader, streamWriter := io.Pipe()
+	go func() {
+		_, err := names.WriteTo(streamWriter)
+		streamWriter.CloseWithError(err)
+	}()
+	jsonReader, jsonWriter := io.Pipe()
+	go func() {
+		jsonWriter.CloseWithError(names.ExportJSON(jsonWriter))
+	}()
+	streamed := bufio.NewReader(streamReader)
+	if _, err := streamed.Peek(1); err != nil {
+		t.Fatal(err)
+	}
+	exported := bufio.NewReader(jsonReader)
+	if _, err := exported.Peek(1); err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 50; i++ {
+		if err := names.Upsert(&NameDocument{Name: "added"}); err != nil {
+			t.Fatal(err)
+		}
+		if err := names.DeleteKey(uint64(i + 1)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(names.List()) != 100 {
+		t.Fatalf("Expected 100 keys, found %d", len(names.List()))
+	}
+
+	copied := datastore.New().In(Names)
+	if _, err := copied.ReadFrom(streamed); err != nil {
+		t.Fatal(err)
+	}
+	if len(copied.List()) != 100 || copied.FindKey(1) == nil || copied.FindKey(101) != nil {
+		t.Errorf("Expected the Collection as it was when WriteTo started, found keys %v", copied.List())
+	}
+
+	lines, err := io.ReadAll(exported)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count := bytes.Count(lines, []byte("\n")); count != 100 || bytes.Contains(lines, []byte("added")) {
+		t.Errorf("Expected the 100 original Documents, found %d lines", count)
+	}
+}
@@ -36,8 +36,8 @@
 // data structures are re-created during the Open call.
 //
 // As mentioned, collections are created based on the type of the data stored in
-// them. There are currently no special facilities provided for migrating data,
-// so take care when renaming types. Gob is designed to handle addition and
+// them. Use RegisterUpgrade to migrate the data in a Collection from one schema
+// version to the next, but take care when renaming types. Gob is designed to handle addition and
 // deletion of fields but renaming a type will likely cause data to be ignored
 // the next time the datastore is opened. You may safely Open a datastore that
 // contains incompatible types but calling Flush will destroy any incompatible
@@ -53,10 +53,14 @@ package datastore
 
 import (
 	"compress/gzip"
+	"context"
 	"encoding/gob"
 	"errors"
+	"io"
 	"os"
+	"sort"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -68,6 +72,33 @@ const Extension = ".datastore"
 
 var ErrInvalidSignature = errors.New("datastore signature does not match")
 var ErrInvalidType = errors.New("type does not match collection")
+var ErrViewExists = errors.New("view already exists")
+var ErrKeyNotFound = errors.New("key not found in collection")
+var ErrInvalidField = errors.New("field does not exist or has the wrong type")
+var ErrVersionNotFound = errors.New("version not found in history")
+var ErrKeyExists = errors.New("key already exists in collection")
+var ErrReadOnly = errors.New("collection is read-only")
+var ErrNotPersistent = errors.New("datastore is in-memory and has no path")
+var ErrInvalidAttachment = errors.New("attachment name is invalid")
+var ErrAttachmentNotFound = errors.New("attachment not found")
+var ErrDocumentInOtherCollection = errors.New("document belongs to another collection")
+var ErrClosed = errors.New("datastore is closed")
+var ErrNoReplica = errors.New("collection has no replica name")
+var ErrQueryNotFound = errors.New("query is not defined")
+var ErrDocumentTooLarge = errors.New("document is larger than the collection allows")
+var ErrQuotaExceeded = errors.New("collection quota exceeded")
+var ErrOrphanedFlush = errors.New("found a temp file from an interrupted flush")
+var ErrRoundTrip = errors.New("document changed when encoded and decoded")
+var ErrPluginNotFound = errors.New("plugin is not registered")
+var ErrPluginExists = errors.New("plugin is already attached")
+var ErrOverflow = errors.New("value is out of range for the field")
+var ErrUnorderedQueue = errors.New("queue collection has a custom ID generator")
+
+// ErrCorrupt, ErrCodec, and ErrIO classify the cause of an *Error. Use
+// errors.Is to check for them.
+var ErrCorrupt = errors.New("datastore file is corrupt")
+var ErrCodec = errors.New("could not encode or decode document")
+var ErrIO = errors.New("datastore file could not be read or written")
 
 // Datastore contains Collections of Documents and coordinates reading / writing
 // them to a file.
@@ -81,6 +112,97 @@ type Datastore struct {
 
 	mutex sync.Mutex
 
+	// flushMutex ensures only one Flush writes to disk at a time. It is held
+	// for the duration of the Flush, while mutex is only held long enough to
+	// take a snapshot.
+	flushMutex sync.Mutex
+
+	// flushRequests counts calls to Flush. flushedRequests is the count
+	// covered by the last successful Flush, and lastFlush holds its stats;
+	// both are guarded by flushMutex.
+	flushRequests   atomic.Uint64
+	flushedRequests uint64
+	lastFlush       FlushStats
+
+	// views holds the Views created for this datastore, by name
+	views map[string]*View
+
+	// series holds the TimeSeries created for this datastore, by name
+	series map[string]*TimeSeries
+
+	// queues holds the Queues created for this datastore, by name
+	queues map[string]*Queue
+
+	// identities maps each Document instance to the Collection it is stored
+	// in, so the same instance can not be stored in two Collections
+	identities sync.Map
+
+	// closed is set by Close. See ErrClosed.
+	closed atomic.Bool
+
+	// clock replaces time.Now if it is set. See SetClock.
+	clock atomic.Pointer[func() time.Time]
+
+	// generation is incremented each time a Document is changed. See
+	// ChangesSince.
+	generation atomic.Uint64
+
+	// aliasDetection records the encoding of each Document so changes made
+	// without Upsert can be reported. See SetAliasDetection.
+	aliasDetection atomic.Bool
+
+	// strict makes Collections store and return copies of Documents. See
+	// SetStrict.
+	strict atomic.Bool
+
+	// retry controls how failed Flushes are retried. See SetRetryPolicy.
+	retry atomic.Pointer[RetryPolicy]
+
+	// deterministic makes Flush write the same bytes for the same content.
+	// See SetDeterministic.
+	deterministic bool
+
+	// lowMemory makes Flush encode one Collection at a time. See
+	// SetLowMemory.
+	lowMemory bool
+
+	// fs is the filesystem Flush writes through, or nil for OSFS. It is
+	// guarded by mutex. See SetFS.
+	fs FS
+
+	// audit is the Collection that changes are recorded in, if auditing is
+	// enabled. It is read by Collections while they are locked.
+	audit atomic.Pointer[Collection]
+
+	// events holds subscribers for lifecycle events
+	events events
+
+	// plugins holds the Plugins attached with Extend, in order. It is guarded
+	// by mutex.
+	plugins []Plugin
+
+	// middleware is called around each change to a Collection
+	middleware atomic.Pointer[[]Middleware]
+
+	// flushDelay and flushTimer are used by FlushSoon
+	flushDelay time.Duration
+	flushTimer *time.Timer
+
+	// pending counts changes that have not been flushed. It is atomic so
+	// marking a change doesn't contend with other writers. See PendingChanges.
+	pending atomic.Int64
+
+	// dirtySince is when the oldest pending change was made, in Unix
+	// nanoseconds, or 0 if there are none. watchdog reports pending changes
+	// that get too old, and is guarded by mutex. See SetWatchdog.
+	dirtySince atomic.Int64
+	watchdog   *watchdog
+
+	// opened is when the Datastore was created or opened, and flushed holds
+	// the outcome of the most recent Flush. See Health.
+	opened  time.Time
+	flushed atomic.Pointer[flushOutcome]
+
 	// Collections is public because Gob needs to read it. You should not modify
 	// this map directly. Use In(), InType(), and the Collection API instead.
 	Collections map[string]*Collection
@@ -99,6 +221,20 @@ func (d *Datastore) Path() string {
 	return d.path
 }
 
+// CollectionNames returns the names of the Collections in this Datastore, in
+// sorted order.
+func (d *Datastore) CollectionNames() []string {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	names := make([]string, 0, len(d.Collections))
+	for name := range d.Collections {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
 // In provides a pseudo-fluent interface to select a specific Collection from
 // this Datastore by name. Each collection may only hold one type of Document.
 //
@@ -117,7 +253,11 @@ func (d *Datastore) In(name string) *Collection {
 
 	// Create a new collection
 	c := &Collection{
-		Items: map[uint64]Document{},
+		Items:         map[uint64]Document{},
+		SchemaVersion: latestSchemaVersion(name),
+		name:          name,
+		store:         d,
+		index:         NewSliceIndex(),
 	}
 	d.Collections[name] = c
 	return c
@@ -138,52 +278,287 @@ func (d *Datastore) Init(name string, document Document) (*Collection, error) {
 
 // Flush writes changes to disk, or no-ops if it has already flushed all
 // changes. This uses atomic replace and is not compatible with Windows.
+//
+// If Flush is called while another Flush is running, it waits and returns once
+// a Flush that includes its changes has finished, so concurrent callers share
+// one write instead of writing the file back to back.
+//
+// A Datastore created with New has no path, so Flush fails with
+// ErrNotPersistent without touching the filesystem.
 func (d *Datastore) Flush() error {
+	return d.FlushContext(context.Background())
+}
+
+// FlushContext behaves like Flush, but gives up when ctx is done, whether it is
+// waiting for another Flush to finish or writing to disk, and returns an error
+// that wraps ctx.Err(). The file on disk is left unchanged if the Flush gives
+// up. Use it to bound how long shutdown can block on a slow disk.
+func (d *Datastore) FlushContext(ctx context.Context) error {
+	if err := d.checkOpen(); err != nil {
+		return err
+	}
+	_, err := d.flushStats(ctx)
+	return err
+}
+
+// FlushStats describes the work done by a Flush.
+type FlushStats struct {
+	// BytesWritten is the size of the compressed file written to disk.
+	BytesWritten int64
+
+	// EncodedBytes is the size of the Gob encoding before compression.
+	EncodedBytes int64
+
+	// CompressionRatio is EncodedBytes divided by BytesWritten.
+	CompressionRatio float64
+
+	// Duration is how long the Flush took.
+	Duration time.Duration
+
+	// Documents holds the number of Documents written for each Collection.
+	Documents map[string]int
+}
+
+// FlushStats behaves like Flush and also returns statistics about the data that
+// was written, so you can log or alert on abnormal growth or slow storage.
+func (d *Datastore) FlushStats() (FlushStats, error) {
+	if err := d.checkOpen(); err != nil {
+		return FlushStats{}, err
+	}
+	return d.flushStats(context.Background())
+}
+
+// flushStats flushes the Datastore and sends the flush events. It is called by
+// Close after the Datastore has been marked closed.
+//
+// Callers that arrive while another Flush is running wait for it, and then
+// only Flush if no Flush has started since they arrived. A Flush that started
+// later includes their changes, so several callers waiting at once share a
+// single write.
+func (d *Datastore) flushStats(ctx context.Context) (FlushStats, error) {
+	defer profile(ctx, "flush", "")()
+	request := d.flushRequests.Add(1)
+	if err := d.lockFlush(ctx); err != nil {
+		return FlushStats{}, &Error{Op: "flush", Path: d.path, Err: err}
+	}
+	defer d.flushMutex.Unlock()
+
+	if d.flushedRequests >= request {
+		return d.lastFlush, nil
+	}
+	// Every caller counted so far made its changes before the snapshot we
+	// are about to take
+	covered := d.flushRequests.Load()
+
+	d.verifyChecksums()
+	d.detectAliasing()
+	d.emit(Event{Type: EventFlushStart})
+	stats, err := d.flushRetry(ctx)
+	event := Event{Type: EventFlushEnd, Err: err}
+	if err == nil {
+		event.Stats = &stats
+	}
+	d.emit(event)
+	d.recordFlush(err)
+	if err == nil {
+		d.flushedRequests = covered
+		d.lastFlush = stats
+	}
+	return stats, err
+}
+
+// flush writes the Datastore to disk. It must be called while flushMutex is
+// held. If it fails the temp file is removed, so a failed flush leaves the
+// directory as it found it.
+func (d *Datastore) flush(ctx context.Context) (stats FlushStats, err error) {
+	if d.path == "" {
+		return stats, &Error{Op: "flush", Err: ErrNotPersistent}
+	}
+	start := time.Now()
+	snapshotAt := d.now()
+	// Read the pending count before the snapshot. A change made while the
+	// snapshot is being taken may be counted as pending even though it was
+	// written, but a change will never be counted as written when it wasn't.
+	pending := d.PendingChanges()
+	d.recordSchemas()
 	d.mutex.Lock()
-	defer d.mutex.Unlock()
+	fsys := d.filesystem()
+	d.mutex.Unlock()
 
 	temp := d.path + ".tmp"
 	final := d.path
 
-	if err := os.RemoveAll(temp); err != nil {
-		return err
+	if err := fsys.RemoveAll(temp); err != nil {
+		return stats, fileError("flush", d.path, err)
 	}
 
-	file, err := os.OpenFile(temp, os.O_RDWR|os.O_CREATE|os.O_TRUNC|os.O_EXCL, 0644)
+	file, err := fsys.Create(temp)
 	if err != nil {
-		return err
+		return stats, fileError("flush", d.path, err)
+	}
+	defer func() {
+		if err != nil {
+			// Close may already have been called; the error doesn't matter
+			file.Close()
+			fsys.RemoveAll(temp)
+		}
+	}()
+
+	compressed := &countingWriter{writer: &contextWriter{ctx: ctx, writer: file}}
+	stats.Documents = map[string]int{}
+	encoded, err := d.encodeFile(compressed, stats.Documents)
+	if err != nil {
+		return stats, fileError("flush", d.path, err)
+	}
+
+	// Make sure the contents are on disk before the rename makes them the
+	// Datastore, so a crash can't leave a torn file in its place
+	if err := file.Sync(); err != nil {
+		return stats, fileError("flush", d.path, err)
+	}
+
+	if err := file.Close(); err != nil {
+		return stats, fileError("flush", d.path, err)
 	}
 
-	writer := gzip.NewWriter(file)
+	if err := ctx.Err(); err != nil {
+		return stats, &Error{Op: "flush", Path: d.path, Err: err}
+	}
+	if err := fsys.Rename(temp, final); err != nil {
+		return stats, fileError("flush", d.path, err)
+	}
+	d.markFlushed(pending, snapshotAt)
+
+	stats.BytesWritten = compressed.count
+	stats.EncodedBytes = encoded
+	if stats.BytesWritten > 0 {
+		stats.CompressionRatio = float64(stats.EncodedBytes) / float64(stats.BytesWritten)
+	}
+	stats.Duration = time.Since(start)
+	return stats, nil
+}
+
+// encodeFile writes a snapshot of the Datastore to w in the format of a
+// Datastore file, and returns the number of bytes encoded before compression.
+// The number of Documents in each Collection is recorded in counts.
+func (d *Datastore) encodeFile(w io.Writer, counts map[string]int) (int64, error) {
+	d.mutex.Lock()
+	deterministic := d.deterministic
+	lowMemory := d.lowMemory
+	d.mutex.Unlock()
+
+	// In low-memory mode each Collection is copied as it is encoded instead
+	var snapshot *Datastore
+	if !lowMemory {
+		snapshot = d.snapshot()
+		for name, c := range snapshot.Collections {
+			counts[name] = len(c.Items)
+		}
+	}
+
+	writer := gzip.NewWriter(w)
 	writer.Comment = d.signature
-	writer.ModTime = time.Now()
 
-	encoder := gob.NewEncoder(writer)
-	if err := encoder.Encode(d); err != nil {
-		return err
+	encoded := &countingWriter{writer: writer}
+	encoder := gob.NewEncoder(encoded)
+	var err error
+	switch {
+	case lowMemory:
+		if deterministic {
+			writer.Name = sortedStreamedLayout
+		} else {
+			writer.Name = streamedLayout
+			writer.ModTime = d.now()
+		}
+		err = d.encodeStreamed(encoder, counts)
+	case deterministic:
+		writer.Name = sortedLayout
+		err = encodeSorted(encoder, snapshot)
+	default:
+		writer.ModTime = d.now()
+		err = encoder.Encode(snapshot)
+	}
+	if err != nil {
+		return encoded.count, err
 	}
+	return encoded.count, writer.Close()
+}
 
-	if err := writer.Close(); err != nil {
-		return err
+// lockFlush acquires flushMutex, or returns ctx.Err() if ctx is done first.
+func (d *Datastore) lockFlush(ctx context.Context) error {
+	if ctx.Done() == nil {
+		d.flushMutex.Lock()
+		return nil
 	}
 
-	if err := file.Close(); err != nil {
-		return err
+	locked := make(chan struct{})
+	go func() {
+		d.flushMutex.Lock()
+		close(locked)
+	}()
+
+	select {
+	case <-locked:
+		return nil
+	case <-ctx.Done():
+		// Release the lock once the goroutine gets it
+		go func() {
+			<-locked
+			d.flushMutex.Unlock()
+		}()
+		return ctx.Err()
 	}
+}
 
-	if err := os.Rename(temp, final); err != nil {
-		return err
+// contextWriter fails writes once its context is done.
+type contextWriter struct {
+	ctx    context.Context
+	writer io.Writer
+}
+
+func (c *contextWriter) Write(p []byte) (int, error) {
+	if err := c.ctx.Err(); err != nil {
+		return 0, err
 	}
+	return c.writer.Write(p)
+}
+
+// countingWriter counts the bytes written through it.
+type countingWriter struct {
+	writer io.Writer
+	count  int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.writer.Write(p)
+	c.count += int64(n)
+	return n, err
+}
+
+// snapshot returns a copy of the Datastore that can be encoded without holding
+// any locks. The Datastore is only locked while the copy is made, so writers
+// are not blocked while the snapshot is encoded and written to disk.
+func (d *Datastore) snapshot() *Datastore {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
 
-	return nil
+	snapshot := &Datastore{
+		Collections: make(map[string]*Collection, len(d.Collections)),
+	}
+	for name, c := range d.Collections {
+		snapshot.Collections[name] = c.snapshot()
+	}
+	return snapshot
 }
 
 // New creates a new in-memory Datastore. Flush will never succeed with this
 // type of Datastore. For a persistent Datastore, start with Open or Create.
 func New() *Datastore {
-	return &Datastore{
+	ds := &Datastore{
 		Collections: map[string]*Collection{},
 	}
+	ds.opened = ds.now()
+	return ds
 }
 
 // Create creates a new datastore and flushes it to disk. For details on
@@ -212,55 +587,75 @@ func Create(path, signature string) (*Datastore, error) {
 // If Open fails with ErrInvalidSignature you can call ds.Signature() on the
 // result to see what Signature was found on disk.
 func Open(path, signature string) (ds *Datastore, err error) {
-	if _, err = os.Stat(path); os.IsNotExist(err) {
-		return
+	defer profile(context.Background(), "open", "")()
+	ds, err = open(path, signature)
+	if err != nil {
+		return nil, err
 	}
 
-	// TODO acquire exclusive read/write lock when opening the file
-	//  Q: Is this actually necessary since we use an atomic write/rename? Probably...
-	//file, err := os.OpenFile(path, os.O_RDWR|os.O_EXCL, 0644)
-	file, err := os.Open(path)
-	if err != nil {
-		return
+	for _, c := range ds.Collections {
+		if err = c.upgrade(); err != nil {
+			return nil, &Error{Op: "upgrade", Path: path, Collection: c.name, Err: err}
+		}
 	}
-	defer file.Close()
 
-	reader, err := gzip.NewReader(file)
-	if err != nil {
+	ds.setAsideTemp()
+	ds.verifyChecksums()
+	ds.verifySchema(func(mismatch *SchemaError) {
+		ds.emit(Event{Type: EventSchemaChange, Collection: mismatch.Collection, Err: mismatch})
+	})
+	ds.emit(Event{Type: EventOpen})
+	return
+}
+
+// setAsideTemp moves a temp file left behind by an interrupted Flush to
+// <path>.orphaned and sends EventOrphanedFlush. The temp file may be a complete
+// copy that was never renamed into place, so it is kept for recovery rather
+// than deleted. An older .orphaned file is replaced.
+func (d *Datastore) setAsideTemp() {
+	temp := d.path + ".tmp"
+	if _, err := os.Lstat(temp); err != nil {
 		return
 	}
-	defer reader.Close()
 
-	ds = &Datastore{
-		path:      path,
-		signature: reader.Comment,
+	orphaned := d.path + ".orphaned"
+	err := os.RemoveAll(orphaned)
+	if err == nil {
+		err = os.Rename(temp, orphaned)
 	}
-
-	// Validate signature matches before we decode
-	if reader.Comment != Signature(signature) {
-		return nil, ErrInvalidSignature
+	if err != nil {
+		// Don't leave the temp file in place if it can't be kept
+		os.RemoveAll(temp)
+		d.emit(Event{Type: EventOrphanedFlush, Err: fileError("open", temp, err)})
+		return
 	}
+	d.emit(Event{Type: EventOrphanedFlush, Err: &Error{Op: "open", Path: orphaned, Err: ErrOrphanedFlush}})
+}
 
-	decoder := gob.NewDecoder(reader)
-
-	if err = decoder.Decode(ds); err != nil {
-		return
+// open reads and decodes the Datastore but does not run upgrades.
+func open(path, signature string) (ds *Datastore, err error) {
+	if _, err = os.Stat(path); os.IsNotExist(err) {
+		return nil, fileError("open", path, err)
 	}
 
-	// Restore transient data structures (private fields)
-	for _, c := range ds.Collections {
-		c.generateList()
+	// TODO acquire exclusive read/write lock when opening the file
+	//  Q: Is this actually necessary since we use an atomic write/rename? Probably...
+	//file, err := os.OpenFile(path, os.O_RDWR|os.O_EXCL, 0644)
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fileError("open", path, err)
 	}
+	defer file.Close()
 
-	return
+	return decode(file, "open", path, Signature(signature))
 }
 
 // OpenOrCreate is a convenience function that can be called to read or
 // initialize a datastore in a single call. We first call Open, and if the Open
-// call fails because of os.IsNotExist we will attempt to Create it.
+// call fails because the file does not exist we will attempt to Create it.
 func OpenOrCreate(path, signature string) (store *Datastore, err error) {
 	store, err = Open(path, signature)
-	if err != nil && os.IsNotExist(err) {
+	if err != nil && errors.Is(err, os.ErrNotExist) {
 		store, err = Create(path, signature)
 	}
 	return
@@ -4,13 +4,17 @@ package datastore_test
 
 import (
 	"encoding/gob"
+	"errors"
 	"io/ioutil"
 	"os"
 	"path/filepath"
 	"reflect"
 	"runtime"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"git.stormbase.io/cbednarski/datastore"
 )
@@ -140,6 +144,119 @@ func TestCreateDatastore(t *testing.T) {
 	}
 }
 
+func TestFlushWhileWriting(t *testing.T) {
+	tempdir, err := ioutil.TempDir("", "datastore")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempdir)
+
+	datapath := filepath.Join(tempdir, "writing"+datastore.Extension)
+	ds, err := datastore.Create(datapath, TestdataSignature)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	numbers := ds.In("numbers")
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 500; i++ {
+			if err := numbers.Upsert(&NumberDocument{Number: i}); err != nil {
+				t.Error(err)
+				return
+			}
+		}
+	}()
+
+	for i := 0; i < 5; i++ {
+		if err := ds.Flush(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	<-done
+
+	if err := ds.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	reopened, err := datastore.Open(datapath, TestdataSignature)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count := len(reopened.In("numbers").List()); count != 500 {
+		t.Errorf("Expected 500 documents, found %d", count)
+	}
+}
+
+func TestFlushInMemory(t *testing.T) {
+	dir := t.TempDir()
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+
+	if err := datastore.New().Flush(); !errors.Is(err, datastore.ErrNotPersistent) {
+		t.Errorf("Expected %s, found %v", datastore.ErrNotPersistent, err)
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 0 {
+		t.Errorf("Expected no files to be written, found %v", entries)
+	}
+}
+
+func TestFlushStats(t *testing.T) {
+	tempdir, err := ioutil.TempDir("", "datastore")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempdir)
+
+	datapath := filepath.Join(tempdir, "stats"+datastore.Extension)
+	ds, err := datastore.Create(datapath, TestdataSignature)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 100; i++ {
+		if err := ds.In("names").Upsert(&NameDocument{Name: "the same name over and over"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	ds.In("empty")
+
+	stats, err := ds.FlushStats()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	info, err := os.Stat(datapath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.BytesWritten != info.Size() {
+		t.Errorf("Expected %d bytes written, found %d", info.Size(), stats.BytesWritten)
+	}
+	if stats.EncodedBytes <= stats.BytesWritten || stats.CompressionRatio <= 1 {
+		t.Errorf("Expected repetitive data to compress, found %#v", stats)
+	}
+	if stats.Duration <= 0 {
+		t.Errorf("Expected a positive duration, found %s", stats.Duration)
+	}
+
+	expected := map[string]int{"names": 100, "empty": 0}
+	if !reflect.DeepEqual(stats.Documents, expected) {
+		t.Errorf("Expected %#v, found %#v", expected, stats.Documents)
+	}
+}
+
 func TestCreateDatastoreDoesNotExist(t *testing.T) {
 	_, err := datastore.Create(filepath.Join("doesnotexist", "filename"), "sig")
 	if err == nil || !os.IsNotExist(err) {
@@ -210,6 +327,53 @@ func TestOpenDatastoreInvalidGob(t *testing.T) {
 	}
 }
 
+func TestOpenOrphanedFlush(t *testing.T) {
+	tempdir, err := ioutil.TempDir("", "datastore")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempdir)
+
+	datapath := filepath.Join(tempdir, "orphaned"+datastore.Extension)
+	if _, err := datastore.Create(datapath, TestdataSignature); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(datapath+".tmp", []byte("partial"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var received []error
+	unsubscribe := datastore.Subscribe(func(event datastore.Event) {
+		if event.Path == datapath && event.Type == datastore.EventOrphanedFlush {
+			received = append(received, event.Err)
+		}
+	})
+	defer unsubscribe()
+
+	ds, err := datastore.Open(datapath, TestdataSignature)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(received) != 1 || !errors.Is(received[0], datastore.ErrOrphanedFlush) {
+		t.Fatalf("Expected one %s event, found %v", datastore.EventOrphanedFlush, received)
+	}
+
+	if _, err := os.Stat(datapath + ".tmp"); !os.IsNotExist(err) {
+		t.Errorf("Expected temp file to be moved, found %v", err)
+	}
+	data, err := ioutil.ReadFile(datapath + ".orphaned")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "partial" {
+		t.Errorf("Expected %q, found %q", "partial", data)
+	}
+
+	if err := ds.Flush(); err != nil {
+		t.Fatal(err)
+	}
+}
+
 func TestOpenOrCreate(t *testing.T) {
 	_, err := datastore.OpenOrCreate(TestdataDatastore, TestdataSignature)
 	if err != nil {
@@ -332,3 +496,127 @@ func TestReadSignature(t *testing.T) {
 		t.Errorf("Expected error, no gzip data")
 	}
 }
+
+func TestParseSignature(t *testing.T) {
+	parsed, err := datastore.ParseSignature(datastore.Signature("my.pet.store.3;build=abc;arch=amd64"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := datastore.ParsedSignature{
+		Program:  "my.pet.store",
+		Version:  3,
+		Metadata: map[string]string{"build": "abc", "arch": "amd64"},
+	}
+	if !reflect.DeepEqual(parsed, expected) {
+		t.Errorf("Expected %#v, found %#v", expected, parsed)
+	}
+	if parsed.String() != "my.pet.store.3;arch=amd64;build=abc" {
+		t.Errorf("Unexpected signature %q", parsed.String())
+	}
+
+	older := datastore.ParsedSignature{Program: "my.pet.store", Version: 2}
+	if !parsed.CompatibleWith(older) || older.CompatibleWith(parsed) {
+		t.Error("Expected newer program to read older data, but not the reverse")
+	}
+	if parsed.CompatibleWith(datastore.ParsedSignature{Program: "cakes", Version: 3}) {
+		t.Error("Expected different programs to be incompatible")
+	}
+	if parsed.Compare(older) != 1 || older.Compare(parsed) != -1 || parsed.Compare(parsed) != 0 {
+		t.Error("Unexpected result from Compare")
+	}
+
+	for _, invalid := range []string{"cakes", "cakes.x", ".3", "cakes.3;build"} {
+		if _, err := datastore.ParseSignature(invalid); !errors.Is(err, datastore.ErrInvalidSignature) {
+			t.Errorf("Expected %s for %q, found %v", datastore.ErrInvalidSignature, invalid, err)
+		}
+	}
+}
+
+func TestInitSigned(t *testing.T) {
+	tempdir, err := ioutil.TempDir("", "datastore")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempdir)
+
+	datapath := filepath.Join(tempdir, "signed"+datastore.Extension)
+	ds, err := datastore.Create(datapath, TestdataSignature)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ds.InitSigned("plugin", "plugin.1", &NameDocument{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := ds.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	ds, err = datastore.Open(datapath, TestdataSignature)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ds.InitSigned("plugin", "plugin.1", &NameDocument{}); err != nil {
+		t.Error(err)
+	}
+	if _, err := ds.InitSigned("plugin", "plugin.2", &NameDocument{}); !errors.Is(err, datastore.ErrInvalidSignature) {
+		t.Errorf("Expected %s, found %v", datastore.ErrInvalidSignature, err)
+	}
+
+	if err := ds.In("plugin").SetSignature("plugin.2"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ds.InitSigned("plugin", "plugin.2", &NameDocument{}); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestFlushCoalescing(t *testing.T) {
+	tempdir, err := ioutil.TempDir("", "datastore")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempdir)
+
+	ds, err := datastore.Create(filepath.Join(tempdir, "coalesce"+datastore.Extension), TestdataSignature)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Hold up the first Flush until the other callers are waiting for it
+	release := make(chan struct{})
+	var starts atomic.Int32
+	ds.Subscribe(func(event datastore.Event) {
+		if event.Type == datastore.EventFlushStart && starts.Add(1) == 1 {
+			<-release
+		}
+	})
+
+	var wg sync.WaitGroup
+	flush := func() {
+		defer wg.Done()
+		if err := ds.Flush(); err != nil {
+			t.Error(err)
+		}
+	}
+	wg.Add(1)
+	go flush()
+	for starts.Load() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	for i := 0; i < 5; i++ {
+		ds.In("names").Upsert(&NameDocument{Name: "waiting"})
+		wg.Add(1)
+		go flush()
+	}
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	if found := starts.Load(); found != 2 {
+		t.Errorf("Expected the waiting callers to share one flush, found %d flushes", found)
+	}
+	if ds.Dirty() {
+		t.Error("Expected every change to be flushed")
+	}
+}
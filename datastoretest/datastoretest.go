@@ -0,0 +1,156 @@
+// Package datastoretest provides helpers for testing programs that use
+// datastore, such as temporary Datastores, fixtures, golden files, and ways to
+// damage a Datastore file or the disk beneath it to exercise failure paths.
+package datastoretest
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"git.stormbase.io/cbednarski/datastore"
+)
+
+// UpdateEnv is the environment variable that makes Golden write the golden file
+// instead of comparing it. For example:
+//
+//	UPDATE_GOLDEN=1 go test ./...
+const UpdateEnv = "UPDATE_GOLDEN"
+
+// ErrInjected is returned by FailingWriter once its limit is reached, and
+// wrapped by the errors FaultyFS injects.
+var ErrInjected = errors.New("datastoretest: injected write failure")
+
+// NewTempStore creates a Datastore in a temporary directory that is removed
+// when the test finishes.
+func NewTempStore(t testing.TB, signature string) *datastore.Datastore {
+	t.Helper()
+
+	ds, err := datastore.Create(filepath.Join(t.TempDir(), "test"+datastore.Extension), signature)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ds
+}
+
+// Reopen flushes the Datastore and opens it again from disk, so you can check
+// that your data survives a round trip.
+func Reopen(t testing.TB, ds *datastore.Datastore) *datastore.Datastore {
+	t.Helper()
+
+	if err := ds.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	reopened, err := datastore.Open(ds.Path(), strings.TrimPrefix(ds.Signature(), datastore.Signature("")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return reopened
+}
+
+// Seed upserts each Document into the Collection, and fails the test if any of
+// them can not be stored.
+func Seed(t testing.TB, c *datastore.Collection, documents ...datastore.Document) {
+	t.Helper()
+
+	for _, document := range documents {
+		if err := c.Upsert(document); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// Golden compares the Collection, exported with ExportJSON, to the contents of
+// the golden file at path. If the UPDATE_GOLDEN environment variable is set the
+// golden file is written instead.
+func Golden(t testing.TB, c *datastore.Collection, path string) {
+	t.Helper()
+
+	exported := &bytes.Buffer{}
+	if err := c.ExportJSON(exported); err != nil {
+		t.Fatal(err)
+	}
+
+	if os.Getenv(UpdateEnv) != "" {
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, exported.Bytes(), 0644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+
+	expected, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("%s (set %s=1 to create it)", err, UpdateEnv)
+	}
+	if !bytes.Equal(expected, exported.Bytes()) {
+		t.Errorf("Collection does not match %s (set %s=1 to update it)\nExpected:\n%s\nFound:\n%s", path, UpdateEnv, expected, exported.Bytes())
+	}
+}
+
+// CorruptFile flips the bits of the byte at offset in the file at path. Use a
+// negative offset to count from the end of the file.
+func CorruptFile(t testing.TB, path string, offset int64) {
+	t.Helper()
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if offset < 0 {
+		offset += int64(len(data))
+	}
+	if offset < 0 || offset >= int64(len(data)) {
+		t.Fatalf("offset %d is outside %s (%d bytes)", offset, path, len(data))
+	}
+	data[offset] ^= 0xff
+
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TruncateFile shortens the file at path to size bytes, as if a write had been
+// interrupted.
+func TruncateFile(t testing.TB, path string, size int64) {
+	t.Helper()
+
+	if err := os.Truncate(path, size); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// FailingWriter writes to W until Limit bytes have been written, and then
+// returns ErrInjected. Use it with ExportJSON, ExportCSV, and similar methods to
+// test how your program handles a failed write.
+type FailingWriter struct {
+	W     io.Writer
+	Limit int64
+
+	written int64
+}
+
+func (f *FailingWriter) Write(p []byte) (int, error) {
+	remaining := f.Limit - f.written
+	if remaining <= 0 {
+		return 0, ErrInjected
+	}
+	if int64(len(p)) > remaining {
+		n, err := f.W.Write(p[:remaining])
+		f.written += int64(n)
+		if err == nil {
+			err = ErrInjected
+		}
+		return n, err
+	}
+
+	n, err := f.W.Write(p)
+	f.written += int64(n)
+	return n, err
+}
@@ -0,0 +1,134 @@
+package datastoretest_test
+
+import (
+	"bytes"
+	"encoding/gob"
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"git.stormbase.io/cbednarski/datastore"
+	"git.stormbase.io/cbednarski/datastore/datastoretest"
+)
+
+type Pet struct {
+	Identifier uint64
+	Name       string
+}
+
+func (p *Pet) ID() uint64 {
+	return p.Identifier
+}
+
+func (p *Pet) SetID(id uint64) {
+	p.Identifier = id
+}
+
+func init() {
+	gob.Register(&Pet{})
+}
+
+func TestReopen(t *testing.T) {
+	ds := datastoretest.NewTempStore(t, "pets.1")
+	datastoretest.Seed(t, ds.In("pets"), &Pet{Name: "Chomper"}, &Pet{Name: "Mittens"})
+
+	reopened := datastoretest.Reopen(t, ds)
+	if len(reopened.In("pets").List()) != 2 {
+		t.Errorf("Expected 2 pets, found %d", len(reopened.In("pets").List()))
+	}
+
+	datastoretest.Golden(t, reopened.In("pets"), filepath.Join("testdata", "pets.golden"))
+}
+
+func TestCorruptFile(t *testing.T) {
+	ds := datastoretest.NewTempStore(t, "pets.1")
+	datastoretest.Seed(t, ds.In("pets"), &Pet{Name: "Chomper"})
+	if err := ds.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	datastoretest.CorruptFile(t, ds.Path(), -1)
+	if _, err := datastore.Open(ds.Path(), "pets.1"); !errors.Is(err, datastore.ErrCorrupt) {
+		t.Errorf("Expected %s, found %v", datastore.ErrCorrupt, err)
+	}
+
+	// Damage inside the compressed data is detected too
+	if err := ds.In("pets").Upsert(&Pet{Name: "Mittens"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := ds.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	datastoretest.CorruptFile(t, ds.Path(), -40)
+	if _, err := datastore.Open(ds.Path(), "pets.1"); !errors.Is(err, datastore.ErrCorrupt) {
+		t.Errorf("Expected %s, found %v", datastore.ErrCorrupt, err)
+	}
+
+	datastoretest.TruncateFile(t, ds.Path(), 20)
+	if _, err := datastore.Open(ds.Path(), "pets.1"); !errors.Is(err, datastore.ErrCorrupt) {
+		t.Errorf("Expected %s, found %v", datastore.ErrCorrupt, err)
+	}
+}
+
+func TestFailingWriter(t *testing.T) {
+	ds := datastore.New()
+	datastoretest.Seed(t, ds.In("pets"), &Pet{Name: "Chomper"}, &Pet{Name: "Mittens"})
+
+	buffer := &bytes.Buffer{}
+	writer := &datastoretest.FailingWriter{W: buffer, Limit: 10}
+	if err := ds.In("pets").ExportJSON(writer); !errors.Is(err, datastoretest.ErrInjected) {
+		t.Errorf("Expected %s, found %v", datastoretest.ErrInjected, err)
+	}
+	if buffer.Len() != 10 {
+		t.Errorf("Expected 10 bytes written, found %d", buffer.Len())
+	}
+}
+
+func TestFaultyFS(t *testing.T) {
+	ds := datastoretest.NewTempStore(t, "pets.1")
+	datastoretest.Seed(t, ds.In("pets"), &Pet{Name: "Chomper"})
+	if err := ds.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	faulty := &datastoretest.FaultyFS{}
+	ds.SetFS(faulty)
+
+	// A failed Flush leaves the previous file in place
+	for _, fault := range []datastoretest.Fault{datastoretest.ShortWrite, datastoretest.SyncFailure, datastoretest.RenameFailure} {
+		if err := ds.In("pets").Upsert(&Pet{Name: "Mittens"}); err != nil {
+			t.Fatal(err)
+		}
+		faulty.Inject(fault)
+		err := ds.Flush()
+		if !errors.Is(err, datastoretest.ErrInjected) || !errors.Is(err, datastore.ErrIO) {
+			t.Errorf("Expected %s, found %v", datastore.ErrIO, err)
+		}
+		if faulty.Injected(fault) != 1 {
+			t.Errorf("Expected fault %d to be injected once, found %d", fault, faulty.Injected(fault))
+		}
+
+		reopened, err := datastore.Open(ds.Path(), "pets.1")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(reopened.In("pets").List()) != 1 {
+			t.Errorf("Expected 1 pet after fault %d, found %d", fault, len(reopened.In("pets").List()))
+		}
+	}
+
+	if err := ds.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	// A torn file goes unnoticed until it is opened
+	faulty.Inject(datastoretest.TornFile)
+	if err := ds.In("pets").Upsert(&Pet{Name: "Rex"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := ds.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := datastore.Open(ds.Path(), "pets.1"); !errors.Is(err, datastore.ErrCorrupt) {
+		t.Errorf("Expected %s, found %v", datastore.ErrCorrupt, err)
+	}
+}
@@ -0,0 +1,156 @@
+package datastoretest
+
+import (
+	"bytes"
+	"os"
+	"sync"
+
+	"git.stormbase.io/cbednarski/datastore"
+)
+
+// Fault is a failure that FaultyFS can inject.
+type Fault int
+
+const (
+	// ShortWrite makes a Write store half of its data and then fail.
+	ShortWrite Fault = iota + 1
+
+	// SyncFailure makes Sync fail, as if the disk reported an I/O error.
+	SyncFailure
+
+	// RenameFailure makes Rename fail, so the new file is never put in place.
+	RenameFailure
+
+	// TornFile makes a file keep only the first half of what was written to
+	// it, while every operation still succeeds. It simulates a disk that lost
+	// data it claimed to have synced before the system crashed.
+	TornFile
+)
+
+// FaultyFS is a datastore.FS that injects failures on demand, so you can test
+// how your program (and the Datastore) behaves when the disk misbehaves. Pass
+// it to Datastore.SetFS, then call Inject before the Flush that should fail:
+//
+//	faulty := &datastoretest.FaultyFS{}
+//	ds.SetFS(faulty)
+//	faulty.Inject(datastoretest.RenameFailure)
+//	err := ds.Flush() // fails, and the file on disk is unchanged
+//
+// Injected errors wrap ErrInjected and are classified as datastore.ErrIO.
+type FaultyFS struct {
+	// FS receives the operations that are not failed. If it is nil,
+	// datastore.OSFS is used.
+	FS datastore.FS
+
+	mutex    sync.Mutex
+	armed    map[Fault]int
+	injected map[Fault]int
+}
+
+// Inject arms fault so it happens the next time the operation it affects is
+// called. Call Inject more than once to make it happen more than once.
+func (f *FaultyFS) Inject(fault Fault) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	if f.armed == nil {
+		f.armed = map[Fault]int{}
+	}
+	f.armed[fault]++
+}
+
+// Injected returns the number of times fault has happened.
+func (f *FaultyFS) Injected(fault Fault) int {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	return f.injected[fault]
+}
+
+// take disarms fault and returns true if it was armed.
+func (f *FaultyFS) take(fault Fault) bool {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	if f.armed[fault] == 0 {
+		return false
+	}
+	f.armed[fault]--
+	if f.injected == nil {
+		f.injected = map[Fault]int{}
+	}
+	f.injected[fault]++
+	return true
+}
+
+func (f *FaultyFS) fs() datastore.FS {
+	if f.FS == nil {
+		return datastore.OSFS
+	}
+	return f.FS
+}
+
+func (f *FaultyFS) Create(name string) (datastore.File, error) {
+	file, err := f.fs().Create(name)
+	if err != nil {
+		return nil, err
+	}
+	return &faultyFile{File: file, fs: f, name: name, torn: f.take(TornFile)}, nil
+}
+
+func (f *FaultyFS) Rename(oldpath, newpath string) error {
+	if f.take(RenameFailure) {
+		return &os.LinkError{Op: "rename", Old: oldpath, New: newpath, Err: ErrInjected}
+	}
+	return f.fs().Rename(oldpath, newpath)
+}
+
+func (f *FaultyFS) RemoveAll(name string) error {
+	return f.fs().RemoveAll(name)
+}
+
+// faultyFile injects the faults that affect an open file.
+type faultyFile struct {
+	datastore.File
+	fs   *FaultyFS
+	name string
+
+	// torn files hold their writes in buffer, and only write half of it when
+	// they are closed
+	torn   bool
+	buffer bytes.Buffer
+}
+
+func (f *faultyFile) Write(p []byte) (int, error) {
+	if f.fs.take(ShortWrite) {
+		n, err := f.write(p[:len(p)/2])
+		if err == nil {
+			err = &os.PathError{Op: "write", Path: f.name, Err: ErrInjected}
+		}
+		return n, err
+	}
+	return f.write(p)
+}
+
+func (f *faultyFile) write(p []byte) (int, error) {
+	if f.torn {
+		return f.buffer.Write(p)
+	}
+	return f.File.Write(p)
+}
+
+func (f *faultyFile) Sync() error {
+	if f.fs.take(SyncFailure) {
+		return &os.PathError{Op: "sync", Path: f.name, Err: ErrInjected}
+	}
+	return f.File.Sync()
+}
+
+func (f *faultyFile) Close() error {
+	if f.torn {
+		data := f.buffer.Bytes()
+		f.torn = false
+		if _, err := f.File.Write(data[:len(data)/2]); err != nil {
+			f.File.Close()
+			return err
+		}
+	}
+	return f.File.Close()
+}
@@ -0,0 +1,133 @@
+package datastore
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/gob"
+	"io"
+	"time"
+)
+
+// Header is the gzip header of a Datastore file. See ParseHeader.
+type Header struct {
+	// Signature is the signature the file was written with, including the
+	// "datastore:" prefix.
+	Signature string
+
+	// Deterministic is true if the file was written by a deterministic
+	// Datastore. See SetDeterministic.
+	Deterministic bool
+
+	// LowMemory is true if the file was written in low-memory mode. See
+	// SetLowMemory.
+	LowMemory bool
+
+	// ModTime is when the file was written, or zero for a deterministic file.
+	ModTime time.Time
+}
+
+// ParseHeader parses the header at the start of a Datastore file. data only
+// needs to hold the header, not the whole file. It is cheaper than
+// ReadSignature when you already have the bytes, for example from an upload.
+//
+// ParseHeader returns an *Error classified as ErrCorrupt if data does not begin
+// with a complete gzip header. It does not check the signature.
+func ParseHeader(data []byte) (Header, error) {
+	reader, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return Header{}, fileError("parse header", "", err)
+	}
+	// Close does not read any further, so the error can be ignored
+	defer reader.Close()
+	return header(reader), nil
+}
+
+// header returns the Header read by reader.
+func header(reader *gzip.Reader) Header {
+	deterministic, lowMemory := layout(reader.Name)
+	return Header{
+		Signature:     reader.Comment,
+		Deterministic: deterministic,
+		LowMemory:     lowMemory,
+		ModTime:       reader.ModTime,
+	}
+}
+
+// Decode reads a Datastore from r, which holds the contents of a Datastore
+// file. It does the same work as Open without touching the filesystem, so it is
+// useful for files received over the network and as a fuzzing target. The
+// result is an in-memory Datastore (see New) and Decode does not check its
+// signature; compare Signature() with the value you expect before trusting it.
+//
+// As with Open, you must call gob.Register for each type stored in the file.
+// Decode returns an *Error classified as ErrCorrupt or ErrCodec if r can not be
+// decoded.
+func Decode(r io.Reader) (*Datastore, error) {
+	return decode(r, "decode", "", "")
+}
+
+// decode reads a Datastore written by Flush from r. If signature is not empty
+// the file must match it; it includes the "datastore:" prefix, so Open always
+// passes one. Upgrades are not run.
+func decode(r io.Reader, op, path, signature string) (ds *Datastore, err error) {
+	reader, err := gzip.NewReader(r)
+	if err != nil {
+		classified := fileError(op, path, err)
+		globalEvents.send(Event{Type: EventCorruption, Path: path, Time: time.Now(), Err: classified})
+		// Open has always returned this error as it is (see Error)
+		if op == "open" && err == gzip.ErrHeader {
+			return nil, err
+		}
+		return nil, classified
+	}
+	defer reader.Close()
+
+	header := header(reader)
+	ds = &Datastore{
+		path:          path,
+		signature:     header.Signature,
+		deterministic: header.Deterministic,
+		lowMemory:     header.LowMemory,
+	}
+	ds.opened = ds.now()
+
+	// Validate signature matches before we decode
+	if signature != "" && header.Signature != signature {
+		return nil, fileError(op, path, ErrInvalidSignature)
+	}
+
+	decoder := gob.NewDecoder(reader)
+
+	// Read to the end of the stream even after decoding, so gzip verifies its
+	// checksum. A damaged file often fails to decode before the checksum is
+	// reached, so this also tells corruption apart from a type mismatch.
+	if ds.lowMemory {
+		err = decodeStreamed(decoder, ds)
+	} else if ds.deterministic {
+		err = decodeSorted(decoder, ds)
+	} else {
+		err = decoder.Decode(ds)
+	}
+	if _, drainErr := io.Copy(io.Discard, reader); drainErr != nil {
+		err = drainErr
+	}
+	if err != nil {
+		err = fileError(op, path, err)
+		globalEvents.send(Event{Type: EventCorruption, Path: path, Time: time.Now(), Err: err})
+		return nil, err
+	}
+
+	// Restore transient data structures (private fields)
+	for name, c := range ds.Collections {
+		c.name = name
+		c.store = ds
+		c.generateList()
+		for _, generation := range c.Generations {
+			if generation > ds.generation.Load() {
+				ds.generation.Store(generation)
+			}
+		}
+	}
+
+	return ds, nil
+}
@@ -0,0 +1,120 @@
+package datastore_test
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"git.stormbase.io/cbednarski/datastore"
+)
+
+// seedFiles returns Datastore files written in each layout, for use as fuzz
+// seeds.
+func seedFiles(f *testing.F) [][]byte {
+	f.Helper()
+
+	files := [][]byte{}
+	for _, path := range []string{TestdataDatastore, TestdataInvalid, TestdataReadonly} {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			f.Fatal(err)
+		}
+		files = append(files, data)
+	}
+
+	for _, configure := range []func(*datastore.Datastore){
+		func(*datastore.Datastore) {},
+		func(ds *datastore.Datastore) { ds.SetDeterministic(true) },
+		func(ds *datastore.Datastore) { ds.SetLowMemory(true) },
+	} {
+		ds, err := datastore.Create(filepath.Join(f.TempDir(), "seed"+datastore.Extension), TestdataSignature)
+		if err != nil {
+			f.Fatal(err)
+		}
+		configure(ds)
+		if err := ds.In(Names).Upsert(&NameDocument{Name: ExpectedName}); err != nil {
+			f.Fatal(err)
+		}
+		if err := ds.Flush(); err != nil {
+			f.Fatal(err)
+		}
+		data, err := os.ReadFile(ds.Path())
+		if err != nil {
+			f.Fatal(err)
+		}
+		files = append(files, data)
+	}
+	return files
+}
+
+func TestDecode(t *testing.T) {
+	data, err := os.ReadFile(TestdataDatastore)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	header, err := datastore.ParseHeader(data[:64])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if header.Signature != datastore.Signature(TestdataSignature) {
+		t.Errorf("Expected %s, found %s", datastore.Signature(TestdataSignature), header.Signature)
+	}
+
+	ds, err := datastore.Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ds.Signature() != header.Signature {
+		t.Errorf("Expected %s, found %s", header.Signature, ds.Signature())
+	}
+	if ds.Path() != "" {
+		t.Errorf("Expected an in-memory Datastore, found path %s", ds.Path())
+	}
+	if len(ds.In(Names).List()) == 0 {
+		t.Error("Expected Documents to be decoded")
+	}
+
+	if _, err := datastore.ParseHeader(data[:5]); !errors.Is(err, datastore.ErrCorrupt) {
+		t.Errorf("Expected %s, found %v", datastore.ErrCorrupt, err)
+	}
+	if _, err := datastore.Decode(bytes.NewReader(data[:len(data)-4])); !errors.Is(err, datastore.ErrCorrupt) {
+		t.Errorf("Expected %s, found %v", datastore.ErrCorrupt, err)
+	}
+}
+
+func FuzzParseHeader(f *testing.F) {
+	for _, data := range seedFiles(f) {
+		f.Add(data)
+	}
+	f.Fuzz(func(t *testing.T, data []byte) {
+		if _, err := datastore.ParseHeader(data); err != nil && !errors.Is(err, datastore.ErrCorrupt) {
+			t.Errorf("Expected %s, found %v", datastore.ErrCorrupt, err)
+		}
+	})
+}
+
+func FuzzDecode(f *testing.F) {
+	for _, data := range seedFiles(f) {
+		f.Add(data)
+	}
+	f.Fuzz(func(t *testing.T, data []byte) {
+		ds, err := datastore.Decode(bytes.NewReader(data))
+		if err != nil {
+			var dsErr *datastore.Error
+			if !errors.As(err, &dsErr) {
+				t.Errorf("Expected *datastore.Error, found %T: %v", err, err)
+			}
+			return
+		}
+		// Anything that decodes must be usable
+		for _, name := range ds.CollectionNames() {
+			c := ds.In(name)
+			for _, key := range c.List() {
+				c.FindKey(key)
+			}
+		}
+	})
+}
@@ -0,0 +1,27 @@
+package datastore
+
+// Derive registers a function that computes denormalized fields of each
+// Document (such as search keys, lowercase names, or totals) before it is
+// stored by Upsert, Patch, PatchJSON, or Increment. Find predicates can then
+// compare against the precomputed fields instead of computing them for every
+// Document on every query.
+//
+// Functions run in the order they were registered, while the Collection is
+// locked, so they must not call methods on the Collection. The Document has
+// its key when the functions run. Documents already in the Collection are not
+// changed until they are next stored.
+//
+// Derive functions are not written to disk, so call Derive again after Open.
+func (c *Collection) Derive(derive func(Document)) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.derivers = append(c.derivers, derive)
+}
+
+// derive runs the functions registered with Derive. It must be called while
+// the Collection is locked.
+func (c *Collection) derive(document Document) {
+	for _, derive := range c.derivers {
+		derive(document)
+	}
+}
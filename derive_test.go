@@ -0,0 +1,47 @@
+package datastore_test
+
+import (
+	"strings"
+	"testing"
+
+	"git.stormbase.io/cbednarski/datastore"
+)
+
+func TestCollection_Derive(t *testing.T) {
+	ds := datastore.New()
+	names := ds.In("names")
+
+	names.Upsert(&NameDocument{Name: "Before"})
+	names.Derive(func(d datastore.Document) {
+		d.(*NameDocument).Name = strings.ToLower(d.(*NameDocument).Name)
+	})
+
+	if name := names.FindKey(1).(*NameDocument).Name; name != "Before" {
+		t.Errorf("Expected existing documents to be unchanged, found %s", name)
+	}
+
+	document := &NameDocument{Name: "MiXeD"}
+	if err := names.Upsert(document); err != nil {
+		t.Fatal(err)
+	}
+	if document.Name != "mixed" {
+		t.Errorf("Expected %s, found %s", "mixed", document.Name)
+	}
+
+	if err := names.Patch(1, map[string]interface{}{"Name": "PATCHED"}); err != nil {
+		t.Fatal(err)
+	}
+	if name := names.FindKey(1).(*NameDocument).Name; name != "patched" {
+		t.Errorf("Expected %s, found %s", "patched", name)
+	}
+
+	if err := names.PatchJSON(2, []byte(`{"Name": "JSON"}`)); err != nil {
+		t.Fatal(err)
+	}
+	found := names.FindOne(func(d datastore.Document) bool {
+		return d.(*NameDocument).Name == "json"
+	})
+	if found == nil || found.ID() != 2 {
+		t.Errorf("Expected to find key 2 by its derived name, found %v", found)
+	}
+}
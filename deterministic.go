@@ -0,0 +1,247 @@
+package datastore
+
+import (
+	"encoding/gob"
+	"fmt"
+	"reflect"
+	"sort"
+)
+
+// sortedLayout is written to the Name field of the gzip header of files written
+// by a deterministic Datastore, so Open knows how to decode them.
+const sortedLayout = "datastore:sorted"
+
+// SetDeterministic changes whether Flush writes the Datastore so that the same
+// content always produces the same bytes. Collections and keys are written in
+// sorted order and the gzip modification time is left empty. This is useful for
+// content-addressed storage and for comparing against golden files in tests.
+//
+// The setting is recorded in the file, so a Datastore opened from a
+// deterministic file stays deterministic. Older versions of this package can not
+// read deterministic files.
+//
+// Gob numbers types in the order a program first encodes them, and encodes the
+// maps inside Documents in random order, so files are only byte-identical when
+// they are written by the same program and the Documents do not contain maps.
+// The times recorded by history, the trash, and the audit log are part of the
+// content. Use SetClock to control them.
+func (d *Datastore) SetDeterministic(deterministic bool) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	d.deterministic = deterministic
+}
+
+// encodeSorted encodes the Datastore with Collections sorted by name, followed
+// by each Collection. The public map fields of each Collection are encoded
+// separately as sorted lists of keys and values, preceded by the field name.
+func encodeSorted(encoder *gob.Encoder, ds *Datastore) error {
+	names := make([]string, 0, len(ds.Collections))
+	for name := range ds.Collections {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	if err := encoder.Encode(names); err != nil {
+		return err
+	}
+
+	for _, name := range names {
+		if err := encodeSortedCollection(encoder, ds.Collections[name], 0); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// encodeSortedCollection encodes one Collection for encodeSorted. If chunk is
+// more than zero, each map is written as a series of lists of at most chunk
+// keys and values, each preceded by its length and ending with a length of
+// zero, so the encoder never holds more than chunk entries at a time.
+func encodeSortedCollection(encoder *gob.Encoder, c *Collection, chunk int) error {
+	source := reflect.ValueOf(c).Elem()
+
+	scalars := &Collection{}
+	target := reflect.ValueOf(scalars).Elem()
+	maps := []int{}
+	for i := 0; i < source.NumField(); i++ {
+		if source.Type().Field(i).PkgPath != "" {
+			continue
+		}
+		if source.Field(i).Kind() == reflect.Map {
+			maps = append(maps, i)
+			continue
+		}
+		target.Field(i).Set(source.Field(i))
+	}
+	if err := encoder.Encode(scalars); err != nil {
+		return err
+	}
+
+	for _, i := range maps {
+		field := source.Field(i)
+		if field.Len() == 0 {
+			continue
+		}
+		keys := field.MapKeys()
+		sortValues(keys)
+
+		if err := encoder.Encode(source.Type().Field(i).Name); err != nil {
+			return err
+		}
+		size := chunk
+		if size <= 0 {
+			size = len(keys)
+		}
+		for start := 0; start < len(keys); start += size {
+			end := start + size
+			if end > len(keys) {
+				end = len(keys)
+			}
+			keyList := reflect.MakeSlice(reflect.SliceOf(field.Type().Key()), 0, end-start)
+			valueList := reflect.MakeSlice(reflect.SliceOf(field.Type().Elem()), 0, end-start)
+			for _, key := range keys[start:end] {
+				keyList = reflect.Append(keyList, key)
+				valueList = reflect.Append(valueList, field.MapIndex(key))
+			}
+			if chunk > 0 {
+				if err := encoder.Encode(end - start); err != nil {
+					return err
+				}
+			}
+			if err := encoder.EncodeValue(keyList); err != nil {
+				return err
+			}
+			if err := encoder.EncodeValue(valueList); err != nil {
+				return err
+			}
+		}
+		if chunk > 0 {
+			if err := encoder.Encode(0); err != nil {
+				return err
+			}
+		}
+	}
+
+	// An empty field name marks the end of the Collection
+	return encoder.Encode("")
+}
+
+// decodeSorted decodes a Datastore written by encodeSorted.
+func decodeSorted(decoder *gob.Decoder, ds *Datastore) error {
+	return decodeSortedLayout(decoder, ds, false)
+}
+
+// decodeSortedLayout decodes a Datastore written by encodeSorted, or if chunked
+// is true, by encodeStreamed.
+func decodeSortedLayout(decoder *gob.Decoder, ds *Datastore, chunked bool) error {
+	names := []string{}
+	if err := decoder.Decode(&names); err != nil {
+		return err
+	}
+
+	ds.Collections = make(map[string]*Collection, len(names))
+	for _, name := range names {
+		c := &Collection{}
+		if err := decoder.Decode(c); err != nil {
+			return err
+		}
+		target := reflect.ValueOf(c).Elem()
+
+		for {
+			var fieldName string
+			if err := decoder.Decode(&fieldName); err != nil {
+				return err
+			}
+			if fieldName == "" {
+				break
+			}
+
+			field := target.FieldByName(fieldName)
+			if !field.IsValid() || field.Kind() != reflect.Map {
+				// Skip fields written by a newer version of this package
+				if err := skipSortedField(decoder, chunked); err != nil {
+					return err
+				}
+				continue
+			}
+
+			decoded := reflect.MakeMap(field.Type())
+			for {
+				if chunked {
+					count, err := decodeChunkLength(decoder)
+					if err != nil {
+						return err
+					}
+					if count == 0 {
+						break
+					}
+				}
+				keyList := reflect.New(reflect.SliceOf(field.Type().Key()))
+				if err := decoder.DecodeValue(keyList); err != nil {
+					return err
+				}
+				valueList := reflect.New(reflect.SliceOf(field.Type().Elem()))
+				if err := decoder.DecodeValue(valueList); err != nil {
+					return err
+				}
+				if keyList.Elem().Len() != valueList.Elem().Len() {
+					return fmt.Errorf("%s of collection %q has %d keys and %d values", fieldName, name, keyList.Elem().Len(), valueList.Elem().Len())
+				}
+				for i := 0; i < keyList.Elem().Len(); i++ {
+					decoded.SetMapIndex(keyList.Elem().Index(i), valueList.Elem().Index(i))
+				}
+				if !chunked {
+					break
+				}
+			}
+			field.Set(decoded)
+		}
+
+		ds.Collections[name] = c
+	}
+	return nil
+}
+
+// skipSortedField reads past the keys and values of a map field.
+func skipSortedField(decoder *gob.Decoder, chunked bool) error {
+	for {
+		if chunked {
+			count, err := decodeChunkLength(decoder)
+			if err != nil || count == 0 {
+				return err
+			}
+		}
+		if err := decoder.DecodeValue(reflect.Value{}); err != nil {
+			return err
+		}
+		if err := decoder.DecodeValue(reflect.Value{}); err != nil {
+			return err
+		}
+		if !chunked {
+			return nil
+		}
+	}
+}
+
+// decodeChunkLength reads the length written before each chunk of a map by
+// encodeSortedCollection.
+func decodeChunkLength(decoder *gob.Decoder) (int, error) {
+	var count int
+	err := decoder.Decode(&count)
+	return count, err
+}
+
+// sortValues sorts map keys of any integer or string type.
+func sortValues(values []reflect.Value) {
+	sort.Slice(values, func(i, j int) bool {
+		a, b := values[i], values[j]
+		switch a.Kind() {
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			return a.Uint() < b.Uint()
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			return a.Int() < b.Int()
+		case reflect.String:
+			return a.String() < b.String()
+		}
+		return fmt.Sprint(a.Interface()) < fmt.Sprint(b.Interface())
+	})
+}
@@ -0,0 +1,76 @@
+package datastore_test
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"git.stormbase.io/cbednarski/datastore"
+)
+
+func TestSetDeterministic(t *testing.T) {
+	tempdir, err := ioutil.TempDir("", "datastore")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempdir)
+
+	write := func(name string) []byte {
+		datapath := filepath.Join(tempdir, name+datastore.Extension)
+		ds, err := datastore.Create(datapath, TestdataSignature)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ds.SetDeterministic(true)
+
+		for _, collection := range []string{"cats", "dogs", "fish", "birds"} {
+			c := ds.In(collection)
+			if err := c.SetChecksums(true); err != nil {
+				t.Fatal(err)
+			}
+			for i := 0; i < 20; i++ {
+				if err := c.Upsert(&NameDocument{Name: collection}); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := c.DeleteKey(3); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := ds.Flush(); err != nil {
+			t.Fatal(err)
+		}
+
+		data, err := ioutil.ReadFile(datapath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return data
+	}
+
+	first := write("first")
+	time.Sleep(time.Millisecond)
+	second := write("second")
+	if !bytes.Equal(first, second) {
+		t.Error("Expected identical content to produce identical files")
+	}
+
+	ds, err := datastore.Open(filepath.Join(tempdir, "first"+datastore.Extension), TestdataSignature)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dogs := ds.In("dogs")
+	if len(dogs.List()) != 19 {
+		t.Errorf("Expected 19 dogs, found %d", len(dogs.List()))
+	}
+	if err := dogs.VerifyChecksums(); err != nil {
+		t.Error(err)
+	}
+	if !reflect.DeepEqual(dogs.FindKey(20), &NameDocument{Identifier: 20, Name: "dogs"}) {
+		t.Errorf("Unexpected document %#v", dogs.FindKey(20))
+	}
+}
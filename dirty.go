@@ -0,0 +1,61 @@
+package datastore
+
+import "time"
+
+// Dirty returns true if the Datastore has changes that have not been written to
+// disk by Flush. This is useful for deciding whether to prompt the user to save
+// before exiting, or to skip a Flush when nothing has changed.
+func (d *Datastore) Dirty() bool {
+	return d.PendingChanges() > 0
+}
+
+// PendingChanges returns the number of changes made to the Datastore since the
+// last successful Flush. Each Upsert, Delete, or other change to a Document
+// counts as one change.
+func (d *Datastore) PendingChanges() int {
+	return int(d.pending.Load())
+}
+
+// markDirty records changes that need to be flushed. It is called by
+// Collections while they are locked.
+func (d *Datastore) markDirty(changes int) {
+	d.pending.Add(int64(changes))
+	if d.dirtySince.Load() == 0 {
+		d.dirtySince.CompareAndSwap(0, d.now().UnixNano())
+	}
+}
+
+// markFlushed records that changes have been written to disk. flushed is the
+// value of PendingChanges before the snapshot was taken, so changes made while
+// the Flush was in progress remain pending, and are treated as dirty since
+// started, when the Flush began.
+func (d *Datastore) markFlushed(flushed int, started time.Time) {
+	if d.pending.Add(-int64(flushed)) > 0 {
+		d.dirtySince.Store(started.UnixNano())
+		return
+	}
+	d.dirtySince.Store(0)
+	// A change made after the Add above may have seen the old dirtySince and
+	// not replaced it
+	if d.pending.Load() > 0 {
+		d.dirtySince.CompareAndSwap(0, started.UnixNano())
+	}
+}
+
+// unflushedAge returns how long the oldest pending change has waited to be
+// flushed, or 0 if there are no pending changes.
+func (d *Datastore) unflushedAge() time.Duration {
+	since := d.dirtySince.Load()
+	if since == 0 {
+		return 0
+	}
+	return d.now().Sub(time.Unix(0, since))
+}
+
+// markDirty records changes to the Collection's Datastore. It is called while
+// the Collection is locked.
+func (c *Collection) markDirty(changes int) {
+	if c.store != nil && changes > 0 {
+		c.store.markDirty(changes)
+	}
+}
@@ -0,0 +1,61 @@
+package datastore_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"git.stormbase.io/cbednarski/datastore"
+)
+
+func TestDirty(t *testing.T) {
+	tempdir, err := ioutil.TempDir("", "datastore")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempdir)
+
+	ds, err := datastore.Create(filepath.Join(tempdir, "dirty"+datastore.Extension), TestdataSignature)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if ds.Dirty() {
+		t.Error("Expected new datastore to be clean")
+	}
+
+	cakes := ds.In("cakes")
+	cake := &NameDocument{Name: "chocolate"}
+	if err := cakes.Upsert(cake); err != nil {
+		t.Fatal(err)
+	}
+	if err := cakes.Upsert(cake); err != nil {
+		t.Fatal(err)
+	}
+	// Deleting a missing key doesn't change anything
+	if err := cakes.DeleteKey(60); err != nil {
+		t.Fatal(err)
+	}
+
+	if !ds.Dirty() {
+		t.Error("Expected datastore to be dirty")
+	}
+	if ds.PendingChanges() != 2 {
+		t.Errorf("Expected 2 pending changes, found %d", ds.PendingChanges())
+	}
+
+	if err := ds.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if ds.Dirty() {
+		t.Errorf("Expected datastore to be clean after Flush, found %d pending changes", ds.PendingChanges())
+	}
+
+	if err := cakes.Delete(cake); err != nil {
+		t.Fatal(err)
+	}
+	if ds.PendingChanges() != 1 {
+		t.Errorf("Expected 1 pending change, found %d", ds.PendingChanges())
+	}
+}
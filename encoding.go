@@ -0,0 +1,204 @@
+package datastore
+
+import (
+	"bytes"
+	"encoding"
+	"encoding/binary"
+	"encoding/gob"
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+)
+
+// encodeDocument encodes a single Document using Gob. The concrete type is
+// encoded (rather than the Document interface) so the type does not need to be
+// registered unless it contains interface fields of its own.
+func encodeDocument(document Document) ([]byte, error) {
+	buffer := &bytes.Buffer{}
+	if err := gob.NewEncoder(buffer).Encode(document); err != nil {
+		return nil, codecError("encode", err)
+	}
+	return buffer.Bytes(), nil
+}
+
+// decodeDocument decodes a Document previously encoded with encodeDocument.
+// like must be a Document of the same type, and is used to create the new
+// Document.
+func decodeDocument(data []byte, like Document) (Document, error) {
+	kind := reflect.TypeOf(like)
+	if kind.Kind() != reflect.Ptr {
+		return nil, ErrInvalidType
+	}
+
+	value := reflect.New(kind.Elem())
+	if err := gob.NewDecoder(bytes.NewReader(data)).DecodeValue(value); err != nil {
+		return nil, codecError("decode", err)
+	}
+
+	document, ok := value.Interface().(Document)
+	if !ok {
+		return nil, ErrInvalidType
+	}
+	return document, nil
+}
+
+// copyDocument makes a deep copy of a Document by encoding and decoding it.
+// Gob omits zero values, so the copy is always decoded into a new value.
+func copyDocument(document Document) (Document, error) {
+	data, err := encodeDocument(document)
+	if err != nil {
+		return nil, err
+	}
+	return decodeDocument(data, document)
+}
+
+var textMarshalType = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+
+// stableEncoding encodes the same fields of a Document that Gob does (so
+// fields hidden from JSON are included), for fingerprints and checksums. Gob
+// writes the entries of a map in random order, so this writes them sorted by
+// their encoded keys instead, and the same content always gives the same bytes.
+// The result cannot be decoded.
+func stableEncoding(document Document) ([]byte, error) {
+	buffer := &bytes.Buffer{}
+	if err := encodeStable(buffer, reflect.ValueOf(document)); err != nil {
+		return nil, codecError("encode", err)
+	}
+	return buffer.Bytes(), nil
+}
+
+func encodeStable(buffer *bytes.Buffer, value reflect.Value) error {
+	if !value.IsValid() {
+		buffer.WriteByte(0)
+		return nil
+	}
+
+	switch value.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if value.IsNil() {
+			buffer.WriteByte(0)
+			return nil
+		}
+		buffer.WriteByte(1)
+		if value.Kind() == reflect.Interface {
+			writeStableBytes(buffer, []byte(value.Elem().Type().String()))
+		}
+		return encodeStable(buffer, value.Elem())
+	}
+
+	if data, ok, err := marshalStable(value); ok {
+		if err != nil {
+			return err
+		}
+		writeStableBytes(buffer, data)
+		return nil
+	}
+
+	switch value.Kind() {
+	case reflect.Bool:
+		if value.Bool() {
+			buffer.WriteByte(1)
+		} else {
+			buffer.WriteByte(0)
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		buffer.Write(binary.AppendVarint(nil, value.Int()))
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		buffer.Write(binary.AppendUvarint(nil, value.Uint()))
+	case reflect.Float32, reflect.Float64:
+		buffer.Write(binary.AppendUvarint(nil, math.Float64bits(value.Float())))
+	case reflect.Complex64, reflect.Complex128:
+		buffer.Write(binary.AppendUvarint(nil, math.Float64bits(real(value.Complex()))))
+		buffer.Write(binary.AppendUvarint(nil, math.Float64bits(imag(value.Complex()))))
+	case reflect.String:
+		writeStableBytes(buffer, []byte(value.String()))
+	case reflect.Slice, reflect.Array:
+		if value.Kind() == reflect.Slice && value.Type().Elem().Kind() == reflect.Uint8 {
+			writeStableBytes(buffer, value.Bytes())
+			return nil
+		}
+		buffer.Write(binary.AppendUvarint(nil, uint64(value.Len())))
+		for i := 0; i < value.Len(); i++ {
+			if err := encodeStable(buffer, value.Index(i)); err != nil {
+				return err
+			}
+		}
+	case reflect.Map:
+		return encodeStableMap(buffer, value)
+	case reflect.Struct:
+		kind := value.Type()
+		for i := 0; i < kind.NumField(); i++ {
+			field := kind.Field(i)
+			// Gob skips unexported fields and fields it cannot send.
+			if !field.IsExported() || field.Type.Kind() == reflect.Chan || field.Type.Kind() == reflect.Func {
+				continue
+			}
+			writeStableBytes(buffer, []byte(field.Name))
+			if err := encodeStable(buffer, value.Field(i)); err != nil {
+				return err
+			}
+		}
+	default:
+		return fmt.Errorf("gob: type %s cannot be encoded", value.Type())
+	}
+	return nil
+}
+
+// encodeStableMap writes the entries of a map sorted by their encoded keys.
+func encodeStableMap(buffer *bytes.Buffer, value reflect.Value) error {
+	type entry struct {
+		key   []byte
+		value reflect.Value
+	}
+
+	entries := make([]entry, 0, value.Len())
+	iterator := value.MapRange()
+	for iterator.Next() {
+		key := &bytes.Buffer{}
+		if err := encodeStable(key, iterator.Key()); err != nil {
+			return err
+		}
+		entries = append(entries, entry{key: key.Bytes(), value: iterator.Value()})
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return bytes.Compare(entries[i].key, entries[j].key) < 0
+	})
+
+	buffer.Write(binary.AppendUvarint(nil, uint64(len(entries))))
+	for _, e := range entries {
+		writeStableBytes(buffer, e.key)
+		if err := encodeStable(buffer, e.value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// marshalStable uses the same marshaling methods as Gob, in the same order. ok
+// is false if the value does not implement any of them.
+func marshalStable(value reflect.Value) (data []byte, ok bool, err error) {
+	if !value.CanAddr() {
+		addressable := reflect.New(value.Type()).Elem()
+		addressable.Set(value)
+		value = addressable
+	}
+	pointer := value.Addr()
+
+	switch {
+	case pointer.Type().Implements(gobEncoderType):
+		data, err = pointer.Interface().(gob.GobEncoder).GobEncode()
+	case pointer.Type().Implements(binaryMarshalType):
+		data, err = pointer.Interface().(encoding.BinaryMarshaler).MarshalBinary()
+	case pointer.Type().Implements(textMarshalType):
+		data, err = pointer.Interface().(encoding.TextMarshaler).MarshalText()
+	default:
+		return nil, false, nil
+	}
+	return data, true, err
+}
+
+func writeStableBytes(buffer *bytes.Buffer, data []byte) {
+	buffer.Write(binary.AppendUvarint(nil, uint64(len(data))))
+	buffer.Write(data)
+}
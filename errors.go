@@ -0,0 +1,139 @@
+package datastore
+
+import (
+	"compress/flate"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"strings"
+)
+
+// Error is returned by Open, Create, Flush, and the Collection methods that
+// change Documents. It records what was being done when the error happened,
+// and supports errors.Is and errors.As for both the underlying error and its
+// Kind. For example, errors.Is(err, ErrCorrupt) works on an error returned by
+// Open.
+//
+// Errors that were returned as they are before Error existed still are, so
+// comparing them with == keeps working: ErrInvalidType and ErrInvalidSignature
+// are never wrapped, Open returns gzip.ErrHeader for a file that is not
+// gzipped, and when the file does not exist Open, Create, and Flush return the
+// *fs.PathError, so os.IsNotExist works on it.
+type Error struct {
+	// Op is the operation that failed, such as "open", "flush", or "upsert".
+	Op string
+
+	// Path is the path of the Datastore file, if the operation used it.
+	Path string
+
+	// Collection and Key identify the Collection and Document, if the operation
+	// was on a Collection. Key is zero when it is not known, such as for a new
+	// Document.
+	Collection string
+	Key        uint64
+
+	// Kind is ErrCorrupt, ErrCodec, or ErrIO, if the cause is one of them.
+	Kind error
+
+	// Err is the underlying error.
+	Err error
+}
+
+func (e *Error) Error() string {
+	message := &strings.Builder{}
+	message.WriteString(e.Op)
+	if e.Path != "" {
+		message.WriteString(" " + e.Path)
+	}
+	if e.Collection != "" {
+		fmt.Fprintf(message, " %q", e.Collection)
+	}
+	if e.Key != 0 {
+		fmt.Fprintf(message, " key %d", e.Key)
+	}
+	message.WriteString(": ")
+	if e.Err != nil {
+		message.WriteString(e.Err.Error())
+	} else if e.Kind != nil {
+		message.WriteString(e.Kind.Error())
+	}
+	return message.String()
+}
+
+func (e *Error) Unwrap() []error {
+	unwrapped := []error{}
+	if e.Err != nil {
+		unwrapped = append(unwrapped, e.Err)
+	}
+	if e.Kind != nil {
+		unwrapped = append(unwrapped, e.Kind)
+	}
+	return unwrapped
+}
+
+// wrapError returns err as an *Error for the specified operation. If err is
+// already an *Error (for example one with Kind ErrCodec) a copy is made with the
+// operation and location filled in, so the result is never nested. Sentinels
+// that are never wrapped (see Error) are returned as they are.
+func wrapError(err error, op string, c *Collection, key uint64) error {
+	if err == nil || bare(err) {
+		return err
+	}
+
+	wrapped := &Error{Err: err}
+	if e, ok := err.(*Error); ok {
+		copied := *e
+		wrapped = &copied
+	}
+	wrapped.Op = op
+	if c != nil {
+		wrapped.Collection = c.name
+	}
+	if key != 0 {
+		wrapped.Key = key
+	}
+	return wrapped
+}
+
+// bare reports whether err is a sentinel that is returned without an Error
+// around it.
+func bare(err error) bool {
+	return err == ErrInvalidType || err == ErrInvalidSignature
+}
+
+// codecError marks an encoding or decoding error with ErrCodec.
+func codecError(op string, err error) error {
+	return &Error{Op: op, Kind: ErrCodec, Err: err}
+}
+
+// fileError classifies an error reading or writing the Datastore file. File
+// system errors are ErrIO, errors from gzip or truncated data are ErrCorrupt,
+// and anything else (such as a Gob type error) is ErrCodec. An error saying the
+// file or its directory does not exist is returned as it is, so os.IsNotExist
+// works on it as well as errors.Is, and so are the sentinels described by Error.
+func fileError(op, path string, err error) error {
+	if os.IsNotExist(err) || bare(err) {
+		return err
+	}
+	e := &Error{Op: op, Path: path, Err: err}
+
+	var pathErr *fs.PathError
+	var linkErr *os.LinkError
+	var flateErr flate.CorruptInputError
+	switch {
+	case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+	case errors.As(err, &pathErr), errors.As(err, &linkErr):
+		e.Kind = ErrIO
+	case errors.Is(err, io.EOF), errors.Is(err, io.ErrUnexpectedEOF),
+		errors.Is(err, gzip.ErrHeader), errors.Is(err, gzip.ErrChecksum),
+		errors.As(err, &flateErr):
+		e.Kind = ErrCorrupt
+	default:
+		e.Kind = ErrCodec
+	}
+	return e
+}
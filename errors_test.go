@@ -0,0 +1,55 @@
+package datastore_test
+
+import (
+	"errors"
+	"os"
+	"testing"
+
+	"git.stormbase.io/cbednarski/datastore"
+)
+
+func TestError(t *testing.T) {
+	numbers := datastore.New().In("numbers")
+	_, err := numbers.Increment(42, "Number", 1)
+
+	var e *datastore.Error
+	if !errors.As(err, &e) {
+		t.Fatalf("Expected *datastore.Error, found %#v", err)
+	}
+	if e.Op != "increment" || e.Collection != "numbers" || e.Key != 42 {
+		t.Errorf("Expected increment of numbers key 42, found %#v", e)
+	}
+	if !errors.Is(err, datastore.ErrKeyNotFound) {
+		t.Errorf("Expected %s, found %s", datastore.ErrKeyNotFound, err)
+	}
+	expected := `increment "numbers" key 42: key not found in collection`
+	if err.Error() != expected {
+		t.Errorf("Expected %q, found %q", expected, err.Error())
+	}
+
+	_, err = datastore.Open("testdata/does-not-exist", TestdataSignature)
+	if !os.IsNotExist(err) || !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("Expected not exist error, found %#v", err)
+	}
+
+	_, err = datastore.Open(TestdataDatastore, "wrong")
+	if !errors.Is(err, datastore.ErrInvalidSignature) || errors.Is(err, datastore.ErrCorrupt) {
+		t.Errorf("Expected %s, found %#v", datastore.ErrInvalidSignature, err)
+	}
+}
+
+func TestErrorNotModified(t *testing.T) {
+	names := datastore.New().In("names")
+	rejected := &datastore.Error{Op: "policy", Err: errors.New("rejected")}
+
+	err := names.WithLock(func(tx *datastore.Locked) error {
+		return rejected
+	})
+	var e *datastore.Error
+	if !errors.As(err, &e) || e.Collection != "names" {
+		t.Errorf("Expected an error for names, found %#v", err)
+	}
+	if rejected.Op != "policy" || rejected.Collection != "" {
+		t.Errorf("Expected the returned error to be unchanged, found %#v", rejected)
+	}
+}
@@ -0,0 +1,165 @@
+package datastore
+
+import (
+	"sync"
+	"time"
+)
+
+// EventType identifies a Datastore lifecycle event.
+type EventType int
+
+const (
+	// EventOpen is sent after a Datastore has been opened successfully.
+	EventOpen EventType = iota + 1
+
+	// EventFlushStart is sent before a Datastore is written to disk.
+	EventFlushStart
+
+	// EventFlushEnd is sent after a Datastore has been written to disk, or
+	// has failed to be written. Err is set if the Flush failed.
+	EventFlushEnd
+
+	// EventMigration is sent after a Collection has been migrated to a new
+	// schema version.
+	EventMigration
+
+	// EventCorruption is sent when a Datastore could not be decoded, or when
+	// Documents fail checksum verification. Err holds the error.
+	EventCorruption
+
+	// EventClose is sent after a Datastore has been closed.
+	EventClose
+
+	// EventSchemaChange is sent by Open for each Collection whose Document
+	// type no longer matches the fields it was flushed with. Err holds a
+	// *SchemaError. See VerifySchema.
+	EventSchemaChange
+
+	// EventAliasedMutation is sent before a Flush for each Collection with
+	// Documents that were changed without being upserted. Err holds an
+	// *AliasError. See SetAliasDetection.
+	EventAliasedMutation
+
+	// EventOrphanedFlush is sent by Open when it finds a temp file left behind
+	// by a Flush that did not finish. The file is moved to <path>.orphaned so
+	// it can be inspected or recovered. Err is an *Error wrapping
+	// ErrOrphanedFlush whose Path is the .orphaned file, or the error that
+	// prevented it from being moved, in which case the temp file is removed.
+	EventOrphanedFlush
+)
+
+func (e EventType) String() string {
+	switch e {
+	case EventOpen:
+		return "open"
+	case EventFlushStart:
+		return "flush start"
+	case EventFlushEnd:
+		return "flush end"
+	case EventMigration:
+		return "migration"
+	case EventCorruption:
+		return "corruption"
+	case EventClose:
+		return "close"
+	case EventSchemaChange:
+		return "schema change"
+	case EventAliasedMutation:
+		return "aliased mutation"
+	case EventOrphanedFlush:
+		return "orphaned flush"
+	}
+	return "unknown"
+}
+
+// Event describes something that happened to a Datastore.
+type Event struct {
+	Type EventType
+
+	// Path is the path of the Datastore on disk.
+	Path string
+
+	// Time is when the event happened.
+	Time time.Time
+
+	// Collection is the name of the Collection the event applies to, if any.
+	Collection string
+
+	// Err is set if the event represents a failure.
+	Err error
+
+	// Stats is set for EventFlushEnd if the Flush succeeded.
+	Stats *FlushStats
+}
+
+// events is a list of subscribers that receive Events.
+type events struct {
+	subscribers map[int]func(Event)
+	next        int
+	mutex       sync.Mutex
+}
+
+func (e *events) subscribe(fn func(Event)) (unsubscribe func()) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	if e.subscribers == nil {
+		e.subscribers = map[int]func(Event){}
+	}
+	id := e.next
+	e.next++
+	e.subscribers[id] = fn
+
+	return func() {
+		e.mutex.Lock()
+		delete(e.subscribers, id)
+		e.mutex.Unlock()
+	}
+}
+
+func (e *events) send(event Event) {
+	e.mutex.Lock()
+	subscribers := make([]func(Event), 0, len(e.subscribers))
+	for _, fn := range e.subscribers {
+		subscribers = append(subscribers, fn)
+	}
+	e.mutex.Unlock()
+
+	for _, fn := range subscribers {
+		fn(event)
+	}
+}
+
+// globalEvents receives events from every Datastore.
+var globalEvents events
+
+// Subscribe registers fn to receive lifecycle events from every Datastore in
+// this program. Because a Datastore does not exist until Open returns, this is
+// the only way to receive EventOpen, and EventCorruption events from a failed
+// Open. Call unsubscribe to stop receiving events.
+//
+// Events are delivered synchronously, so fn should return quickly and must not
+// call Flush.
+func Subscribe(fn func(Event)) (unsubscribe func()) {
+	return globalEvents.subscribe(fn)
+}
+
+// Subscribe registers fn to receive lifecycle events from this Datastore, such
+// as the start and end of each Flush. Call unsubscribe to stop receiving events.
+//
+// Events are delivered synchronously, so fn should return quickly and must not
+// call Flush.
+func (d *Datastore) Subscribe(fn func(Event)) (unsubscribe func()) {
+	return d.events.subscribe(fn)
+}
+
+// emit sends an Event to this Datastore's subscribers and to global
+// subscribers. It must not be called while the Datastore is locked.
+func (d *Datastore) emit(event Event) {
+	event.Path = d.path
+	if event.Time.IsZero() {
+		event.Time = d.now()
+	}
+	d.events.send(event)
+	globalEvents.send(event)
+}
@@ -0,0 +1,73 @@
+package datastore_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"git.stormbase.io/cbednarski/datastore"
+)
+
+func TestSubscribe(t *testing.T) {
+	received := []datastore.EventType{}
+	unsubscribe := datastore.Subscribe(func(e datastore.Event) {
+		if e.Path == TestdataDatastore || e.Path == TestdataInvalid {
+			received = append(received, e.Type)
+		}
+	})
+
+	if _, err := datastore.Open(TestdataDatastore, TestdataSignature); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := datastore.Open(TestdataInvalid, TestdataSignature); err == nil {
+		t.Fatal("Expected error, invalid datastore")
+	}
+
+	unsubscribe()
+	if _, err := datastore.Open(TestdataDatastore, TestdataSignature); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []datastore.EventType{datastore.EventOpen, datastore.EventCorruption}
+	if !reflect.DeepEqual(received, expected) {
+		t.Errorf("Expected %v, found %v", expected, received)
+	}
+}
+
+func TestDatastore_Subscribe(t *testing.T) {
+	tempdir, err := ioutil.TempDir("", "datastore")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempdir)
+
+	ds, err := datastore.Create(filepath.Join(tempdir, "events"+datastore.Extension), TestdataSignature)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	events := []datastore.Event{}
+	unsubscribe := ds.Subscribe(func(e datastore.Event) {
+		events = append(events, e)
+	})
+	defer unsubscribe()
+
+	if err := ds.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(events) != 2 {
+		t.Fatalf("Expected 2 events, found %d", len(events))
+	}
+	if events[0].Type != datastore.EventFlushStart || events[1].Type != datastore.EventFlushEnd {
+		t.Errorf("Expected flush start and end, found %s and %s", events[0].Type, events[1].Type)
+	}
+	if events[1].Err != nil {
+		t.Errorf("Expected no error, found %s", events[1].Err)
+	}
+	if events[0].Path != ds.Path() {
+		t.Errorf("Expected %s, found %s", ds.Path(), events[0].Path)
+	}
+}
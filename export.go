@@ -0,0 +1,263 @@
+package datastore
+
+import (
+	"encoding"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// Redacted replaces the value of sensitive fields in exported data.
+//
+// To mark a field as sensitive, add the struct tag `datastore:"redact"` to it,
+// or call Collection.RedactFields with the field name.
+const Redacted = "[REDACTED]"
+
+var jsonMarshalerType = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+var textMarshalerType = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+
+// RedactFields marks the named fields of the Documents in this Collection as
+// sensitive, in addition to any fields tagged with `datastore:"redact"`.
+// Sensitive fields are replaced with Redacted when the Collection is exported.
+// Field names are the Go struct field names. Only top-level fields may be
+// named; use struct tags to redact fields of nested structs.
+func (c *Collection) RedactFields(fields ...string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.redact == nil {
+		c.redact = map[string]bool{}
+	}
+	for _, field := range fields {
+		c.redact[field] = true
+	}
+}
+
+// Redact returns document as ExportJSON writes it: a value that can be encoded
+// with encoding/json, in which sensitive fields are replaced with Redacted.
+func (c *Collection) Redact(document Document) interface{} {
+	c.mutex.RLock()
+	redact := map[string]bool{}
+	for field := range c.redact {
+		redact[field] = true
+	}
+	c.mutex.RUnlock()
+
+	return exportValue(reflect.ValueOf(document), redact)
+}
+
+// ExportJSON writes each Document in the Collection to w as a JSON object, one
+// per line (sometimes called JSON Lines), in ascending order. Sensitive fields
+// are replaced with Redacted.
+func (c *Collection) ExportJSON(w io.Writer) error {
+	if err := c.checkOpen(); err != nil {
+		return err
+	}
+	documents, redact := c.exportable()
+
+	encoder := json.NewEncoder(w)
+	for _, document := range documents {
+		if err := encoder.Encode(exportValue(reflect.ValueOf(document), redact)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ExportCSV writes the Documents in the Collection to w as CSV, in ascending
+// order. The first row holds the names of the top-level fields of the Document
+// type. Fields that hold structs, slices, or maps are written as JSON.
+// Sensitive fields are replaced with Redacted.
+func (c *Collection) ExportCSV(w io.Writer) error {
+	if err := c.checkOpen(); err != nil {
+		return err
+	}
+	documents, redact := c.exportable()
+
+	writer := csv.NewWriter(w)
+	var header []string
+	for _, document := range documents {
+		row, ok := exportValue(reflect.ValueOf(document), redact).(map[string]interface{})
+		if !ok {
+			return ErrInvalidType
+		}
+
+		if header == nil {
+			header = exportFields(reflect.TypeOf(document))
+			if err := writer.Write(header); err != nil {
+				return err
+			}
+		}
+
+		record := make([]string, len(header))
+		for i, name := range header {
+			cell, err := csvCell(row[name])
+			if err != nil {
+				return err
+			}
+			record[i] = cell
+		}
+		if err := writer.Write(record); err != nil {
+			return err
+		}
+	}
+
+	writer.Flush()
+	return writer.Error()
+}
+
+// exportable returns the Documents in the Collection, in ascending order, and
+// the set of redacted field names. The Documents are read from a frozen
+// snapshot (see snapshot), so writers are not blocked while they are collected
+// and exported.
+func (c *Collection) exportable() ([]Document, map[string]bool) {
+	c.mutex.RLock()
+	frozen := c.freeze()
+	redact := map[string]bool{}
+	for field := range c.redact {
+		redact[field] = true
+	}
+	c.mutex.RUnlock()
+
+	keys := make([]uint64, 0, len(frozen.Items))
+	for key := range frozen.Items {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i] < keys[j] })
+	documents := make([]Document, 0, len(keys))
+	for _, key := range keys {
+		document := frozen.Items[key]
+		if frozen.Compressed {
+			// Like item, a Document that can't be decoded is exported as nil
+			document, _ = unpackDocument(document)
+		}
+		documents = append(documents, document)
+	}
+	return documents, redact
+}
+
+// exportName returns the name a struct field is exported under, and false if
+// the field should not be exported.
+func exportName(field reflect.StructField) (string, bool) {
+	if field.PkgPath != "" {
+		return "", false
+	}
+
+	name := field.Name
+	if tag, ok := field.Tag.Lookup("json"); ok {
+		tagName := strings.Split(tag, ",")[0]
+		if tagName == "-" {
+			return "", false
+		}
+		if tagName != "" {
+			name = tagName
+		}
+	}
+	return name, true
+}
+
+// exportFields returns the exported field names of a struct type, in order.
+func exportFields(kind reflect.Type) []string {
+	for kind.Kind() == reflect.Ptr {
+		kind = kind.Elem()
+	}
+
+	fields := []string{}
+	for i := 0; i < kind.NumField(); i++ {
+		if name, ok := exportName(kind.Field(i)); ok {
+			fields = append(fields, name)
+		}
+	}
+	return fields
+}
+
+// isRedacted returns true if the struct field is marked as sensitive.
+func isRedacted(field reflect.StructField) bool {
+	for _, option := range strings.Split(field.Tag.Get("datastore"), ",") {
+		if option == "redact" {
+			return true
+		}
+	}
+	return false
+}
+
+// exportValue converts v into a value that can be encoded as JSON, replacing
+// sensitive fields with Redacted. redact holds the names of top-level fields
+// that should also be replaced.
+func exportValue(v reflect.Value, redact map[string]bool) interface{} {
+	if !v.IsValid() {
+		return nil
+	}
+
+	// Types that know how to encode themselves, like time.Time, are left as-is
+	if v.Type().Implements(jsonMarshalerType) || v.Type().Implements(textMarshalerType) {
+		return v.Interface()
+	}
+
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if v.IsNil() {
+			return nil
+		}
+		return exportValue(v.Elem(), redact)
+	case reflect.Struct:
+		object := map[string]interface{}{}
+		for i := 0; i < v.NumField(); i++ {
+			field := v.Type().Field(i)
+			name, ok := exportName(field)
+			if !ok {
+				continue
+			}
+			if isRedacted(field) || redact[field.Name] {
+				object[name] = Redacted
+				continue
+			}
+			object[name] = exportValue(v.Field(i), nil)
+		}
+		return object
+	case reflect.Slice, reflect.Array:
+		if v.Kind() == reflect.Slice && v.IsNil() {
+			return nil
+		}
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			return v.Interface()
+		}
+		list := make([]interface{}, v.Len())
+		for i := range list {
+			list[i] = exportValue(v.Index(i), nil)
+		}
+		return list
+	case reflect.Map:
+		if v.IsNil() {
+			return nil
+		}
+		object := map[string]interface{}{}
+		iter := v.MapRange()
+		for iter.Next() {
+			object[fmt.Sprint(iter.Key().Interface())] = exportValue(iter.Value(), nil)
+		}
+		return object
+	}
+	return v.Interface()
+}
+
+// csvCell formats an exported value for a CSV cell.
+func csvCell(value interface{}) (string, error) {
+	switch v := value.(type) {
+	case nil:
+		return "", nil
+	case string:
+		return v, nil
+	case map[string]interface{}, []interface{}, []byte:
+		encoded, err := json.Marshal(v)
+		return string(encoded), err
+	case encoding.TextMarshaler:
+		text, err := v.MarshalText()
+		return string(text), err
+	}
+	return fmt.Sprint(value), nil
+}
@@ -0,0 +1,86 @@
+package datastore_test
+
+import (
+	"bytes"
+	"testing"
+
+	"git.stormbase.io/cbednarski/datastore"
+)
+
+func accountsForExport(t *testing.T) *datastore.Collection {
+	ds := datastore.New()
+	accounts := ds.In("accounts")
+
+	documents := []*AccountDocument{
+		{
+			Name:    "alice",
+			Email:   "alice@example.com",
+			Token:   "s3cr3t",
+			Tags:    []string{"admin"},
+			Profile: AccountProfile{Bio: "hi", Password: "hunter2"},
+		},
+		{
+			Name:  "bob",
+			Email: "bob@example.com",
+			Token: "t0k3n",
+		},
+	}
+	for _, document := range documents {
+		if err := accounts.Upsert(document); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return accounts
+}
+
+func TestCollection_ExportJSON(t *testing.T) {
+	accounts := accountsForExport(t)
+
+	output := &bytes.Buffer{}
+	if err := accounts.ExportJSON(output); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := `{"Email":"alice@example.com","Identifier":1,"Name":"alice","Profile":{"Bio":"hi","password":"[REDACTED]"},"Tags":["admin"],"Token":"[REDACTED]"}
+{"Email":"bob@example.com","Identifier":2,"Name":"bob","Profile":{"Bio":"","password":"[REDACTED]"},"Tags":null,"Token":"[REDACTED]"}
+`
+	if output.String() != expected {
+		t.Errorf("Expected %s, found %s", expected, output.String())
+	}
+}
+
+func TestCollection_ExportCSV(t *testing.T) {
+	accounts := accountsForExport(t)
+	accounts.RedactFields("Email")
+
+	output := &bytes.Buffer{}
+	if err := accounts.ExportCSV(output); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := `Identifier,Name,Email,Token,Tags,Profile
+1,alice,[REDACTED],[REDACTED],"[""admin""]","{""Bio"":""hi"",""password"":""[REDACTED]""}"
+2,bob,[REDACTED],[REDACTED],,"{""Bio"":"""",""password"":""[REDACTED]""}"
+`
+	if output.String() != expected {
+		t.Errorf("Expected %s, found %s", expected, output.String())
+	}
+}
+
+func TestCollection_Redact(t *testing.T) {
+	accounts := accountsForExport(t)
+	accounts.RedactFields("Email")
+
+	redacted, ok := accounts.Redact(accounts.FindKey(1)).(map[string]interface{})
+	if !ok {
+		t.Fatalf("Expected a JSON object, found %#v", redacted)
+	}
+	for _, field := range []string{"Email", "Token"} {
+		if redacted[field] != datastore.Redacted {
+			t.Errorf("Expected %s to be %s, found %v", field, datastore.Redacted, redacted[field])
+		}
+	}
+	if redacted["Name"] != "alice" {
+		t.Errorf("Expected alice, found %v", redacted["Name"])
+	}
+}
@@ -0,0 +1,139 @@
+package datastore
+
+import (
+	"encoding"
+	"encoding/json"
+	"reflect"
+)
+
+// documentField returns the named field from a Document, which must be a
+// pointer to a struct. The field must be exported so it can be set.
+func documentField(document Document, name string) (reflect.Value, error) {
+	value := reflect.ValueOf(document)
+	if value.Kind() != reflect.Ptr || value.Elem().Kind() != reflect.Struct {
+		return reflect.Value{}, ErrInvalidField
+	}
+
+	field := value.Elem().FieldByName(name)
+	if !field.IsValid() || !field.CanSet() {
+		return reflect.Value{}, ErrInvalidField
+	}
+	return field, nil
+}
+
+// assignableValue converts value so it can be assigned to a field of the given
+// type. nil is converted to the zero value for the type. Numeric values may be
+// converted between numeric types, but otherwise the value must be assignable
+// to the field as-is.
+func assignableValue(value interface{}, to reflect.Type) (reflect.Value, error) {
+	if value == nil {
+		return reflect.Zero(to), nil
+	}
+
+	v := reflect.ValueOf(value)
+	if v.Type().AssignableTo(to) {
+		return v, nil
+	}
+	if isNumeric(v.Kind()) && isNumeric(to.Kind()) {
+		return v.Convert(to), nil
+	}
+	return reflect.Value{}, ErrInvalidField
+}
+
+func isNumeric(kind reflect.Kind) bool {
+	switch kind {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return true
+	}
+	return false
+}
+
+// mergePatch applies an RFC 7396 JSON Merge Patch to target. Keys in the patch
+// with a null value are removed from the target. Objects are merged
+// recursively; any other value replaces the target value.
+func mergePatch(target, patch interface{}) interface{} {
+	patchObject, ok := patch.(map[string]interface{})
+	if !ok {
+		return patch
+	}
+
+	targetObject, ok := target.(map[string]interface{})
+	if !ok {
+		targetObject = map[string]interface{}{}
+	}
+
+	for key, value := range patchObject {
+		if value == nil {
+			delete(targetObject, key)
+			continue
+		}
+		targetObject[key] = mergePatch(targetObject[key], value)
+	}
+	return targetObject
+}
+
+// applyMergePatch applies a JSON Merge Patch to a Document, which must be a
+// pointer to a struct. The Document is encoded as JSON and patched, and the
+// result is decoded into a copy of the Document whose JSON fields have been
+// reset, which then replaces the contents of the Document. Fields removed by
+// the patch are reset to their zero values, and fields that are not encoded as
+// JSON (unexported or tagged `json:"-"`) keep their values.
+func applyMergePatch(document Document, patch []byte) error {
+	var patchValue interface{}
+	if err := json.Unmarshal(patch, &patchValue); err != nil {
+		return err
+	}
+
+	encoded, err := json.Marshal(document)
+	if err != nil {
+		return err
+	}
+	var targetValue interface{}
+	if err := json.Unmarshal(encoded, &targetValue); err != nil {
+		return err
+	}
+
+	merged, err := json.Marshal(mergePatch(targetValue, patchValue))
+	if err != nil {
+		return err
+	}
+
+	value := reflect.ValueOf(document)
+	if value.Kind() != reflect.Ptr || value.Elem().Kind() != reflect.Struct {
+		return ErrInvalidField
+	}
+	fresh := reflect.New(value.Elem().Type())
+	fresh.Elem().Set(value.Elem())
+	resetJSONFields(fresh.Elem())
+	if err := json.Unmarshal(merged, fresh.Interface()); err != nil {
+		return err
+	}
+	value.Elem().Set(fresh.Elem())
+	return nil
+}
+
+var jsonUnmarshalerType = reflect.TypeOf((*json.Unmarshaler)(nil)).Elem()
+var textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+
+// resetJSONFields sets the fields of a struct that are encoded as JSON to their
+// zero values, so decoding into it gives them exactly the decoded values.
+// Structs are reset field by field, so their hidden fields are kept, unless
+// they decode themselves (like time.Time).
+func resetJSONFields(v reflect.Value) {
+	for i := 0; i < v.NumField(); i++ {
+		field := v.Type().Field(i)
+		if _, ok := exportName(field); !ok {
+			continue
+		}
+
+		kind := field.Type
+		if kind.Kind() == reflect.Struct && !reflect.PointerTo(kind).Implements(jsonUnmarshalerType) &&
+			!reflect.PointerTo(kind).Implements(textUnmarshalerType) {
+			resetJSONFields(v.Field(i))
+			continue
+		}
+		v.Field(i).Set(reflect.Zero(kind))
+	}
+}
@@ -0,0 +1,250 @@
+// Package follower keeps a read-only copy of a Datastore in sync with a primary
+// process over HTTP.
+//
+// The primary serves its Datastore file with Handler:
+//
+//	http.Handle("/snapshot", follower.Handler(ds))
+//
+// Each follower opens a local copy with Open and calls Sync (or Run) to pull a
+// fresh snapshot whenever the primary has flushed:
+//
+//	client, err := follower.Open(ctx, "http://primary/snapshot", "copy.datastore", "myapp.1")
+//	go client.Run(ctx, time.Minute)
+//	pets := client.Store().In("pets")
+//
+// Snapshots are swapped in atomically, so Store always returns a complete
+// Datastore. Call Store again for each unit of work to see the latest data.
+package follower
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"git.stormbase.io/cbednarski/datastore"
+)
+
+// Handler serves the Datastore file that ds was opened from. The file on disk
+// is always a complete snapshot because Flush replaces it atomically, so only
+// flushed changes are served. Responses carry an ETag so followers only
+// download the file after it changes.
+func Handler(ds *datastore.Datastore) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Stat the open file rather than the path so the ETag always matches
+		// the content, even if a Flush replaces the file in the meantime.
+		file, err := os.Open(ds.Path())
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		defer file.Close()
+
+		info, err := file.Stat()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/octet-stream")
+		w.Header().Set("ETag", etag(info))
+		http.ServeContent(w, r, "", info.ModTime(), file)
+	})
+}
+
+func etag(info os.FileInfo) string {
+	return `"` + strconv.FormatInt(info.ModTime().UnixNano(), 36) + "-" + strconv.FormatInt(info.Size(), 36) + `"`
+}
+
+// Client keeps a local copy of a primary Datastore. It is safe for concurrent
+// use.
+type Client struct {
+	url       string
+	path      string
+	signature string
+
+	// HTTPClient is used to download snapshots. If it is nil,
+	// http.DefaultClient is used.
+	HTTPClient *http.Client
+
+	// OnError is called by Run when a Sync fails. If it is nil, errors are
+	// ignored and Run tries again at the next interval.
+	OnError func(error)
+
+	store atomic.Pointer[datastore.Datastore]
+
+	// syncMutex ensures only one Sync runs at a time, and guards etag
+	syncMutex sync.Mutex
+	etag      string
+}
+
+// Open returns a Client that follows the Datastore served at url, keeping a
+// copy at path. If a copy already exists at path it is opened; otherwise the
+// first snapshot is downloaded before Open returns.
+func Open(ctx context.Context, url, path, signature string) (*Client, error) {
+	c := &Client{
+		url:       url,
+		path:      path,
+		signature: signature,
+	}
+
+	ds, err := datastore.Open(path, signature)
+	if err == nil {
+		c.swap(ds)
+		return c, nil
+	}
+	if !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+
+	if _, err := c.Sync(ctx); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// Store returns the most recent copy of the Datastore. Do not change it:
+// Collections in the copy are read-only, and any other change is discarded by
+// the next Sync.
+func (c *Client) Store() *datastore.Datastore {
+	return c.store.Load()
+}
+
+// Sync downloads a fresh snapshot from the primary if it has changed since the
+// last Sync, and swaps it in. Sync returns true if a new snapshot was swapped
+// in. If the download or the snapshot is bad the current copy is kept.
+//
+// Callers that still hold the previous Datastore may keep reading from it.
+func (c *Client) Sync(ctx context.Context) (bool, error) {
+	c.syncMutex.Lock()
+	defer c.syncMutex.Unlock()
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, c.url, nil)
+	if err != nil {
+		return false, err
+	}
+	if c.etag != "" && c.store.Load() != nil {
+		request.Header.Set("If-None-Match", c.etag)
+	}
+
+	client := c.HTTPClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+	response, err := client.Do(request)
+	if err != nil {
+		return false, err
+	}
+	defer response.Body.Close()
+
+	switch response.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotModified:
+		return false, nil
+	default:
+		return false, fmt.Errorf("follower: %s returned %s", c.url, response.Status)
+	}
+
+	if err := c.download(response.Body); err != nil {
+		return false, err
+	}
+	ds, err := c.replace()
+	if err != nil {
+		return false, err
+	}
+
+	c.etag = response.Header.Get("ETag")
+	c.swap(ds)
+	return true, nil
+}
+
+// download writes the snapshot next to the local copy.
+func (c *Client) download(body io.Reader) error {
+	temp := c.path + ".download"
+	file, err := os.OpenFile(temp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(file, body); err != nil {
+		file.Close()
+		os.Remove(temp)
+		return err
+	}
+	if err := file.Close(); err != nil {
+		os.Remove(temp)
+		return err
+	}
+	return nil
+}
+
+// replace moves the downloaded snapshot over the local copy and opens it. The
+// previous copy is moved aside first and put back if the snapshot can not be
+// opened, so a bad download never replaces a good copy.
+func (c *Client) replace() (*datastore.Datastore, error) {
+	temp := c.path + ".download"
+	previous := c.path + ".previous"
+
+	hadPrevious := true
+	if err := os.Rename(c.path, previous); errors.Is(err, os.ErrNotExist) {
+		hadPrevious = false
+	} else if err != nil {
+		os.Remove(temp)
+		return nil, err
+	}
+
+	if err := os.Rename(temp, c.path); err != nil {
+		os.Remove(temp)
+		if hadPrevious {
+			os.Rename(previous, c.path)
+		}
+		return nil, err
+	}
+
+	ds, err := datastore.Open(c.path, c.signature)
+	if err != nil {
+		os.Remove(c.path)
+		if hadPrevious {
+			os.Rename(previous, c.path)
+		}
+		return nil, err
+	}
+
+	if hadPrevious {
+		os.Remove(previous)
+	}
+	return ds, nil
+}
+
+// swap makes ds the current copy. Collections are made read-only, since
+// changes to a copy would be lost at the next Sync.
+func (c *Client) swap(ds *datastore.Datastore) {
+	for _, name := range ds.CollectionNames() {
+		ds.In(name).SetReadOnly(true)
+	}
+	c.store.Store(ds)
+}
+
+// Run calls Sync every interval until ctx is cancelled, and returns ctx.Err().
+// Errors from Sync are passed to OnError. Call Sync directly to pull a
+// snapshot sooner, for example when the primary sends a notification.
+func (c *Client) Run(ctx context.Context, interval time.Duration) error {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+			if _, err := c.Sync(ctx); err != nil && c.OnError != nil {
+				c.OnError(err)
+			}
+		}
+	}
+}
@@ -0,0 +1,145 @@
+package follower_test
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/gob"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+
+	"git.stormbase.io/cbednarski/datastore"
+	"git.stormbase.io/cbednarski/datastore/follower"
+)
+
+type Pet struct {
+	Identifier uint64
+	Name       string
+}
+
+func (p *Pet) ID() uint64 {
+	return p.Identifier
+}
+
+func (p *Pet) SetID(id uint64) {
+	p.Identifier = id
+}
+
+func init() {
+	gob.Register(&Pet{})
+}
+
+const signature = "followertest.1"
+
+func TestClient_Sync(t *testing.T) {
+	tempdir := t.TempDir()
+	ctx := context.Background()
+
+	primary, err := datastore.Create(filepath.Join(tempdir, "primary"+datastore.Extension), signature)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := primary.In("pets").Upsert(&Pet{Name: "Rex"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := primary.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	// The handler can be replaced to simulate a misbehaving primary
+	var handler atomic.Pointer[http.Handler]
+	snapshots := follower.Handler(primary)
+	handler.Store(&snapshots)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		(*handler.Load()).ServeHTTP(w, r)
+	}))
+	defer server.Close()
+
+	local := filepath.Join(tempdir, "follower"+datastore.Extension)
+	client, err := follower.Open(ctx, server.URL, local, signature)
+	if err != nil {
+		t.Fatal(err)
+	}
+	first := client.Store()
+	if pet, ok := first.In("pets").FindKey(1).(*Pet); !ok || pet.Name != "Rex" {
+		t.Fatalf("Expected Rex, found %#v", first.In("pets").FindKey(1))
+	}
+	if err := first.In("pets").Upsert(&Pet{Name: "Lost"}); !errors.Is(err, datastore.ErrReadOnly) {
+		t.Errorf("Expected %s, found %v", datastore.ErrReadOnly, err)
+	}
+
+	if synced, err := client.Sync(ctx); err != nil || synced {
+		t.Errorf("Expected no new snapshot, found %t %v", synced, err)
+	}
+
+	if err := primary.In("pets").Upsert(&Pet{Name: "Fido"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := primary.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if synced, err := client.Sync(ctx); err != nil || !synced {
+		t.Fatalf("Expected a new snapshot, found %t %v", synced, err)
+	}
+	if len(client.Store().In("pets").List()) != 2 {
+		t.Errorf("Expected 2 pets, found %d", len(client.Store().In("pets").List()))
+	}
+	if len(first.In("pets").List()) != 1 {
+		t.Errorf("Expected the previous copy to be unchanged, found %d pets", len(first.In("pets").List()))
+	}
+
+	// A bad snapshot is rejected and the local copy is kept
+	if err := primary.In("pets").Upsert(&Pet{Name: "Spot"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := primary.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	var garbage http.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("not a datastore"))
+	})
+	handler.Store(&garbage)
+	// Open returns the gzip error as it is for a file that is not gzipped
+	if _, err := client.Sync(ctx); err != gzip.ErrHeader {
+		t.Errorf("Expected %s, found %v", gzip.ErrHeader, err)
+	}
+	if len(client.Store().In("pets").List()) != 2 {
+		t.Errorf("Expected 2 pets, found %d", len(client.Store().In("pets").List()))
+	}
+
+	// The local copy is opened without downloading
+	reopened, err := follower.Open(ctx, server.URL, local, signature)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(reopened.Store().In("pets").List()) != 2 {
+		t.Errorf("Expected 2 pets, found %d", len(reopened.Store().In("pets").List()))
+	}
+
+	handler.Store(&snapshots)
+	if synced, err := reopened.Sync(ctx); err != nil || !synced {
+		t.Fatalf("Expected a new snapshot, found %t %v", synced, err)
+	}
+	if len(reopened.Store().In("pets").List()) != 3 {
+		t.Errorf("Expected 3 pets, found %d", len(reopened.Store().In("pets").List()))
+	}
+}
+
+func TestOpen_WrongSignature(t *testing.T) {
+	tempdir := t.TempDir()
+
+	primary, err := datastore.Create(filepath.Join(tempdir, "primary"+datastore.Extension), "other.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := httptest.NewServer(follower.Handler(primary))
+	defer server.Close()
+
+	_, err = follower.Open(context.Background(), server.URL, filepath.Join(tempdir, "follower"+datastore.Extension), signature)
+	if !errors.Is(err, datastore.ErrInvalidSignature) {
+		t.Errorf("Expected %s, found %v", datastore.ErrInvalidSignature, err)
+	}
+}
@@ -0,0 +1,65 @@
+package datastore
+
+import (
+	"io"
+	"os"
+)
+
+// FS is the filesystem Flush writes the Datastore file through. The default,
+// OSFS, uses the os package. Replace it with SetFS to inject failures in tests
+// (see datastoretest.FaultyFS) or to wrap file operations with instrumentation.
+type FS interface {
+	// Create creates a new file for writing. It fails if name already exists.
+	Create(name string) (File, error)
+
+	// Rename replaces newpath with oldpath.
+	Rename(oldpath, newpath string) error
+
+	// RemoveAll removes name and anything it contains. It returns nil if name
+	// does not exist.
+	RemoveAll(name string) error
+}
+
+// File is a file created by an FS.
+type File interface {
+	io.Writer
+
+	// Sync commits the contents of the file to stable storage.
+	Sync() error
+
+	Close() error
+}
+
+// OSFS is the FS backed by the os package.
+var OSFS FS = osFS{}
+
+type osFS struct{}
+
+func (osFS) Create(name string) (File, error) {
+	return os.OpenFile(name, os.O_RDWR|os.O_CREATE|os.O_TRUNC|os.O_EXCL, 0644)
+}
+
+func (osFS) Rename(oldpath, newpath string) error {
+	return os.Rename(oldpath, newpath)
+}
+
+func (osFS) RemoveAll(name string) error {
+	return os.RemoveAll(name)
+}
+
+// SetFS changes the filesystem Flush writes through. Pass nil to go back to
+// OSFS. Open always reads through the os package.
+func (d *Datastore) SetFS(fsys FS) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	d.fs = fsys
+}
+
+// filesystem returns the FS set with SetFS, or OSFS. It must be called while
+// mutex is held.
+func (d *Datastore) filesystem() FS {
+	if d.fs == nil {
+		return OSFS
+	}
+	return d.fs
+}
@@ -0,0 +1,83 @@
+package datastore
+
+import (
+	"time"
+)
+
+// Health describes whether a Datastore is open and persisting its changes. It
+// is returned by Datastore.Health and is intended for liveness and readiness
+// probes.
+type Health struct {
+	// Open is false after the Datastore has been closed.
+	Open bool
+
+	// LastFlush is when the last successful Flush finished. It is zero if the
+	// Datastore has not been flushed since it was opened.
+	LastFlush time.Time
+
+	// LastFlushAge is the time since LastFlush, or since the Datastore was
+	// opened if it has not been flushed.
+	LastFlushAge time.Duration
+
+	// PendingChanges is the number of changes that have not been flushed. See
+	// Datastore.PendingChanges.
+	PendingChanges int
+
+	// UnflushedAge is how long the oldest pending change has waited to be
+	// flushed, or 0 if there are none. See SetWatchdog.
+	UnflushedAge time.Duration
+
+	// LastError is the error returned by the most recent Flush, or nil if it
+	// succeeded.
+	LastError error
+}
+
+// Healthy returns true if the Datastore is open and its most recent Flush
+// succeeded.
+func (h Health) Healthy() bool {
+	return h.Open && h.LastError == nil
+}
+
+// flushOutcome records the result of the most recent Flush for Health.
+type flushOutcome struct {
+	// succeeded is when the last successful Flush finished
+	succeeded time.Time
+
+	// err is the error from the most recent Flush
+	err error
+}
+
+// Health returns the current status of the Datastore. It does not wait for a
+// Flush in progress, so it is safe to call from a probe handler while the
+// Datastore is busy.
+func (d *Datastore) Health() Health {
+	now := d.now()
+	health := Health{
+		Open:           d.checkOpen() == nil,
+		PendingChanges: d.PendingChanges(),
+		UnflushedAge:   d.unflushedAge(),
+	}
+	since := d.opened
+	if outcome := d.flushed.Load(); outcome != nil {
+		health.LastFlush = outcome.succeeded
+		health.LastError = outcome.err
+		if !outcome.succeeded.IsZero() {
+			since = outcome.succeeded
+		}
+	}
+	health.LastFlushAge = now.Sub(since)
+	return health
+}
+
+// recordFlush updates the outcome reported by Health. It is called while
+// flushMutex is held.
+func (d *Datastore) recordFlush(err error) {
+	outcome := flushOutcome{err: err}
+	if previous := d.flushed.Load(); previous != nil {
+		outcome.succeeded = previous.succeeded
+	}
+	if err == nil {
+		outcome.succeeded = d.now()
+	}
+	d.flushed.Store(&outcome)
+}
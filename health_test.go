@@ -0,0 +1,69 @@
+package datastore_test
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"git.stormbase.io/cbednarski/datastore"
+)
+
+func TestHealth(t *testing.T) {
+	tempdir, err := ioutil.TempDir("", "datastore")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempdir)
+
+	datapath := filepath.Join(tempdir, "health"+datastore.Extension)
+	ds, err := datastore.Create(datapath, TestdataSignature)
+	if err != nil {
+		t.Fatal(err)
+	}
+	flushed := ds.Health().LastFlush
+	if flushed.IsZero() {
+		t.Fatal("Expected Create to record a flush")
+	}
+
+	now := flushed.Add(time.Minute)
+	ds.SetClock(func() time.Time { return now })
+	if err := ds.In("names").Upsert(&NameDocument{Name: "pending"}); err != nil {
+		t.Fatal(err)
+	}
+	health := ds.Health()
+	if !health.Healthy() || health.PendingChanges != 1 || health.LastFlushAge != time.Minute {
+		t.Errorf("Expected healthy with 1 pending change flushed a minute ago, found %+v", health)
+	}
+
+	// A non-empty directory in place of the file makes the flush fail
+	if err := os.Remove(datapath); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(filepath.Join(datapath, "blocker"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ds.Flush(); err == nil {
+		t.Fatal("Expected flush to fail")
+	}
+	health = ds.Health()
+	if health.Healthy() || !errors.Is(health.LastError, datastore.ErrIO) {
+		t.Errorf("Expected %s, found %v", datastore.ErrIO, health.LastError)
+	}
+	if !health.LastFlush.Equal(flushed) {
+		t.Errorf("Expected %s, found %s", flushed, health.LastFlush)
+	}
+
+	if err := os.RemoveAll(datapath); err != nil {
+		t.Fatal(err)
+	}
+	if err := ds.Close(); err != nil {
+		t.Fatal(err)
+	}
+	health = ds.Health()
+	if health.Open || health.LastError != nil || health.PendingChanges != 0 {
+		t.Errorf("Expected closed with no errors or pending changes, found %+v", health)
+	}
+}
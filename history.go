@@ -0,0 +1,133 @@
+package datastore
+
+import "time"
+
+// Version is a copy of a Document as it was when it was upserted.
+type Version struct {
+	// Number increases by one each time the Document is upserted.
+	Number int
+
+	// Time is when this version was upserted.
+	Time time.Time
+
+	// Document is a copy of the Document. Modifying it does not modify the
+	// version history.
+	Document Document
+}
+
+// SetHistory configures the Collection to keep the last limit versions of each
+// Document. A copy of the Document is recorded each time it is upserted, and
+// the history is written to disk along with the rest of the Collection. Setting
+// limit to zero disables history and discards any versions already recorded.
+//
+// Version history is kept for Documents that have been deleted, so they may be
+// restored later with RestoreVersion.
+func (c *Collection) SetHistory(limit int) error {
+	return c.mutate(Operation{Op: OpHistory}, func() error {
+		c.markDirty(1)
+
+		if limit <= 0 {
+			c.HistoryLimit = 0
+			c.Versions = nil
+			return nil
+		}
+
+		c.HistoryLimit = limit
+		if c.Versions == nil {
+			c.Versions = map[uint64][]Version{}
+		}
+		for key, versions := range c.Versions {
+			if len(versions) > limit {
+				c.Versions[key] = versions[len(versions)-limit:]
+			}
+		}
+		return nil
+	})
+}
+
+// History returns the recorded versions of the Document with the specified key,
+// from oldest to newest. The newest version is the one most recently upserted.
+// Each Version contains a copy of the Document, so you may modify it freely.
+func (c *Collection) History(key uint64) ([]Version, error) {
+	if err := c.checkOpen(); err != nil {
+		return nil, err
+	}
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	history := []Version{}
+	for _, version := range c.Versions[key] {
+		document, err := copyDocument(version.Document)
+		if err != nil {
+			return nil, err
+		}
+		version.Document = document
+		history = append(history, version)
+	}
+	return history, nil
+}
+
+// RestoreVersion replaces the Document with the specified key with a copy of the
+// specified version from its history, and returns the restored Document. If the
+// Document has been deleted it is inserted again. Restoring a version records a
+// new version, so a restore can itself be undone.
+func (c *Collection) RestoreVersion(key uint64, number int) (restored Document, err error) {
+	err = c.mutate(Operation{Op: OpRestore, Key: key}, func() error {
+		for _, version := range c.Versions[key] {
+			if version.Number != number {
+				continue
+			}
+
+			document, err := copyDocument(version.Document)
+			if err != nil {
+				return err
+			}
+			document.SetID(key)
+			if _, err := c.upsert(OpRestore, document); err != nil {
+				return err
+			}
+			restored = document
+			return nil
+		}
+
+		return ErrVersionNotFound
+	})
+	return restored, err
+}
+
+// recordVersion adds a copy of the Document to its version history, if history
+// is enabled. It must be called while the Collection is locked.
+func (c *Collection) recordVersion(document Document) error {
+	if c.HistoryLimit == 0 {
+		return nil
+	}
+
+	copied, err := copyDocument(document)
+	if err != nil {
+		return err
+	}
+
+	if c.Versions == nil {
+		c.Versions = map[uint64][]Version{}
+	}
+
+	key := document.ID()
+	versions := c.Versions[key]
+
+	number := 1
+	if len(versions) > 0 {
+		number = versions[len(versions)-1].Number + 1
+	}
+
+	versions = append(versions, Version{
+		Number:   number,
+		Time:     c.now(),
+		Document: copied,
+	})
+	if len(versions) > c.HistoryLimit {
+		versions = versions[len(versions)-c.HistoryLimit:]
+	}
+
+	c.Versions[key] = versions
+	return nil
+}
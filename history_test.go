@@ -0,0 +1,153 @@
+package datastore_test
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"git.stormbase.io/cbednarski/datastore"
+)
+
+func TestCollection_History(t *testing.T) {
+	tempdir, err := ioutil.TempDir("", "datastore")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempdir)
+
+	datapath := filepath.Join(tempdir, "history"+datastore.Extension)
+	ds, err := datastore.Create(datapath, TestdataSignature)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cakes := ds.In("cakes")
+	if err := cakes.SetHistory(2); err != nil {
+		t.Fatal(err)
+	}
+
+	cake := &NameDocument{Name: "chocolate"}
+	for _, name := range []string{"vanilla", "strawberry"} {
+		if err := cakes.Upsert(cake); err != nil {
+			t.Fatal(err)
+		}
+		cake.Name = name
+	}
+	if err := cakes.Upsert(cake); err != nil {
+		t.Fatal(err)
+	}
+
+	history, err := cakes.History(cake.ID())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(history) != 2 {
+		t.Fatalf("Expected 2 versions, found %d", len(history))
+	}
+
+	expected := []string{"vanilla", "strawberry"}
+	for i, version := range history {
+		if version.Number != i+2 {
+			t.Errorf("Expected version %d, found %d", i+2, version.Number)
+		}
+		if name := version.Document.(*NameDocument).Name; name != expected[i] {
+			t.Errorf("Expected %s, found %s", expected[i], name)
+		}
+	}
+
+	// History is written to disk
+	if err := ds.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	ds, err = datastore.Open(datapath, TestdataSignature)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cakes = ds.In("cakes")
+
+	// Deleted documents can be restored from their history
+	cakes.DeleteKey(cake.ID())
+
+	restored, err := cakes.RestoreVersion(cake.ID(), 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if name := cakes.FindKey(cake.ID()).(*NameDocument).Name; name != "vanilla" {
+		t.Errorf("Expected vanilla, found %s", name)
+	}
+	if restored.ID() != cake.ID() {
+		t.Errorf("Expected ID %d, found %d", cake.ID(), restored.ID())
+	}
+
+	if _, err := cakes.RestoreVersion(cake.ID(), 1); !errors.Is(err, datastore.ErrVersionNotFound) {
+		t.Errorf("Expected %s, found %s", datastore.ErrVersionNotFound, err)
+	}
+
+	history, err = cakes.History(cake.ID())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if last := history[len(history)-1]; last.Number != 4 {
+		t.Errorf("Expected restore to record version 4, found %d", last.Number)
+	}
+
+	cakes.SetReadOnly(true)
+	if err := cakes.SetHistory(0); !errors.Is(err, datastore.ErrReadOnly) {
+		t.Errorf("Expected %s, found %v", datastore.ErrReadOnly, err)
+	}
+	cakes.SetReadOnly(false)
+
+	if err := cakes.SetHistory(0); err != nil {
+		t.Fatal(err)
+	}
+	history, err = cakes.History(cake.ID())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(history) != 0 {
+		t.Errorf("Expected history to be discarded, found %d versions", len(history))
+	}
+}
+
+func TestCollection_HistoryIncrementPatch(t *testing.T) {
+	ds := datastore.New()
+	counters := ds.In("counters")
+	if err := counters.SetHistory(5); err != nil {
+		t.Fatal(err)
+	}
+
+	counter := &NumberDocument{Number: 1}
+	if err := counters.Upsert(counter); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := counters.Increment(counter.ID(), "Number", 2); err != nil {
+		t.Fatal(err)
+	}
+	if err := counters.Patch(counter.ID(), map[string]interface{}{"Number": 10}); err != nil {
+		t.Fatal(err)
+	}
+
+	history, err := counters.History(counter.ID())
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []int{1, 3, 10}
+	if len(history) != len(expected) {
+		t.Fatalf("Expected %d versions, found %d", len(expected), len(history))
+	}
+	for i, version := range history {
+		if number := version.Document.(*NumberDocument).Number; number != expected[i] {
+			t.Errorf("Expected %d, found %d", expected[i], number)
+		}
+	}
+
+	// Changes made by Increment can be undone
+	if _, err := counters.RestoreVersion(counter.ID(), history[0].Number); err != nil {
+		t.Fatal(err)
+	}
+	if number := counters.FindKey(counter.ID()).(*NumberDocument).Number; number != 1 {
+		t.Errorf("Expected 1, found %d", number)
+	}
+}
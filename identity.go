@@ -0,0 +1,29 @@
+package datastore
+
+import "reflect"
+
+// claim records that the Document belongs to this Collection, so it can not be
+// upserted into another Collection where its ID would be overwritten. Returns
+// true if the Document was not already claimed by this Collection. Documents in
+// compressed Collections, and in strict mode, are copies and are not claimed.
+// It must be called while the Collection is locked.
+func (c *Collection) claim(document Document) (bool, error) {
+	if c.store == nil || c.Compressed || c.strict() || reflect.TypeOf(document).Kind() != reflect.Ptr {
+		return false, nil
+	}
+
+	owner, loaded := c.store.identities.LoadOrStore(document, c)
+	if loaded && owner != c {
+		return false, ErrDocumentInOtherCollection
+	}
+	return !loaded, nil
+}
+
+// release forgets that the Document belongs to this Collection. It must be
+// called while the Collection is locked.
+func (c *Collection) release(document Document) {
+	if c.store == nil || document == nil || reflect.TypeOf(document).Kind() != reflect.Ptr {
+		return
+	}
+	c.store.identities.CompareAndDelete(document, c)
+}
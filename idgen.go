@@ -0,0 +1,131 @@
+package datastore
+
+import (
+	"math/rand"
+	"sort"
+	"sync"
+	"time"
+)
+
+// IDGenerator returns a new key for a Document. It is called while the
+// Collection is locked, so it must not call methods on the Collection. If it
+// returns zero or a key that is already in use it is called again.
+type IDGenerator func() uint64
+
+// SetIDGenerator changes how keys are chosen for new Documents in the
+// Collection. By default (or if generator is nil) keys autoincrement from
+// CurrentIndex. Use RandomIDs or TimeOrderedIDs for keys that are unique across
+// Datastores, so Documents from different files can be merged. The generator is
+// not written to disk, so set it again after Open.
+func (c *Collection) SetIDGenerator(generator IDGenerator) {
+	c.mutex.Lock()
+	c.idGenerator = generator
+	c.mutex.Unlock()
+}
+
+// nextID returns an unused key for a new Document. It must be called while the
+// Collection is locked.
+func (c *Collection) nextID() uint64 {
+	inUse := func(key uint64) bool {
+		return key == 0 || c.Items[key] != nil || c.Trash[key].Document != nil
+	}
+
+	if c.idGenerator != nil {
+		key := c.idGenerator()
+		for inUse(key) {
+			key = c.idGenerator()
+		}
+		return key
+	}
+
+	c.CurrentIndex += 1
+	// Skip over any keys that were supplied by the caller, or that belong to a
+	// Document in the trash
+	for inUse(c.CurrentIndex) {
+		c.CurrentIndex += 1
+	}
+	return c.CurrentIndex
+}
+
+// AllocateIDRange reserves n contiguous keys that are not in use and returns the
+// first one. The keys will never be chosen by autoincrement, so a client that
+// is offline can assign them to new Documents itself and merge them back later
+// without colliding with Documents created in the meantime. The reservation is
+// recorded in CurrentIndex, so it is written to disk by the next Flush.
+func (c *Collection) AllocateIDRange(n uint64) (first uint64, err error) {
+	if n == 0 {
+		return 0, nil
+	}
+
+	err = c.mutate(Operation{Op: OpAllocate}, func() error {
+		first = c.CurrentIndex + 1
+		for {
+			// Find the first key in use at or after the start of the range,
+			// and start again after it if it falls inside the range
+			keys := c.index.Keys()
+			position := sort.Search(len(keys), func(i int) bool {
+				return keys[i] >= first
+			})
+			conflict := uint64(0)
+			if position < len(keys) && keys[position]-first < n {
+				conflict = keys[position]
+			}
+			for key := range c.Trash {
+				if key >= first && key-first < n && key > conflict {
+					conflict = key
+				}
+			}
+			if conflict == 0 {
+				break
+			}
+			first = conflict + 1
+		}
+
+		c.CurrentIndex = first + n - 1
+		c.markDirty(1)
+		return nil
+	})
+	return first, err
+}
+
+// RandomIDs returns an IDGenerator that chooses keys at random. With 64 bits the
+// chance of two Datastores choosing the same key is very small, but keys are
+// not ordered by insertion.
+func RandomIDs() IDGenerator {
+	return rand.Uint64
+}
+
+// timeOrderedEpoch is the start of the timestamps in TimeOrderedIDs.
+var timeOrderedEpoch = time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// TimeOrderedIDs returns an IDGenerator that creates keys ordered by the time
+// they were generated, like Twitter's Snowflake IDs. Each key holds the
+// milliseconds since 2020 (41 bits), the node (10 bits), and a sequence number
+// (12 bits). Give each program that writes to a shared set of Documents a
+// different node between 0 and 1023, and keys will never collide.
+func TimeOrderedIDs(node uint16) IDGenerator {
+	var mutex sync.Mutex
+	var last, sequence uint64
+	node &= 1<<10 - 1
+
+	return func() uint64 {
+		mutex.Lock()
+		defer mutex.Unlock()
+
+		now := uint64(time.Since(timeOrderedEpoch).Milliseconds())
+		if now <= last {
+			// Keep increasing even if the clock goes backwards, and borrow
+			// from the next millisecond when the sequence runs out
+			sequence++
+			if sequence >= 1<<12 {
+				sequence = 0
+				last++
+			}
+			now = last
+		} else {
+			sequence = 0
+			last = now
+		}
+		return now<<22 | uint64(node)<<12 | sequence
+	}
+}
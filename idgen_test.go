@@ -0,0 +1,100 @@
+package datastore_test
+
+import (
+	"testing"
+
+	"git.stormbase.io/cbednarski/datastore"
+)
+
+func TestCollection_SetIDGenerator(t *testing.T) {
+	ds := datastore.New()
+	pets := ds.In("pets")
+
+	next := uint64(100)
+	pets.SetIDGenerator(func() uint64 {
+		next++
+		// Collide with an existing key every time to make sure it is skipped
+		if next == 102 {
+			return 101
+		}
+		return next
+	})
+	for i := 0; i < 2; i++ {
+		if err := pets.Upsert(&NameDocument{Name: "pet"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if list := pets.List(); list[0] != 101 || list[1] != 103 {
+		t.Errorf("Expected keys 101 and 103, found %v", list)
+	}
+
+	pets.SetIDGenerator(datastore.RandomIDs())
+	pet := &NameDocument{Name: "random"}
+	if err := pets.Upsert(pet); err != nil {
+		t.Fatal(err)
+	}
+	if pet.ID() == 0 {
+		t.Error("Expected a random key")
+	}
+
+	generate := datastore.TimeOrderedIDs(7)
+	previous := uint64(0)
+	for i := 0; i < 10000; i++ {
+		id := generate()
+		if id <= previous {
+			t.Fatalf("Expected increasing keys, found %d after %d", id, previous)
+		}
+		if node := id >> 12 & 1023; node != 7 {
+			t.Fatalf("Expected node 7, found %d", node)
+		}
+		previous = id
+	}
+
+	// Autoincrement is used again once the generator is removed
+	pets.SetIDGenerator(nil)
+	pet = &NameDocument{Name: "counted"}
+	if err := pets.Upsert(pet); err != nil {
+		t.Fatal(err)
+	}
+	if pet.ID() != 1 {
+		t.Errorf("Expected 1, found %d", pet.ID())
+	}
+}
+
+func TestCollection_AllocateIDRange(t *testing.T) {
+	ds := datastore.New()
+	pets := ds.In("pets")
+
+	seed := []*NameDocument{{Name: "one"}, {Identifier: 5, Name: "five"}, {Identifier: 12, Name: "twelve"}}
+	for _, pet := range seed {
+		if err := pets.Upsert(pet); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// 2 through 4 are free, but 5 is in use
+	first, err := pets.AllocateIDRange(4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first != 6 {
+		t.Errorf("Expected 6, found %d", first)
+	}
+
+	// 10 through 13 would overlap 12
+	first, err = pets.AllocateIDRange(4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first != 13 {
+		t.Errorf("Expected 13, found %d", first)
+	}
+
+	pet := &NameDocument{Name: "next"}
+	if err := pets.Upsert(pet); err != nil {
+		t.Fatal(err)
+	}
+	if pet.ID() != 17 {
+		t.Errorf("Expected autoincrement to skip the reserved keys, found %d", pet.ID())
+	}
+}
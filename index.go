@@ -0,0 +1,233 @@
+package datastore
+
+import (
+	"sort"
+	"sync"
+
+	"git.stormbase.io/cbednarski/datastore/keys"
+)
+
+// KeyIndex holds the keys of the Documents in a Collection in ascending order.
+// Two implementations are provided: NewSliceIndex, the default, keeps the keys
+// in a sorted slice, which is compact and fast to scan but costs O(n) to insert
+// or delete a key in the middle. NewTreeIndex keeps them in a balanced tree,
+// which costs O(log n) per change but more memory, and has to build a slice
+// each time the keys are listed after a change. Use SetKeyIndex to choose.
+//
+// Insert and Delete are called while the Collection is write-locked. Len and
+// Keys are called while it is read-locked, so they may be called concurrently
+// with each other.
+type KeyIndex interface {
+	// Insert adds key, or does nothing if it is already present.
+	Insert(key uint64)
+
+	// Delete removes key, or does nothing if it is not present.
+	Delete(key uint64)
+
+	// Len returns the number of keys.
+	Len() int
+
+	// Keys returns the keys in ascending order. The slice must not be
+	// modified, and is only valid until the next Insert or Delete.
+	Keys() []uint64
+}
+
+// SetKeyIndex changes the KeyIndex used by the Collection. newIndex is called
+// to create an empty index, which is filled with the Collection's keys. For
+// example:
+//
+//	c.SetKeyIndex(datastore.NewTreeIndex)
+//
+// The choice is not written to disk, so call SetKeyIndex again after Open.
+func (c *Collection) SetKeyIndex(newIndex func() KeyIndex) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.newIndex = newIndex
+	c.rebuildIndex()
+}
+
+// newKeyIndex returns an empty KeyIndex of the type chosen with SetKeyIndex.
+func (c *Collection) newKeyIndex() KeyIndex {
+	if c.newIndex == nil {
+		return NewSliceIndex()
+	}
+	return c.newIndex()
+}
+
+// rebuildIndex replaces the index with a new one holding the keys of Items.
+// It must be called while the Collection is locked.
+func (c *Collection) rebuildIndex() {
+	sorted := make([]uint64, 0, len(c.Items))
+	for key := range c.Items {
+		sorted = append(sorted, key)
+	}
+	sort.Sort(UIntSlice(sorted))
+
+	// Inserting in order appends to the end of a slice index
+	c.index = c.newKeyIndex()
+	for _, key := range sorted {
+		c.index.Insert(key)
+	}
+}
+
+// sliceIndex is a KeyIndex backed by a sorted slice.
+type sliceIndex struct {
+	keys []uint64
+}
+
+// NewSliceIndex returns a KeyIndex that keeps keys in a sorted slice. This is
+// the default.
+func NewSliceIndex() KeyIndex {
+	return &sliceIndex{keys: []uint64{}}
+}
+
+func (s *sliceIndex) Insert(key uint64) { keys.Insert(&s.keys, key) }
+func (s *sliceIndex) Delete(key uint64) { keys.Delete(&s.keys, key) }
+func (s *sliceIndex) Len() int          { return len(s.keys) }
+func (s *sliceIndex) Keys() []uint64    { return s.keys }
+
+// treeIndex is a KeyIndex backed by a treap, a binary search tree kept
+// balanced by giving each node a pseudo-random priority derived from its key.
+type treeIndex struct {
+	root *treeNode
+	size int
+
+	// sorted caches the result of Keys until the tree changes. mutex guards
+	// it, since Keys is called by concurrent readers.
+	mutex  sync.Mutex
+	sorted []uint64
+}
+
+type treeNode struct {
+	key         uint64
+	priority    uint64
+	left, right *treeNode
+}
+
+// NewTreeIndex returns a KeyIndex that keeps keys in a balanced tree, for
+// Collections with many inserts and deletes.
+func NewTreeIndex() KeyIndex {
+	return &treeIndex{}
+}
+
+func (t *treeIndex) Insert(key uint64) {
+	var inserted bool
+	t.root, inserted = treeInsert(t.root, key)
+	if inserted {
+		t.size++
+		t.invalidate()
+	}
+}
+
+func (t *treeIndex) Delete(key uint64) {
+	var deleted bool
+	t.root, deleted = treeDelete(t.root, key)
+	if deleted {
+		t.size--
+		t.invalidate()
+	}
+}
+
+func (t *treeIndex) Len() int {
+	return t.size
+}
+
+func (t *treeIndex) Keys() []uint64 {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	if t.sorted == nil {
+		sorted := make([]uint64, 0, t.size)
+		var walk func(n *treeNode)
+		walk = func(n *treeNode) {
+			if n == nil {
+				return
+			}
+			walk(n.left)
+			sorted = append(sorted, n.key)
+			walk(n.right)
+		}
+		walk(t.root)
+		t.sorted = sorted
+	}
+	return t.sorted
+}
+
+func (t *treeIndex) invalidate() {
+	t.mutex.Lock()
+	t.sorted = nil
+	t.mutex.Unlock()
+}
+
+// treePriority scrambles a key (with the splitmix64 finalizer) so keys that
+// are inserted in order still produce a balanced tree.
+func treePriority(key uint64) uint64 {
+	key ^= key >> 30
+	key *= 0xbf58476d1ce4e5b9
+	key ^= key >> 27
+	key *= 0x94d049bb133111eb
+	key ^= key >> 31
+	return key
+}
+
+func treeInsert(n *treeNode, key uint64) (*treeNode, bool) {
+	if n == nil {
+		return &treeNode{key: key, priority: treePriority(key)}, true
+	}
+
+	var inserted bool
+	switch {
+	case key < n.key:
+		n.left, inserted = treeInsert(n.left, key)
+		if n.left.priority > n.priority {
+			n = rotateRight(n)
+		}
+	case key > n.key:
+		n.right, inserted = treeInsert(n.right, key)
+		if n.right.priority > n.priority {
+			n = rotateLeft(n)
+		}
+	}
+	return n, inserted
+}
+
+func treeDelete(n *treeNode, key uint64) (*treeNode, bool) {
+	if n == nil {
+		return nil, false
+	}
+
+	var deleted bool
+	switch {
+	case key < n.key:
+		n.left, deleted = treeDelete(n.left, key)
+	case key > n.key:
+		n.right, deleted = treeDelete(n.right, key)
+	default:
+		// Rotate the node down until it has at most one child
+		switch {
+		case n.left == nil:
+			return n.right, true
+		case n.right == nil:
+			return n.left, true
+		case n.left.priority > n.right.priority:
+			n = rotateRight(n)
+			n.right, deleted = treeDelete(n.right, key)
+		default:
+			n = rotateLeft(n)
+			n.left, deleted = treeDelete(n.left, key)
+		}
+	}
+	return n, deleted
+}
+
+func rotateRight(n *treeNode) *treeNode {
+	left := n.left
+	n.left, left.right = left.right, n
+	return left
+}
+
+func rotateLeft(n *treeNode) *treeNode {
+	right := n.right
+	n.right, right.left = right.left, n
+	return right
+}
@@ -0,0 +1,97 @@
+package datastore_test
+
+import (
+	"math/rand"
+	"reflect"
+	"sort"
+	"testing"
+
+	"git.stormbase.io/cbednarski/datastore"
+)
+
+func TestKeyIndex(t *testing.T) {
+	indexes := map[string]func() datastore.KeyIndex{
+		"slice": datastore.NewSliceIndex,
+		"tree":  datastore.NewTreeIndex,
+	}
+
+	for name, newIndex := range indexes {
+		t.Run(name, func(t *testing.T) {
+			index := newIndex()
+			expected := map[uint64]bool{}
+			rng := rand.New(rand.NewSource(1))
+			for i := 0; i < 2000; i++ {
+				key := uint64(rng.Intn(500))
+				if rng.Intn(3) == 0 {
+					index.Delete(key)
+					delete(expected, key)
+				} else {
+					index.Insert(key)
+					expected[key] = true
+				}
+			}
+
+			keys := []uint64{}
+			for key := range expected {
+				keys = append(keys, key)
+			}
+			sort.Sort(datastore.UIntSlice(keys))
+			if !reflect.DeepEqual(index.Keys(), keys) {
+				t.Errorf("Expected %v, found %v", keys, index.Keys())
+			}
+			if index.Len() != len(keys) {
+				t.Errorf("Expected %d, found %d", len(keys), index.Len())
+			}
+		})
+	}
+}
+
+func TestCollection_SetKeyIndex(t *testing.T) {
+	ds := datastore.New()
+	names := ds.In("names")
+	for _, name := range []string{"a", "b", "c"} {
+		if err := names.Upsert(&NameDocument{Name: name}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	names.SetKeyIndex(datastore.NewTreeIndex)
+	if err := names.DeleteKey(2); err != nil {
+		t.Fatal(err)
+	}
+	if err := names.Upsert(&NameDocument{Name: "d"}); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []uint64{1, 3, 4}
+	if !reflect.DeepEqual(names.List(), expected) {
+		t.Errorf("Expected %v, found %v", expected, names.List())
+	}
+	if found := names.FindLast(func(datastore.Document) bool { return true }); found.ID() != 4 {
+		t.Errorf("Expected %d, found %d", 4, found.ID())
+	}
+}
+
+func benchmarkChurn(b *testing.B, newIndex func() datastore.KeyIndex) {
+	const size = 100000
+	index := newIndex()
+	rng := rand.New(rand.NewSource(1))
+	for i := 0; i < size; i++ {
+		index.Insert(rng.Uint64())
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		key := rng.Uint64()
+		index.Insert(key)
+		index.Delete(key)
+	}
+}
+
+func BenchmarkSliceIndexChurn(b *testing.B) {
+	benchmarkChurn(b, datastore.NewSliceIndex)
+}
+
+func BenchmarkTreeIndexChurn(b *testing.B) {
+	benchmarkChurn(b, datastore.NewTreeIndex)
+}
@@ -0,0 +1,268 @@
+package datastore
+
+import (
+	"compress/gzip"
+	"encoding/gob"
+	"io"
+	"os"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Report describes a Datastore file. See Inspect.
+type Report struct {
+	// Path is the path of the file.
+	Path string
+
+	// Signature is the signature the file was written with, including the
+	// "datastore:" prefix.
+	Signature string
+
+	// Deterministic is true if the file was written by a deterministic
+	// Datastore. See SetDeterministic.
+	Deterministic bool
+
+	// LowMemory is true if the file was written in low-memory mode. See
+	// SetLowMemory.
+	LowMemory bool
+
+	// Collections describes each Collection, sorted by name.
+	Collections []CollectionReport
+
+	// Err is the error Open would return when decoding the file, or nil if the
+	// file can be decoded. The signature is not checked.
+	Err error
+}
+
+// CollectionReport describes a Collection in a Datastore file. See Inspect.
+type CollectionReport struct {
+	Name string
+
+	// Type is the type of the Documents in the Collection, as recorded by
+	// SetType. For example "*main.User".
+	Type string
+
+	// Documents is the number of Documents in the Collection, or -1 if it is
+	// not known because the file could not be decoded.
+	Documents int
+
+	SchemaVersion int
+	Compressed    bool
+
+	// Registered is false if the file could not be decoded because Type is
+	// not registered with gob.Register. Gob stops at the first type it does
+	// not know, so if several types are missing only one is reported at a
+	// time. Register it and call Inspect again to find the next.
+	Registered bool
+}
+
+// inspectedCollection holds the fields of a Collection that can be decoded
+// without knowing the types of its Documents. Gob skips the rest.
+type inspectedCollection struct {
+	Type          string
+	SchemaVersion int
+	Compressed    bool
+}
+
+type inspectedDatastore struct {
+	Collections map[string]*inspectedCollection
+}
+
+// unregistered matches the error Gob returns for an interface value whose type
+// has not been registered.
+var unregistered = regexp.MustCompile(`name not registered for interface: "([^"]*)"`)
+
+// Inspect reads the Datastore file at path and describes what it holds, without
+// opening it. It is meant for debugging a file that Open will not decode, such
+// as one written by a program that registered different types: the report
+// lists each Collection and its Document type even when the Documents
+// themselves can not be decoded.
+//
+// Inspect returns an error only if the file can not be read at all, for example
+// because it does not exist or is not a gzip stream. Decoding errors are
+// reported in Report.Err.
+func Inspect(path string) (*Report, error) {
+	full := &Datastore{}
+	report, err := inspect(path, func(r *Report, decoder *gob.Decoder) error {
+		switch {
+		case r.LowMemory:
+			return decodeStreamed(decoder, full)
+		case r.Deterministic:
+			return decodeSorted(decoder, full)
+		}
+		return decoder.Decode(full)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if report.Err == nil {
+		for name, c := range full.Collections {
+			report.Collections = append(report.Collections, CollectionReport{
+				Name:          name,
+				Type:          c.Type,
+				Documents:     len(c.Items),
+				SchemaVersion: c.SchemaVersion,
+				Compressed:    c.Compressed,
+				Registered:    true,
+			})
+		}
+		sortReports(report.Collections)
+		return report, nil
+	}
+
+	// Decode again, skipping the Documents
+	partial, err := inspect(path, func(r *Report, decoder *gob.Decoder) error {
+		if r.Deterministic || r.LowMemory {
+			return inspectSorted(decoder, r, r.LowMemory)
+		}
+		ds := &inspectedDatastore{}
+		if err := decoder.Decode(ds); err != nil {
+			return err
+		}
+		for name, c := range ds.Collections {
+			r.Collections = append(r.Collections, CollectionReport{
+				Name:          name,
+				Type:          c.Type,
+				Documents:     -1,
+				SchemaVersion: c.SchemaVersion,
+				Compressed:    c.Compressed,
+			})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	missing := ""
+	if match := unregistered.FindStringSubmatch(report.Err.Error()); match != nil {
+		missing = match[1]
+	}
+	for i := range partial.Collections {
+		c := &partial.Collections[i]
+		c.Registered = c.Compressed || !sameTypeName(missing, c.Type)
+	}
+	report.Collections = partial.Collections
+	sortReports(report.Collections)
+	return report, nil
+}
+
+// inspect opens the file and calls decode with a decoder for its contents. An
+// error from decode is stored in Report.Err.
+func inspect(path string, decode func(*Report, *gob.Decoder) error) (*Report, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fileError("inspect", path, err)
+	}
+	defer file.Close()
+
+	reader, err := gzip.NewReader(file)
+	if err != nil {
+		return nil, fileError("inspect", path, err)
+	}
+	defer reader.Close()
+
+	deterministic, lowMemory := layout(reader.Name)
+	report := &Report{
+		Path:          path,
+		Signature:     reader.Comment,
+		Deterministic: deterministic,
+		LowMemory:     lowMemory,
+	}
+	err = decode(report, gob.NewDecoder(reader))
+	if _, drainErr := io.Copy(io.Discard, reader); drainErr != nil && err == nil {
+		err = drainErr
+	}
+	if err != nil {
+		report.Err = fileError("inspect", path, err)
+	}
+	return report, nil
+}
+
+// inspectSorted reads a file written by encodeSorted, or by encodeStreamed if
+// chunked is true, counting the keys of Items and skipping every map's values.
+func inspectSorted(decoder *gob.Decoder, report *Report, chunked bool) error {
+	names := []string{}
+	if err := decoder.Decode(&names); err != nil {
+		return err
+	}
+
+	for _, name := range names {
+		c := &inspectedCollection{}
+		if err := decoder.Decode(c); err != nil {
+			return err
+		}
+		collection := CollectionReport{
+			Name:          name,
+			Type:          c.Type,
+			SchemaVersion: c.SchemaVersion,
+			Compressed:    c.Compressed,
+		}
+
+		for {
+			var fieldName string
+			if err := decoder.Decode(&fieldName); err != nil {
+				return err
+			}
+			if fieldName == "" {
+				break
+			}
+
+			if fieldName != "Items" {
+				if err := skipSortedField(decoder, chunked); err != nil {
+					return err
+				}
+				continue
+			}
+			for {
+				if chunked {
+					count, err := decodeChunkLength(decoder)
+					if err != nil {
+						return err
+					}
+					if count == 0 {
+						break
+					}
+				}
+				keys := []uint64{}
+				if err := decoder.Decode(&keys); err != nil {
+					return err
+				}
+				collection.Documents += len(keys)
+				if err := decoder.DecodeValue(reflect.Value{}); err != nil {
+					return err
+				}
+				if !chunked {
+					break
+				}
+			}
+		}
+		report.Collections = append(report.Collections, collection)
+	}
+	return nil
+}
+
+// sameTypeName compares the name Gob registers a type under, which includes
+// the full package path, with the type's String, which does not.
+func sameTypeName(gobName, typeName string) bool {
+	if gobName == "" {
+		return false
+	}
+	star := ""
+	if strings.HasPrefix(gobName, "*") {
+		star, gobName = "*", gobName[1:]
+	}
+	if i := strings.LastIndex(gobName, "/"); i >= 0 {
+		gobName = gobName[i+1:]
+	}
+	return star+gobName == typeName
+}
+
+func sortReports(reports []CollectionReport) {
+	sort.Slice(reports, func(i, j int) bool {
+		return reports[i].Name < reports[j].Name
+	})
+}
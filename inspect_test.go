@@ -0,0 +1,80 @@
+package datastore_test
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"git.stormbase.io/cbednarski/datastore"
+)
+
+func TestInspect(t *testing.T) {
+	report, err := datastore.Inspect(TestdataInvalid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Err == nil {
+		t.Fatal("Expected decoding error")
+	}
+	if report.Signature != datastore.Signature(TestdataSignature) {
+		t.Errorf("Expected %s, found %s", datastore.Signature(TestdataSignature), report.Signature)
+	}
+
+	expected := []datastore.CollectionReport{{
+		Name:          "invalid",
+		Type:          "*datastore_test.InvalidDocument",
+		Documents:     -1,
+		SchemaVersion: 0,
+	}}
+	if !reflect.DeepEqual(report.Collections, expected) {
+		t.Errorf("Expected %+v, found %+v", expected, report.Collections)
+	}
+
+	if _, err := datastore.Inspect(filepath.Join("testdata", "missing.datastore")); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("Expected %s, found %v", os.ErrNotExist, err)
+	}
+}
+
+func TestInspectDeterministic(t *testing.T) {
+	tempdir, err := ioutil.TempDir("", "datastore")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempdir)
+
+	datapath := filepath.Join(tempdir, "inspect"+datastore.Extension)
+	ds, err := datastore.Create(datapath, TestdataSignature)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ds.SetDeterministic(true)
+	for _, name := range []string{"a", "b"} {
+		if err := ds.In("names").Upsert(&NameDocument{Name: name}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := ds.In("numbers").Upsert(&NumberDocument{Number: 1}); err != nil {
+		t.Fatal(err)
+	}
+	if err := ds.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	report, err := datastore.Inspect(datapath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Err != nil || !report.Deterministic {
+		t.Fatalf("Expected deterministic file without errors, found %+v", report)
+	}
+	expected := []datastore.CollectionReport{
+		{Name: "names", Type: "*datastore_test.NameDocument", Documents: 2, Registered: true},
+		{Name: "numbers", Type: "*datastore_test.NumberDocument", Documents: 1, Registered: true},
+	}
+	if !reflect.DeepEqual(report.Collections, expected) {
+		t.Errorf("Expected %+v, found %+v", expected, report.Collections)
+	}
+}
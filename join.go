@@ -0,0 +1,38 @@
+package datastore
+
+// Joined is a parent Document and the child Documents that refer to it. See
+// Join.
+type Joined struct {
+	Parent   Document
+	Children []Document
+}
+
+// Join pairs each Document in parents with the Documents in children that
+// refer to it, such as blog posts with their comments. parentKey is called once
+// for each child and returns the key of its parent. Each Collection is scanned
+// once, so this is much faster than calling FindAll on children for each
+// parent.
+//
+// Every parent is returned in ascending order, including parents with no
+// children. Children are in ascending order, and children whose parent does not
+// exist are left out. The Collections are read one after the other, so changes
+// made while Join is running may be partially included.
+func Join(parents, children *Collection, parentKey func(child Document) uint64) []Joined {
+	byParent := map[uint64][]Document{}
+	children.FindAll(func(child Document) bool {
+		key := parentKey(child)
+		byParent[key] = append(byParent[key], child)
+		return false
+	})
+
+	joined := []Joined{}
+	parents.FindAll(func(parent Document) bool {
+		found := byParent[parent.ID()]
+		if found == nil {
+			found = []Document{}
+		}
+		joined = append(joined, Joined{Parent: parent, Children: found})
+		return false
+	})
+	return joined
+}
@@ -0,0 +1,48 @@
+package datastore_test
+
+import (
+	"testing"
+
+	"git.stormbase.io/cbednarski/datastore"
+)
+
+func TestJoin(t *testing.T) {
+	ds := datastore.New()
+	posts := ds.In("posts")
+	comments := ds.In("comments")
+
+	for _, title := range []string{"first", "second", "third"} {
+		if err := posts.Upsert(&NameDocument{Name: title}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Number holds the key of the post each comment belongs to
+	for _, post := range []int{1, 3, 1, 42} {
+		if err := comments.Upsert(&NumberDocument{Number: post}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	joined := datastore.Join(posts, comments, func(comment datastore.Document) uint64 {
+		return uint64(comment.(*NumberDocument).Number)
+	})
+
+	if len(joined) != 3 {
+		t.Fatalf("Expected 3 posts, found %d", len(joined))
+	}
+	expected := [][]uint64{{1, 3}, {}, {2}}
+	for i, pair := range joined {
+		if pair.Parent.ID() != uint64(i+1) {
+			t.Errorf("Expected post %d, found %d", i+1, pair.Parent.ID())
+		}
+		if len(pair.Children) != len(expected[i]) {
+			t.Errorf("Expected %d comments for post %d, found %d", len(expected[i]), i+1, len(pair.Children))
+			continue
+		}
+		for j, child := range pair.Children {
+			if child.ID() != expected[i][j] {
+				t.Errorf("Expected comment %d, found %d", expected[i][j], child.ID())
+			}
+		}
+	}
+}
@@ -0,0 +1,67 @@
+// Package keys maintains sorted lists of keys, such as the list of Document keys
+// that datastore keeps for each Collection. It supports any ordered key type
+// (uint64, string, and so on) and, through the Func variants, keys with their
+// own ordering such as time.Time:
+//
+//	keys.InsertFunc(&times, now, time.Time.Compare)
+//
+// Lists are plain slices sorted in ascending order without duplicates. Search,
+// Insert, and Delete use binary search, so they are O(log n) plus the cost of
+// moving the tail of the slice.
+package keys
+
+import (
+	"cmp"
+	"slices"
+)
+
+// Sort sorts list in ascending order. It does not remove duplicates.
+func Sort[K cmp.Ordered](list []K) {
+	slices.Sort(list)
+}
+
+// Search returns the index of key in list, or -1 if it is not present.
+func Search[K cmp.Ordered](list []K, key K) int {
+	return SearchFunc(list, key, cmp.Compare[K])
+}
+
+// Insert adds key to list, keeping it sorted. It returns false if key was
+// already present, in which case list is not modified.
+func Insert[K cmp.Ordered](list *[]K, key K) bool {
+	return InsertFunc(list, key, cmp.Compare[K])
+}
+
+// Delete removes key from list. It returns false if key was not present.
+func Delete[K cmp.Ordered](list *[]K, key K) bool {
+	return DeleteFunc(list, key, cmp.Compare[K])
+}
+
+// SearchFunc behaves like Search for a list sorted by compare, which returns a
+// negative number if a < b, zero if a == b, and a positive number if a > b.
+func SearchFunc[K any](list []K, key K, compare func(a, b K) int) int {
+	i, found := slices.BinarySearchFunc(list, key, compare)
+	if !found {
+		return -1
+	}
+	return i
+}
+
+// InsertFunc behaves like Insert for a list sorted by compare.
+func InsertFunc[K any](list *[]K, key K, compare func(a, b K) int) bool {
+	i, found := slices.BinarySearchFunc(*list, key, compare)
+	if found {
+		return false
+	}
+	*list = slices.Insert(*list, i, key)
+	return true
+}
+
+// DeleteFunc behaves like Delete for a list sorted by compare.
+func DeleteFunc[K any](list *[]K, key K, compare func(a, b K) int) bool {
+	i, found := slices.BinarySearchFunc(*list, key, compare)
+	if !found {
+		return false
+	}
+	*list = slices.Delete(*list, i, i+1)
+	return true
+}
@@ -0,0 +1,67 @@
+package keys_test
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"git.stormbase.io/cbednarski/datastore/keys"
+)
+
+func TestUint64(t *testing.T) {
+	list := []uint64{}
+	for _, key := range []uint64{5, 1, 3, 1, 4} {
+		keys.Insert(&list, key)
+	}
+	expected := []uint64{1, 3, 4, 5}
+	if !reflect.DeepEqual(list, expected) {
+		t.Errorf("Expected %v, found %v", expected, list)
+	}
+
+	if i := keys.Search(list, 4); i != 2 {
+		t.Errorf("Expected %d, found %d", 2, i)
+	}
+	if i := keys.Search(list, 2); i != -1 {
+		t.Errorf("Expected %d, found %d", -1, i)
+	}
+
+	if !keys.Delete(&list, 3) || keys.Delete(&list, 3) {
+		t.Error("Expected 3 to be deleted once")
+	}
+	expected = []uint64{1, 4, 5}
+	if !reflect.DeepEqual(list, expected) {
+		t.Errorf("Expected %v, found %v", expected, list)
+	}
+}
+
+func TestString(t *testing.T) {
+	list := []string{"pear", "apple", "fig"}
+	keys.Sort(list)
+	if !keys.Insert(&list, "banana") || keys.Insert(&list, "fig") {
+		t.Error("Expected only banana to be inserted")
+	}
+	expected := []string{"apple", "banana", "fig", "pear"}
+	if !reflect.DeepEqual(list, expected) {
+		t.Errorf("Expected %v, found %v", expected, list)
+	}
+}
+
+func TestTime(t *testing.T) {
+	start := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	list := []time.Time{}
+	for _, hours := range []int{3, 1, 2} {
+		keys.InsertFunc(&list, start.Add(time.Duration(hours)*time.Hour), time.Time.Compare)
+	}
+
+	for i := 1; i < len(list); i++ {
+		if !list[i-1].Before(list[i]) {
+			t.Fatalf("Expected ascending times, found %v", list)
+		}
+	}
+	if i := keys.SearchFunc(list, start.Add(2*time.Hour), time.Time.Compare); i != 1 {
+		t.Errorf("Expected %d, found %d", 1, i)
+	}
+	if !keys.DeleteFunc(&list, start.Add(time.Hour), time.Time.Compare) || len(list) != 2 {
+		t.Errorf("Expected one time to be deleted, found %v", list)
+	}
+}
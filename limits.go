@@ -0,0 +1,172 @@
+package datastore
+
+import "fmt"
+
+// SetMaxDocumentSize limits the size of each Document stored by Upsert to size
+// bytes when encoded with Gob. Upsert encodes each Document to measure it and
+// fails with ErrDocumentTooLarge if it is too large, so a single runaway
+// Document can not blow up memory use and Flush times. Use zero (the default)
+// to allow Documents of any size.
+//
+// Patch, PatchJSON, and Increment are checked the same way. The limit is not
+// written to disk, so call SetMaxDocumentSize again after Open.
+func (c *Collection) SetMaxDocumentSize(size int) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.maxDocumentSize = size
+}
+
+// Quota limits the size of a Collection. See SetQuota.
+type Quota struct {
+	// MaxDocuments is the largest number of Documents the Collection may
+	// hold. Documents in the trash are not counted.
+	MaxDocuments int
+
+	// MaxBytes is the largest total size of the Documents in the Collection
+	// when encoded with Gob. The size is an estimate: each Document is
+	// measured separately, so type information is counted for each one.
+	MaxBytes int64
+
+	// Evict deletes the Documents with the lowest keys to make room for a new
+	// Document, instead of failing. The lowest keys are the oldest Documents
+	// unless the Collection has an IDGenerator that does not assign keys in
+	// order.
+	Evict bool
+}
+
+// SetQuota limits the number of Documents in the Collection, or their total
+// size, or both. Once the quota is reached Upsert fails with ErrQuotaExceeded,
+// or evicts old Documents if quota.Evict is set. A Document larger than
+// MaxBytes on its own is never stored. Use a zero Quota (the default) to
+// remove the limits.
+//
+// A Collection that is already over its quota is not changed until the next
+// Upsert, Patch, PatchJSON, or Increment. The quota is not written to disk, so
+// call SetQuota again after Open.
+func (c *Collection) SetQuota(quota Quota) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.quota = quota
+	if err := c.trackSizes(); err != nil {
+		c.quota = Quota{}
+		return wrapError(err, "set quota", c, 0)
+	}
+	return nil
+}
+
+// trackSizes starts recording the size of each Document if the quota or
+// SetSizeTracking needs them, or stops if neither does. It must be called while
+// the Collection is locked.
+func (c *Collection) trackSizes() error {
+	if c.quota.MaxBytes <= 0 && !c.sizeTracking {
+		c.sizes = nil
+		c.totalSize = 0
+		return nil
+	}
+	if c.sizes != nil {
+		return nil
+	}
+	if err := c.measureAll(); err != nil {
+		c.sizes = nil
+		c.totalSize = 0
+		return err
+	}
+	return nil
+}
+
+// measureAll records the size of every Document in the Collection. It must be
+// called while the Collection is locked.
+func (c *Collection) measureAll() error {
+	c.sizes = map[uint64]int{}
+	c.totalSize = 0
+	for _, key := range c.index.Keys() {
+		document, _ := c.item(key)
+		data, err := encodeDocument(document)
+		if err != nil {
+			return err
+		}
+		c.sizes[key] = len(data)
+		c.totalSize += int64(len(data))
+	}
+	return nil
+}
+
+// checkLimits returns an error if the Document can not be stored because of the
+// limits set with SetMaxDocumentSize or SetQuota, and evicts Documents to make
+// room for it if the quota allows. It must be called while the Collection is
+// locked.
+func (c *Collection) checkLimits(document Document) error {
+	size := 0
+	if c.maxDocumentSize > 0 || c.quota.MaxBytes > 0 {
+		data, err := encodeDocument(document)
+		if err != nil {
+			return err
+		}
+		size = len(data)
+	}
+
+	if c.maxDocumentSize > 0 && size > c.maxDocumentSize {
+		return fmt.Errorf("%w (%d bytes, limit %d)", ErrDocumentTooLarge, size, c.maxDocumentSize)
+	}
+	if c.quota == (Quota{}) {
+		return nil
+	}
+
+	key := document.ID()
+	count := c.index.Len()
+	if _, exists := c.Items[key]; !exists {
+		count++
+	}
+	total := c.totalSize - int64(c.sizes[key]) + int64(size)
+
+	// Work out which Documents must be evicted before evicting any, so
+	// nothing is lost if the Document will not fit anyway
+	evict := []uint64{}
+	for _, oldest := range c.index.Keys() {
+		if !c.overQuota(count, total) {
+			break
+		}
+		if !c.quota.Evict {
+			break
+		}
+		if oldest == key {
+			continue
+		}
+		evict = append(evict, oldest)
+		count--
+		total -= int64(c.sizes[oldest])
+	}
+	if c.overQuota(count, total) {
+		return fmt.Errorf("%w (%d documents, %d bytes)", ErrQuotaExceeded, count, total)
+	}
+
+	for _, oldest := range evict {
+		c.deleteKey(oldest)
+	}
+	return nil
+}
+
+func (c *Collection) overQuota(count int, total int64) bool {
+	return c.quota.MaxDocuments > 0 && count > c.quota.MaxDocuments ||
+		c.quota.MaxBytes > 0 && total > c.quota.MaxBytes
+}
+
+// measure records the size of the Document stored under key, or forgets it if
+// the Document is nil, while sizes are tracked (see trackSizes). It must be
+// called while the Collection is locked.
+func (c *Collection) measure(key uint64, document Document) {
+	if c.sizes == nil {
+		return
+	}
+
+	c.totalSize -= int64(c.sizes[key])
+	delete(c.sizes, key)
+	if document == nil {
+		return
+	}
+	if data, err := encodeDocument(document); err == nil {
+		c.sizes[key] = len(data)
+		c.totalSize += int64(len(data))
+	}
+}
@@ -0,0 +1,105 @@
+package datastore_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"git.stormbase.io/cbednarski/datastore"
+)
+
+func TestCollection_SetMaxDocumentSize(t *testing.T) {
+	ds := datastore.New()
+	names := ds.In("names")
+	names.SetMaxDocumentSize(200)
+
+	if err := names.Upsert(&NameDocument{Name: "small"}); err != nil {
+		t.Fatal(err)
+	}
+
+	large := &NameDocument{Name: strings.Repeat("x", 500)}
+	if err := names.Upsert(large); !errors.Is(err, datastore.ErrDocumentTooLarge) {
+		t.Errorf("Expected %s, found %v", datastore.ErrDocumentTooLarge, err)
+	}
+	if large.ID() != 0 {
+		t.Errorf("Expected rejected document to have no key, found %d", large.ID())
+	}
+	if len(names.List()) != 1 {
+		t.Errorf("Expected 1 document, found %d", len(names.List()))
+	}
+
+	small := names.List()[0]
+	err := names.Patch(small, map[string]interface{}{"Name": strings.Repeat("x", 500)})
+	if !errors.Is(err, datastore.ErrDocumentTooLarge) {
+		t.Errorf("Expected %s, found %v", datastore.ErrDocumentTooLarge, err)
+	}
+	if name := names.FindKey(small).(*NameDocument).Name; name != "small" {
+		t.Errorf("Expected small, found %s", name)
+	}
+
+	names.SetMaxDocumentSize(0)
+	if err := names.Upsert(large); err != nil {
+		t.Errorf("Expected no limit, found %s", err)
+	}
+}
+
+func TestCollection_SetQuota(t *testing.T) {
+	ds := datastore.New()
+	names := ds.In("names")
+	if err := names.SetQuota(datastore.Quota{MaxDocuments: 3}); err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 3; i++ {
+		if err := names.Upsert(&NameDocument{Name: "name"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := names.Upsert(&NameDocument{Name: "full"}); !errors.Is(err, datastore.ErrQuotaExceeded) {
+		t.Errorf("Expected %s, found %v", datastore.ErrQuotaExceeded, err)
+	}
+
+	// Updating an existing document does not count against the quota
+	if err := names.Upsert(&NameDocument{Identifier: 2, Name: "updated"}); err != nil {
+		t.Errorf("Expected update to succeed, found %s", err)
+	}
+
+	if err := names.SetQuota(datastore.Quota{MaxDocuments: 3, Evict: true}); err != nil {
+		t.Fatal(err)
+	}
+	if err := names.Upsert(&NameDocument{Name: "newest"}); err != nil {
+		t.Fatal(err)
+	}
+	if keys := names.List(); len(keys) != 3 || keys[0] != 2 {
+		t.Errorf("Expected the oldest document to be evicted, found %v", keys)
+	}
+}
+
+func TestCollection_SetQuotaBytes(t *testing.T) {
+	ds := datastore.New()
+	names := ds.In("names")
+	for i := 0; i < 5; i++ {
+		names.Upsert(&NameDocument{Name: strings.Repeat("x", 100)})
+	}
+
+	// The quota only has room for about three documents
+	if err := names.SetQuota(datastore.Quota{MaxBytes: 500, Evict: true}); err != nil {
+		t.Fatal(err)
+	}
+
+	huge := &NameDocument{Name: strings.Repeat("x", 1000)}
+	if err := names.Upsert(huge); !errors.Is(err, datastore.ErrQuotaExceeded) {
+		t.Errorf("Expected %s, found %v", datastore.ErrQuotaExceeded, err)
+	}
+	if len(names.List()) != 5 {
+		t.Errorf("Expected nothing to be evicted for a document that can not fit, found %d documents", len(names.List()))
+	}
+
+	if err := names.Upsert(&NameDocument{Name: strings.Repeat("y", 100)}); err != nil {
+		t.Fatal(err)
+	}
+	keys := names.List()
+	if len(keys) >= 5 || keys[len(keys)-1] != 7 {
+		t.Errorf("Expected old documents to be evicted to make room, found %v", keys)
+	}
+}
@@ -54,6 +54,34 @@ func TestDeleteKeyFromList(t *testing.T) {
 	})
 }
 
+func TestInsertKeyIntoList(t *testing.T) {
+	type testCase struct {
+		Input    uint64
+		Expected []uint64
+	}
+
+	cases := []testCase{
+		{1, []uint64{1, 2, 4, 6}},
+		{3, []uint64{2, 3, 4, 6}},
+		{4, []uint64{2, 4, 6}},
+		{7, []uint64{2, 4, 6, 7}},
+	}
+
+	for _, c := range cases {
+		list := []uint64{2, 4, 6}
+		insertKeyIntoList(&list, c.Input)
+		if !reflect.DeepEqual(list, c.Expected) {
+			t.Errorf("Expected %#v, found %#v", c.Expected, list)
+		}
+	}
+
+	var empty []uint64
+	insertKeyIntoList(&empty, 5)
+	if !reflect.DeepEqual(empty, []uint64{5}) {
+		t.Errorf("Expected %#v, found %#v", []uint64{5}, empty)
+	}
+}
+
 func TestSortUIntSlice(t *testing.T) {
 	list := []uint64{100, 7, 18, 3}
 	expected := []uint64{3, 7, 18, 100}
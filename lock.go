@@ -0,0 +1,93 @@
+package datastore
+
+import "reflect"
+
+// Locked gives access to a Collection while it is locked by WithLock or
+// WithRLock. Its methods behave like the Collection methods with the same names
+// but do not take the lock themselves, so several of them can be called as one
+// atomic step. A Locked must not be used after the function it was passed to
+// returns.
+type Locked struct {
+	c        *Collection
+	writable bool
+}
+
+// WithLock locks the Collection for writing and calls fn, so a sequence such as
+// checking whether a Document exists and then upserting it can't be interleaved
+// with changes from other goroutines. fn must use tx rather than the Collection,
+// since calling a Collection method while it is locked will deadlock.
+//
+// WithLock is passed through Middleware as a single OpLocked Operation. The
+// changes made through tx are audited individually. If fn returns an error it is
+// returned from WithLock, but changes that were already made are kept.
+func (c *Collection) WithLock(fn func(tx *Locked) error) error {
+	return c.mutate(Operation{Op: OpLocked}, func() error {
+		return fn(&Locked{c: c, writable: true})
+	})
+}
+
+// WithRLock locks the Collection for reading and calls fn, so the Documents it
+// reads are consistent with each other. Changes made through tx fail with
+// ErrReadOnly.
+func (c *Collection) WithRLock(fn func(tx *Locked)) {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	fn(&Locked{c: c})
+}
+
+// FindKey returns the Document with the specified key, or nil.
+func (tx *Locked) FindKey(key uint64) Document {
+	document, ok := tx.c.item(key)
+	if !ok {
+		return nil
+	}
+	return document
+}
+
+// FindOne returns the first Document that satisfies finder, or nil.
+func (tx *Locked) FindOne(finder func(Document) bool) Document {
+	for _, key := range tx.c.index.Keys() {
+		if document, _ := tx.c.item(key); finder(document) {
+			return document
+		}
+	}
+	return nil
+}
+
+// FindAll returns every Document that satisfies finder, in ascending order.
+func (tx *Locked) FindAll(finder func(Document) bool) []Document {
+	found := []Document{}
+	for _, key := range tx.c.index.Keys() {
+		if document, _ := tx.c.item(key); finder(document) {
+			found = append(found, document)
+		}
+	}
+	return found
+}
+
+// Upsert inserts or updates a Document in the Collection.
+func (tx *Locked) Upsert(document Document) error {
+	if !tx.writable {
+		return ErrReadOnly
+	}
+
+	kind := reflect.TypeOf(document).String()
+	if tx.c.Type == "" {
+		tx.c.Type = kind
+	} else if tx.c.Type != kind {
+		return ErrInvalidType
+	}
+
+	_, err := tx.c.upsert(OpUpsert, document)
+	return err
+}
+
+// DeleteKey removes the indicated key from the Collection, or no-ops if the key
+// is not present.
+func (tx *Locked) DeleteKey(key uint64) error {
+	if !tx.writable {
+		return ErrReadOnly
+	}
+	tx.c.deleteKey(key)
+	return nil
+}
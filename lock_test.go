@@ -0,0 +1,65 @@
+package datastore_test
+
+import (
+	"errors"
+	"sync"
+	"testing"
+
+	"git.stormbase.io/cbednarski/datastore"
+)
+
+func TestCollection_WithLock(t *testing.T) {
+	ds := datastore.New()
+	names := ds.In("names")
+
+	// Many goroutines insert the same name if it is missing. Only one should
+	// succeed.
+	wg := sync.WaitGroup{}
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := names.WithLock(func(tx *datastore.Locked) error {
+				existing := tx.FindOne(func(document datastore.Document) bool {
+					return document.(*NameDocument).Name == "unique"
+				})
+				if existing != nil {
+					return nil
+				}
+				return tx.Upsert(&NameDocument{Name: "unique"})
+			})
+			if err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if len(names.List()) != 1 {
+		t.Errorf("Expected %d document, found %d", 1, len(names.List()))
+	}
+
+	if err := names.WithLock(func(tx *datastore.Locked) error {
+		return tx.Upsert(&NumberDocument{Number: 1})
+	}); !errors.Is(err, datastore.ErrInvalidType) {
+		t.Errorf("Expected %s, found %v", datastore.ErrInvalidType, err)
+	}
+
+	names.WithRLock(func(tx *datastore.Locked) {
+		if err := tx.DeleteKey(1); !errors.Is(err, datastore.ErrReadOnly) {
+			t.Errorf("Expected %s, found %v", datastore.ErrReadOnly, err)
+		}
+		if tx.FindKey(1) == nil {
+			t.Error("Expected document 1 to be found")
+		}
+	})
+
+	if err := names.WithLock(func(tx *datastore.Locked) error {
+		return tx.DeleteKey(1)
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if names.FindKey(1) != nil {
+		t.Error("Expected document 1 to be deleted")
+	}
+}
@@ -0,0 +1,102 @@
+package datastore
+
+import (
+	"maps"
+	"slices"
+)
+
+// readSnapshot is an immutable copy of a Collection's Documents and keys that
+// readers use without locking the Collection. See SetLockFreeReads.
+type readSnapshot struct {
+	items map[uint64]Document
+	keys  []uint64
+
+	// locked is set when the Collection can't be read from a snapshot (it is
+	// compressed), so readers should lock it instead
+	locked bool
+
+	// strict is set if the Datastore was in strict mode when the snapshot was
+	// taken, so Documents are copied before they are returned
+	strict bool
+}
+
+// SetLockFreeReads makes FindKey, FindAll, FindOne, Scan, List, and the other
+// read methods use an immutable snapshot of the Collection instead of locking
+// it. Readers never wait for writers or for each other, which helps workloads
+// that are almost entirely reads from many goroutines.
+//
+// The snapshot is dropped by each change and rebuilt by the next read, which
+// copies the whole Collection. Only enable this for Collections that are read
+// far more often than they are changed. Compressed Collections are always read
+// with a lock.
+//
+// Callbacks passed to FindAll, Scan, and similar methods see the snapshot taken
+// when the read began, and are not called while the Collection is locked.
+func (c *Collection) SetLockFreeReads(enabled bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.lockFree.Store(enabled)
+	c.dropSnapshot()
+}
+
+// dropSnapshot discards the read snapshot after the Collection changes. It must
+// be called while the Collection is locked for writing.
+func (c *Collection) dropSnapshot() {
+	c.reads.Store(nil)
+}
+
+// readSnapshot returns the current read snapshot, taking one if needed, or nil
+// if the Collection must be locked to read it.
+func (c *Collection) readSnapshot() *readSnapshot {
+	if !c.lockFree.Load() {
+		return nil
+	}
+	if snapshot := c.reads.Load(); snapshot != nil {
+		if snapshot.locked {
+			return nil
+		}
+		return snapshot
+	}
+
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	// Writers drop the snapshot while holding the write lock, so one stored
+	// while we hold the read lock can't be stale
+	snapshot := &readSnapshot{locked: c.Compressed, strict: c.strict()}
+	if !snapshot.locked {
+		snapshot.items = maps.Clone(c.Items)
+		snapshot.keys = slices.Clone(c.index.Keys())
+	}
+	c.reads.Store(snapshot)
+	if snapshot.locked {
+		return nil
+	}
+	return snapshot
+}
+
+// item returns the Document with key from the snapshot.
+func (s *readSnapshot) item(key uint64) (Document, bool) {
+	document, ok := s.items[key]
+	if !ok {
+		return nil, false
+	}
+	if s.strict {
+		copied, err := copyDocument(document)
+		if err != nil {
+			return nil, false
+		}
+		return copied, true
+	}
+	return document, true
+}
+
+// reader returns the keys of the Collection in ascending order and a function
+// to look up Documents, from the read snapshot if there is one or else while
+// the Collection is locked. done must be called when the read is finished.
+func (c *Collection) reader() (keys []uint64, item func(uint64) (Document, bool), done func()) {
+	if snapshot := c.readSnapshot(); snapshot != nil {
+		return snapshot.keys, snapshot.item, func() {}
+	}
+	c.mutex.RLock()
+	return c.index.Keys(), c.item, c.mutex.RUnlock
+}
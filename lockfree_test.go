@@ -0,0 +1,108 @@
+package datastore_test
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+
+	"git.stormbase.io/cbednarski/datastore"
+)
+
+func TestLockFreeReads(t *testing.T) {
+	ds := datastore.New()
+	names := ds.In(Names)
+	names.SetLockFreeReads(true)
+
+	for i := 0; i < 10; i++ {
+		if err := names.Upsert(&NameDocument{Name: fmt.Sprintf("name-%d", i)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(names.List()) != 10 {
+		t.Fatalf("Expected 10 keys, found %d", len(names.List()))
+	}
+
+	// Changes are visible to the next read
+	if err := names.Upsert(&NameDocument{Identifier: 1, Name: "renamed"}); err != nil {
+		t.Fatal(err)
+	}
+	if name := names.FindKey(1).(*NameDocument).Name; name != "renamed" {
+		t.Errorf("Expected renamed, found %s", name)
+	}
+	if err := names.DeleteKey(2); err != nil {
+		t.Fatal(err)
+	}
+	if names.FindKey(2) != nil {
+		t.Error("Expected deleted Document to be gone")
+	}
+	found := names.FindAllKeys(func(datastore.Document) bool { return true })
+	if len(found) != 9 || found[0] != 1 || found[1] != 3 {
+		t.Errorf("Expected keys 1, 3..10, found %v", found)
+	}
+
+	// Compressed Collections are read with a lock
+	if err := names.SetCompressed(true); err != nil {
+		t.Fatal(err)
+	}
+	if name := names.FindKey(1).(*NameDocument).Name; name != "renamed" {
+		t.Errorf("Expected renamed, found %s", name)
+	}
+	if err := names.SetCompressed(false); err != nil {
+		t.Fatal(err)
+	}
+
+	// Readers don't block writers, and always see a complete Collection
+	wg := sync.WaitGroup{}
+	for i := 0; i < 4; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				names.Upsert(&NameDocument{Name: "concurrent"})
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				for _, key := range names.List() {
+					if names.FindKey(key) == nil {
+						t.Errorf("Expected Document %d", key)
+						return
+					}
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	if len(names.List()) != 409 {
+		t.Errorf("Expected 409 keys, found %d", len(names.List()))
+	}
+}
+
+func benchmarkParallelFindKey(b *testing.B, lockFree bool) {
+	ds := datastore.New()
+	names := ds.In(Names)
+	names.SetLockFreeReads(lockFree)
+	for i := 0; i < 1000; i++ {
+		if err := names.Upsert(&NameDocument{Name: "bench"}); err != nil {
+			b.Fatal(err)
+		}
+	}
+
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		key := uint64(1)
+		for pb.Next() {
+			names.FindKey(key)
+			key = key%1000 + 1
+		}
+	})
+}
+
+func BenchmarkFindKeyParallel(b *testing.B) {
+	benchmarkParallelFindKey(b, false)
+}
+
+func BenchmarkFindKeyParallelLockFree(b *testing.B) {
+	benchmarkParallelFindKey(b, true)
+}
@@ -0,0 +1,88 @@
+package datastore
+
+import (
+	"encoding/gob"
+	"sort"
+)
+
+// streamedLayout is written to the Name field of the gzip header of files
+// written in low-memory mode, so Open knows how to decode them.
+// sortedStreamedLayout is written instead if the Datastore is also
+// deterministic.
+const (
+	streamedLayout       = "datastore:streamed"
+	sortedStreamedLayout = "datastore:sorted,streamed"
+)
+
+// layout returns the settings recorded in the Name field of a gzip header.
+func layout(name string) (deterministic, lowMemory bool) {
+	switch name {
+	case sortedLayout:
+		return true, false
+	case streamedLayout:
+		return false, true
+	case sortedStreamedLayout:
+		return true, true
+	}
+	return false, false
+}
+
+// streamedChunk is the most map entries encoded at once in low-memory mode.
+const streamedChunk = 256
+
+// SetLowMemory changes whether Flush saves memory at the cost of speed, for
+// devices where the memory needed to Flush is what limits the size of the
+// Datastore.
+//
+// By default Flush snapshots every Collection at once and encodes the whole
+// Datastore as one Gob message, which Gob holds in memory until it is
+// complete, so a Flush can briefly need as much memory again as the Datastore
+// itself. Snapshots share the maps of their Collections, which are only copied
+// if they change while the Flush is running. In low-memory mode Collections
+// are snapshotted and encoded one at a time, in order of name, and their
+// Documents are written in sorted batches of a few hundred, so only one batch
+// is held at a time. Because Collections are snapshotted at different times, a
+// Flush may include a change to one Collection but not an earlier change to
+// another.
+//
+// The setting is recorded in the file, so a Datastore opened from a low-memory
+// file stays in low-memory mode. Older versions of this package can not read
+// these files. If SetDeterministic is also on, the gzip modification time is
+// left empty, and both settings are recorded in the file.
+func (d *Datastore) SetLowMemory(lowMemory bool) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	d.lowMemory = lowMemory
+}
+
+// encodeStreamed encodes the Datastore in the same way as encodeSorted, but
+// copies one Collection at a time and writes maps in chunks. The number of
+// Documents in each Collection is recorded in counts.
+func (d *Datastore) encodeStreamed(encoder *gob.Encoder, counts map[string]int) error {
+	collections := d.collections()
+	sort.Slice(collections, func(i, j int) bool {
+		return collections[i].name < collections[j].name
+	})
+
+	names := make([]string, 0, len(collections))
+	for _, c := range collections {
+		names = append(names, c.name)
+	}
+	if err := encoder.Encode(names); err != nil {
+		return err
+	}
+
+	for _, c := range collections {
+		snapshot := c.snapshot()
+		counts[c.name] = len(snapshot.Items)
+		if err := encodeSortedCollection(encoder, snapshot, streamedChunk); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// decodeStreamed decodes a Datastore written by encodeStreamed.
+func decodeStreamed(decoder *gob.Decoder, ds *Datastore) error {
+	return decodeSortedLayout(decoder, ds, true)
+}
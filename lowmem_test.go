@@ -0,0 +1,117 @@
+package datastore_test
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"git.stormbase.io/cbednarski/datastore"
+)
+
+func TestSetLowMemory(t *testing.T) {
+	tempdir, err := ioutil.TempDir("", "datastore")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempdir)
+
+	datapath := filepath.Join(tempdir, "lowmem"+datastore.Extension)
+	ds, err := datastore.Create(datapath, TestdataSignature)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ds.SetLowMemory(true)
+
+	// More than one chunk, and an exact multiple of it
+	for i := 0; i < 1000; i++ {
+		if err := ds.In("names").Upsert(&NameDocument{Name: fmt.Sprint(i)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for i := 0; i < 512; i++ {
+		if err := ds.In("numbers").Upsert(&NumberDocument{Number: i}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := ds.In("names").SetChecksums(true); err != nil {
+		t.Fatal(err)
+	}
+	stats, err := ds.FlushStats()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Documents["names"] != 1000 || stats.Documents["numbers"] != 512 {
+		t.Errorf("Expected 1000 names and 512 numbers, found %v", stats.Documents)
+	}
+
+	ds, err = datastore.Open(datapath, TestdataSignature)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if found := len(ds.In("names").List()); found != 1000 {
+		t.Errorf("Expected %d names, found %d", 1000, found)
+	}
+	if found := ds.In("numbers").FindKey(512); found == nil || found.(*NumberDocument).Number != 511 {
+		t.Errorf("Expected number 511, found %v", found)
+	}
+	if err := ds.In("names").VerifyChecksums(); err != nil {
+		t.Error(err)
+	}
+
+	report, err := datastore.Inspect(datapath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !report.LowMemory || report.Err != nil || report.Collections[0].Documents != 1000 {
+		t.Errorf("Expected low-memory report with 1000 names, found %+v", report)
+	}
+}
+
+func TestSetLowMemoryDeterministic(t *testing.T) {
+	datapath := filepath.Join(t.TempDir(), "lowmem"+datastore.Extension)
+	ds, err := datastore.Create(datapath, TestdataSignature)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ds.SetLowMemory(true)
+	ds.SetDeterministic(true)
+	if err := ds.In("names").Upsert(&NameDocument{Name: "bob"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := ds.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Both settings survive Open, so the next Flush writes the same layout
+	ds, err = datastore.Open(datapath, TestdataSignature)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ds.In("names").Upsert(&NameDocument{Name: "alice"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := ds.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadFile(datapath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	header, err := datastore.ParseHeader(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !header.Deterministic || !header.LowMemory || !header.ModTime.IsZero() {
+		t.Errorf("Expected a deterministic low-memory header, found %+v", header)
+	}
+
+	report, err := datastore.Inspect(datapath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !report.Deterministic || !report.LowMemory || report.Err != nil {
+		t.Errorf("Expected a deterministic low-memory report, found %+v", report)
+	}
+}
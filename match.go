@@ -0,0 +1,72 @@
+package datastore
+
+import (
+	"path"
+	"reflect"
+	"regexp"
+	"strings"
+)
+
+// Match builds finders for the Find functions that compare a string field of
+// each Document. Fields are named by their Go struct field names. Documents
+// that do not have the field, or where it is not a string, never match.
+//
+//	pets.FindAll(datastore.Match.Fold("Name", "rex"))
+var Match Matcher
+
+// Matcher provides the functions of Match.
+type Matcher struct{}
+
+// Contains matches Documents where the field contains substr.
+func (Matcher) Contains(field, substr string) func(Document) bool {
+	return matchString(field, func(value string) bool {
+		return strings.Contains(value, substr)
+	})
+}
+
+// Fold matches Documents where the field is equal to value under Unicode case
+// folding, so "Rex" matches "REX" and "rex".
+func (Matcher) Fold(field, value string) func(Document) bool {
+	return matchString(field, func(v string) bool {
+		return strings.EqualFold(v, value)
+	})
+}
+
+// ContainsFold matches Documents where the field contains substr, ignoring
+// case.
+func (Matcher) ContainsFold(field, substr string) func(Document) bool {
+	substr = strings.ToLower(substr)
+	return matchString(field, func(value string) bool {
+		return strings.Contains(strings.ToLower(value), substr)
+	})
+}
+
+// Glob matches Documents where the field matches the shell pattern, using the
+// syntax of path.Match. A malformed pattern matches nothing.
+func (Matcher) Glob(field, pattern string) func(Document) bool {
+	return matchString(field, func(value string) bool {
+		matched, err := path.Match(pattern, value)
+		return err == nil && matched
+	})
+}
+
+// Regexp matches Documents where the field matches re.
+func (Matcher) Regexp(field string, re *regexp.Regexp) func(Document) bool {
+	return matchString(field, re.MatchString)
+}
+
+// matchString returns a finder that calls match with the named string field
+// of each Document.
+func matchString(field string, match func(string) bool) func(Document) bool {
+	return func(document Document) bool {
+		value := reflect.Indirect(reflect.ValueOf(document))
+		if value.Kind() != reflect.Struct {
+			return false
+		}
+		v := value.FieldByName(field)
+		if !v.IsValid() || v.Kind() != reflect.String {
+			return false
+		}
+		return match(v.String())
+	}
+}
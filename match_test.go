@@ -0,0 +1,39 @@
+package datastore_test
+
+import (
+	"regexp"
+	"testing"
+
+	"git.stormbase.io/cbednarski/datastore"
+)
+
+func TestMatch(t *testing.T) {
+	ds := datastore.New()
+	names := ds.In("names")
+	for _, name := range []string{"Rex", "rex", "Fido", "Spot the dog", "Ærø"} {
+		names.Upsert(&NameDocument{Name: name})
+	}
+
+	cases := []struct {
+		name     string
+		finder   func(datastore.Document) bool
+		expected int
+	}{
+		{"contains", datastore.Match.Contains("Name", "ex"), 2},
+		{"contains case", datastore.Match.Contains("Name", "Re"), 1},
+		{"fold", datastore.Match.Fold("Name", "REX"), 2},
+		{"fold unicode", datastore.Match.Fold("Name", "æRØ"), 1},
+		{"contains fold", datastore.Match.ContainsFold("Name", "THE"), 1},
+		{"glob", datastore.Match.Glob("Name", "?ex"), 2},
+		{"glob prefix", datastore.Match.Glob("Name", "Spot*"), 1},
+		{"bad glob", datastore.Match.Glob("Name", "[x"), 0},
+		{"regexp", datastore.Match.Regexp("Name", regexp.MustCompile(`^[A-Z][a-z]+$`)), 2},
+		{"missing field", datastore.Match.Contains("Nope", ""), 0},
+		{"wrong type", datastore.Match.Contains("Identifier", ""), 0},
+	}
+	for _, c := range cases {
+		if found := len(names.FindAll(c.finder)); found != c.expected {
+			t.Errorf("%s: Expected %d matches, found %d", c.name, c.expected, found)
+		}
+	}
+}
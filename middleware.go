@@ -0,0 +1,98 @@
+package datastore
+
+// Operation describes a change that is about to be made to a Collection. It is
+// passed to Middleware.
+type Operation struct {
+	// Op is the type of change.
+	Op Op
+
+	// Collection is the name of the Collection being changed.
+	Collection string
+
+	// Key is the key of the Document being changed. Key is zero when a new
+	// Document is being upserted, since it has not been assigned a key yet.
+	Key uint64
+
+	// Document is the Document being upserted or deleted, if it is known
+	// before the change is made.
+	Document Document
+
+	// Actor is the actor making the change. See Collection.As.
+	Actor string
+}
+
+// Middleware is called around each change made to a Collection. Call next to
+// perform the change and return its error, or return an error without calling
+// next to reject the change. If Middleware returns nil without calling next,
+// the change is silently skipped, which is useful for dry runs.
+//
+// Middleware is called before the Collection is locked, so it may take as long
+// as it needs (for example, to wait on a rate limiter) and may read from the
+// Collection. Read operations such as FindKey and FindAll are not passed
+// through Middleware.
+type Middleware func(op Operation, next func() error) error
+
+// Use adds Middleware to the Datastore. Middleware applies to changes in every
+// Collection and is called in the order it was added, so the first Middleware
+// added is the outermost.
+func (d *Datastore) Use(middleware Middleware) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	var chain []Middleware
+	if current := d.middleware.Load(); current != nil {
+		chain = append(chain, *current...)
+	}
+	chain = append(chain, middleware)
+	d.middleware.Store(&chain)
+}
+
+// mutate passes the Operation through the Datastore's Middleware and then calls
+// fn while the Collection is locked. Every method that changes the Collection
+// should go through mutate.
+func (c *Collection) mutate(op Operation, fn func() error) error {
+	if err := c.checkOpen(); err != nil {
+		return wrapError(err, string(op.Op), c, op.Key)
+	}
+	op.Collection = c.name
+
+	next := func() error {
+		c.mutex.Lock()
+		defer c.mutex.Unlock()
+
+		// Check again while locked so no change can slip in after Close has
+		// taken its final snapshot
+		if err := c.checkOpen(); err != nil {
+			return err
+		}
+		if c.readOnly {
+			return ErrReadOnly
+		}
+
+		c.actor = op.Actor
+		defer func() { c.actor = "" }()
+
+		c.thaw()
+		return fn()
+	}
+	inner := next
+	next = func() error {
+		return wrapError(inner(), string(op.Op), c, op.Key)
+	}
+
+	if c.store == nil {
+		return next()
+	}
+	chain := c.store.middleware.Load()
+	if chain == nil {
+		return next()
+	}
+
+	for i := len(*chain) - 1; i >= 0; i-- {
+		middleware, inner := (*chain)[i], next
+		next = func() error {
+			return middleware(op, inner)
+		}
+	}
+	return next()
+}
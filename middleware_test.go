@@ -0,0 +1,71 @@
+package datastore_test
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"git.stormbase.io/cbednarski/datastore"
+)
+
+func TestUse(t *testing.T) {
+	ds := datastore.New()
+	cakes := ds.In("cakes")
+
+	calls := []string{}
+	ds.Use(func(op datastore.Operation, next func() error) error {
+		calls = append(calls, "outer "+string(op.Op)+" "+op.Collection)
+		return next()
+	})
+
+	errForbidden := errors.New("forbidden")
+	ds.Use(func(op datastore.Operation, next func() error) error {
+		calls = append(calls, "inner "+string(op.Op)+" "+op.Actor)
+		if op.Op == datastore.OpDelete && op.Actor != "admin" {
+			return errForbidden
+		}
+		return next()
+	})
+
+	cake := &NameDocument{Name: "chocolate"}
+	if err := cakes.Upsert(cake); err != nil {
+		t.Fatal(err)
+	}
+	if err := cakes.Delete(cake); err != errForbidden {
+		t.Errorf("Expected %s, found %s", errForbidden, err)
+	}
+	if cake.ID() == 0 || cakes.FindKey(cake.ID()) == nil {
+		t.Errorf("Expected rejected delete not to remove the document")
+	}
+	if err := cakes.As("admin").Delete(cake); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{
+		"outer upsert cakes",
+		"inner upsert ",
+		"outer delete cakes",
+		"inner delete ",
+		"outer delete cakes",
+		"inner delete admin",
+	}
+	if !reflect.DeepEqual(calls, expected) {
+		t.Errorf("Expected %#v, found %#v", expected, calls)
+	}
+}
+
+func TestUseDryRun(t *testing.T) {
+	ds := datastore.New()
+	cakes := ds.In("cakes")
+
+	ds.Use(func(op datastore.Operation, next func() error) error {
+		return nil
+	})
+
+	if err := cakes.Upsert(&NameDocument{Name: "chocolate"}); err != nil {
+		t.Fatal(err)
+	}
+	if len(cakes.List()) != 0 {
+		t.Errorf("Expected dry run not to insert a document, found %#v", cakes.List())
+	}
+}
@@ -0,0 +1,35 @@
+package datastore
+
+import "fmt"
+
+// MustInit is like ds.Init but panics if the Collection already holds a
+// different type. It is meant for wiring up Collections when a program starts,
+// where a type mismatch is a programming error:
+//
+//	users := datastore.MustInit(ds, "users", &User{})
+func MustInit(ds *Datastore, name string, document Document) *Collection {
+	c, err := ds.Init(name, document)
+	if err != nil {
+		panic(fmt.Sprintf("datastore: init collection %q: %s", name, err))
+	}
+	return c
+}
+
+// MustOpen is like Open but panics if the Datastore can not be opened.
+func MustOpen(path, signature string) *Datastore {
+	ds, err := Open(path, signature)
+	if err != nil {
+		panic(fmt.Sprintf("datastore: %s", err))
+	}
+	return ds
+}
+
+// MustOpenOrCreate is like OpenOrCreate but panics if the Datastore can not be
+// opened or created.
+func MustOpenOrCreate(path, signature string) *Datastore {
+	ds, err := OpenOrCreate(path, signature)
+	if err != nil {
+		panic(fmt.Sprintf("datastore: %s", err))
+	}
+	return ds
+}
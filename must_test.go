@@ -0,0 +1,59 @@
+package datastore_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"git.stormbase.io/cbednarski/datastore"
+)
+
+// expectPanic calls fn and returns the message it panicked with.
+func expectPanic(t *testing.T, fn func()) (message string) {
+	t.Helper()
+	defer func() {
+		recovered := recover()
+		if recovered == nil {
+			t.Fatal("Expected panic")
+		}
+		message, _ = recovered.(string)
+	}()
+	fn()
+	return ""
+}
+
+func TestMustInit(t *testing.T) {
+	ds := datastore.New()
+	names := datastore.MustInit(ds, "names", &NameDocument{})
+	if names != ds.In("names") {
+		t.Error("Expected MustInit to return the collection")
+	}
+
+	message := expectPanic(t, func() {
+		datastore.MustInit(ds, "names", &NumberDocument{})
+	})
+	if !strings.Contains(message, `"names"`) || !strings.Contains(message, datastore.ErrInvalidType.Error()) {
+		t.Errorf("Expected message naming the collection and error, found %q", message)
+	}
+}
+
+func TestMustOpen(t *testing.T) {
+	tempdir, err := ioutil.TempDir("", "datastore")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempdir)
+
+	datapath := filepath.Join(tempdir, "must"+datastore.Extension)
+	message := expectPanic(t, func() {
+		datastore.MustOpen(datapath, TestdataSignature)
+	})
+	if !strings.Contains(message, datapath) {
+		t.Errorf("Expected message naming %s, found %q", datapath, message)
+	}
+
+	datastore.MustOpenOrCreate(datapath, TestdataSignature)
+	datastore.MustOpen(datapath, TestdataSignature)
+}
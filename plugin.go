@@ -0,0 +1,147 @@
+package datastore
+
+import (
+	"fmt"
+	"sync"
+)
+
+// Plugin adds optional behavior to a Datastore, such as search indexing,
+// metrics, or replication, from a separate package. The core package never
+// imports plugins: a plugin package registers itself with RegisterPlugin
+// (usually in init), and a program enables it with EnablePlugin, or attaches an
+// instance directly with Extend.
+//
+// Attach is called once when the Plugin is added. A Plugin may also implement
+// any of these interfaces to receive more hooks:
+//
+//   - EventHandler, to receive each Event sent by the Datastore
+//   - MiddlewarePlugin, to be called around each change to a Collection
+//   - Detacher, to be told when the Datastore is closed
+type Plugin interface {
+	// Name identifies the Plugin. Only one Plugin with each name may be
+	// attached to a Datastore.
+	Name() string
+
+	// Attach is called when the Plugin is added to a Datastore. If it
+	// returns an error the Plugin is not added.
+	Attach(ds *Datastore) error
+}
+
+// EventHandler is implemented by Plugins that want the Datastore's events.
+// See Subscribe; the same rules apply.
+type EventHandler interface {
+	HandleEvent(event Event)
+}
+
+// MiddlewarePlugin is implemented by Plugins that want to be called around
+// each change to a Collection. See Middleware.
+type MiddlewarePlugin interface {
+	Middleware(op Operation, next func() error) error
+}
+
+// Detacher is implemented by Plugins that need to release resources when the
+// Datastore is closed. Detach is called after the final Flush, in the
+// reverse of the order the Plugins were attached.
+type Detacher interface {
+	Detach()
+}
+
+var (
+	pluginMutex       sync.Mutex
+	registeredPlugins = map[string]func() Plugin{}
+)
+
+// RegisterPlugin makes a Plugin available to EnablePlugin under name. It is
+// meant to be called from the init function of the package that provides the
+// Plugin, and panics if name is registered twice.
+func RegisterPlugin(name string, factory func() Plugin) {
+	pluginMutex.Lock()
+	defer pluginMutex.Unlock()
+
+	if _, exists := registeredPlugins[name]; exists {
+		panic(fmt.Sprintf("datastore: plugin %q is registered twice", name))
+	}
+	registeredPlugins[name] = factory
+}
+
+// EnablePlugin creates the Plugin registered under name and attaches it to the
+// Datastore. It fails with ErrPluginNotFound if no Plugin is registered under
+// name, usually because the package providing it was not imported.
+func (d *Datastore) EnablePlugin(name string) error {
+	pluginMutex.Lock()
+	factory, ok := registeredPlugins[name]
+	pluginMutex.Unlock()
+	if !ok {
+		return &Error{Op: "enable plugin", Path: d.path, Err: fmt.Errorf("%w: %q", ErrPluginNotFound, name)}
+	}
+	return d.Extend(factory())
+}
+
+// Extend attaches a Plugin to the Datastore. It fails with ErrPluginExists if a
+// Plugin with the same name is already attached. Plugins are attached after
+// Open returns, so they do not receive EventOpen; Attach can be used instead.
+func (d *Datastore) Extend(plugin Plugin) error {
+	if err := d.checkOpen(); err != nil {
+		return err
+	}
+
+	// Reserve the name before calling Attach, which may use the Datastore
+	d.mutex.Lock()
+	for _, attached := range d.plugins {
+		if attached.Name() == plugin.Name() {
+			d.mutex.Unlock()
+			return &Error{Op: "extend", Path: d.path, Err: fmt.Errorf("%w: %q", ErrPluginExists, plugin.Name())}
+		}
+	}
+	d.plugins = append(d.plugins, plugin)
+	d.mutex.Unlock()
+
+	if err := plugin.Attach(d); err != nil {
+		d.mutex.Lock()
+		for i, attached := range d.plugins {
+			if attached == plugin {
+				d.plugins = append(d.plugins[:i:i], d.plugins[i+1:]...)
+				break
+			}
+		}
+		d.mutex.Unlock()
+		return &Error{Op: "extend", Path: d.path, Err: err}
+	}
+
+	if handler, ok := plugin.(EventHandler); ok {
+		d.Subscribe(handler.HandleEvent)
+	}
+	if middleware, ok := plugin.(MiddlewarePlugin); ok {
+		d.Use(middleware.Middleware)
+	}
+	return nil
+}
+
+// Plugin returns the attached Plugin with the specified name, or nil. Plugin
+// packages use it to find their instance, for example to expose a search
+// function for a Datastore.
+func (d *Datastore) Plugin(name string) Plugin {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	for _, plugin := range d.plugins {
+		if plugin.Name() == name {
+			return plugin
+		}
+	}
+	return nil
+}
+
+// detachPlugins calls Detach on each Plugin that implements it, in reverse
+// order.
+func (d *Datastore) detachPlugins() {
+	d.mutex.Lock()
+	attached := d.plugins
+	d.mutex.Unlock()
+
+	for i := len(attached) - 1; i >= 0; i-- {
+		if detacher, ok := attached[i].(Detacher); ok {
+			detacher.Detach()
+		}
+	}
+}
@@ -0,0 +1,91 @@
+package datastore_test
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"git.stormbase.io/cbednarski/datastore"
+)
+
+// countingPlugin counts the changes made to a Datastore and the events it
+// sends.
+type countingPlugin struct {
+	attached *datastore.Datastore
+	changes  int
+	events   []datastore.EventType
+	detached bool
+}
+
+func (c *countingPlugin) Name() string { return "counting" }
+
+func (c *countingPlugin) Attach(ds *datastore.Datastore) error {
+	c.attached = ds
+	return nil
+}
+
+func (c *countingPlugin) HandleEvent(event datastore.Event) {
+	c.events = append(c.events, event.Type)
+}
+
+func (c *countingPlugin) Middleware(op datastore.Operation, next func() error) error {
+	c.changes++
+	return next()
+}
+
+func (c *countingPlugin) Detach() {
+	c.detached = true
+}
+
+func init() {
+	datastore.RegisterPlugin("counting", func() datastore.Plugin {
+		return &countingPlugin{}
+	})
+}
+
+func TestPlugin(t *testing.T) {
+	tempdir, err := ioutil.TempDir("", "datastore")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempdir)
+
+	ds, err := datastore.Create(filepath.Join(tempdir, "plugin"+datastore.Extension), TestdataSignature)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ds.EnablePlugin("missing"); !errors.Is(err, datastore.ErrPluginNotFound) {
+		t.Errorf("Expected %s, found %v", datastore.ErrPluginNotFound, err)
+	}
+	if err := ds.EnablePlugin("counting"); err != nil {
+		t.Fatal(err)
+	}
+	if err := ds.Extend(&countingPlugin{}); !errors.Is(err, datastore.ErrPluginExists) {
+		t.Errorf("Expected %s, found %v", datastore.ErrPluginExists, err)
+	}
+
+	plugin, ok := ds.Plugin("counting").(*countingPlugin)
+	if !ok || plugin.attached != ds {
+		t.Fatalf("Expected attached plugin, found %v", ds.Plugin("counting"))
+	}
+
+	if err := ds.In("names").Upsert(&NameDocument{Name: "a"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := ds.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if plugin.changes != 1 {
+		t.Errorf("Expected %d change, found %d", 1, plugin.changes)
+	}
+	if !plugin.detached {
+		t.Error("Expected plugin to be detached")
+	}
+	last := plugin.events[len(plugin.events)-1]
+	if last != datastore.EventClose {
+		t.Errorf("Expected %s, found %s", datastore.EventClose, last)
+	}
+}
@@ -0,0 +1,54 @@
+package datastore
+
+import (
+	"context"
+	"runtime/pprof"
+	"sync/atomic"
+)
+
+// profileLabels is set by SetProfileLabels.
+var profileLabels atomic.Bool
+
+// SetProfileLabels turns on (or off) runtime/pprof labels for Open, Flush, and
+// the methods that scan a whole Collection (FindAll, FindAllKeys, FindOne,
+// FindAllDescending, FindLast, Scan, and Query). While they run, the calling
+// goroutine is labeled with datastore_op (such as "flush" or "findall") and,
+// for Collection methods, datastore_collection, so CPU profiles of a program
+// that embeds datastore attribute the time to the right Collection. Go only
+// records labels in CPU and goroutine profiles.
+//
+// Labels are off by default because Go has no way to read a goroutine's
+// labels: when the operation finishes the goroutine's labels are reset to
+// those of the Context passed to FlushContext, or to none for the other
+// methods. If your program labels its goroutines, pass the labeled Context to
+// FlushContext, and expect other labels to be cleared by the Collection
+// methods listed above.
+func SetProfileLabels(enabled bool) {
+	profileLabels.Store(enabled)
+}
+
+// profile labels the calling goroutine with op and collection (if it is not
+// empty), when SetProfileLabels is on, and returns a function that restores the
+// labels of ctx. Use it as:
+//
+//	defer profile(ctx, "flush", "")()
+func profile(ctx context.Context, op, collection string) (restore func()) {
+	if !profileLabels.Load() {
+		return func() {}
+	}
+
+	labels := []string{"datastore_op", op}
+	if collection != "" {
+		labels = append(labels, "datastore_collection", collection)
+	}
+	pprof.SetGoroutineLabels(pprof.WithLabels(ctx, pprof.Labels(labels...)))
+	return func() {
+		pprof.SetGoroutineLabels(ctx)
+	}
+}
+
+// profile labels the calling goroutine with op and the Collection's name. See
+// the profile function.
+func (c *Collection) profile(op string) (restore func()) {
+	return profile(context.Background(), op, c.name)
+}
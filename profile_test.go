@@ -0,0 +1,44 @@
+package datastore_test
+
+import (
+	"bytes"
+	"runtime/pprof"
+	"strings"
+	"testing"
+
+	"git.stormbase.io/cbednarski/datastore"
+)
+
+func TestSetProfileLabels(t *testing.T) {
+	datastore.SetProfileLabels(true)
+	defer datastore.SetProfileLabels(false)
+
+	ds := datastore.New()
+	names := ds.In("names")
+	if err := names.Upsert(&NameDocument{Name: "a"}); err != nil {
+		t.Fatal(err)
+	}
+
+	// The goroutine profile includes labels, so it shows them while the scan
+	// is running
+	var profile bytes.Buffer
+	names.FindAll(func(datastore.Document) bool {
+		if err := pprof.Lookup("goroutine").WriteTo(&profile, 1); err != nil {
+			t.Fatal(err)
+		}
+		return true
+	})
+	for _, label := range []string{`"datastore_op":"findall"`, `"datastore_collection":"names"`} {
+		if !strings.Contains(profile.String(), label) {
+			t.Errorf("Expected profile to contain %s", label)
+		}
+	}
+
+	profile.Reset()
+	if err := pprof.Lookup("goroutine").WriteTo(&profile, 1); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(profile.String(), "datastore_op") {
+		t.Error("Expected labels to be removed after the scan")
+	}
+}
@@ -0,0 +1,122 @@
+package datastore
+
+import "time"
+
+// query is a finder registered with DefineQuery, and its cached results.
+type query struct {
+	finder  func(Document) bool
+	results []Document
+	valid   bool
+}
+
+// DefineQuery registers a finder under name, so its results can be fetched with
+// Query. The results are cached after the first call to Query and are thrown
+// away whenever a Document in the Collection is changed, so repeated queries
+// over a Collection that rarely changes do not scan it each time. Defining a
+// query with the same name replaces it.
+//
+// The finder is called while the Collection is locked, so it must not call
+// methods on the Collection, and it must only depend on the Document it is
+// given. Queries are not written to disk, so call DefineQuery again after Open.
+func (c *Collection) DefineQuery(name string, finder func(Document) bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.queries == nil {
+		c.queries = map[string]*query{}
+	}
+	c.queries[name] = &query{finder: finder}
+}
+
+// Query returns the Documents that satisfy the query registered under name
+// with DefineQuery, in ascending order, or ErrQueryNotFound. The Documents are
+// shared between callers until the Collection changes, so do not modify them.
+func (c *Collection) Query(name string) ([]Document, error) {
+	results, _, err := c.runQuery(name)
+	return results, err
+}
+
+// Explanation describes how a query was run. See Explain.
+type Explanation struct {
+	// Cached is true if the results were returned from the cache without
+	// scanning the Collection.
+	Cached bool
+
+	// Scanned is the number of Documents passed to the finder, and Matched is
+	// the number of results.
+	Scanned int
+	Matched int
+
+	// Duration is how long the query took, including waiting for locks.
+	Duration time.Duration
+}
+
+// Explain runs the query registered under name like Query, and describes how
+// it was run instead of returning the results. Use it to find out why a query
+// is slow: a query that is rarely Cached is invalidated by frequent changes to
+// the Collection. Collections are only indexed by key, so a query that is not
+// cached always scans every Document.
+func (c *Collection) Explain(name string) (Explanation, error) {
+	_, explanation, err := c.runQuery(name)
+	return explanation, err
+}
+
+func (c *Collection) runQuery(name string) ([]Document, Explanation, error) {
+	defer c.profile("query")()
+	start := time.Now()
+	explanation := Explanation{}
+
+	c.mutex.RLock()
+	q, ok := c.queries[name]
+	if ok && q.valid {
+		results := q.copyResults()
+		c.mutex.RUnlock()
+		explanation.Cached = true
+		explanation.Matched = len(results)
+		explanation.Duration = time.Since(start)
+		return results, explanation, nil
+	}
+	c.mutex.RUnlock()
+	if !ok {
+		return nil, explanation, wrapError(ErrQueryNotFound, "query", c, 0)
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	// The query may have been run or replaced while we were unlocked
+	q, ok = c.queries[name]
+	if !ok {
+		return nil, explanation, wrapError(ErrQueryNotFound, "query", c, 0)
+	}
+	if q.valid {
+		explanation.Cached = true
+	} else {
+		q.results = []Document{}
+		for _, key := range c.index.Keys() {
+			if document, _ := c.item(key); q.finder(document) {
+				q.results = append(q.results, document)
+			}
+		}
+		q.valid = true
+		explanation.Scanned = c.index.Len()
+	}
+	explanation.Matched = len(q.results)
+	explanation.Duration = time.Since(start)
+	return q.copyResults(), explanation, nil
+}
+
+func (q *query) copyResults() []Document {
+	results := make([]Document, len(q.results))
+	copy(results, q.results)
+	return results
+}
+
+// invalidateQueries throws away the cached results of every query. It must be
+// called while the Collection is locked.
+func (c *Collection) invalidateQueries() {
+	for _, q := range c.queries {
+		q.valid = false
+		q.results = nil
+	}
+}
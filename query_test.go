@@ -0,0 +1,88 @@
+package datastore_test
+
+import (
+	"errors"
+	"testing"
+
+	"git.stormbase.io/cbednarski/datastore"
+)
+
+func TestCollection_DefineQuery(t *testing.T) {
+	ds := datastore.New()
+	numbers := ds.In("numbers")
+	for i := 1; i <= 10; i++ {
+		numbers.Upsert(&NumberDocument{Number: i})
+	}
+
+	runs := 0
+	numbers.DefineQuery("even", func(d datastore.Document) bool {
+		runs++
+		return d.(*NumberDocument).Number%2 == 0
+	})
+
+	for i := 0; i < 3; i++ {
+		results, err := numbers.Query("even")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(results) != 5 {
+			t.Errorf("Expected 5 results, found %d", len(results))
+		}
+	}
+	if runs != 10 {
+		t.Errorf("Expected the finder to run once per document, found %d runs", runs)
+	}
+
+	// Changing the Collection invalidates the results
+	if err := numbers.Upsert(&NumberDocument{Number: 12}); err != nil {
+		t.Fatal(err)
+	}
+	results, err := numbers.Query("even")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 6 || results[5].(*NumberDocument).Number != 12 {
+		t.Errorf("Expected 6 results ending with 12, found %d", len(results))
+	}
+	if err := numbers.DeleteKey(2); err != nil {
+		t.Fatal(err)
+	}
+	if results, _ := numbers.Query("even"); len(results) != 5 {
+		t.Errorf("Expected 5 results after delete, found %d", len(results))
+	}
+
+	if _, err := numbers.Query("odd"); !errors.Is(err, datastore.ErrQueryNotFound) {
+		t.Errorf("Expected %s, found %v", datastore.ErrQueryNotFound, err)
+	}
+}
+
+func TestCollection_Explain(t *testing.T) {
+	ds := datastore.New()
+	numbers := ds.In("numbers")
+	for i := 1; i <= 10; i++ {
+		numbers.Upsert(&NumberDocument{Number: i})
+	}
+	numbers.DefineQuery("small", func(d datastore.Document) bool {
+		return d.(*NumberDocument).Number <= 3
+	})
+
+	explanation, err := numbers.Explain("small")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if explanation.Cached || explanation.Scanned != 10 || explanation.Matched != 3 {
+		t.Errorf("Expected a scan of 10 documents with 3 matches, found %+v", explanation)
+	}
+
+	explanation, err = numbers.Explain("small")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !explanation.Cached || explanation.Scanned != 0 || explanation.Matched != 3 {
+		t.Errorf("Expected cached results, found %+v", explanation)
+	}
+
+	if _, err := numbers.Explain("large"); !errors.Is(err, datastore.ErrQueryNotFound) {
+		t.Errorf("Expected %s, found %v", datastore.ErrQueryNotFound, err)
+	}
+}
@@ -0,0 +1,137 @@
+package datastore
+
+import "sync"
+
+// Queue wraps a Collection to provide a first-in, first-out queue, such as for
+// background jobs. Documents are delivered in the order they were pushed, which
+// is the order of their keys as long as the Collection assigns them by
+// autoincrement. Push fails with ErrUnorderedQueue if the Collection has an
+// IDGenerator (see SetIDGenerator), and Documents should be pushed without a
+// key of their own.
+//
+// Delivery is at-least-once: Pop hides the Document from other callers but
+// does not remove it. Call Ack when you have finished processing the Document
+// to remove it, or Nack to return it to the front of the Queue. Documents that
+// were popped but not acknowledged are not written as such to disk, so after
+// Open they are delivered again.
+type Queue struct {
+	collection *Collection
+
+	// inflight holds the keys of Documents that have been popped but not
+	// acknowledged
+	inflight map[uint64]bool
+	mutex    sync.Mutex
+}
+
+// Queue returns a Queue backed by the named Collection, creating the Collection
+// if necessary. Calling Queue again with the same name returns the same Queue.
+func (d *Datastore) Queue(name string) *Queue {
+	c := d.In(name)
+
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	if q, ok := d.queues[name]; ok {
+		return q
+	}
+
+	q := &Queue{
+		collection: c,
+		inflight:   map[uint64]bool{},
+	}
+	if d.queues == nil {
+		d.queues = map[string]*Queue{}
+	}
+	d.queues[name] = q
+	return q
+}
+
+// Collection returns the Collection that holds the queued Documents.
+func (q *Queue) Collection() *Collection {
+	return q.collection
+}
+
+// Push adds a Document to the back of the Queue.
+func (q *Queue) Push(document Document) error {
+	q.collection.mutex.RLock()
+	unordered := q.collection.idGenerator != nil
+	q.collection.mutex.RUnlock()
+	if unordered {
+		return &Error{Op: "push", Collection: q.collection.name, Err: ErrUnorderedQueue}
+	}
+	return q.collection.Upsert(document)
+}
+
+// Pop returns the Document at the front of the Queue and hides it from Peek and
+// Pop until it is passed to Nack. Returns nil if the Queue is empty.
+func (q *Queue) Pop() Document {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	document := q.peek()
+	if document != nil {
+		q.inflight[document.ID()] = true
+	}
+	return document
+}
+
+// Peek returns the Document at the front of the Queue without removing it, or
+// nil if the Queue is empty.
+func (q *Queue) Peek() Document {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	return q.peek()
+}
+
+// peek must be called while the Queue is locked. In-flight keys are skipped
+// before their Documents are read, so only the Document returned is fetched
+// (and decompressed).
+func (q *Queue) peek() Document {
+	keys, item, done := q.collection.reader()
+	defer done()
+
+	for _, key := range keys {
+		if !q.inflight[key] {
+			document, _ := item(key)
+			return document
+		}
+	}
+	return nil
+}
+
+// Ack removes a Document returned by Pop from the Queue, once it has been
+// processed.
+func (q *Queue) Ack(document Document) error {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	if err := q.collection.DeleteKey(document.ID()); err != nil {
+		return err
+	}
+	delete(q.inflight, document.ID())
+	return nil
+}
+
+// Nack returns a Document returned by Pop to the Queue, so it will be returned
+// by Pop again. Since the Queue is ordered by key it returns to the front.
+func (q *Queue) Nack(document Document) {
+	q.mutex.Lock()
+	delete(q.inflight, document.ID())
+	q.mutex.Unlock()
+}
+
+// Len returns the number of Documents waiting in the Queue, which does not
+// include Documents that have been popped but not acknowledged.
+func (q *Queue) Len() int {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	return len(q.collection.List()) - len(q.inflight)
+}
+
+// InFlight returns the number of Documents that have been popped but not
+// acknowledged.
+func (q *Queue) InFlight() int {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	return len(q.inflight)
+}
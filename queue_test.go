@@ -0,0 +1,95 @@
+package datastore_test
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"git.stormbase.io/cbednarski/datastore"
+)
+
+func TestQueue(t *testing.T) {
+	tempdir, err := ioutil.TempDir("", "datastore")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempdir)
+	datapath := filepath.Join(tempdir, "queue"+datastore.Extension)
+
+	ds, err := datastore.Create(datapath, TestdataSignature)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	jobs := ds.Queue("jobs")
+	if jobs.Pop() != nil {
+		t.Error("Expected empty queue")
+	}
+	for _, name := range []string{"first", "second", "third"} {
+		if err := jobs.Push(&NameDocument{Name: name}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if peeked := jobs.Peek().(*NameDocument); peeked.Name != "first" {
+		t.Errorf("Expected first, found %s", peeked.Name)
+	}
+
+	first := jobs.Pop()
+	second := jobs.Pop()
+	if name := second.(*NameDocument).Name; name != "second" {
+		t.Errorf("Expected second, found %s", name)
+	}
+	if jobs.Len() != 1 || jobs.InFlight() != 2 {
+		t.Errorf("Expected 1 waiting and 2 in flight, found %d and %d", jobs.Len(), jobs.InFlight())
+	}
+
+	if err := jobs.Ack(first); err != nil {
+		t.Fatal(err)
+	}
+	jobs.Nack(second)
+	if name := jobs.Pop().(*NameDocument).Name; name != "second" {
+		t.Errorf("Expected second after Nack, found %s", name)
+	}
+
+	// second is still in flight, so it should be delivered again after Open
+	if err := ds.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	ds2, err := datastore.Open(datapath, TestdataSignature)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	jobs2 := ds2.Queue("jobs")
+	if jobs2.Len() != 2 {
+		t.Errorf("Expected 2 waiting, found %d", jobs2.Len())
+	}
+	if name := jobs2.Pop().(*NameDocument).Name; name != "second" {
+		t.Errorf("Expected second after Open, found %s", name)
+	}
+	if ds2.Queue("jobs") != jobs2 {
+		t.Error("Expected the same Queue")
+	}
+}
+
+func TestQueue_IDGenerator(t *testing.T) {
+	ds := datastore.New()
+	jobs := ds.Queue("jobs")
+	jobs.Collection().SetIDGenerator(datastore.RandomIDs())
+
+	// Random keys would not keep the Documents in the order they were pushed
+	if err := jobs.Push(&NameDocument{Name: "first"}); !errors.Is(err, datastore.ErrUnorderedQueue) {
+		t.Errorf("Expected %s, found %v", datastore.ErrUnorderedQueue, err)
+	}
+	if jobs.Len() != 0 {
+		t.Errorf("Expected an empty queue, found %d", jobs.Len())
+	}
+
+	jobs.Collection().SetIDGenerator(nil)
+	if err := jobs.Push(&NameDocument{Name: "first"}); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,158 @@
+package datastore
+
+import (
+	"reflect"
+	"sort"
+)
+
+// Ref is a typed reference to a Document in another Collection, for use as a
+// field in your own Documents instead of a bare uint64 key. T is the type stored
+// in the Collection, for example Ref[*Pet]. The Collection name and key are
+// exported so they are written to disk (and to JSON) with your Document.
+type Ref[T Document] struct {
+	Collection string
+	Key        uint64
+}
+
+// NewRef returns a Ref to a Document stored in the named Collection. The
+// Document must already have been upserted so it has a key.
+func NewRef[T Document](collection string, document T) Ref[T] {
+	return Ref[T]{Collection: collection, Key: document.ID()}
+}
+
+// IsZero returns true if the Ref does not refer to anything.
+func (r Ref[T]) IsZero() bool {
+	return r.Collection == "" && r.Key == 0
+}
+
+// Resolve returns the Document the Ref refers to. Returns ErrKeyNotFound if the
+// Collection or Document does not exist, and ErrInvalidType if the Document is
+// not a T.
+func (r Ref[T]) Resolve(ds *Datastore) (T, error) {
+	var zero T
+	document := ds.lookup(r.Collection, r.Key)
+	if document == nil {
+		return zero, ErrKeyNotFound
+	}
+	typed, ok := document.(T)
+	if !ok {
+		return zero, ErrInvalidType
+	}
+	return typed, nil
+}
+
+// target implements reference, so CheckReferences can find Refs of any type.
+func (r Ref[T]) target() (string, uint64) {
+	return r.Collection, r.Key
+}
+
+// reference is implemented by every Ref.
+type reference interface {
+	target() (collection string, key uint64)
+}
+
+var referenceType = reflect.TypeOf((*reference)(nil)).Elem()
+
+// BrokenReference describes a Ref that does not resolve. See CheckReferences.
+type BrokenReference struct {
+	// Collection and Key identify the Document that holds the Ref.
+	Collection string
+	Key        uint64
+
+	// Target and TargetKey are the Collection and key the Ref refers to.
+	Target    string
+	TargetKey uint64
+}
+
+// CheckReferences finds every Ref in every Document in the Datastore that
+// refers to a Document that does not exist, for example because it has been
+// deleted. Refs that are zero are ignored. Refs are found in struct fields,
+// pointers, slices, arrays, and map values.
+func (d *Datastore) CheckReferences() []BrokenReference {
+	collections := d.collections()
+	sort.Slice(collections, func(i, j int) bool {
+		return collections[i].name < collections[j].name
+	})
+
+	// Collect the references first, so no Collection is locked while the
+	// targets are looked up
+	references := []BrokenReference{}
+	for _, c := range collections {
+		name := c.name
+		c.FindAll(func(document Document) bool {
+			findReferences(reflect.ValueOf(document), map[uintptr]bool{}, func(r reference) {
+				target, key := r.target()
+				if target != "" || key != 0 {
+					references = append(references, BrokenReference{
+						Collection: name,
+						Key:        document.ID(),
+						Target:     target,
+						TargetKey:  key,
+					})
+				}
+			})
+			return false
+		})
+	}
+
+	broken := []BrokenReference{}
+	for _, r := range references {
+		if d.lookup(r.Target, r.TargetKey) == nil {
+			broken = append(broken, r)
+		}
+	}
+	return broken
+}
+
+// lookup returns a Document without creating the Collection if it does not
+// exist.
+func (d *Datastore) lookup(collection string, key uint64) Document {
+	d.mutex.Lock()
+	c := d.Collections[collection]
+	d.mutex.Unlock()
+
+	if c == nil {
+		return nil
+	}
+	return c.FindKey(key)
+}
+
+// findReferences calls found for each Ref reachable from value.
+func findReferences(value reflect.Value, visited map[uintptr]bool, found func(reference)) {
+	if !value.IsValid() {
+		return
+	}
+	if value.Type().Implements(referenceType) && value.Kind() == reflect.Struct {
+		found(value.Interface().(reference))
+		return
+	}
+
+	switch value.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if value.IsNil() {
+			return
+		}
+		if value.Kind() == reflect.Ptr {
+			if visited[value.Pointer()] {
+				return
+			}
+			visited[value.Pointer()] = true
+		}
+		findReferences(value.Elem(), visited, found)
+	case reflect.Struct:
+		for i := 0; i < value.NumField(); i++ {
+			if value.Type().Field(i).PkgPath == "" {
+				findReferences(value.Field(i), visited, found)
+			}
+		}
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < value.Len(); i++ {
+			findReferences(value.Index(i), visited, found)
+		}
+	case reflect.Map:
+		iter := value.MapRange()
+		for iter.Next() {
+			findReferences(iter.Value(), visited, found)
+		}
+	}
+}
@@ -0,0 +1,72 @@
+package datastore_test
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"git.stormbase.io/cbednarski/datastore"
+)
+
+func TestRef(t *testing.T) {
+	tempdir, err := ioutil.TempDir("", "datastore")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempdir)
+	datapath := filepath.Join(tempdir, "ref"+datastore.Extension)
+
+	ds, err := datastore.Create(datapath, TestdataSignature)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	owner := &NameDocument{Name: "Alice"}
+	if err := ds.In("owners").Upsert(owner); err != nil {
+		t.Fatal(err)
+	}
+	rex := &PetDocument{Name: "Rex", Owner: datastore.NewRef("owners", owner)}
+	if err := ds.In("pets").Upsert(rex); err != nil {
+		t.Fatal(err)
+	}
+	chomper := &PetDocument{
+		Name:    "Chomper",
+		Owner:   datastore.NewRef("owners", owner),
+		Friends: []datastore.Ref[*PetDocument]{datastore.NewRef("pets", rex), {Collection: "pets", Key: 99}},
+	}
+	if err := ds.In("pets").Upsert(chomper); err != nil {
+		t.Fatal(err)
+	}
+	if err := ds.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	ds2, err := datastore.Open(datapath, TestdataSignature)
+	if err != nil {
+		t.Fatal(err)
+	}
+	found := ds2.In("pets").FindKey(chomper.ID()).(*PetDocument)
+	resolved, err := found.Owner.Resolve(ds2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resolved.Name != "Alice" {
+		t.Errorf("Expected Alice, found %s", resolved.Name)
+	}
+
+	if _, err := found.Friends[1].Resolve(ds2); !errors.Is(err, datastore.ErrKeyNotFound) {
+		t.Errorf("Expected %s, found %v", datastore.ErrKeyNotFound, err)
+	}
+	wrongType := datastore.Ref[*NameDocument]{Collection: "pets", Key: rex.ID()}
+	if _, err := wrongType.Resolve(ds2); !errors.Is(err, datastore.ErrInvalidType) {
+		t.Errorf("Expected %s, found %v", datastore.ErrInvalidType, err)
+	}
+
+	expected := []datastore.BrokenReference{{Collection: "pets", Key: chomper.ID(), Target: "pets", TargetKey: 99}}
+	if broken := ds2.CheckReferences(); !reflect.DeepEqual(broken, expected) {
+		t.Errorf("Expected %#v, found %#v", expected, broken)
+	}
+}
@@ -0,0 +1,137 @@
+package datastore
+
+import (
+	"encoding/gob"
+	"io"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// RequiredRegistrations returns the types that must be registered with
+// gob.Register before the Documents can be written to disk, and have not been.
+// This includes the type of each Document and the concrete type of each value
+// stored in an interface field, at any depth. Without these registrations Flush
+// fails with an error like "gob: type not registered for interface".
+//
+// Only the values in the Documents passed in are inspected, since an interface
+// field may hold any type. Pass a representative sample, or use
+// InterfaceFields to find the fields that need attention. The types are
+// returned sorted by name.
+func RequiredRegistrations(documents ...Document) []reflect.Type {
+	found := map[reflect.Type]bool{}
+	for _, document := range documents {
+		found[reflect.TypeOf(document)] = true
+		walkInterfaces(reflect.ValueOf(document), found, map[uintptr]bool{})
+	}
+
+	required := []reflect.Type{}
+	for t := range found {
+		if !registered(t) {
+			required = append(required, t)
+		}
+	}
+	sort.Slice(required, func(i, j int) bool {
+		return required[i].String() < required[j].String()
+	})
+	return required
+}
+
+// RegisterTypes calls gob.Register for each type returned by
+// RequiredRegistrations, and returns them. It is meant to be called when a
+// program starts, with an example of each Document it stores:
+//
+//	datastore.RegisterTypes(&User{Avatar: PNG{}}, &Post{})
+func RegisterTypes(documents ...Document) []reflect.Type {
+	required := RequiredRegistrations(documents...)
+	for _, t := range required {
+		gob.Register(example(t))
+	}
+	return required
+}
+
+// InterfaceFields returns the paths of the interface-typed fields in a Document
+// type, such as ".Shape" or ".Shapes[]", at any depth. Each concrete type
+// stored in these fields must be registered with gob.Register.
+func InterfaceFields(document Document) []string {
+	fields := []string{}
+	walkInterfaceFields(reflect.TypeOf(document), "", &fields, map[reflect.Type]bool{})
+	return fields
+}
+
+func walkInterfaceFields(t reflect.Type, path string, fields *[]string, seen map[reflect.Type]bool) {
+	switch t.Kind() {
+	case reflect.Interface:
+		*fields = append(*fields, path)
+	case reflect.Ptr:
+		walkInterfaceFields(t.Elem(), path, fields, seen)
+	case reflect.Slice, reflect.Array:
+		walkInterfaceFields(t.Elem(), path+"[]", fields, seen)
+	case reflect.Map:
+		walkInterfaceFields(t.Key(), path+"[key]", fields, seen)
+		walkInterfaceFields(t.Elem(), path+"[]", fields, seen)
+	case reflect.Struct:
+		// Recursive types would otherwise be walked forever
+		if seen[t] {
+			return
+		}
+		seen[t] = true
+		defer delete(seen, t)
+		for i := 0; i < t.NumField(); i++ {
+			if field := t.Field(i); field.IsExported() {
+				walkInterfaceFields(field.Type, path+"."+field.Name, fields, seen)
+			}
+		}
+	}
+}
+
+// walkInterfaces records the concrete types of the values held in interfaces
+// within v. visited holds the pointers already walked, so cycles end.
+func walkInterfaces(v reflect.Value, found map[reflect.Type]bool, visited map[uintptr]bool) {
+	switch v.Kind() {
+	case reflect.Interface:
+		if !v.IsNil() {
+			found[v.Elem().Type()] = true
+			walkInterfaces(v.Elem(), found, visited)
+		}
+	case reflect.Ptr:
+		if v.IsNil() || visited[v.Pointer()] {
+			return
+		}
+		visited[v.Pointer()] = true
+		walkInterfaces(v.Elem(), found, visited)
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			walkInterfaces(v.Index(i), found, visited)
+		}
+	case reflect.Map:
+		iter := v.MapRange()
+		for iter.Next() {
+			walkInterfaces(iter.Key(), found, visited)
+			walkInterfaces(iter.Value(), found, visited)
+		}
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			if v.Type().Field(i).IsExported() {
+				walkInterfaces(v.Field(i), found, visited)
+			}
+		}
+	}
+}
+
+// registered reports whether t has been registered with gob.Register. Gob has
+// no way to ask, so a zero value is encoded as an interface to find out.
+func registered(t reflect.Type) bool {
+	value := example(t)
+	err := gob.NewEncoder(io.Discard).Encode(&value)
+	return err == nil || !strings.Contains(err.Error(), "not registered")
+}
+
+// example returns a value of type t that Gob can encode. Gob refuses nil
+// pointers, so a pointer type gets a pointer to a zero value.
+func example(t reflect.Type) interface{} {
+	if t.Kind() == reflect.Ptr {
+		return reflect.New(t.Elem()).Interface()
+	}
+	return reflect.Zero(t).Interface()
+}
@@ -0,0 +1,78 @@
+package datastore_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"git.stormbase.io/cbednarski/datastore"
+)
+
+type Triangle struct {
+	Base, Height float64
+}
+
+func (t Triangle) Area() float64 { return t.Base * t.Height / 2 }
+
+type DrawingDocument struct {
+	Identifier uint64
+	Shapes     map[string]Shape
+	Layers     []struct{ Shape Shape }
+}
+
+func (d *DrawingDocument) ID() uint64 {
+	return d.Identifier
+}
+
+func (d *DrawingDocument) SetID(id uint64) {
+	d.Identifier = id
+}
+
+func TestInterfaceFields(t *testing.T) {
+	expected := []string{".Shapes[]", ".Layers[].Shape"}
+	if found := datastore.InterfaceFields(&DrawingDocument{}); !reflect.DeepEqual(found, expected) {
+		t.Errorf("Expected %v, found %v", expected, found)
+	}
+}
+
+func TestRegisterTypes(t *testing.T) {
+	drawing := &DrawingDocument{
+		Shapes: map[string]Shape{"a": Square{Side: 1}},
+		Layers: []struct{ Shape Shape }{{Shape: Triangle{Base: 1, Height: 2}}},
+	}
+
+	// Square is registered by the verify tests
+	expected := []reflect.Type{reflect.TypeOf(&DrawingDocument{}), reflect.TypeOf(Triangle{})}
+	if found := datastore.RequiredRegistrations(drawing); !reflect.DeepEqual(found, expected) {
+		t.Errorf("Expected %v, found %v", expected, found)
+	}
+
+	tempdir, err := ioutil.TempDir("", "datastore")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempdir)
+
+	ds, err := datastore.Create(filepath.Join(tempdir, "register"+datastore.Extension), TestdataSignature)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ds.In("drawings").Upsert(drawing); err != nil {
+		t.Fatal(err)
+	}
+	if err := ds.Flush(); err == nil {
+		t.Fatal("Expected flush to fail before registering types")
+	}
+
+	if found := datastore.RegisterTypes(drawing); !reflect.DeepEqual(found, expected) {
+		t.Errorf("Expected %v, found %v", expected, found)
+	}
+	if found := datastore.RequiredRegistrations(drawing); len(found) != 0 {
+		t.Errorf("Expected no registrations, found %v", found)
+	}
+	if err := ds.Flush(); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,63 @@
+package datastore
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// RetryPolicy controls how a Flush is retried after a transient error, such as
+// a full disk or a network filesystem that is briefly unavailable.
+type RetryPolicy struct {
+	// Attempts is the maximum number of times to write the file. Zero or one
+	// means a Flush is not retried.
+	Attempts int
+
+	// Delay is how long to wait before the first retry. It is doubled after
+	// each retry.
+	Delay time.Duration
+
+	// Retryable reports whether err is worth retrying. If it is nil, errors
+	// with Kind ErrIO are retried. Encoding errors are never fixed by waiting,
+	// and errors from the Flush's context are never retried.
+	Retryable func(err error) bool
+}
+
+// SetRetryPolicy sets how failed Flushes are retried. By default they are not.
+// EventFlushStart and EventFlushEnd are sent once per Flush, no matter how many
+// attempts it takes, and the error from the last attempt is returned.
+func (d *Datastore) SetRetryPolicy(policy RetryPolicy) {
+	d.retry.Store(&policy)
+}
+
+// flushRetry calls flush until it succeeds or the retry policy gives up. It
+// must be called while flushMutex is held.
+func (d *Datastore) flushRetry(ctx context.Context) (FlushStats, error) {
+	policy := RetryPolicy{}
+	if p := d.retry.Load(); p != nil {
+		policy = *p
+	}
+	retryable := policy.Retryable
+	if retryable == nil {
+		retryable = func(err error) bool {
+			return errors.Is(err, ErrIO)
+		}
+	}
+
+	delay := policy.Delay
+	for attempt := 1; ; attempt++ {
+		stats, err := d.flush(ctx)
+		if err == nil || attempt >= policy.Attempts || ctx.Err() != nil || !retryable(err) {
+			return stats, err
+		}
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return stats, err
+		case <-timer.C:
+		}
+		delay *= 2
+	}
+}
@@ -0,0 +1,64 @@
+package datastore_test
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"git.stormbase.io/cbednarski/datastore"
+)
+
+func TestRetryPolicy(t *testing.T) {
+	tempdir, err := ioutil.TempDir("", "datastore")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempdir)
+
+	datapath := filepath.Join(tempdir, "retry"+datastore.Extension)
+	ds, err := datastore.Create(datapath, TestdataSignature)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A non-empty directory in place of the file makes the rename fail
+	if err := os.Remove(datapath); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(filepath.Join(datapath, "blocker"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ds.Flush(); !errors.Is(err, datastore.ErrIO) {
+		t.Fatalf("Expected %s, found %v", datastore.ErrIO, err)
+	}
+	if _, err := os.Stat(datapath + ".tmp"); !os.IsNotExist(err) {
+		t.Errorf("Expected temp file to be removed, found %v", err)
+	}
+
+	attempts := 0
+	ds.SetRetryPolicy(datastore.RetryPolicy{
+		Attempts: 3,
+		Retryable: func(err error) bool {
+			attempts++
+			if _, statErr := os.Stat(datapath + ".tmp"); !os.IsNotExist(statErr) {
+				t.Errorf("Expected temp file to be removed, found %v", statErr)
+			}
+			if attempts == 2 {
+				os.RemoveAll(datapath)
+			}
+			return errors.Is(err, datastore.ErrIO)
+		},
+	})
+	if err := ds.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if attempts != 2 {
+		t.Errorf("Expected %d retries, found %d", 2, attempts)
+	}
+	if _, err := datastore.Open(datapath, TestdataSignature); err != nil {
+		t.Fatal(err)
+	}
+}
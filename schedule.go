@@ -0,0 +1,44 @@
+package datastore
+
+import "time"
+
+// DefaultFlushDelay is the quiet period FlushSoon waits for before flushing,
+// unless it is changed with SetFlushDelay.
+const DefaultFlushDelay = time.Second
+
+// SetFlushDelay changes how long FlushSoon waits after the most recent call
+// before flushing. See FlushSoon.
+func (d *Datastore) SetFlushDelay(delay time.Duration) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	d.flushDelay = delay
+}
+
+// FlushSoon schedules a Flush to happen once FlushSoon has not been called for
+// the flush delay (DefaultFlushDelay, or the value passed to SetFlushDelay).
+// Each call restarts the delay, so a burst of changes followed by calls to
+// FlushSoon results in a single write to disk.
+//
+// The Flush happens in the background, so FlushSoon cannot return its error.
+// Use Subscribe to receive EventFlushEnd if you need to know whether it
+// succeeded.
+func (d *Datastore) FlushSoon() {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	if d.closed.Load() {
+		return
+	}
+
+	delay := d.flushDelay
+	if delay == 0 {
+		delay = DefaultFlushDelay
+	}
+
+	if d.flushTimer != nil {
+		d.flushTimer.Stop()
+	}
+	d.flushTimer = time.AfterFunc(delay, func() {
+		d.Flush()
+	})
+}
@@ -0,0 +1,63 @@
+package datastore_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"git.stormbase.io/cbednarski/datastore"
+)
+
+func TestFlushSoon(t *testing.T) {
+	tempdir, err := ioutil.TempDir("", "datastore")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempdir)
+
+	ds, err := datastore.Create(filepath.Join(tempdir, "soon"+datastore.Extension), TestdataSignature)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ds.SetFlushDelay(20 * time.Millisecond)
+
+	flushed := make(chan error, 10)
+	ds.Subscribe(func(e datastore.Event) {
+		if e.Type == datastore.EventFlushEnd {
+			flushed <- e.Err
+		}
+	})
+
+	for i := 0; i < 5; i++ {
+		if err := ds.In("numbers").Upsert(&NumberDocument{Number: i}); err != nil {
+			t.Fatal(err)
+		}
+		ds.FlushSoon()
+	}
+
+	select {
+	case err := <-flushed:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Expected a flush")
+	}
+
+	// The burst should have been coalesced into a single flush
+	select {
+	case <-flushed:
+		t.Error("Expected only one flush")
+	case <-time.After(60 * time.Millisecond):
+	}
+
+	reopened, err := datastore.Open(ds.Path(), TestdataSignature)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count := len(reopened.In("numbers").List()); count != 5 {
+		t.Errorf("Expected 5 documents, found %d", count)
+	}
+}
@@ -0,0 +1,172 @@
+package datastore
+
+import (
+	"encoding"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// SchemaError describes fields that were recorded for a Collection the last
+// time it was flushed, but that do not match the Document type it holds now.
+// Gob silently drops the data in fields that have been removed or renamed, so
+// this usually means data has been lost. See VerifySchema.
+type SchemaError struct {
+	Collection string
+
+	// Removed lists the fields that no longer exist, by path (for example
+	// "Owner.Name").
+	Removed []string
+
+	// Changed lists the fields whose type has changed.
+	Changed []string
+}
+
+func (e *SchemaError) Error() string {
+	problems := []string{}
+	if len(e.Removed) > 0 {
+		problems = append(problems, "removed "+strings.Join(e.Removed, ", "))
+	}
+	if len(e.Changed) > 0 {
+		problems = append(problems, "changed "+strings.Join(e.Changed, ", "))
+	}
+	return fmt.Sprintf("schema of collection %q does not match: %s", e.Collection, strings.Join(problems, "; "))
+}
+
+// VerifySchema compares the fields of each Collection's Document type with the
+// fields recorded when the Collection was last flushed, and returns a
+// *SchemaError (joined with errors.Join if there are several) for each
+// Collection where fields were removed or changed. Open sends an
+// EventSchemaChange for each of these, but does not fail. Call VerifySchema
+// after Open, before the next Flush, if you would rather stop.
+func (d *Datastore) VerifySchema() error {
+	if err := d.checkOpen(); err != nil {
+		return err
+	}
+	return d.verifySchema(nil)
+}
+
+// verifySchema checks each Collection in name order, calls report (if not nil)
+// for each mismatch, and returns the mismatches joined together.
+func (d *Datastore) verifySchema(report func(*SchemaError)) error {
+	d.mutex.Lock()
+	names := make([]string, 0, len(d.Collections))
+	for name := range d.Collections {
+		names = append(names, name)
+	}
+	collections := d.Collections
+	d.mutex.Unlock()
+	sort.Strings(names)
+
+	found := []error{}
+	for _, name := range names {
+		if err := collections[name].verifySchema(); err != nil {
+			if report != nil {
+				report(err)
+			}
+			found = append(found, err)
+		}
+	}
+	return errors.Join(found...)
+}
+
+// verifySchema compares the recorded schema with the current Document type.
+func (c *Collection) verifySchema() *SchemaError {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	if len(c.Schema) == 0 || c.index.Len() == 0 {
+		return nil
+	}
+	document, _ := c.item(c.index.Keys()[0])
+	if document == nil {
+		return nil
+	}
+	current := schemaOf(reflect.TypeOf(document))
+
+	mismatch := &SchemaError{Collection: c.name}
+	for field, kind := range c.Schema {
+		switch now, ok := current[field]; {
+		case !ok:
+			mismatch.Removed = append(mismatch.Removed, field)
+		case now != kind:
+			mismatch.Changed = append(mismatch.Changed, field)
+		}
+	}
+	if len(mismatch.Removed) == 0 && len(mismatch.Changed) == 0 {
+		return nil
+	}
+	sort.Strings(mismatch.Removed)
+	sort.Strings(mismatch.Changed)
+	return mismatch
+}
+
+// recordSchema records the fields of the Collection's Document type, if it has
+// any Documents.
+func (c *Collection) recordSchema() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.index.Len() == 0 {
+		return
+	}
+	if document, _ := c.item(c.index.Keys()[0]); document != nil {
+		c.Schema = schemaOf(reflect.TypeOf(document))
+	}
+}
+
+// recordSchemas records the schema of every Collection before a Flush.
+func (d *Datastore) recordSchemas() {
+	d.mutex.Lock()
+	collections := make([]*Collection, 0, len(d.Collections))
+	for _, c := range d.Collections {
+		collections = append(collections, c)
+	}
+	d.mutex.Unlock()
+
+	for _, c := range collections {
+		c.recordSchema()
+	}
+}
+
+var (
+	gobEncoderType    = reflect.TypeOf((*gob.GobEncoder)(nil)).Elem()
+	binaryMarshalType = reflect.TypeOf((*encoding.BinaryMarshaler)(nil)).Elem()
+)
+
+// schemaOf returns the type of each exported field that Gob encodes, by path.
+// Nested structs are included, except for types like time.Time that encode
+// themselves.
+func schemaOf(kind reflect.Type) map[string]string {
+	schema := map[string]string{}
+	addSchemaFields(schema, "", kind, map[reflect.Type]bool{})
+	return schema
+}
+
+func addSchemaFields(schema map[string]string, prefix string, kind reflect.Type, visited map[reflect.Type]bool) {
+	for kind.Kind() == reflect.Ptr {
+		kind = kind.Elem()
+	}
+	if kind.Kind() != reflect.Struct || visited[kind] {
+		return
+	}
+	if kind.Implements(gobEncoderType) || reflect.PtrTo(kind).Implements(gobEncoderType) ||
+		kind.Implements(binaryMarshalType) || reflect.PtrTo(kind).Implements(binaryMarshalType) {
+		return
+	}
+	visited[kind] = true
+	defer delete(visited, kind)
+
+	for i := 0; i < kind.NumField(); i++ {
+		field := kind.Field(i)
+		if field.PkgPath != "" || field.Type.Kind() == reflect.Func || field.Type.Kind() == reflect.Chan {
+			continue
+		}
+		path := prefix + field.Name
+		schema[path] = field.Type.String()
+		addSchemaFields(schema, path+".", field.Type, visited)
+	}
+}
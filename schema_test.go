@@ -0,0 +1,68 @@
+package datastore_test
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"git.stormbase.io/cbednarski/datastore"
+)
+
+func TestVerifySchema(t *testing.T) {
+	tempdir, err := ioutil.TempDir("", "datastore")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempdir)
+	datapath := filepath.Join(tempdir, "schema"+datastore.Extension)
+
+	ds, err := datastore.Create(datapath, TestdataSignature)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ds.In("accounts").Upsert(&AccountDocument{Name: "Chomper"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := ds.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	ds2, err := datastore.Open(datapath, TestdataSignature)
+	if err != nil {
+		t.Fatal(err)
+	}
+	accounts := ds2.In("accounts")
+	if accounts.Schema["Profile.Bio"] != "string" || accounts.Schema["Tags"] != "[]string" {
+		t.Errorf("Expected nested fields in schema, found %#v", accounts.Schema)
+	}
+	if err := ds2.VerifySchema(); err != nil {
+		t.Errorf("Expected no error, found %s", err)
+	}
+
+	// Pretend the file was written by a version of the type with a field that
+	// has since been removed, and one that has changed type
+	accounts.Schema["Nickname"] = "string"
+	accounts.Schema["Name"] = "int"
+
+	var mismatch *datastore.SchemaError
+	if err := ds2.VerifySchema(); !errors.As(err, &mismatch) {
+		t.Fatalf("Expected *SchemaError, found %#v", err)
+	}
+	if !reflect.DeepEqual(mismatch.Removed, []string{"Nickname"}) {
+		t.Errorf("Expected Nickname removed, found %#v", mismatch.Removed)
+	}
+	if !reflect.DeepEqual(mismatch.Changed, []string{"Name"}) {
+		t.Errorf("Expected Name changed, found %#v", mismatch.Changed)
+	}
+
+	// Flush records the current schema
+	if err := ds2.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if err := ds2.VerifySchema(); err != nil {
+		t.Errorf("Expected no error after Flush, found %s", err)
+	}
+}
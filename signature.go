@@ -0,0 +1,144 @@
+package datastore
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ParsedSignature is a signature that follows the recommended
+// program_name.schema_version format, with optional metadata. See Signature.
+//
+// A ParsedSignature is written as the program name and schema version separated
+// by the last "." in the signature, followed by any metadata as ";key=value"
+// pairs, for example "petstore.3;build=abc123". Use String to build the
+// signature to pass to Open and Create.
+type ParsedSignature struct {
+	// Program identifies the program that owns the Datastore.
+	Program string
+
+	// Version is the schema version of the data.
+	Version int
+
+	// Metadata holds optional extra information, such as the build that wrote
+	// the file. It is not used to compare signatures.
+	Metadata map[string]string
+}
+
+// ParseSignature parses a signature in the program_name.schema_version format.
+// The "datastore:" prefix added by Signature is removed if it is present, so
+// the result of ReadSignature may be passed in directly. Returns
+// ErrInvalidSignature if the signature does not follow the format.
+func ParseSignature(signature string) (ParsedSignature, error) {
+	signature = strings.TrimPrefix(signature, Signature(""))
+
+	parts := strings.Split(signature, ";")
+	dot := strings.LastIndex(parts[0], ".")
+	if dot < 1 {
+		return ParsedSignature{}, ErrInvalidSignature
+	}
+	version, err := strconv.Atoi(parts[0][dot+1:])
+	if err != nil || version < 0 {
+		return ParsedSignature{}, ErrInvalidSignature
+	}
+
+	parsed := ParsedSignature{
+		Program: parts[0][:dot],
+		Version: version,
+	}
+	for _, pair := range parts[1:] {
+		key, value, ok := strings.Cut(pair, "=")
+		if !ok || key == "" {
+			return ParsedSignature{}, ErrInvalidSignature
+		}
+		if parsed.Metadata == nil {
+			parsed.Metadata = map[string]string{}
+		}
+		parsed.Metadata[key] = value
+	}
+	return parsed, nil
+}
+
+// String formats the ParsedSignature so it may be passed to Open or Create.
+// Metadata is sorted by key so the result is always the same.
+func (s ParsedSignature) String() string {
+	signature := s.Program + "." + strconv.Itoa(s.Version)
+
+	keys := make([]string, 0, len(s.Metadata))
+	for key := range s.Metadata {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		signature += ";" + key + "=" + s.Metadata[key]
+	}
+	return signature
+}
+
+// Compare returns -1 if the schema version of s is older than the version of
+// other, 0 if they are the same, and +1 if s is newer. Signatures for
+// different programs are not comparable. Use CompatibleWith first.
+func (s ParsedSignature) Compare(other ParsedSignature) int {
+	switch {
+	case s.Version < other.Version:
+		return -1
+	case s.Version > other.Version:
+		return 1
+	}
+	return 0
+}
+
+// CompatibleWith returns true if a program using signature s can read a
+// Datastore written with signature other: the programs are the same, and the
+// other schema version is not newer than s. Data written with an older schema
+// version can be brought up to date with RegisterUpgrade, but an older program
+// can not understand a newer schema. Metadata is ignored.
+func (s ParsedSignature) CompatibleWith(other ParsedSignature) bool {
+	return s.Program == other.Program && s.Compare(other) >= 0
+}
+
+// InitSigned is like Init, but also checks that the Collection belongs to the
+// code that is initializing it. This lets independent modules, such as plugins,
+// share one Datastore file: each one owns its own Collections and versions
+// them with its own signature, without agreeing on a single signature for the
+// whole file.
+//
+// The signature is recorded in the Collection the first time InitSigned is
+// called, including for an existing Collection that has no signature yet. After
+// that InitSigned fails with ErrInvalidSignature if the signature does not
+// match. Use SetSignature to change it, for example after migrating the
+// Collection to a new schema.
+func (d *Datastore) InitSigned(name, signature string, document Document) (*Collection, error) {
+	c, err := d.Init(name, document)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	switch c.Signature {
+	case "":
+		c.Signature = signature
+		c.markDirty(1)
+	case signature:
+	default:
+		return nil, &Error{Op: "init", Path: d.path, Collection: name, Err: ErrInvalidSignature}
+	}
+	return c, nil
+}
+
+// SetSignature changes the signature recorded in the Collection. See
+// InitSigned.
+func (c *Collection) SetSignature(signature string) error {
+	if err := c.checkOpen(); err != nil {
+		return err
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.Signature != signature {
+		c.Signature = signature
+		c.markDirty(1)
+	}
+	return nil
+}
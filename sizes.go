@@ -0,0 +1,135 @@
+package datastore
+
+import (
+	"cmp"
+	"slices"
+)
+
+// DocumentSize is the size of a Document when encoded with Gob on its own,
+// including its type information. See LargestDocuments.
+type DocumentSize struct {
+	Key   uint64
+	Bytes int
+}
+
+// CollectionSize describes how much of a Datastore a Collection accounts for.
+// See Datastore.Sizes.
+type CollectionSize struct {
+	Name      string
+	Documents int
+
+	// Bytes is the total of the sizes of the Documents. Type information is
+	// counted for each Document, so it overstates the size of the file when
+	// there are many small Documents. History and the trash are not counted.
+	Bytes int64
+
+	// Largest is the largest Document in the Collection, or zero if it is
+	// empty.
+	Largest DocumentSize
+}
+
+// SetSizeTracking records the encoded size of each Document as it is upserted,
+// so DocumentSizes, LargestDocuments, and Datastore.Sizes don't have to encode
+// the whole Collection each time they are called. Tracking costs an extra
+// encoding on every change. It is not written to disk, so call SetSizeTracking
+// again after Open.
+func (c *Collection) SetSizeTracking(enabled bool) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.sizeTracking = enabled
+	if err := c.trackSizes(); err != nil {
+		c.sizeTracking = false
+		return wrapError(err, "set size tracking", c, 0)
+	}
+	return nil
+}
+
+// DocumentSizes returns the encoded size of each Document in the Collection, by
+// key. Sizes are measured as they are in SetQuota. If sizes are not being
+// tracked (see SetSizeTracking) every Document is encoded to measure it.
+func (c *Collection) DocumentSizes() (map[uint64]int, error) {
+	if err := c.checkOpen(); err != nil {
+		return nil, wrapError(err, "sizes", c, 0)
+	}
+
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	sizes := make(map[uint64]int, c.index.Len())
+	if c.sizes != nil {
+		for key, size := range c.sizes {
+			sizes[key] = size
+		}
+		return sizes, nil
+	}
+
+	for _, key := range c.index.Keys() {
+		document, _ := c.item(key)
+		data, err := encodeDocument(document)
+		if err != nil {
+			return nil, wrapError(err, "sizes", c, key)
+		}
+		sizes[key] = len(data)
+	}
+	return sizes, nil
+}
+
+// LargestDocuments returns the n largest Documents in the Collection, largest
+// first. Documents of the same size are ordered by key. See DocumentSizes.
+func (c *Collection) LargestDocuments(n int) ([]DocumentSize, error) {
+	sizes, err := c.DocumentSizes()
+	if err != nil {
+		return nil, err
+	}
+	return largest(sizes, n), nil
+}
+
+// largest returns the n largest entries in sizes, largest first.
+func largest(sizes map[uint64]int, n int) []DocumentSize {
+	ranked := make([]DocumentSize, 0, len(sizes))
+	for key, size := range sizes {
+		ranked = append(ranked, DocumentSize{Key: key, Bytes: size})
+	}
+	slices.SortFunc(ranked, func(a, b DocumentSize) int {
+		if a.Bytes != b.Bytes {
+			return cmp.Compare(b.Bytes, a.Bytes)
+		}
+		return cmp.Compare(a.Key, b.Key)
+	})
+	if n >= 0 && n < len(ranked) {
+		ranked = ranked[:n]
+	}
+	return ranked
+}
+
+// Sizes returns the size of each Collection in the Datastore, largest first,
+// to help find what is making the file grow. See DocumentSizes.
+func (d *Datastore) Sizes() ([]CollectionSize, error) {
+	if err := d.checkOpen(); err != nil {
+		return nil, err
+	}
+
+	result := []CollectionSize{}
+	for _, c := range d.collections() {
+		sizes, err := c.DocumentSizes()
+		if err != nil {
+			return nil, err
+		}
+		size := CollectionSize{Name: c.name, Documents: len(sizes)}
+		for _, bytes := range sizes {
+			size.Bytes += int64(bytes)
+		}
+		if top := largest(sizes, 1); len(top) > 0 {
+			size.Largest = top[0]
+		}
+		result = append(result, size)
+	}
+	slices.SortFunc(result, func(a, b CollectionSize) int {
+		if a.Bytes != b.Bytes {
+			return cmp.Compare(b.Bytes, a.Bytes)
+		}
+		return cmp.Compare(a.Name, b.Name)
+	})
+	return result, nil
+}
@@ -0,0 +1,76 @@
+package datastore_test
+
+import (
+	"strings"
+	"testing"
+
+	"git.stormbase.io/cbednarski/datastore"
+)
+
+func TestDocumentSizes(t *testing.T) {
+	ds := datastore.New()
+	names := ds.In(Names)
+	for _, name := range []string{"small", strings.Repeat("large", 100), strings.Repeat("medium", 10)} {
+		if err := names.Upsert(&NameDocument{Name: name}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := ds.In("other").Upsert(&NameDocument{Name: "tiny"}); err != nil {
+		t.Fatal(err)
+	}
+
+	measured, err := names.LargestDocuments(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(measured) != 2 || measured[0].Key != 2 || measured[1].Key != 3 || measured[0].Bytes <= measured[1].Bytes {
+		t.Errorf("Expected keys 2 and 3, largest first, found %+v", measured)
+	}
+
+	// Tracked sizes match measured sizes, and follow changes
+	if err := names.SetSizeTracking(true); err != nil {
+		t.Fatal(err)
+	}
+	tracked, err := names.LargestDocuments(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tracked[0] != measured[0] || tracked[1] != measured[1] {
+		t.Errorf("Expected %+v, found %+v", measured, tracked)
+	}
+	if err := names.Upsert(&NameDocument{Identifier: 1, Name: strings.Repeat("huge", 1000)}); err != nil {
+		t.Fatal(err)
+	}
+	if err := names.DeleteKey(3); err != nil {
+		t.Fatal(err)
+	}
+	tracked, err = names.LargestDocuments(-1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tracked) != 2 || tracked[0].Key != 1 || tracked[1].Key != 2 {
+		t.Errorf("Expected keys 1 and 2, found %+v", tracked)
+	}
+
+	sizes, err := ds.Sizes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sizes) != 2 || sizes[0].Name != Names || sizes[1].Name != "other" {
+		t.Fatalf("Expected names then other, found %+v", sizes)
+	}
+	if sizes[0].Documents != 2 || sizes[0].Largest != tracked[0] || sizes[0].Bytes != int64(tracked[0].Bytes+tracked[1].Bytes) {
+		t.Errorf("Expected 2 Documents totalling %d bytes, found %+v", tracked[0].Bytes+tracked[1].Bytes, sizes[0])
+	}
+
+	// Turning off tracking doesn't affect the quota
+	if err := names.SetQuota(datastore.Quota{MaxBytes: 1}); err != nil {
+		t.Fatal(err)
+	}
+	if err := names.SetSizeTracking(false); err != nil {
+		t.Fatal(err)
+	}
+	if err := names.Upsert(&NameDocument{Name: "too much"}); err == nil {
+		t.Error("Expected quota to be enforced")
+	}
+}
@@ -0,0 +1,60 @@
+package datastore
+
+import (
+	"encoding/gob"
+	"io"
+)
+
+// CollectionStats describes the size of a Collection. See Collection.Stats.
+type CollectionStats struct {
+	// Documents is the number of Documents in the Collection, and Trashed is
+	// the number in the trash.
+	Documents int
+	Trashed   int
+
+	// EncodedBytes is the approximate size of the Documents when encoded
+	// with Gob, before compression. Type information is only counted once,
+	// as it is in the Datastore file.
+	EncodedBytes int64
+
+	// AverageBytes is EncodedBytes divided by Documents.
+	AverageBytes float64
+
+	// MinKey and MaxKey are the smallest and largest keys in use.
+	MinKey uint64
+	MaxKey uint64
+}
+
+// Stats returns statistics about the Documents in the Collection. Stats
+// encodes every Document to measure it, so it is about as expensive as
+// flushing the Collection; do not call it on every request.
+func (c *Collection) Stats() (CollectionStats, error) {
+	if err := c.checkOpen(); err != nil {
+		return CollectionStats{}, err
+	}
+
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	stats := CollectionStats{
+		Documents: c.index.Len(),
+		Trashed:   len(c.Trash),
+	}
+	if c.index.Len() == 0 {
+		return stats, nil
+	}
+	keys := c.index.Keys()
+	stats.MinKey, stats.MaxKey = keys[0], keys[len(keys)-1]
+
+	counter := &countingWriter{writer: io.Discard}
+	encoder := gob.NewEncoder(counter)
+	for _, key := range c.index.Keys() {
+		document, _ := c.item(key)
+		if err := encoder.Encode(document); err != nil {
+			return stats, wrapError(codecError("stats", err), "stats", c, key)
+		}
+	}
+	stats.EncodedBytes = counter.count
+	stats.AverageBytes = float64(stats.EncodedBytes) / float64(stats.Documents)
+	return stats, nil
+}
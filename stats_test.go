@@ -0,0 +1,40 @@
+package datastore_test
+
+import (
+	"strings"
+	"testing"
+
+	"git.stormbase.io/cbednarski/datastore"
+)
+
+func TestCollection_Stats(t *testing.T) {
+	ds := datastore.New()
+	names := ds.In("names")
+
+	stats, err := names.Stats()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats != (datastore.CollectionStats{}) {
+		t.Errorf("Expected empty stats, found %+v", stats)
+	}
+
+	for i := 0; i < 10; i++ {
+		names.Upsert(&NameDocument{Name: strings.Repeat("x", 100)})
+	}
+	names.SoftDelete(names.FindKey(1))
+
+	stats, err = names.Stats()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Documents != 9 || stats.Trashed != 1 {
+		t.Errorf("Expected 9 documents and 1 trashed, found %+v", stats)
+	}
+	if stats.MinKey != 2 || stats.MaxKey != 10 {
+		t.Errorf("Expected keys 2-10, found %d-%d", stats.MinKey, stats.MaxKey)
+	}
+	if stats.AverageBytes < 100 || stats.AverageBytes > 200 {
+		t.Errorf("Expected about 100 bytes per document, found %f", stats.AverageBytes)
+	}
+}
@@ -0,0 +1,180 @@
+package datastore
+
+import (
+	"compress/gzip"
+	"encoding/gob"
+	"io"
+	"reflect"
+)
+
+// collectionStream is written to the Name field of the gzip header by WriteTo.
+const collectionStream = "datastore:collection"
+
+// WriteTo writes the Datastore to w in the same format Flush writes to disk, and
+// returns the number of bytes written. The Datastore is not marked as flushed,
+// so WriteTo can stream a backup while the Datastore is in use. Use Decode to
+// read it, or write it to a file and Open it.
+func (d *Datastore) WriteTo(w io.Writer) (int64, error) {
+	if err := d.checkOpen(); err != nil {
+		return 0, err
+	}
+
+	counter := &countingWriter{writer: w}
+	if _, err := d.encodeFile(counter, map[string]int{}); err != nil {
+		return counter.count, fileError("write", d.path, err)
+	}
+	return counter.count, nil
+}
+
+// WriteTo writes the Collection to w as a gzipped Gob stream, independently of
+// the rest of the Datastore, and returns the number of bytes written. Use
+// ReadFrom to load it into a Collection in another Datastore with the same
+// signature. Everything that Flush would write for the Collection (including
+// history and the trash) is included.
+func (c *Collection) WriteTo(w io.Writer) (int64, error) {
+	if err := c.checkOpen(); err != nil {
+		return 0, err
+	}
+
+	return c.encode(w, c.snapshot())
+}
+
+// encode writes a snapshot of the Collection to w in the format read by
+// ReadFrom.
+func (c *Collection) encode(w io.Writer, snapshot *Collection) (int64, error) {
+	counter := &countingWriter{writer: w}
+	writer := gzip.NewWriter(counter)
+	writer.Name = collectionStream
+	writer.ModTime = c.now()
+	if c.store != nil {
+		writer.Comment = c.store.signature
+	}
+
+	if err := gob.NewEncoder(writer).Encode(snapshot); err != nil {
+		return counter.count, wrapError(codecError("write", err), "write", c, 0)
+	}
+	if err := writer.Close(); err != nil {
+		return counter.count, wrapError(err, "write", c, 0)
+	}
+	return counter.count, nil
+}
+
+// ReadFrom replaces the contents of the Collection with a Collection written by
+// WriteTo, and returns the number of bytes read. It fails with
+// ErrInvalidSignature if the stream was written by a Datastore with a different
+// signature, and with ErrInvalidType if the Collection already holds a
+// different type of Document. Views of the Collection are rebuilt.
+func (c *Collection) ReadFrom(r io.Reader) (int64, error) {
+	counter := &countingReader{reader: r}
+	reader, err := gzip.NewReader(counter)
+	if err != nil {
+		return counter.count, wrapError(&Error{Kind: ErrCorrupt, Err: err}, "read", c, 0)
+	}
+	defer reader.Close()
+
+	if reader.Name != collectionStream {
+		return counter.count, wrapError(&Error{Kind: ErrCorrupt, Err: gzip.ErrHeader}, "read", c, 0)
+	}
+	if c.store != nil && c.store.signature != "" && reader.Comment != c.store.signature {
+		return counter.count, wrapError(ErrInvalidSignature, "read", c, 0)
+	}
+
+	incoming := &Collection{}
+	if err := gob.NewDecoder(reader).Decode(incoming); err != nil {
+		return counter.count, wrapError(codecError("read", err), "read", c, 0)
+	}
+	if _, err := io.Copy(io.Discard, reader); err != nil {
+		return counter.count, wrapError(&Error{Kind: ErrCorrupt, Err: err}, "read", c, 0)
+	}
+
+	err = c.mutate(Operation{Op: OpImport}, func() error {
+		if c.Type != "" && incoming.Type != "" && c.Type != incoming.Type {
+			return ErrInvalidType
+		}
+		c.replace(incoming)
+		return nil
+	})
+	return counter.count, err
+}
+
+// replace swaps the public fields of the Collection for those of incoming, and
+// rebuilds everything derived from them. It must be called while the
+// Collection is locked.
+func (c *Collection) replace(incoming *Collection) {
+	for _, document := range c.Items {
+		c.release(document)
+	}
+	for _, item := range c.Trash {
+		c.release(item.Document)
+	}
+
+	if incoming.Type == "" {
+		incoming.Type = c.Type
+	}
+	// Generations belong to the Datastore that wrote the stream, so every
+	// Document that was replaced or removed is recorded as a new change here
+	previous := c.index.Keys()
+	incoming.Generations = c.Generations
+
+	source := reflect.ValueOf(incoming).Elem()
+	target := reflect.ValueOf(c).Elem()
+	for i := 0; i < source.NumField(); i++ {
+		if source.Type().Field(i).PkgPath == "" {
+			target.Field(i).Set(source.Field(i))
+		}
+	}
+	if c.Items == nil {
+		c.Items = map[uint64]Document{}
+	}
+	if c.cache != nil {
+		c.cache.clear()
+	}
+	c.invalidateQueries()
+	c.dropSnapshot()
+
+	for _, document := range c.Items {
+		c.claim(document)
+	}
+	c.rebuildIndex()
+	for _, key := range previous {
+		c.changed(key)
+	}
+	for _, key := range c.index.Keys() {
+		c.changed(key)
+	}
+	for _, item := range c.Trash {
+		c.claim(item.Document)
+	}
+
+	if c.sizes != nil {
+		c.measureAll()
+	}
+	if c.fingerprints != nil {
+		c.fingerprintAll()
+	}
+
+	for _, v := range c.views {
+		v.mutex.Lock()
+		v.items = map[uint64]Document{}
+		v.list = []uint64{}
+		v.mutex.Unlock()
+		for _, key := range c.index.Keys() {
+			document, _ := c.item(key)
+			v.update(key, document)
+		}
+	}
+	c.audited(OpImport, 0)
+	c.markDirty(1)
+}
+
+// countingReader counts the bytes read through it.
+type countingReader struct {
+	reader io.Reader
+	count  int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.reader.Read(p)
+	c.count += int64(n)
+	return n, err
+}
@@ -0,0 +1,179 @@
+package datastore_test
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"git.stormbase.io/cbednarski/datastore"
+)
+
+func TestCollection_WriteTo(t *testing.T) {
+	tempdir, err := ioutil.TempDir("", "datastore")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempdir)
+
+	source, err := datastore.Create(filepath.Join(tempdir, "source"+datastore.Extension), TestdataSignature)
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := source.In("names")
+	for _, name := range []string{"alpha", "beta", "gamma"} {
+		if err := names.Upsert(&NameDocument{Name: name}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	buf := &bytes.Buffer{}
+	written, err := names.WriteTo(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if written != int64(buf.Len()) {
+		t.Errorf("Expected %d bytes written, found %d", buf.Len(), written)
+	}
+	encoded := buf.Bytes()
+
+	target, err := datastore.Create(filepath.Join(tempdir, "target"+datastore.Extension), TestdataSignature)
+	if err != nil {
+		t.Fatal(err)
+	}
+	moved := target.In("moved")
+	if err := moved.Upsert(&NameDocument{Name: "replaced"}); err != nil {
+		t.Fatal(err)
+	}
+	view, err := target.CreateView("moved-names", moved, func(d datastore.Document) datastore.Document {
+		return d
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	read, err := moved.ReadFrom(bytes.NewReader(encoded))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if read != int64(len(encoded)) {
+		t.Errorf("Expected %d bytes read, found %d", len(encoded), read)
+	}
+
+	if len(moved.List()) != 3 {
+		t.Errorf("Expected 3 documents, found %d", len(moved.List()))
+	}
+	if name := moved.FindKey(2).(*NameDocument).Name; name != "beta" {
+		t.Errorf("Expected %s, found %s", "beta", name)
+	}
+	if len(view.List()) != 3 {
+		t.Errorf("Expected view to be rebuilt with 3 documents, found %d", len(view.List()))
+	}
+	if !target.Dirty() {
+		t.Error("Expected datastore to be dirty after ReadFrom")
+	}
+
+	// New keys continue from the imported collection
+	next := &NameDocument{Name: "delta"}
+	if err := moved.Upsert(next); err != nil {
+		t.Fatal(err)
+	}
+	if next.ID() != 4 {
+		t.Errorf("Expected key 4, found %d", next.ID())
+	}
+
+	if err := target.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	reopened, err := datastore.Open(filepath.Join(tempdir, "target"+datastore.Extension), TestdataSignature)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(reopened.In("moved").List()) != 4 {
+		t.Errorf("Expected 4 documents after reopening, found %d", len(reopened.In("moved").List()))
+	}
+}
+
+func TestCollection_ReadFromErrors(t *testing.T) {
+	tempdir, err := ioutil.TempDir("", "datastore")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempdir)
+
+	source, err := datastore.Create(filepath.Join(tempdir, "source"+datastore.Extension), TestdataSignature)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := source.In("names").Upsert(&NameDocument{Name: "alpha"}); err != nil {
+		t.Fatal(err)
+	}
+	buf := &bytes.Buffer{}
+	if _, err := source.In("names").WriteTo(buf); err != nil {
+		t.Fatal(err)
+	}
+
+	other, err := datastore.Create(filepath.Join(tempdir, "other"+datastore.Extension), "other.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := other.In("names").ReadFrom(bytes.NewReader(buf.Bytes())); !errors.Is(err, datastore.ErrInvalidSignature) {
+		t.Errorf("Expected %s, found %v", datastore.ErrInvalidSignature, err)
+	}
+
+	numbers := source.In("numbers")
+	if err := numbers.Upsert(&NumberDocument{Number: 1}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := numbers.ReadFrom(bytes.NewReader(buf.Bytes())); !errors.Is(err, datastore.ErrInvalidType) {
+		t.Errorf("Expected %s, found %v", datastore.ErrInvalidType, err)
+	}
+	if len(numbers.List()) != 1 {
+		t.Errorf("Expected collection to be unchanged, found %d documents", len(numbers.List()))
+	}
+
+	if _, err := numbers.ReadFrom(bytes.NewReader([]byte("not a collection"))); !errors.Is(err, datastore.ErrCorrupt) {
+		t.Errorf("Expected %s, found %v", datastore.ErrCorrupt, err)
+	}
+}
+
+func TestDatastore_WriteTo(t *testing.T) {
+	source, err := datastore.Create(filepath.Join(t.TempDir(), "source"+datastore.Extension), TestdataSignature)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"alpha", "beta"} {
+		if err := source.In("names").Upsert(&NameDocument{Name: name}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	buf := &bytes.Buffer{}
+	written, err := source.WriteTo(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if written != int64(buf.Len()) {
+		t.Errorf("Expected %d bytes written, found %d", buf.Len(), written)
+	}
+	if !source.Dirty() {
+		t.Error("Expected WriteTo to leave the Datastore dirty")
+	}
+
+	decoded, err := datastore.Decode(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if decoded.Signature() != source.Signature() || len(decoded.In("names").List()) != 2 {
+		t.Errorf("Expected 2 names with signature %s, found %d with %s", source.Signature(), len(decoded.In("names").List()), decoded.Signature())
+	}
+
+	if err := source.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := source.WriteTo(buf); !errors.Is(err, datastore.ErrClosed) {
+		t.Errorf("Expected %s, found %v", datastore.ErrClosed, err)
+	}
+}
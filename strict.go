@@ -0,0 +1,48 @@
+package datastore
+
+// SetStrict turns on (or off) strict mode, a debug option for catching code
+// that shares Document pointers. In strict mode each Collection stores a copy of
+// every Document passed to Upsert, and every Find function returns new copies,
+// so no two callers (and no caller and the Collection) ever share a Document.
+//
+// Code that changes a Document without upserting it, or that relies on two
+// Finds returning the same pointer, behaves differently in strict mode, so
+// running your tests with strict mode on shows where that happens. Because
+// goroutines no longer share Documents, the race detector reports misuse in
+// your code rather than in datastore. Copies are made by encoding each
+// Document with Gob, which is slow, so only use strict mode in tests and
+// development.
+//
+// Strict mode does not apply to compressed Collections, which already store and
+// return copies.
+func (d *Datastore) SetStrict(strict bool) error {
+	d.strict.Store(strict)
+	if !strict {
+		return nil
+	}
+
+	// Detach the Documents that callers may already be holding
+	for _, c := range d.collections() {
+		c.mutex.Lock()
+		c.thaw()
+		if !c.Compressed {
+			for key, document := range c.Items {
+				copied, err := copyDocument(document)
+				if err != nil {
+					c.mutex.Unlock()
+					return wrapError(err, "set strict", c, key)
+				}
+				c.release(document)
+				c.Items[key] = copied
+			}
+		}
+		c.dropSnapshot()
+		c.mutex.Unlock()
+	}
+	return nil
+}
+
+// strict returns true if the Datastore is in strict mode. See SetStrict.
+func (c *Collection) strict() bool {
+	return c.store != nil && c.store.strict.Load()
+}
@@ -0,0 +1,55 @@
+package datastore_test
+
+import (
+	"testing"
+
+	"git.stormbase.io/cbednarski/datastore"
+)
+
+func TestDatastore_SetStrict(t *testing.T) {
+	ds := datastore.New()
+	names := ds.In("names")
+	retained := &NameDocument{Name: "before"}
+	names.Upsert(retained)
+
+	if err := ds.SetStrict(true); err != nil {
+		t.Fatal(err)
+	}
+
+	// Documents stored before strict mode are detached from callers
+	retained.Name = "changed"
+	if name := names.FindKey(1).(*NameDocument).Name; name != "before" {
+		t.Errorf("Expected %s, found %s", "before", name)
+	}
+
+	first := names.FindKey(1)
+	if first == names.FindKey(1) {
+		t.Error("Expected each find to return a copy")
+	}
+	first.(*NameDocument).Name = "not upserted"
+	if name := names.FindKey(1).(*NameDocument).Name; name != "before" {
+		t.Errorf("Expected %s, found %s", "before", name)
+	}
+
+	document := &NameDocument{Name: "new"}
+	names.Upsert(document)
+	document.Name = "not upserted"
+	if name := names.FindKey(2).(*NameDocument).Name; name != "new" {
+		t.Errorf("Expected %s, found %s", "new", name)
+	}
+
+	// Changes are still made through the Collection
+	first.(*NameDocument).Name = "upserted"
+	if err := names.Upsert(first); err != nil {
+		t.Fatal(err)
+	}
+	if name := names.FindOne(func(datastore.Document) bool { return true }).(*NameDocument).Name; name != "upserted" {
+		t.Errorf("Expected %s, found %s", "upserted", name)
+	}
+
+	// The same instance may be upserted into two Collections, since neither
+	// keeps it
+	if err := ds.In("copies").Upsert(document); err != nil {
+		t.Errorf("Expected upsert into a second collection to succeed, found %s", err)
+	}
+}
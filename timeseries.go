@@ -0,0 +1,264 @@
+package datastore
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// Point is a Document with a timestamp, for storing in a TimeSeries.
+type Point interface {
+	Document
+
+	// Timestamp is the time the Point was measured. It is used to order the
+	// Points in a TimeSeries and should not change once the Point is appended.
+	Timestamp() time.Time
+}
+
+// TimeSeries wraps a Collection of Points that are appended in (roughly) time
+// order, such as metrics history. It keeps the Points sorted by timestamp so
+// range queries do not need to scan the Collection, and it can discard old
+// Points automatically. See SetRetention.
+//
+// The time index is not written to disk. It is rebuilt from the Collection the
+// first time TimeSeries is called after Open. Add and remove Points using the
+// TimeSeries rather than the underlying Collection, or the index will not
+// include them.
+type TimeSeries struct {
+	collection *Collection
+
+	// maxPoints and maxAge are the retention limits. Zero means unlimited.
+	maxPoints int
+	maxAge    time.Duration
+
+	// index holds the key of each Point, sorted by timestamp and then key
+	index []timeKey
+	mutex sync.RWMutex
+}
+
+type timeKey struct {
+	time time.Time
+	key  uint64
+}
+
+func (t timeKey) before(other timeKey) bool {
+	if t.time.Equal(other.time) {
+		return t.key < other.key
+	}
+	return t.time.Before(other.time)
+}
+
+// TimeSeries returns a TimeSeries for the named Collection, creating the
+// Collection if necessary. Each Document already in the Collection must be a
+// Point, or TimeSeries returns ErrInvalidType. Calling TimeSeries again with the
+// same name returns the same TimeSeries.
+func (d *Datastore) TimeSeries(name string) (*TimeSeries, error) {
+	if err := d.checkOpen(); err != nil {
+		return nil, err
+	}
+	c := d.In(name)
+
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	if ts, ok := d.series[name]; ok {
+		return ts, nil
+	}
+
+	ts := &TimeSeries{collection: c}
+	for _, document := range c.FindAll(func(Document) bool { return true }) {
+		point, ok := document.(Point)
+		if !ok {
+			return nil, ErrInvalidType
+		}
+		ts.index = append(ts.index, timeKey{point.Timestamp(), point.ID()})
+	}
+	sort.Slice(ts.index, func(i, j int) bool {
+		return ts.index[i].before(ts.index[j])
+	})
+
+	if d.series == nil {
+		d.series = map[string]*TimeSeries{}
+	}
+	d.series[name] = ts
+	return ts, nil
+}
+
+// Collection returns the Collection that holds the Points.
+func (ts *TimeSeries) Collection() *Collection {
+	return ts.collection
+}
+
+// SetRetention limits the TimeSeries to the most recent points Points, and to
+// Points with a timestamp less than age ago. Use zero to disable either limit.
+// Older Points are deleted immediately, and again each time a Point is
+// appended. The retention limits are not written to disk.
+func (ts *TimeSeries) SetRetention(points int, age time.Duration) error {
+	ts.mutex.Lock()
+	ts.maxPoints = points
+	ts.maxAge = age
+	ts.mutex.Unlock()
+
+	_, err := ts.Trim()
+	return err
+}
+
+// Append adds the Point to the TimeSeries, and then deletes any Points outside
+// the retention limits. Appending a Point that has already been stored updates
+// it.
+func (ts *TimeSeries) Append(point Point) error {
+	ts.mutex.Lock()
+	defer ts.mutex.Unlock()
+
+	updated := point.ID() != 0
+	if err := ts.collection.Upsert(point); err != nil {
+		return err
+	}
+	if updated {
+		ts.removeKey(point.ID())
+	}
+
+	entry := timeKey{point.Timestamp(), point.ID()}
+	position := sort.Search(len(ts.index), func(i int) bool {
+		return entry.before(ts.index[i])
+	})
+	ts.index = append(ts.index, timeKey{})
+	copy(ts.index[position+1:], ts.index[position:])
+	ts.index[position] = entry
+
+	_, err := ts.trim()
+	return err
+}
+
+// Len returns the number of Points in the TimeSeries.
+func (ts *TimeSeries) Len() int {
+	ts.mutex.RLock()
+	defer ts.mutex.RUnlock()
+	return len(ts.index)
+}
+
+// Range returns the Points with a timestamp in the half-open interval [from,
+// to), in time order.
+func (ts *TimeSeries) Range(from, to time.Time) []Document {
+	ts.mutex.RLock()
+	defer ts.mutex.RUnlock()
+
+	start := sort.Search(len(ts.index), func(i int) bool {
+		return !ts.index[i].time.Before(from)
+	})
+
+	found := []Document{}
+	for _, entry := range ts.index[start:] {
+		if !entry.time.Before(to) {
+			break
+		}
+		if document := ts.collection.FindKey(entry.key); document != nil {
+			found = append(found, document)
+		}
+	}
+	return found
+}
+
+// Latest returns the n most recent Points, in time order.
+func (ts *TimeSeries) Latest(n int) []Document {
+	ts.mutex.RLock()
+	defer ts.mutex.RUnlock()
+
+	if n > len(ts.index) {
+		n = len(ts.index)
+	}
+
+	found := []Document{}
+	for _, entry := range ts.index[len(ts.index)-n:] {
+		if document := ts.collection.FindKey(entry.key); document != nil {
+			found = append(found, document)
+		}
+	}
+	return found
+}
+
+// Downsample divides [from, to) into buckets of the specified width and calls
+// reduce once for each bucket that contains Points, with the start of the bucket
+// and the Points in time order. The Documents returned by reduce are returned in
+// bucket order, and are not stored. If reduce returns nil the bucket is skipped.
+//
+// For example, to average per-second samples into one Point per minute:
+//
+//	ts.Downsample(from, to, time.Minute, func(start time.Time, points []datastore.Document) datastore.Document {
+//		sum := 0.0
+//		for _, point := range points {
+//			sum += point.(*Sample).Value
+//		}
+//		return &Sample{Time: start, Value: sum / float64(len(points))}
+//	})
+func (ts *TimeSeries) Downsample(from, to time.Time, width time.Duration, reduce func(start time.Time, points []Document) Document) []Document {
+	reduced := []Document{}
+	if width <= 0 {
+		return reduced
+	}
+
+	var bucket []Document
+	var start time.Time
+	flush := func() {
+		if len(bucket) > 0 {
+			if document := reduce(start, bucket); document != nil {
+				reduced = append(reduced, document)
+			}
+		}
+		bucket = nil
+	}
+
+	for _, document := range ts.Range(from, to) {
+		offset := document.(Point).Timestamp().Sub(from)
+		bucketStart := from.Add(offset - offset%width)
+		if len(bucket) > 0 && !bucketStart.Equal(start) {
+			flush()
+		}
+		start = bucketStart
+		bucket = append(bucket, document)
+	}
+	flush()
+	return reduced
+}
+
+// Trim deletes the Points outside the retention limits and returns the number
+// of Points deleted.
+func (ts *TimeSeries) Trim() (int, error) {
+	ts.mutex.Lock()
+	defer ts.mutex.Unlock()
+	return ts.trim()
+}
+
+// trim must be called while the TimeSeries is locked.
+func (ts *TimeSeries) trim() (int, error) {
+	expired := 0
+	if ts.maxPoints > 0 && len(ts.index) > ts.maxPoints {
+		expired = len(ts.index) - ts.maxPoints
+	}
+	if ts.maxAge > 0 {
+		cutoff := ts.collection.now().Add(-ts.maxAge)
+		for expired < len(ts.index) && ts.index[expired].time.Before(cutoff) {
+			expired++
+		}
+	}
+
+	for i := 0; i < expired; i++ {
+		if err := ts.collection.DeleteKey(ts.index[i].key); err != nil {
+			ts.index = ts.index[i:]
+			return i, err
+		}
+	}
+	ts.index = ts.index[expired:]
+	return expired, nil
+}
+
+// removeKey removes the key from the index. It must be called while the
+// TimeSeries is locked.
+func (ts *TimeSeries) removeKey(key uint64) {
+	for i, entry := range ts.index {
+		if entry.key == key {
+			ts.index = append(ts.index[:i], ts.index[i+1:]...)
+			return
+		}
+	}
+}
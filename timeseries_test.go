@@ -0,0 +1,87 @@
+package datastore_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"git.stormbase.io/cbednarski/datastore"
+)
+
+func TestTimeSeries(t *testing.T) {
+	ds := datastore.New()
+	ts, err := ds.TimeSeries("cpu")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Now().Truncate(time.Minute).Add(-time.Hour)
+	// Append out of order to make sure the index is sorted by time
+	for _, i := range []int{0, 1, 2, 5, 3, 4, 6, 7, 8, 9} {
+		sample := &SampleDocument{Time: start.Add(time.Duration(i) * time.Second), Value: float64(i)}
+		if err := ts.Append(sample); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	found := ts.Range(start.Add(2*time.Second), start.Add(6*time.Second))
+	if len(found) != 4 {
+		t.Fatalf("Expected 4 samples, found %d", len(found))
+	}
+	for i, document := range found {
+		if value := document.(*SampleDocument).Value; value != float64(i+2) {
+			t.Errorf("Expected %d, found %f", i+2, value)
+		}
+	}
+
+	latest := ts.Latest(2)
+	if len(latest) != 2 || latest[1].(*SampleDocument).Value != 9 {
+		t.Errorf("Expected the last two samples, found %#v", latest)
+	}
+
+	averages := ts.Downsample(start, start.Add(time.Minute), 5*time.Second, func(bucket time.Time, points []datastore.Document) datastore.Document {
+		sum := 0.0
+		for _, point := range points {
+			sum += point.(*SampleDocument).Value
+		}
+		return &SampleDocument{Time: bucket, Value: sum / float64(len(points))}
+	})
+	if len(averages) != 2 {
+		t.Fatalf("Expected 2 buckets, found %d", len(averages))
+	}
+	if value := averages[1].(*SampleDocument).Value; value != 7 {
+		t.Errorf("Expected 7, found %f", value)
+	}
+
+	if err := ts.SetRetention(4, 0); err != nil {
+		t.Fatal(err)
+	}
+	if ts.Len() != 4 || len(ts.Collection().List()) != 4 {
+		t.Errorf("Expected 4 samples, found %d", ts.Len())
+	}
+	if first := ts.Latest(4)[0].(*SampleDocument).Value; first != 6 {
+		t.Errorf("Expected oldest sample to be 6, found %f", first)
+	}
+
+	if err := ts.SetRetention(0, 30*time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	if ts.Len() != 0 {
+		t.Errorf("Expected samples older than 30 minutes to be removed, found %d", ts.Len())
+	}
+
+	again, err := ds.TimeSeries("cpu")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again != ts {
+		t.Error("Expected the same TimeSeries")
+	}
+
+	if err := ds.In("names").Upsert(&NameDocument{Name: "not a point"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ds.TimeSeries("names"); !errors.Is(err, datastore.ErrInvalidType) {
+		t.Errorf("Expected %s, found %s", datastore.ErrInvalidType, err)
+	}
+}
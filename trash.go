@@ -0,0 +1,101 @@
+package datastore
+
+import (
+	"sort"
+	"time"
+)
+
+// TrashItem holds a Document that has been soft deleted.
+type TrashItem struct {
+	// Document is the Document that was deleted. It keeps its ID so it can be
+	// restored under the same key.
+	Document Document
+
+	// Time is when the Document was deleted.
+	Time time.Time
+}
+
+// SoftDelete moves the Document from the Collection into the trash. Documents
+// in the trash are excluded from Find operations and List, but keep their ID and
+// may be returned to the Collection by calling Restore. The trash is written to
+// disk along with the rest of the Collection.
+func (c *Collection) SoftDelete(document Document) error {
+	key := document.ID()
+	return c.mutate(Operation{Op: OpSoftDelete, Key: key, Document: document}, func() error {
+		document, ok := c.item(key)
+		if !ok || key == 0 {
+			return ErrKeyNotFound
+		}
+
+		if c.Trash == nil {
+			c.Trash = map[uint64]TrashItem{}
+		}
+		c.Trash[key] = TrashItem{
+			Document: document,
+			Time:     c.now(),
+		}
+
+		delete(c.Items, key)
+		delete(c.Checksums, key)
+		c.uncache(key)
+		c.index.Delete(key)
+		c.deleted(OpSoftDelete, key)
+		return nil
+	})
+}
+
+// Restore moves the Document with the specified key out of the trash and back
+// into the Collection, and returns it. Restore fails with ErrKeyExists if
+// another Document has been stored under the same key in the meantime.
+func (c *Collection) Restore(key uint64) (restored Document, err error) {
+	err = c.mutate(Operation{Op: OpRestore, Key: key}, func() error {
+		item, ok := c.Trash[key]
+		if !ok {
+			return ErrKeyNotFound
+		}
+		if _, ok := c.Items[key]; ok {
+			return ErrKeyExists
+		}
+
+		if _, err := c.upsert(OpRestore, item.Document); err != nil {
+			return err
+		}
+		delete(c.Trash, key)
+		restored = item.Document
+		return nil
+	})
+	return restored, err
+}
+
+// TrashList returns a sorted list of keys (in ascending order) for all Documents
+// currently in the trash.
+func (c *Collection) TrashList() []uint64 {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	list := make([]uint64, 0, len(c.Trash))
+	for key := range c.Trash {
+		list = append(list, key)
+	}
+	sort.Sort(UIntSlice(list))
+	return list
+}
+
+// PurgeTrash permanently removes Documents that were soft deleted more than
+// olderThan ago, and returns the number of Documents removed. Use zero to empty
+// the trash.
+func (c *Collection) PurgeTrash(olderThan time.Duration) (purged int, err error) {
+	err = c.mutate(Operation{Op: OpPurge}, func() error {
+		cutoff := c.now().Add(-olderThan)
+		for key, item := range c.Trash {
+			if !item.Time.After(cutoff) {
+				c.release(item.Document)
+				delete(c.Trash, key)
+				purged++
+			}
+		}
+		c.markDirty(purged)
+		return nil
+	})
+	return purged, err
+}
@@ -0,0 +1,95 @@
+package datastore_test
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"git.stormbase.io/cbednarski/datastore"
+)
+
+func TestCollection_SoftDelete(t *testing.T) {
+	ds := datastore.New()
+	cakes := ds.In("cakes")
+
+	chocolate := &NameDocument{Name: "chocolate"}
+	vanilla := &NameDocument{Name: "vanilla"}
+	for _, cake := range []*NameDocument{chocolate, vanilla} {
+		if err := cakes.Upsert(cake); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := cakes.SoftDelete(&NameDocument{Identifier: 60}); !errors.Is(err, datastore.ErrKeyNotFound) {
+		t.Errorf("Expected %s, found %s", datastore.ErrKeyNotFound, err)
+	}
+
+	if err := cakes.SoftDelete(chocolate); err != nil {
+		t.Fatal(err)
+	}
+
+	if cakes.FindKey(chocolate.ID()) != nil {
+		t.Errorf("Expected soft deleted document to be excluded from FindKey")
+	}
+	expected := []uint64{2}
+	if !reflect.DeepEqual(cakes.List(), expected) {
+		t.Errorf("Expected %#v, found %#v", expected, cakes.List())
+	}
+	expected = []uint64{1}
+	if !reflect.DeepEqual(cakes.TrashList(), expected) {
+		t.Errorf("Expected %#v, found %#v", expected, cakes.TrashList())
+	}
+
+	// New documents don't reuse the key of a document in the trash
+	strawberry := &NameDocument{Name: "strawberry"}
+	if err := cakes.Upsert(strawberry); err != nil {
+		t.Fatal(err)
+	}
+	if strawberry.ID() != 3 {
+		t.Errorf("Expected ID 3, found %d", strawberry.ID())
+	}
+
+	restored, err := cakes.Restore(chocolate.ID())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if restored != chocolate {
+		t.Errorf("Expected %#v, found %#v", chocolate, restored)
+	}
+	expected = []uint64{1, 2, 3}
+	if !reflect.DeepEqual(cakes.List(), expected) {
+		t.Errorf("Expected %#v, found %#v", expected, cakes.List())
+	}
+
+	if _, err := cakes.Restore(chocolate.ID()); !errors.Is(err, datastore.ErrKeyNotFound) {
+		t.Errorf("Expected %s, found %s", datastore.ErrKeyNotFound, err)
+	}
+
+	// Restoring a key that has been reused fails
+	if err := cakes.SoftDelete(vanilla); err != nil {
+		t.Fatal(err)
+	}
+	if err := cakes.Upsert(&NameDocument{Identifier: vanilla.ID(), Name: "french vanilla"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := cakes.Restore(vanilla.ID()); !errors.Is(err, datastore.ErrKeyExists) {
+		t.Errorf("Expected %s, found %s", datastore.ErrKeyExists, err)
+	}
+
+	cakes.SetReadOnly(true)
+	if _, err := cakes.PurgeTrash(0); !errors.Is(err, datastore.ErrReadOnly) {
+		t.Errorf("Expected %s, found %v", datastore.ErrReadOnly, err)
+	}
+	cakes.SetReadOnly(false)
+
+	if purged, err := cakes.PurgeTrash(time.Hour); err != nil || purged != 0 {
+		t.Errorf("Expected nothing to be purged, found %d (%v)", purged, err)
+	}
+	if purged, err := cakes.PurgeTrash(0); err != nil || purged != 1 {
+		t.Errorf("Expected 1 to be purged, found %d (%v)", purged, err)
+	}
+	if len(cakes.TrashList()) != 0 {
+		t.Errorf("Expected trash to be empty, found %#v", cakes.TrashList())
+	}
+}
@@ -0,0 +1,61 @@
+package datastore
+
+import "runtime/debug"
+
+// Trim releases memory the Datastore can do without, for programs that run for
+// a long time on small devices. Call it when memory is short, for example when
+// a container is near its limit. Trim:
+//
+//   - empties the cache of each compressed Collection (see SetCacheSize)
+//   - throws away the cached results of queries (see DefineQuery)
+//   - shrinks the key list and the map of Documents of each Collection to fit,
+//     since neither shrinks on its own after Documents are deleted
+//   - runs the garbage collector and returns as much memory to the operating
+//     system as possible, with debug.FreeOSMemory
+//
+// Nothing is lost: caches are refilled as they are used. Each Collection is
+// locked while it is trimmed, and Trim is slow on a large Datastore, so don't
+// call it routinely.
+func (d *Datastore) Trim() {
+	for _, c := range d.collections() {
+		c.trim()
+	}
+	debug.FreeOSMemory()
+}
+
+// trimmer is implemented by KeyIndexes that can release memory.
+type trimmer interface {
+	trim()
+}
+
+func (c *Collection) trim() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.cache != nil {
+		c.cache.clear()
+	}
+	c.invalidateQueries()
+	c.dropSnapshot()
+	if index, ok := c.index.(trimmer); ok {
+		index.trim()
+	}
+
+	items := make(map[uint64]Document, len(c.Items))
+	for key, document := range c.Items {
+		items[key] = document
+	}
+	c.Items = items
+}
+
+func (s *sliceIndex) trim() {
+	if cap(s.keys) > len(s.keys) {
+		keys := make([]uint64, len(s.keys))
+		copy(keys, s.keys)
+		s.keys = keys
+	}
+}
+
+func (t *treeIndex) trim() {
+	t.invalidate()
+}
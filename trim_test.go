@@ -0,0 +1,41 @@
+package datastore_test
+
+import (
+	"reflect"
+	"testing"
+
+	"git.stormbase.io/cbednarski/datastore"
+)
+
+func TestTrim(t *testing.T) {
+	ds := datastore.New()
+	names := ds.In("names")
+	if err := names.SetCompressed(true); err != nil {
+		t.Fatal(err)
+	}
+	names.SetCacheSize(10)
+	for i := 0; i < 100; i++ {
+		if err := names.Upsert(&NameDocument{Name: "name"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for key := uint64(1); key <= 90; key++ {
+		if err := names.DeleteKey(key); err != nil {
+			t.Fatal(err)
+		}
+	}
+	names.FindKey(95)
+
+	ds.Trim()
+
+	if stats := names.CacheStats(); stats.Size != 0 {
+		t.Errorf("Expected empty cache, found %d", stats.Size)
+	}
+	expected := []uint64{91, 92, 93, 94, 95, 96, 97, 98, 99, 100}
+	if !reflect.DeepEqual(names.List(), expected) {
+		t.Errorf("Expected %v, found %v", expected, names.List())
+	}
+	if found := names.FindKey(95); found == nil || found.(*NameDocument).Name != "name" {
+		t.Errorf("Expected document 95, found %v", found)
+	}
+}
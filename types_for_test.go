@@ -1,6 +1,11 @@
 package datastore_test
 
-import "encoding/gob"
+import (
+	"encoding/gob"
+	"time"
+
+	"git.stormbase.io/cbednarski/datastore"
+)
 
 type NameDocument struct {
 	Identifier uint64
@@ -28,9 +33,67 @@ func (n *NumberDocument) SetID(id uint64) {
 	n.Identifier = id
 }
 
+type AccountDocument struct {
+	Identifier uint64
+	Name       string
+	Email      string
+	Token      string `datastore:"redact"`
+	Tags       []string
+	Profile    AccountProfile
+}
+
+type AccountProfile struct {
+	Bio      string
+	Password string `datastore:"redact" json:"password"`
+}
+
+func (a *AccountDocument) ID() uint64 {
+	return a.Identifier
+}
+
+func (a *AccountDocument) SetID(id uint64) {
+	a.Identifier = id
+}
+
+type SampleDocument struct {
+	Identifier uint64
+	Time       time.Time
+	Value      float64
+}
+
+func (s *SampleDocument) ID() uint64 {
+	return s.Identifier
+}
+
+func (s *SampleDocument) SetID(id uint64) {
+	s.Identifier = id
+}
+
+func (s *SampleDocument) Timestamp() time.Time {
+	return s.Time
+}
+
+type PetDocument struct {
+	Identifier uint64
+	Name       string
+	Owner      datastore.Ref[*NameDocument]
+	Friends    []datastore.Ref[*PetDocument]
+}
+
+func (p *PetDocument) ID() uint64 {
+	return p.Identifier
+}
+
+func (p *PetDocument) SetID(id uint64) {
+	p.Identifier = id
+}
+
 func init() {
 	gob.Register(&NameDocument{})
 	gob.Register(&NumberDocument{})
+	gob.Register(&AccountDocument{})
+	gob.Register(&SampleDocument{})
+	gob.Register(&PetDocument{})
 	// InvalidDocument is NOT to be included in the init func because it is
 	// specifically used in tests where we check what happens when we don't
 	// do this.
@@ -0,0 +1,66 @@
+package datastore
+
+import "crypto/sha256"
+
+// SetSkipUnchanged makes Upsert skip Documents that have not changed. When a
+// Document is upserted under a key that already exists and the fields Flush
+// writes are the same as when that key was last changed, the Collection stores
+// the incoming instance but otherwise treats the Upsert as a no-op: the
+// Datastore is not marked dirty, and no history, audit entry, version, or
+// change is recorded. This keeps periodic jobs that rewrite the same data from
+// causing a Flush.
+//
+// The Collection keeps a fingerprint of each Document while this is enabled.
+// Documents that can not be encoded are always treated as changed. The
+// setting is not written to disk, so call SetSkipUnchanged again after Open.
+func (c *Collection) SetSkipUnchanged(enabled bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.fingerprints = nil
+	if enabled {
+		c.fingerprintAll()
+	}
+}
+
+// fingerprintAll replaces the fingerprints of every Document. It must be called
+// while the Collection is locked.
+func (c *Collection) fingerprintAll() {
+	c.fingerprints = map[uint64][sha256.Size]byte{}
+	for _, key := range c.index.Keys() {
+		document, _ := c.item(key)
+		c.fingerprint(key, document)
+	}
+}
+
+// fingerprint records the fingerprint of a Document that has been stored, if
+// SetSkipUnchanged is enabled. It must be called while the Collection is
+// locked.
+func (c *Collection) fingerprint(key uint64, document Document) {
+	if c.fingerprints == nil {
+		return
+	}
+	encoded, err := stableEncoding(document)
+	if err != nil {
+		delete(c.fingerprints, key)
+		return
+	}
+	c.fingerprints[key] = sha256.Sum256(encoded)
+}
+
+// unchanged returns true if the Document matches the fingerprint recorded for
+// its key. It must be called while the Collection is locked.
+func (c *Collection) unchanged(document Document) bool {
+	if c.fingerprints == nil {
+		return false
+	}
+	recorded, ok := c.fingerprints[document.ID()]
+	if !ok {
+		return false
+	}
+	encoded, err := stableEncoding(document)
+	if err != nil {
+		return false
+	}
+	return sha256.Sum256(encoded) == recorded
+}
@@ -0,0 +1,107 @@
+package datastore_test
+
+import (
+	"testing"
+
+	"git.stormbase.io/cbednarski/datastore"
+)
+
+func TestCollection_SetSkipUnchanged(t *testing.T) {
+	ds := datastore.New()
+	names := ds.In("names")
+
+	original := &NameDocument{Name: "bob"}
+	if err := names.Upsert(original); err != nil {
+		t.Fatal(err)
+	}
+	names.SetSkipUnchanged(true)
+	pending := ds.PendingChanges()
+
+	// A new instance with the same content is stored without a change
+	refreshed := &NameDocument{Name: "bob"}
+	refreshed.SetID(original.ID())
+	previous, err := names.UpsertReturning(refreshed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if previous != original {
+		t.Errorf("Expected %v, found %v", original, previous)
+	}
+	if names.FindKey(original.ID()) != refreshed {
+		t.Error("Expected the refreshed instance to be stored")
+	}
+	if ds.PendingChanges() != pending {
+		t.Errorf("Expected %d pending changes, found %d", pending, ds.PendingChanges())
+	}
+
+	// Changing the stored instance in place is still a change
+	refreshed.Name = "alice"
+	if err := names.Upsert(refreshed); err != nil {
+		t.Fatal(err)
+	}
+	if ds.PendingChanges() != pending+1 {
+		t.Errorf("Expected %d pending changes, found %d", pending+1, ds.PendingChanges())
+	}
+
+	names.SetSkipUnchanged(false)
+	if err := names.Upsert(refreshed); err != nil {
+		t.Fatal(err)
+	}
+	if ds.PendingChanges() != pending+2 {
+		t.Errorf("Expected %d pending changes, found %d", pending+2, ds.PendingChanges())
+	}
+}
+
+type TokenDocument struct {
+	Identifier uint64
+	Name       string
+	Token      string `json:"-"`
+}
+
+func (t *TokenDocument) ID() uint64 {
+	return t.Identifier
+}
+
+func (t *TokenDocument) SetID(id uint64) {
+	t.Identifier = id
+}
+
+func TestCollection_SetSkipUnchangedHiddenField(t *testing.T) {
+	ds := datastore.New()
+	tokens := ds.In("tokens")
+	tokens.SetSkipUnchanged(true)
+
+	if err := tokens.Upsert(&TokenDocument{Name: "bob", Token: "old"}); err != nil {
+		t.Fatal(err)
+	}
+	pending := ds.PendingChanges()
+
+	// Token is not in the JSON encoding, but it is written by Flush
+	if err := tokens.Upsert(&TokenDocument{Identifier: 1, Name: "bob", Token: "new"}); err != nil {
+		t.Fatal(err)
+	}
+	if ds.PendingChanges() != pending+1 {
+		t.Errorf("Expected %d pending changes, found %d", pending+1, ds.PendingChanges())
+	}
+}
+
+func TestCollection_SetSkipUnchangedMap(t *testing.T) {
+	ds := datastore.New()
+	rich := ds.In("rich")
+	rich.SetSkipUnchanged(true)
+
+	labels := map[string]int{"a": 1, "b": 2, "c": 3, "d": 4, "e": 5}
+	if err := rich.Upsert(&RichDocument{Labels: labels}); err != nil {
+		t.Fatal(err)
+	}
+	pending := ds.PendingChanges()
+
+	for i := 0; i < 10; i++ {
+		if err := rich.Upsert(&RichDocument{Identifier: 1, Labels: labels}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if ds.PendingChanges() != pending {
+		t.Errorf("Expected %d pending changes, found %d", pending, ds.PendingChanges())
+	}
+}
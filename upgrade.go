@@ -0,0 +1,205 @@
+package datastore
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"sync"
+)
+
+// upgrade converts a Collection from one schema version to another.
+type upgrade struct {
+	from, to int
+	fn       func(*Collection) error
+}
+
+var upgrades = map[string][]upgrade{}
+var upgradesMutex sync.Mutex
+
+// RegisterUpgrade registers fn to upgrade the named Collection from schema
+// version from to schema version to. Each Collection stores its own schema
+// version, so a Collection can evolve without changing the Datastore's
+// signature and invalidating the whole file.
+//
+// Upgrades run during Open, in sequence, until no upgrade is registered for the
+// Collection's current schema version. fn may use the Collection normally (for
+// example by calling FindAll and Upsert). If fn returns an error, Open fails.
+// Collections created with In start at the highest registered schema version,
+// so upgrades never run on new data.
+//
+// Like gob.Register, RegisterUpgrade should be called from an init func.
+//
+//	datastore.RegisterUpgrade("pets", 0, 1, func(c *datastore.Collection) error {
+//		for _, doc := range c.FindAll(func(datastore.Document) bool { return true }) {
+//			pet := doc.(*Pet)
+//			pet.Name = strings.TrimSpace(pet.Name)
+//			if err := c.Upsert(pet); err != nil {
+//				return err
+//			}
+//		}
+//		return nil
+//	})
+func RegisterUpgrade(collection string, from, to int, fn func(*Collection) error) {
+	if to <= from {
+		panic(fmt.Sprintf("datastore: upgrade for %q must increase the schema version (%d to %d)", collection, from, to))
+	}
+
+	upgradesMutex.Lock()
+	defer upgradesMutex.Unlock()
+
+	for _, u := range upgrades[collection] {
+		if u.from == from {
+			panic(fmt.Sprintf("datastore: duplicate upgrade for %q from schema version %d", collection, from))
+		}
+	}
+	upgrades[collection] = append(upgrades[collection], upgrade{from: from, to: to, fn: fn})
+}
+
+// latestSchemaVersion returns the highest schema version registered for the
+// named Collection, or zero if it has no upgrades.
+func latestSchemaVersion(collection string) int {
+	upgradesMutex.Lock()
+	defer upgradesMutex.Unlock()
+
+	latest := 0
+	for _, u := range upgrades[collection] {
+		if u.to > latest {
+			latest = u.to
+		}
+	}
+	return latest
+}
+
+// findUpgrade returns the upgrade for the named Collection that starts at the
+// specified schema version.
+func findUpgrade(collection string, from int) (upgrade, bool) {
+	upgradesMutex.Lock()
+	defer upgradesMutex.Unlock()
+
+	for _, u := range upgrades[collection] {
+		if u.from == from {
+			return u, true
+		}
+	}
+	return upgrade{}, false
+}
+
+// upgrade runs the registered upgrades for the Collection until it reaches the
+// latest schema version.
+func (c *Collection) upgrade() error {
+	for {
+		c.mutex.RLock()
+		version := c.SchemaVersion
+		c.mutex.RUnlock()
+
+		u, ok := findUpgrade(c.name, version)
+		if !ok {
+			return nil
+		}
+
+		if err := u.fn(c); err != nil {
+			return fmt.Errorf("from schema version %d to %d: %w", u.from, u.to, err)
+		}
+
+		c.mutex.Lock()
+		c.SchemaVersion = u.to
+		c.markDirty(1)
+		c.mutex.Unlock()
+
+		c.store.emit(Event{Type: EventMigration, Collection: c.name})
+	}
+}
+
+// PlannedUpgrade describes an upgrade that would run the next time a Datastore
+// is opened. See PlanUpgrades.
+type PlannedUpgrade struct {
+	// Collection is the name of the Collection that would be upgraded.
+	Collection string
+
+	// From and To are the schema versions before and after the upgrade.
+	From, To int
+
+	// Documents is the number of Documents the upgrade would insert, change,
+	// or delete.
+	Documents int
+
+	// Err is the error returned by the upgrade, if it failed. Upgrades after a
+	// failed upgrade are not planned.
+	Err error
+}
+
+// PlanUpgrades reports which registered upgrades would run when the Datastore
+// at path is opened, and how many Documents each would touch, without changing
+// the file. The upgrades are run against a private copy of the Datastore which
+// is discarded afterward, so the plan reflects exactly what Open would do.
+// Upgrades are planned in order of Collection name.
+func PlanUpgrades(path, signature string) ([]PlannedUpgrade, error) {
+	ds, err := open(path, signature)
+	if err != nil {
+		return nil, err
+	}
+
+	names := make([]string, 0, len(ds.Collections))
+	for name := range ds.Collections {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	plan := []PlannedUpgrade{}
+	for _, name := range names {
+		c := ds.Collections[name]
+		for {
+			u, ok := findUpgrade(name, c.SchemaVersion)
+			if !ok {
+				break
+			}
+
+			planned := PlannedUpgrade{Collection: name, From: u.from, To: u.to}
+			before, err := c.copyAll()
+			if err != nil {
+				return nil, err
+			}
+			if planned.Err = u.fn(c); planned.Err != nil {
+				plan = append(plan, planned)
+				break
+			}
+			after, err := c.copyAll()
+			if err != nil {
+				return nil, err
+			}
+
+			for key, document := range after {
+				if !reflect.DeepEqual(document, before[key]) {
+					planned.Documents++
+				}
+			}
+			for key := range before {
+				if _, ok := after[key]; !ok {
+					planned.Documents++
+				}
+			}
+
+			c.SchemaVersion = u.to
+			plan = append(plan, planned)
+		}
+	}
+	return plan, nil
+}
+
+// copyAll copies every Document in the Collection, by key. The copies are
+// compared with reflect.DeepEqual rather than by their encoding, because Gob
+// writes maps in random order.
+func (c *Collection) copyAll() (map[uint64]Document, error) {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	copied := make(map[uint64]Document, len(c.Items))
+	for key, document := range c.Items {
+		document, err := copyDocument(document)
+		if err != nil {
+			return nil, err
+		}
+		copied[key] = document
+	}
+	return copied, nil
+}
@@ -0,0 +1,227 @@
+package datastore_test
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"git.stormbase.io/cbednarski/datastore"
+)
+
+func TestRegisterUpgrade(t *testing.T) {
+	tempdir, err := ioutil.TempDir("", "datastore")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempdir)
+
+	datapath := filepath.Join(tempdir, "upgrade"+datastore.Extension)
+	ds, err := datastore.Create(datapath, TestdataSignature)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	const collection = "upgrade-test-names"
+	for _, name := range []string{"  chocolate", "vanilla  "} {
+		if err := ds.In(collection).Upsert(&NameDocument{Name: name}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := ds.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	datastore.RegisterUpgrade(collection, 1, 2, func(c *datastore.Collection) error {
+		for _, doc := range c.FindAll(func(datastore.Document) bool { return true }) {
+			name := doc.(*NameDocument)
+			name.Name = strings.ToUpper(name.Name)
+			if err := c.Upsert(name); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	datastore.RegisterUpgrade(collection, 0, 1, func(c *datastore.Collection) error {
+		for _, doc := range c.FindAll(func(datastore.Document) bool { return true }) {
+			name := doc.(*NameDocument)
+			name.Name = strings.TrimSpace(name.Name)
+			if err := c.Upsert(name); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+
+	migrations := 0
+	unsubscribe := datastore.Subscribe(func(e datastore.Event) {
+		if e.Type == datastore.EventMigration && e.Collection == collection {
+			migrations++
+		}
+	})
+	defer unsubscribe()
+
+	ds, err = datastore.Open(datapath, TestdataSignature)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	names := ds.In(collection)
+	if names.SchemaVersion != 2 {
+		t.Errorf("Expected schema version 2, found %d", names.SchemaVersion)
+	}
+	if migrations != 2 {
+		t.Errorf("Expected 2 migration events, found %d", migrations)
+	}
+	if name := names.FindKey(1).(*NameDocument).Name; name != "CHOCOLATE" {
+		t.Errorf("Expected CHOCOLATE, found %q", name)
+	}
+	if !ds.Dirty() {
+		t.Error("Expected upgraded datastore to be dirty")
+	}
+
+	// New collections start at the latest version
+	fresh := datastore.New().In(collection)
+	if fresh.SchemaVersion != 2 {
+		t.Errorf("Expected schema version 2, found %d", fresh.SchemaVersion)
+	}
+}
+
+func TestRegisterUpgradeError(t *testing.T) {
+	tempdir, err := ioutil.TempDir("", "datastore")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempdir)
+
+	datapath := filepath.Join(tempdir, "upgrade"+datastore.Extension)
+	ds, err := datastore.Create(datapath, TestdataSignature)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	const collection = "upgrade-test-error"
+	ds.In(collection)
+	if err := ds.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	errBroken := errors.New("broken")
+	datastore.RegisterUpgrade(collection, 0, 1, func(c *datastore.Collection) error {
+		return errBroken
+	})
+
+	if _, err := datastore.Open(datapath, TestdataSignature); !errors.Is(err, errBroken) {
+		t.Errorf("Expected %s, found %s", errBroken, err)
+	}
+}
+
+func TestPlanUpgrades(t *testing.T) {
+	tempdir, err := ioutil.TempDir("", "datastore")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempdir)
+
+	datapath := filepath.Join(tempdir, "plan"+datastore.Extension)
+	ds, err := datastore.Create(datapath, TestdataSignature)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	const collection = "upgrade-test-plan"
+	for _, number := range []int{1, 2, 3, 4} {
+		if err := ds.In(collection).Upsert(&NumberDocument{Number: number}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := ds.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Double the even numbers
+	datastore.RegisterUpgrade(collection, 0, 1, func(c *datastore.Collection) error {
+		for _, doc := range c.FindAll(func(datastore.Document) bool { return true }) {
+			number := doc.(*NumberDocument)
+			if number.Number%2 == 0 {
+				if _, err := c.Increment(number.ID(), "Number", int64(number.Number)); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+	errBroken := errors.New("broken")
+	datastore.RegisterUpgrade(collection, 1, 3, func(c *datastore.Collection) error {
+		return errBroken
+	})
+
+	plan, err := datastore.PlanUpgrades(datapath, TestdataSignature)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(plan) != 2 {
+		t.Fatalf("Expected 2 planned upgrades, found %#v", plan)
+	}
+	if plan[0].Collection != collection || plan[0].From != 0 || plan[0].To != 1 || plan[0].Documents != 2 || plan[0].Err != nil {
+		t.Errorf("Expected upgrade from 0 to 1 touching 2 documents, found %#v", plan[0])
+	}
+	if plan[1].From != 1 || plan[1].To != 3 || plan[1].Err != errBroken {
+		t.Errorf("Expected failed upgrade from 1 to 3, found %#v", plan[1])
+	}
+
+	// The file is unchanged, so the same upgrades are planned again
+	again, err := datastore.PlanUpgrades(datapath, TestdataSignature)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(again) != 2 || again[0].Documents != 2 {
+		t.Errorf("Expected the same plan, found %#v", again)
+	}
+}
+
+func TestPlanUpgradesUnchangedMaps(t *testing.T) {
+	tempdir, err := ioutil.TempDir("", "datastore")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempdir)
+
+	datapath := filepath.Join(tempdir, "plan"+datastore.Extension)
+	ds, err := datastore.Create(datapath, TestdataSignature)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	const collection = "upgrade-test-plan-maps"
+	labels := map[string]int{}
+	for i := 0; i < 20; i++ {
+		labels[fmt.Sprintf("label-%d", i)] = i
+	}
+	for i := 0; i < 5; i++ {
+		if err := ds.In(collection).Upsert(&RichDocument{Labels: labels}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := ds.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	// An upgrade that only bumps the schema version touches no documents, even
+	// though Gob encodes the maps in a different order each time
+	datastore.RegisterUpgrade(collection, 0, 1, func(c *datastore.Collection) error {
+		return nil
+	})
+
+	plan, err := datastore.PlanUpgrades(datapath, TestdataSignature)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(plan) != 1 || plan[0].Documents != 0 {
+		t.Errorf("Expected one upgrade touching no documents, found %#v", plan)
+	}
+}
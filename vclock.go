@@ -0,0 +1,284 @@
+package datastore
+
+import (
+	"reflect"
+	"sort"
+)
+
+// VersionVector counts the changes each replica has made to a Document. It is
+// maintained by Collections that have a replica name. See SetReplica.
+type VersionVector map[string]uint64
+
+// Ordering describes how two VersionVectors are related. See Compare.
+type Ordering int
+
+const (
+	// Equal means both versions have seen the same changes.
+	Equal Ordering = iota
+
+	// Before means this version is older: the other version has seen every
+	// change this one has, and more.
+	Before
+
+	// After means this version is newer: it has seen every change the other
+	// version has, and more.
+	After
+
+	// Concurrent means each version has changes the other has not seen, so
+	// the versions are in conflict.
+	Concurrent
+)
+
+// Compare reports whether v is Equal to, Before, After, or Concurrent with
+// other.
+func (v VersionVector) Compare(other VersionVector) Ordering {
+	older, newer := false, false
+	for replica, count := range v {
+		if count > other[replica] {
+			newer = true
+		}
+	}
+	for replica, count := range other {
+		if count > v[replica] {
+			older = true
+		}
+	}
+
+	switch {
+	case older && newer:
+		return Concurrent
+	case older:
+		return Before
+	case newer:
+		return After
+	}
+	return Equal
+}
+
+// merge returns a new VersionVector that has seen every change seen by v or
+// other.
+func (v VersionVector) merge(other VersionVector) VersionVector {
+	merged := make(VersionVector, len(v)+len(other))
+	for replica, count := range v {
+		merged[replica] = count
+	}
+	for replica, count := range other {
+		if count > merged[replica] {
+			merged[replica] = count
+		}
+	}
+	return merged
+}
+
+// SetReplica names this copy of the Collection and starts recording a
+// VersionVector for each Document, so copies that are changed independently
+// (for example on two machines that sync files through a shared folder) can be
+// combined later with Merge. Each copy must have a different replica name; if
+// you copy a Datastore file, call SetReplica with a new name on the copy
+// before changing it.
+//
+// Documents that are already in the Collection are given a version from this
+// replica. The replica name and versions are written to disk.
+//
+// Copies that insert Documents independently should use an IDGenerator such
+// as RandomIDs, otherwise both copies will use the same keys and the new
+// Documents will be reported as conflicts.
+func (c *Collection) SetReplica(replica string) error {
+	if err := c.checkOpen(); err != nil {
+		return err
+	}
+	if replica == "" {
+		return ErrNoReplica
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.thaw()
+
+	c.Replica = replica
+	if c.Clocks == nil {
+		c.Clocks = map[uint64]VersionVector{}
+	}
+	for _, key := range c.index.Keys() {
+		if _, ok := c.Clocks[key]; !ok {
+			c.tick(key)
+		}
+	}
+	c.markDirty(1)
+	return nil
+}
+
+// Version returns a copy of the VersionVector for the Document with the
+// specified key, or nil if the Collection has no replica name or the key has
+// never been used. Deleted Documents keep their version so the deletion can be
+// merged.
+func (c *Collection) Version(key uint64) VersionVector {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	if c.Clocks[key] == nil {
+		return nil
+	}
+	return c.Clocks[key].merge(nil)
+}
+
+// tick records a change to the Document with the specified key by this
+// replica. It must be called while the Collection is locked.
+func (c *Collection) tick(key uint64) {
+	if c.Replica == "" {
+		return
+	}
+
+	// VersionVectors are shared with snapshots, so they are replaced rather
+	// than modified
+	version := c.Clocks[key].merge(nil)
+	version[c.Replica]++
+	c.Clocks[key] = version
+}
+
+// Conflict describes a Document that was changed in both copies of a
+// Collection since they were last merged. Local or Remote is nil if the
+// Document was deleted in that copy.
+type Conflict struct {
+	Key           uint64
+	Local         Document
+	LocalVersion  VersionVector
+	Remote        Document
+	RemoteVersion VersionVector
+}
+
+// MergeStats describes the changes made by Merge.
+type MergeStats struct {
+	// Updated is the number of Documents inserted or replaced by newer
+	// versions from the remote copy.
+	Updated int
+
+	// Deleted is the number of Documents deleted because they were deleted in
+	// the remote copy.
+	Deleted int
+
+	// Conflicts is the number of Documents passed to resolve.
+	Conflicts int
+}
+
+// Merge brings changes from remote, another copy of this Collection (usually
+// opened from another Datastore file), into this Collection. Both Collections
+// must have a replica name. For each Document:
+//
+//   - if the remote version is newer, it replaces the local Document, or
+//     deletes it if it was deleted remotely
+//   - if the local version is newer or the same, nothing is changed
+//   - if both copies were changed, resolve is called with the Conflict and
+//     returns the Document to keep, or nil to delete it. If resolve is nil the
+//     local Document is kept.
+//
+// Resolved Documents get a version that is newer than both copies, so the
+// resolution wins when the copies are merged the other way. Documents taken
+// from remote are copied, so remote is not changed and can be discarded.
+//
+// resolve is called while this Collection is locked, so it must not call
+// methods on this Collection. If Merge fails part way through, the Documents
+// merged before the failure are kept.
+func (c *Collection) Merge(remote *Collection, resolve func(Conflict) Document) (MergeStats, error) {
+	stats := MergeStats{}
+	if remote == c {
+		return stats, nil
+	}
+
+	type incoming struct {
+		document Document
+		version  VersionVector
+	}
+	changes := map[uint64]incoming{}
+	keys := []uint64{}
+	remote.mutex.RLock()
+	remoteReplica, remoteType := remote.Replica, remote.Type
+	for key, version := range remote.Clocks {
+		document, _ := remote.item(key)
+		if document != nil {
+			copied, err := copyDocument(document)
+			if err != nil {
+				remote.mutex.RUnlock()
+				return stats, wrapError(err, string(OpMerge), remote, key)
+			}
+			document = copied
+		}
+		changes[key] = incoming{document: document, version: version}
+		keys = append(keys, key)
+	}
+	remote.mutex.RUnlock()
+	if remoteReplica == "" {
+		return stats, wrapError(ErrNoReplica, string(OpMerge), remote, 0)
+	}
+	sort.Sort(UIntSlice(keys))
+
+	err := c.mutate(Operation{Op: OpMerge}, func() error {
+		if c.Replica == "" {
+			return ErrNoReplica
+		}
+		if c.Type == "" {
+			c.Type = remoteType
+		} else if remoteType != "" && remoteType != c.Type {
+			return ErrInvalidType
+		}
+
+		for _, key := range keys {
+			change := changes[key]
+			local, _ := c.item(key)
+
+			var keep Document
+			var version VersionVector
+			switch c.Clocks[key].Compare(change.version) {
+			case Before:
+				keep, version = change.document, change.version
+			case Concurrent:
+				stats.Conflicts++
+				keep = local
+				if resolve != nil {
+					keep = resolve(Conflict{
+						Key:           key,
+						Local:         local,
+						LocalVersion:  c.Clocks[key].merge(nil),
+						Remote:        change.document,
+						RemoteVersion: change.version.merge(nil),
+					})
+				}
+				// The resolution is a new change by this replica, so it is
+				// newer than both copies
+				version = c.Clocks[key].merge(change.version)
+				version[c.Replica]++
+			default:
+				continue
+			}
+
+			if keep != local {
+				if err := c.apply(key, keep); err != nil {
+					return err
+				}
+				if keep == nil {
+					stats.Deleted++
+				} else {
+					stats.Updated++
+				}
+			}
+			c.Clocks[key] = version
+		}
+		return nil
+	})
+	return stats, err
+}
+
+// apply stores the Document under key, or deletes key if the Document is nil.
+// It must be called while the Collection is locked.
+func (c *Collection) apply(key uint64, document Document) error {
+	if document == nil {
+		c.deleteKey(key)
+		return nil
+	}
+	if reflect.TypeOf(document).String() != c.Type {
+		return ErrInvalidType
+	}
+	document.SetID(key)
+	_, err := c.upsert(OpMerge, document)
+	return err
+}
@@ -0,0 +1,147 @@
+package datastore_test
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"git.stormbase.io/cbednarski/datastore"
+)
+
+func TestVersionVector_Compare(t *testing.T) {
+	cases := []struct {
+		a, b     datastore.VersionVector
+		expected datastore.Ordering
+	}{
+		{nil, nil, datastore.Equal},
+		{datastore.VersionVector{"a": 1}, datastore.VersionVector{"a": 1}, datastore.Equal},
+		{datastore.VersionVector{"a": 1}, datastore.VersionVector{"a": 2}, datastore.Before},
+		{nil, datastore.VersionVector{"a": 1}, datastore.Before},
+		{datastore.VersionVector{"a": 2, "b": 1}, datastore.VersionVector{"a": 2}, datastore.After},
+		{datastore.VersionVector{"a": 2}, datastore.VersionVector{"a": 1, "b": 1}, datastore.Concurrent},
+	}
+	for _, c := range cases {
+		if found := c.a.Compare(c.b); found != c.expected {
+			t.Errorf("Expected %v compared to %v to be %d, found %d", c.a, c.b, c.expected, found)
+		}
+	}
+}
+
+func TestCollection_Merge(t *testing.T) {
+	tempdir, err := ioutil.TempDir("", "datastore")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempdir)
+	laptop := filepath.Join(tempdir, "laptop"+datastore.Extension)
+	desktop := filepath.Join(tempdir, "desktop"+datastore.Extension)
+
+	a, err := datastore.Create(laptop, TestdataSignature)
+	if err != nil {
+		t.Fatal(err)
+	}
+	notesA := a.In("notes")
+	if err := notesA.Upsert(&NameDocument{Name: "one"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := notesA.SetReplica("laptop"); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"two", "three"} {
+		if err := notesA.Upsert(&NameDocument{Name: name}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := a.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	// The desktop starts as a copy of the laptop's file
+	data, err := ioutil.ReadFile(laptop)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(desktop, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	b, err := datastore.Open(desktop, TestdataSignature)
+	if err != nil {
+		t.Fatal(err)
+	}
+	notesB := b.In("notes")
+	if version := notesB.Version(1); version.Compare(datastore.VersionVector{"laptop": 1}) != datastore.Equal {
+		t.Errorf("Expected version to be written to disk, found %v", version)
+	}
+	if err := notesB.SetReplica("desktop"); err != nil {
+		t.Fatal(err)
+	}
+
+	// Each copy changes different documents
+	if err := notesA.Patch(1, map[string]interface{}{"Name": "one (laptop)"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := notesB.DeleteKey(3); err != nil {
+		t.Fatal(err)
+	}
+
+	stats, err := notesB.Merge(notesA, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats != (datastore.MergeStats{Updated: 1}) {
+		t.Errorf("Expected 1 update, found %+v", stats)
+	}
+	if name := notesB.FindKey(1).(*NameDocument).Name; name != "one (laptop)" {
+		t.Errorf("Expected %s, found %s", "one (laptop)", name)
+	}
+	if notesB.FindKey(1) == notesA.FindKey(1) {
+		t.Error("Expected merged document to be a copy")
+	}
+
+	stats, err = notesA.Merge(notesB, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats != (datastore.MergeStats{Deleted: 1}) {
+		t.Errorf("Expected 1 deletion, found %+v", stats)
+	}
+	if notesA.FindKey(3) != nil {
+		t.Error("Expected deletion to be merged")
+	}
+
+	// Both copies change the same document
+	if err := notesA.Patch(2, map[string]interface{}{"Name": "two (laptop)"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := notesB.Patch(2, map[string]interface{}{"Name": "two (desktop)"}); err != nil {
+		t.Fatal(err)
+	}
+	conflicts := []datastore.Conflict{}
+	stats, err = notesA.Merge(notesB, func(conflict datastore.Conflict) datastore.Document {
+		conflicts = append(conflicts, conflict)
+		return conflict.Remote
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Conflicts != 1 || len(conflicts) != 1 || conflicts[0].Key != 2 {
+		t.Fatalf("Expected a conflict for key 2, found %+v", conflicts)
+	}
+	if name := notesA.FindKey(2).(*NameDocument).Name; name != "two (desktop)" {
+		t.Errorf("Expected %s, found %s", "two (desktop)", name)
+	}
+
+	// The resolution wins when merged back
+	if _, err := notesB.Merge(notesA, nil); err != nil {
+		t.Fatal(err)
+	}
+	if order := notesA.Version(2).Compare(notesB.Version(2)); order != datastore.Equal {
+		t.Errorf("Expected versions to converge, found %d", order)
+	}
+
+	if _, err := notesA.Merge(a.In("unversioned"), nil); !errors.Is(err, datastore.ErrNoReplica) {
+		t.Errorf("Expected %s, found %v", datastore.ErrNoReplica, err)
+	}
+}
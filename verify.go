@@ -0,0 +1,176 @@
+package datastore
+
+import (
+	"bytes"
+	"encoding"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+)
+
+// Verify checks that every Document in the Datastore can be written to disk and
+// read back unchanged, without writing anything. It returns an *Error for each
+// Document that fails, joined with errors.Join, or nil if they all pass.
+//
+// Documents may contain maps, slices, arrays, pointers, nested structs, and
+// interface fields, with these rules (which come from Gob):
+//
+//   - Each Document type, and each concrete type stored in an interface field,
+//     must be registered with gob.Register. A Document that breaks this rule
+//     fails with ErrCodec. See RequiredRegistrations and RegisterTypes.
+//   - Only exported fields are stored. A Document with a non-zero unexported
+//     field fails with ErrRoundTrip.
+//   - Nil and empty maps and slices are not told apart, and a nil pointer is
+//     read back as a pointer to a zero value (or the reverse), so these are not
+//     treated as changes.
+//   - Channels and functions can not be stored, and maps and slices may not
+//     hold nil pointers. Documents that break these rules fail with ErrCodec.
+//
+// Verify encodes and decodes every Document, so it is slow on a large
+// Datastore. It is meant for tests and for checking a new Document type.
+func (d *Datastore) Verify() error {
+	if err := d.checkOpen(); err != nil {
+		return err
+	}
+
+	collections := d.collections()
+	sort.Slice(collections, func(i, j int) bool {
+		return collections[i].name < collections[j].name
+	})
+
+	errs := []error{}
+	for _, c := range collections {
+		errs = append(errs, c.verify()...)
+	}
+	return errors.Join(errs...)
+}
+
+func (c *Collection) verify() []error {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	errs := []error{}
+	for _, key := range c.index.Keys() {
+		document, _ := c.item(key)
+		if err := verifyDocument(document); err != nil {
+			errs = append(errs, wrapError(err, "verify", c, key))
+		}
+	}
+	return errs
+}
+
+// verifyDocument encodes the Document the way Flush does, as an interface, and
+// compares what is decoded with the original.
+func verifyDocument(document Document) error {
+	buffer := &bytes.Buffer{}
+	if err := gob.NewEncoder(buffer).Encode(&document); err != nil {
+		return codecError("encode", err)
+	}
+	var decoded Document
+	if err := gob.NewDecoder(buffer).Decode(&decoded); err != nil {
+		return codecError("decode", err)
+	}
+
+	if path, equal := roundTripEqual(reflect.ValueOf(document), reflect.ValueOf(decoded), ""); !equal {
+		if path == "" {
+			path = "document"
+		}
+		return &Error{Kind: ErrCodec, Err: fmt.Errorf("%w: %s", ErrRoundTrip, path)}
+	}
+	return nil
+}
+
+// roundTripEqual compares a value with the result of encoding and decoding it
+// with Gob, ignoring the differences Gob is documented to introduce. If they
+// are not equal it returns the path to the first difference, such as
+// ".Tags[2]".
+func roundTripEqual(a, b reflect.Value, path string) (string, bool) {
+	if !a.IsValid() || !b.IsValid() {
+		return path, (!a.IsValid() || a.IsZero()) && (!b.IsValid() || b.IsZero())
+	}
+	if a.Type() != b.Type() {
+		return path, false
+	}
+
+	if a.CanInterface() && b.CanInterface() {
+		if encoded, ok := marshalled(a); ok {
+			other, _ := marshalled(b)
+			return path, bytes.Equal(encoded, other)
+		}
+	}
+
+	switch a.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		return roundTripEqual(a.Elem(), b.Elem(), path)
+	case reflect.Struct:
+		for i := 0; i < a.NumField(); i++ {
+			field := a.Type().Field(i)
+			fieldPath := path + "." + field.Name
+			if !field.IsExported() {
+				if !a.Field(i).IsZero() {
+					return fieldPath, false
+				}
+				continue
+			}
+			if p, equal := roundTripEqual(a.Field(i), b.Field(i), fieldPath); !equal {
+				return p, false
+			}
+		}
+		return path, true
+	case reflect.Slice, reflect.Array:
+		if a.Len() != b.Len() {
+			return path, false
+		}
+		for i := 0; i < a.Len(); i++ {
+			if p, equal := roundTripEqual(a.Index(i), b.Index(i), fmt.Sprintf("%s[%d]", path, i)); !equal {
+				return p, false
+			}
+		}
+		return path, true
+	case reflect.Map:
+		if a.Len() != b.Len() {
+			return path, false
+		}
+		iter := a.MapRange()
+		for iter.Next() {
+			other := b.MapIndex(iter.Key())
+			if !other.IsValid() {
+				return fmt.Sprintf("%s[%v]", path, iter.Key()), false
+			}
+			if p, equal := roundTripEqual(iter.Value(), other, fmt.Sprintf("%s[%v]", path, iter.Key())); !equal {
+				return p, false
+			}
+		}
+		return path, true
+	case reflect.Bool:
+		return path, a.Bool() == b.Bool()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return path, a.Int() == b.Int()
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return path, a.Uint() == b.Uint()
+	case reflect.Float32, reflect.Float64:
+		return path, a.Float() == b.Float() || (a.Float() != a.Float() && b.Float() != b.Float())
+	case reflect.Complex64, reflect.Complex128:
+		return path, a.Complex() == b.Complex()
+	case reflect.String:
+		return path, a.String() == b.String()
+	}
+	// Channels and functions can't be encoded, so they never get this far
+	return path, false
+}
+
+// marshalled returns the encoding of a value that encodes itself, such as a
+// time.Time, since its fields are not what Gob stores.
+func marshalled(v reflect.Value) ([]byte, bool) {
+	switch marshaler := v.Interface().(type) {
+	case gob.GobEncoder:
+		encoded, _ := marshaler.GobEncode()
+		return encoded, true
+	case encoding.BinaryMarshaler:
+		encoded, _ := marshaler.MarshalBinary()
+		return encoded, true
+	}
+	return nil, false
+}
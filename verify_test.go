@@ -0,0 +1,97 @@
+package datastore_test
+
+import (
+	"encoding/gob"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"git.stormbase.io/cbednarski/datastore"
+)
+
+type Shape interface {
+	Area() float64
+}
+
+type Square struct {
+	Side float64
+}
+
+func (s Square) Area() float64 { return s.Side * s.Side }
+
+type Circle struct {
+	Radius float64
+}
+
+func (c Circle) Area() float64 { return 3 * c.Radius * c.Radius }
+
+type RichDocument struct {
+	Identifier uint64
+	Labels     map[string]int
+	Tags       []string
+	Nested     struct{ When time.Time }
+	Pointer    *AccountProfile
+	Shape      Shape
+	Shapes     []Shape
+	Empty      []int
+	hidden     string
+}
+
+func (r *RichDocument) ID() uint64 {
+	return r.Identifier
+}
+
+func (r *RichDocument) SetID(id uint64) {
+	r.Identifier = id
+}
+
+func init() {
+	gob.Register(&RichDocument{})
+	gob.Register(Square{})
+	// Circle is not registered, so Verify reports it
+}
+
+func TestVerify(t *testing.T) {
+	ds := datastore.New()
+	rich := ds.In("rich")
+
+	valid := &RichDocument{
+		Labels:  map[string]int{"a": 1, "zero": 0},
+		Tags:    []string{"x", ""},
+		Pointer: &AccountProfile{Bio: "hello"},
+		Shape:   Square{Side: 2},
+		Shapes:  []Shape{Square{Side: 1}, Square{}},
+		Empty:   []int{},
+	}
+	valid.Nested.When = time.Now()
+	if err := rich.Upsert(valid); err != nil {
+		t.Fatal(err)
+	}
+	if err := ds.Verify(); err != nil {
+		t.Fatal(err)
+	}
+
+	unregistered := &RichDocument{Shape: Circle{Radius: 1}}
+	hidden := &RichDocument{hidden: "lost"}
+	if err := rich.Upsert(unregistered); err != nil {
+		t.Fatal(err)
+	}
+	if err := rich.Upsert(hidden); err != nil {
+		t.Fatal(err)
+	}
+
+	err := ds.Verify()
+	if !errors.Is(err, datastore.ErrCodec) {
+		t.Fatalf("Expected %s, found %v", datastore.ErrCodec, err)
+	}
+	if !errors.Is(err, datastore.ErrRoundTrip) {
+		t.Errorf("Expected %s, found %v", datastore.ErrRoundTrip, err)
+	}
+	if !strings.Contains(err.Error(), "not registered") {
+		t.Errorf("Expected unregistered type to be reported, found %v", err)
+	}
+	if !strings.Contains(err.Error(), ".hidden") {
+		t.Errorf("Expected hidden field to be reported, found %v", err)
+	}
+}
@@ -0,0 +1,146 @@
+package datastore
+
+import "sync"
+
+// View is a read-only, in-memory collection of Documents derived from a source
+// Collection. Each Document in the source Collection is passed through the
+// View's transform function and the result is stored in the View under the
+// same key. The View is updated automatically whenever a Document is upserted
+// into or deleted from the source Collection, so it never drifts.
+//
+// Views are not written to disk. Create them again after calling Open.
+type View struct {
+	name      string
+	transform func(Document) Document
+
+	items map[uint64]Document
+	list  []uint64
+	mutex sync.RWMutex
+}
+
+// CreateView derives a new View called name from the source Collection. The
+// transform is called once for each Document already in the source Collection,
+// and again each time a Document is upserted. The transform may return the
+// Document it is given, a new Document (for example a summary type), or nil to
+// exclude the Document from the View.
+//
+// The transform is called while the source Collection is locked, so it must
+// not call methods on the source Collection.
+func (d *Datastore) CreateView(name string, source *Collection, transform func(Document) Document) (*View, error) {
+	if err := d.checkOpen(); err != nil {
+		return nil, err
+	}
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	if d.views == nil {
+		d.views = map[string]*View{}
+	}
+	if _, ok := d.views[name]; ok {
+		return nil, ErrViewExists
+	}
+
+	v := &View{
+		name:      name,
+		transform: transform,
+		items:     map[uint64]Document{},
+	}
+
+	// Hold the write lock while we populate the view so we don't miss any
+	// changes made between the initial scan and registering the view.
+	source.mutex.Lock()
+	for _, key := range source.index.Keys() {
+		document, _ := source.item(key)
+		v.update(key, document)
+	}
+	source.views = append(source.views, v)
+	source.mutex.Unlock()
+
+	d.views[name] = v
+	return v, nil
+}
+
+// View returns the View with the specified name, or nil if there is no View
+// with that name.
+func (d *Datastore) View(name string) *View {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	return d.views[name]
+}
+
+// Name returns the name the View was created with.
+func (v *View) Name() string {
+	return v.name
+}
+
+// FindKey returns the derived Document for the specified key, or nil if the key
+// is not present in the View.
+func (v *View) FindKey(key uint64) Document {
+	v.mutex.RLock()
+	defer v.mutex.RUnlock()
+	return v.items[key]
+}
+
+// FindAll returns a list of derived Documents that satisfy the finder. The View
+// is scanned in ascending order.
+func (v *View) FindAll(finder func(Document) bool) []Document {
+	v.mutex.RLock()
+	defer v.mutex.RUnlock()
+
+	found := []Document{}
+	for _, key := range v.list {
+		if finder(v.items[key]) {
+			found = append(found, v.items[key])
+		}
+	}
+	return found
+}
+
+// FindOne returns the first derived Document that satisfies the finder, or nil
+// if there is no match. The View is scanned in ascending order.
+func (v *View) FindOne(finder func(Document) bool) Document {
+	v.mutex.RLock()
+	defer v.mutex.RUnlock()
+
+	for _, key := range v.list {
+		if finder(v.items[key]) {
+			return v.items[key]
+		}
+	}
+	return nil
+}
+
+// List returns a sorted list of keys (in ascending order) for all Documents
+// currently held in the View.
+func (v *View) List() []uint64 {
+	v.mutex.RLock()
+	defer v.mutex.RUnlock()
+
+	list := make([]uint64, len(v.list))
+	copy(list, v.list)
+	return list
+}
+
+// update is called by the source Collection (while it is locked) after a
+// Document has been inserted or updated.
+func (v *View) update(key uint64, document Document) {
+	derived := v.transform(document)
+	if derived == nil {
+		v.remove(key)
+		return
+	}
+
+	v.mutex.Lock()
+	v.items[key] = derived
+	insertKeyIntoList(&v.list, key)
+	v.mutex.Unlock()
+}
+
+// remove is called by the source Collection (while it is locked) after a
+// Document has been deleted.
+func (v *View) remove(key uint64) {
+	v.mutex.Lock()
+	delete(v.items, key)
+	deleteKeyFromList(&v.list, key)
+	v.mutex.Unlock()
+}
@@ -0,0 +1,88 @@
+package datastore_test
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"git.stormbase.io/cbednarski/datastore"
+)
+
+func TestCreateView(t *testing.T) {
+	ds := datastore.New()
+	desserts := ds.In("desserts")
+
+	for _, name := range []string{"chocolate cake", "lemon cake", "chocolate chip cookie"} {
+		if err := desserts.Upsert(&NameDocument{Name: name}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	chocolates, err := ds.CreateView("chocolates", desserts, func(d datastore.Document) datastore.Document {
+		if dessert, ok := d.(*NameDocument); ok && strings.Contains(dessert.Name, "chocolate") {
+			return &NumberDocument{Number: len(dessert.Name)}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if ds.View("chocolates") != chocolates {
+		t.Errorf("Expected View to return the view by name")
+	}
+
+	if _, err := ds.CreateView("chocolates", desserts, nil); !errors.Is(err, datastore.ErrViewExists) {
+		t.Errorf("Expected %s, found %s", datastore.ErrViewExists, err)
+	}
+
+	expected := []uint64{1, 3}
+	if !reflect.DeepEqual(chocolates.List(), expected) {
+		t.Errorf("Expected %#v, found %#v", expected, chocolates.List())
+	}
+
+	// Adding a new matching document updates the view
+	fudge := &NameDocument{Name: "chocolate fudge"}
+	if err := desserts.Upsert(fudge); err != nil {
+		t.Fatal(err)
+	}
+
+	length, ok := chocolates.FindKey(fudge.ID()).(*NumberDocument)
+	if !ok {
+		t.Fatal("Expected *NumberDocument type")
+	}
+	if length.Number != len(fudge.Name) {
+		t.Errorf("Expected %d, found %d", len(fudge.Name), length.Number)
+	}
+
+	// Updating a document so it no longer matches removes it from the view
+	lemon := desserts.FindKey(2).(*NameDocument)
+	lemon.Name = "lemon chocolate cake"
+	if err := desserts.Upsert(lemon); err != nil {
+		t.Fatal(err)
+	}
+	fudge.Name = "vanilla fudge"
+	if err := desserts.Upsert(fudge); err != nil {
+		t.Fatal(err)
+	}
+
+	// Deleting a document removes it from the view
+	desserts.DeleteKey(1)
+
+	expected = []uint64{2, 3}
+	if !reflect.DeepEqual(chocolates.List(), expected) {
+		t.Errorf("Expected %#v, found %#v", expected, chocolates.List())
+	}
+
+	long := chocolates.FindAll(func(d datastore.Document) bool {
+		return d.(*NumberDocument).Number > 19
+	})
+	if len(long) != 2 {
+		t.Errorf("Expected 2 results, found %d", len(long))
+	}
+
+	if chocolates.FindOne(func(d datastore.Document) bool { return false }) != nil {
+		t.Errorf("Expected nil")
+	}
+}
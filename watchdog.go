@@ -0,0 +1,89 @@
+package datastore
+
+import "time"
+
+// watchdog checks periodically for changes that have not been flushed. See
+// SetWatchdog.
+type watchdog struct {
+	limit time.Duration
+	alarm func(age time.Duration)
+	timer *time.Timer
+
+	// alarmed is the dirtySince value the alarm was last called for, so it is
+	// called once each time the Datastore becomes stale
+	alarmed int64
+}
+
+// SetWatchdog calls alarm when a change has not been flushed for longer than
+// limit. It is meant to catch applications that never schedule a Flush (or
+// whose Flushes keep failing) before the changes are lost, so alarm usually
+// logs, increments a metric, or pages someone. It is called at most once for
+// each period the Datastore spends dirty, from its own goroutine.
+//
+// The Datastore is checked every quarter of limit, so alarm may be called up to
+// limit/4 late. Pass a limit of 0 to stop the watchdog; it also stops when the
+// Datastore is closed. SetWatchdog returns ErrNotPersistent for an in-memory
+// Datastore, because it can never be flushed.
+func (d *Datastore) SetWatchdog(limit time.Duration, alarm func(age time.Duration)) error {
+	if d.path == "" {
+		return ErrNotPersistent
+	}
+
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	if d.closed.Load() {
+		return ErrClosed
+	}
+
+	d.stopWatchdog()
+	if limit <= 0 || alarm == nil {
+		return nil
+	}
+
+	w := &watchdog{limit: limit, alarm: alarm}
+	w.timer = time.AfterFunc(w.interval(), func() { d.checkWatchdog(w) })
+	d.watchdog = w
+	return nil
+}
+
+// interval is how often the watchdog checks the Datastore.
+func (w *watchdog) interval() time.Duration {
+	if interval := w.limit / 4; interval > time.Millisecond {
+		return interval
+	}
+	return time.Millisecond
+}
+
+// checkWatchdog calls the alarm if the oldest pending change is older than the
+// limit, and schedules the next check. It does nothing if w has been replaced.
+func (d *Datastore) checkWatchdog(w *watchdog) {
+	d.mutex.Lock()
+	if d.watchdog != w {
+		d.mutex.Unlock()
+		return
+	}
+
+	// A Datastore being closed is flushing, so it is not stale
+	since := d.dirtySince.Load()
+	age := d.now().Sub(time.Unix(0, since))
+	stale := since != 0 && since != w.alarmed && age > w.limit && !d.closed.Load()
+	if stale {
+		w.alarmed = since
+	}
+	w.timer = time.AfterFunc(w.interval(), func() { d.checkWatchdog(w) })
+	d.mutex.Unlock()
+
+	// Call the alarm without holding mutex so it can use the Datastore
+	if stale {
+		w.alarm(age)
+	}
+}
+
+// stopWatchdog stops the watchdog, if there is one. It must be called while
+// mutex is held.
+func (d *Datastore) stopWatchdog() {
+	if d.watchdog != nil {
+		d.watchdog.timer.Stop()
+		d.watchdog = nil
+	}
+}
@@ -0,0 +1,89 @@
+package datastore_test
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"git.stormbase.io/cbednarski/datastore"
+)
+
+func TestWatchdog(t *testing.T) {
+	tempdir, err := ioutil.TempDir("", "datastore")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempdir)
+
+	ds, err := datastore.Create(filepath.Join(tempdir, "watchdog"+datastore.Extension), TestdataSignature)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := datastore.New().SetWatchdog(time.Minute, func(time.Duration) {}); !errors.Is(err, datastore.ErrNotPersistent) {
+		t.Errorf("Expected %s, found %v", datastore.ErrNotPersistent, err)
+	}
+
+	var now atomic.Int64
+	now.Store(time.Now().UnixNano())
+	ds.SetClock(func() time.Time { return time.Unix(0, now.Load()) })
+
+	alarms := make(chan time.Duration, 10)
+	// The clock is advanced by a minute, so any limit shorter than that works
+	if err := ds.SetWatchdog(4*time.Millisecond, func(age time.Duration) { alarms <- age }); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ds.In("names").Upsert(&NameDocument{Name: "forgotten"}); err != nil {
+		t.Fatal(err)
+	}
+	now.Add(int64(time.Minute))
+	select {
+	case age := <-alarms:
+		if age != time.Minute {
+			t.Errorf("Expected %s, found %s", time.Minute, age)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected watchdog to call the alarm")
+	}
+	if age := ds.Health().UnflushedAge; age != time.Minute {
+		t.Errorf("Expected %s, found %s", time.Minute, age)
+	}
+
+	// The alarm is only called once until the Datastore is flushed
+	time.Sleep(20 * time.Millisecond)
+	if len(alarms) != 0 {
+		t.Errorf("Expected one alarm, found %d more", len(alarms))
+	}
+
+	if err := ds.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if age := ds.Health().UnflushedAge; age != 0 {
+		t.Errorf("Expected 0, found %s", age)
+	}
+	time.Sleep(20 * time.Millisecond)
+	if len(alarms) != 0 {
+		t.Errorf("Expected no alarm after flush, found %d", len(alarms))
+	}
+
+	if err := ds.In("names").Upsert(&NameDocument{Name: "forgotten again"}); err != nil {
+		t.Fatal(err)
+	}
+	now.Add(int64(time.Minute))
+	select {
+	case <-alarms:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected watchdog to call the alarm again")
+	}
+
+	if err := ds.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := ds.SetWatchdog(time.Minute, func(time.Duration) {}); !errors.Is(err, datastore.ErrClosed) {
+		t.Errorf("Expected %s, found %v", datastore.ErrClosed, err)
+	}
+}
@@ -0,0 +1,34 @@
+package datastore
+
+// Wrap adapts any value to the Document interface by storing its key alongside
+// it. Use it to store types from other packages that you can not add ID and
+// SetID methods to:
+//
+//	gob.Register(&datastore.Wrap[url.URL]{})
+//
+//	links := ds.In("links")
+//	link := datastore.NewWrap(url.URL{Scheme: "https", Host: "example.com"})
+//	links.Upsert(link)
+//
+//	found := links.FindKey(link.ID()).(*datastore.Wrap[url.URL])
+//	fmt.Println(found.Value.Host)
+//
+// As with any Document, each Wrap type must be registered with gob.Register.
+type Wrap[T any] struct {
+	Key   uint64
+	Value T
+}
+
+// NewWrap returns a new Wrap holding value. It does not have a key until it is
+// upserted.
+func NewWrap[T any](value T) *Wrap[T] {
+	return &Wrap[T]{Value: value}
+}
+
+func (w *Wrap[T]) ID() uint64 {
+	return w.Key
+}
+
+func (w *Wrap[T]) SetID(id uint64) {
+	w.Key = id
+}
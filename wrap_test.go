@@ -0,0 +1,50 @@
+package datastore_test
+
+import (
+	"encoding/gob"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"git.stormbase.io/cbednarski/datastore"
+)
+
+func init() {
+	gob.Register(&datastore.Wrap[url.URL]{})
+}
+
+func TestWrap(t *testing.T) {
+	tempdir, err := ioutil.TempDir("", "datastore")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempdir)
+	datapath := filepath.Join(tempdir, "wrap"+datastore.Extension)
+
+	ds, err := datastore.Create(datapath, TestdataSignature)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	link := datastore.NewWrap(url.URL{Scheme: "https", Host: "example.com"})
+	if err := ds.In("links").Upsert(link); err != nil {
+		t.Fatal(err)
+	}
+	if link.ID() != 1 {
+		t.Errorf("Expected 1, found %d", link.ID())
+	}
+	if err := ds.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	ds2, err := datastore.Open(datapath, TestdataSignature)
+	if err != nil {
+		t.Fatal(err)
+	}
+	found, ok := ds2.In("links").FindKey(1).(*datastore.Wrap[url.URL])
+	if !ok || found.Value.Host != "example.com" {
+		t.Errorf("Expected example.com, found %#v", found)
+	}
+}